@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxAdmissionReviewSize limits the size of an AdmissionReview, nodes are well below it.
+const maxAdmissionReviewSize = 3 << 20
+
+var (
+	admissionCertFile     = flag.String("admission-cert-file", "", "path to the certificate the admission webhook is served with")
+	admissionKeyFile      = flag.String("admission-key-file", "", "path to the key of the certificate of the admission webhook")
+	admissionAllowedUsers = flag.StringSlice("admission-allowed-users", []string{"system:serviceaccount:default:nudl"}, "users that the admission webhook allows to change the labels with the label prefix, e.g. the service account of nudl")
+
+	admissionReviewCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nudl_admission_reviews_total",
+			Help: "Number of node updates reviewed by the admission webhook",
+		},
+		[]string{"allowed"},
+	)
+)
+
+// admissionHandler is a validating admission webhook that rejects changes of the labels nudl manages
+// by users other than the allowed users.
+type admissionHandler struct {
+	allowed map[string]bool
+	logger  log.Logger
+}
+
+func newAdmissionHandler(users []string, logger log.Logger) *admissionHandler {
+	allowed := make(map[string]bool, len(users))
+	for _, u := range users {
+		allowed[u] = true
+	}
+	return &admissionHandler{allowed: allowed, logger: logger}
+}
+
+// ServeHTTP answers an AdmissionReview.
+func (h *admissionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAdmissionReviewSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read body: %v", err), http.StatusBadRequest)
+		return
+	}
+	var ar admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &ar); err != nil || ar.Request == nil {
+		http.Error(w, "could not decode admission review", http.StatusBadRequest)
+		return
+	}
+	ar.Response = h.review(ar.Request)
+	ar.Request = nil
+	admissionReviewCounter.With(prometheus.Labels{"allowed": fmt.Sprint(ar.Response.Allowed)}).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ar); err != nil {
+		level.Warn(h.logger).Log("msg", "could not write admission review", "err", err)
+	}
+}
+
+// review allows the request, unless a user that is not allowed changes a label with the label prefix of a node.
+// Labels that are preserved are not managed by nudl and can be changed by everyone.
+func (h *admissionHandler) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	res := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Kind.Kind != "Node" || req.Operation != admissionv1.Update || h.allowed[req.UserInfo.Username] {
+		return res
+	}
+	var old, cur metav1.PartialObjectMetadata
+	if err := json.Unmarshal(req.OldObject.Raw, &old); err != nil {
+		res.Allowed = false
+		res.Result = &metav1.Status{Code: http.StatusBadRequest, Message: fmt.Sprintf("could not decode old node: %v", err)}
+		return res
+	}
+	if err := json.Unmarshal(req.Object.Raw, &cur); err != nil {
+		res.Allowed = false
+		res.Result = &metav1.Status{Code: http.StatusBadRequest, Message: fmt.Sprintf("could not decode node: %v", err)}
+		return res
+	}
+	changed := changedLabels(filter(old.Labels), filter(cur.Labels))
+	if len(changed) == 0 {
+		return res
+	}
+	level.Info(h.logger).Log("msg", "rejected change of labels managed by nudl", "node", req.Name, "user", req.UserInfo.Username, "labels", strings.Join(changed, ","))
+	res.Allowed = false
+	res.Result = &metav1.Status{
+		Code:    http.StatusForbidden,
+		Reason:  metav1.StatusReasonForbidden,
+		Message: fmt.Sprintf("labels %s are managed by nudl and can not be changed by %s", strings.Join(changed, ", "), req.UserInfo.Username),
+	}
+	return res
+}
+
+// changedLabels returns the sorted keys of the labels that were added, removed or changed.
+func changedLabels(old, cur labels) []string {
+	var changed []string
+	for k, v := range cur {
+		if ov, ok := old[k]; !ok || ov != v {
+			changed = append(changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// runAdmission serves the admission webhook at /validate with TLS and the metrics at /metrics.
+func runAdmission(logger log.Logger) error {
+	if *admissionCertFile == "" || *admissionKeyFile == "" {
+		return fmt.Errorf("the admission webhook requires admission-cert-file and admission-key-file")
+	}
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		admissionReviewCounter,
+		panicCounter,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m := http.NewServeMux()
+	m.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
+	m.Handle("/validate", newAdmissionHandler(*admissionAllowedUsers, logger))
+	srv := &http.Server{Addr: *addr, Handler: m}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		l, err := listen(ctx, *addr, logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("could not start admission webhook server: %w", err)
+		}
+		level.Info(logger).Log("msg", "starting admission webhook", "address", *addr)
+		if err := srv.ServeTLS(l, *admissionCertFile, *admissionKeyFile); err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("admission webhook server failed: %w", err)
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		level.Info(logger).Log("msg", "shutting down admission webhook")
+		sctx, scancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer scancel()
+		return srv.Shutdown(sctx)
+	})
+	return g.Wait()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestAdmissionHandler(t *testing.T) {
+	raw := func(l map[string]string) runtime.RawExtension {
+		data, err := json.Marshal(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: l}})
+		require.NoError(t, err)
+		return runtime.RawExtension{Raw: data}
+	}
+	h := newAdmissionHandler([]string{"system:serviceaccount:default:nudl"}, log.NewNopLogger())
+	for _, tc := range []struct {
+		name    string
+		user    string
+		old     map[string]string
+		cur     map[string]string
+		allowed bool
+	}{
+		{
+			name:    "nudl",
+			user:    "system:serviceaccount:default:nudl",
+			old:     nil,
+			cur:     map[string]string{"nudl.squat.ai/Arduino": "true"},
+			allowed: true,
+		},
+		{
+			name:    "other labels",
+			user:    "admin",
+			old:     map[string]string{"nudl.squat.ai/Arduino": "true"},
+			cur:     map[string]string{"nudl.squat.ai/Arduino": "true", "zone": "a"},
+			allowed: true,
+		},
+		{
+			name:    "changed",
+			user:    "admin",
+			old:     map[string]string{"nudl.squat.ai/Arduino": "true"},
+			cur:     map[string]string{"nudl.squat.ai/Arduino": "false"},
+			allowed: false,
+		},
+		{
+			name:    "removed",
+			user:    "admin",
+			old:     map[string]string{"nudl.squat.ai/Arduino": "true"},
+			cur:     nil,
+			allowed: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ar := admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "uid",
+					Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Node"},
+					Name:      "node",
+					Operation: admissionv1.Update,
+					UserInfo:  authenticationv1.UserInfo{Username: tc.user},
+					OldObject: raw(tc.old),
+					Object:    raw(tc.cur),
+				},
+			}
+			body, err := json.Marshal(ar)
+			require.NoError(t, err)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+			require.Equal(t, http.StatusOK, rec.Code)
+			var res admissionv1.AdmissionReview
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			require.NotNil(t, res.Response)
+			assert.Equal(t, ar.Request.UID, res.Response.UID)
+			assert.Equal(t, tc.allowed, res.Response.Allowed)
+			if !tc.allowed {
+				assert.Contains(t, res.Response.Result.Message, "nudl.squat.ai/Arduino")
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// akriDiscoveryHandler is the name of the discovery handler in the Configurations that are created by nudl.
+const akriDiscoveryHandler = "nudl"
+
+var (
+	akriConfiguration = flag.String("akri-configuration", "", "name of the Akri Configuration to create Instances for the discovered devices for. It is created if it does not exist. Akri is disabled if empty.")
+	akriNamespace     = flag.String("akri-namespace", "default", "namespace of the Akri Configuration and Instances")
+	akriCapacity      = flag.Int("akri-capacity", 1, "number of slots of an Akri Instance, i.e. the number of pods that can use a device")
+
+	akriConfigurationResource = schema.GroupVersionResource{Group: "akri.sh", Version: "v0", Resource: "configurations"}
+	akriInstanceResource      = schema.GroupVersionResource{Group: "akri.sh", Version: "v0", Resource: "instances"}
+)
+
+// akriPublisher creates an Akri Instance for every device on the node
+// and deletes the Instances of devices that were detached.
+type akriPublisher struct {
+	client dynamic.Interface
+	logger log.Logger
+	// configured is true if the Configuration exists.
+	configured bool
+}
+
+func newAkriPublisher(config *rest.Config, logger log.Logger) (*akriPublisher, error) {
+	if *akriCapacity < 1 {
+		return nil, fmt.Errorf("Akri capacity must be at least 1, got %d", *akriCapacity)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	return &akriPublisher{client: client, logger: logger}, nil
+}
+
+func (p *akriPublisher) Name() string {
+	return "akri"
+}
+
+func (p *akriPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	if err := p.ensureConfiguration(ctx); err != nil {
+		return err
+	}
+	instances := akriInstances(inv.Devices)
+	wanted := make(map[string]struct{}, len(instances))
+	for _, i := range instances {
+		wanted[i.GetName()] = struct{}{}
+		if _, err := p.client.Resource(akriInstanceResource).Namespace(*akriNamespace).Apply(ctx, i.GetName(), i, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+			return fmt.Errorf("could not apply Akri Instance %q: %w", i.GetName(), err)
+		}
+	}
+	return p.deleteInstances(ctx, wanted)
+}
+
+// ensureConfiguration creates the Configuration if it does not exist.
+// An existing Configuration is not modified.
+func (p *akriPublisher) ensureConfiguration(ctx context.Context) error {
+	if p.configured {
+		return nil
+	}
+	c := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": akriConfigurationResource.GroupVersion().String(),
+		"kind":       "Configuration",
+		"metadata": map[string]interface{}{
+			"name":      *akriConfiguration,
+			"namespace": *akriNamespace,
+		},
+		"spec": map[string]interface{}{
+			"discoveryHandler": map[string]interface{}{
+				"name":             akriDiscoveryHandler,
+				"discoveryDetails": "",
+			},
+			"capacity": int64(*akriCapacity),
+		},
+	}}
+	_, err := p.client.Resource(akriConfigurationResource).Namespace(*akriNamespace).Create(ctx, c, metav1.CreateOptions{FieldManager: fieldManager})
+	switch {
+	case err == nil:
+		level.Info(p.logger).Log("msg", "created Akri Configuration", "name", *akriConfiguration)
+	case apierrors.IsAlreadyExists(err):
+	default:
+		return fmt.Errorf("could not create Akri Configuration: %w", err)
+	}
+	p.configured = true
+	return nil
+}
+
+// deleteInstances deletes the Instances of the node that are not wanted.
+func (p *akriPublisher) deleteInstances(ctx context.Context, wanted map[string]struct{}) error {
+	l, err := p.client.Resource(akriInstanceResource).Namespace(*akriNamespace).List(ctx, metav1.ListOptions{LabelSelector: akriSelector()})
+	if err != nil {
+		return fmt.Errorf("could not list Akri Instances: %w", err)
+	}
+	for _, i := range l.Items {
+		if _, ok := wanted[i.GetName()]; ok {
+			continue
+		}
+		if err := p.client.Resource(akriInstanceResource).Namespace(*akriNamespace).Delete(ctx, i.GetName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("could not delete Akri Instance %q: %w", i.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func (p *akriPublisher) PublishEvents(_ context.Context, _ []event) error {
+	return nil
+}
+
+// Close deletes all Instances of the node, like the labels are removed on shutdown.
+// In once mode or without cleanup-on-exit, the Instances are kept like the labels.
+func (p *akriPublisher) Close() error {
+	if keepOnExit() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *publishTimeout)
+	defer cancel()
+	return p.deleteInstances(ctx, nil)
+}
+
+// akriSelector selects the Instances of the node.
+func akriSelector() string {
+	return fmt.Sprintf("%s=%s,%s=%s", akriConfigurationLabel(), *akriConfiguration, akriNodeLabel(), *hostname)
+}
+
+func akriConfigurationLabel() string {
+	return sprintLabelKey("akri-configuration")
+}
+
+func akriNodeLabel() string {
+	return sprintLabelKey("node")
+}
+
+// akriInstances returns an unshared Instance for every device that is not filtered.
+// The names are derived from the node and the device id, so they are stable between scans.
+func akriInstances(ds []device) []*unstructured.Unstructured {
+	var is []*unstructured.Unstructured
+	seen := make(map[string]int, len(ds))
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		h := fnv.New32a()
+		// Identical devices are distinguished by their index.
+		fmt.Fprintf(h, "%s/%s/%d", *hostname, d.ID, seen[d.ID])
+		seen[d.ID]++
+		name := fmt.Sprintf("%s-%06x", *akriConfiguration, h.Sum32()&0xffffff)
+		usage := make(map[string]interface{}, *akriCapacity)
+		for i := 0; i < *akriCapacity; i++ {
+			usage[fmt.Sprintf("%s-%d", name, i)] = ""
+		}
+		is = append(is, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": akriInstanceResource.GroupVersion().String(),
+			"kind":       "Instance",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": *akriNamespace,
+				"labels": map[string]interface{}{
+					akriConfigurationLabel(): *akriConfiguration,
+					akriNodeLabel():          *hostname,
+				},
+			},
+			"spec": map[string]interface{}{
+				"configurationName": *akriConfiguration,
+				"shared":            false,
+				"nodes":             []interface{}{*hostname},
+				"deviceUsage":       usage,
+				"brokerProperties": map[string]interface{}{
+					"NUDL_DEVICE_ID":          d.ID,
+					"NUDL_DEVICE_KEY":         d.Key,
+					"NUDL_DEVICE_DESCRIPTION": d.Description,
+				},
+			},
+		}})
+	}
+	return is
+}
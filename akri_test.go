@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestAkriInstances(t *testing.T) {
+	*akriConfiguration = "usb"
+	*hostname = "node"
+	*noContain = []string{"hub"}
+	defer func() {
+		*akriConfiguration = ""
+		*hostname = ""
+		*noContain = []string{}
+	}()
+
+	is := akriInstances([]device{
+		{ID: "a_a", Key: "a", Description: "A"},
+		{ID: "a_a", Key: "a", Description: "A"},
+		{ID: "b_b", Key: "hub", Description: "Hub"},
+	})
+	assert.Len(t, is, 2)
+	assert.NotEqual(t, is[0].GetName(), is[1].GetName())
+	assert.Equal(t, is[0].GetName(), akriInstances([]device{{ID: "a_a"}})[0].GetName())
+	assert.Equal(t, "node", is[0].GetLabels()[akriNodeLabel()])
+	nodes, _, _ := unstructured.NestedStringSlice(is[0].Object, "spec", "nodes")
+	assert.Equal(t, []string{"node"}, nodes)
+	props, _, _ := unstructured.NestedStringMap(is[0].Object, "spec", "brokerProperties")
+	assert.Equal(t, "a_a", props["NUDL_DEVICE_ID"])
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	alertFormatAlertmanager = "alertmanager"
+	alertFormatSlack        = "slack"
+	alertName               = "USBDeviceMissing"
+)
+
+var (
+	alertURL    = flag.String("alert-url", "", "URL to send alerts to when a device in required-devices is missing, e.g. http://alertmanager:9093/api/v2/alerts or a Slack incoming webhook. Alerts are disabled if empty.")
+	alertFormat = flag.String("alert-format", alertFormatAlertmanager, fmt.Sprintf("format of the alerts, possible values are: %s, %s", alertFormatAlertmanager, alertFormatSlack))
+	alertTLS    = newTLSFlags("alert", "alert receiver")
+)
+
+// alertmanagerAlert is an alert of the Alertmanager API v2.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// alertPublisher fires an alert when a required device is missing and resolves it when the device is attached again.
+type alertPublisher struct {
+	client *http.Client
+	url    string
+	format string
+	// firing holds the start time of the alerts of the missing devices.
+	firing map[string]time.Time
+}
+
+func newAlertPublisher() (*alertPublisher, error) {
+	if *alertFormat != alertFormatAlertmanager && *alertFormat != alertFormatSlack {
+		return nil, fmt.Errorf("alert format %q unknown; possible values are: %s, %s", *alertFormat, alertFormatAlertmanager, alertFormatSlack)
+	}
+	if len(*requiredDevices) == 0 {
+		return nil, fmt.Errorf("alerts require at least one device in required-devices")
+	}
+	client := &http.Client{}
+	if alertTLS.enabled() {
+		t, err := alertTLS.transport()
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = t
+	}
+	return &alertPublisher{
+		client: client,
+		url:    *alertURL,
+		format: *alertFormat,
+		firing: make(map[string]time.Time),
+	}, nil
+}
+
+func (p *alertPublisher) Name() string {
+	return "alert"
+}
+
+func (p *alertPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	firing := make(map[string]time.Time)
+	var fired, resolved []string
+	for _, k := range missingDevices(inv.Devices) {
+		if s, ok := p.firing[k]; ok {
+			firing[k] = s
+		} else {
+			firing[k] = inv.Time
+			fired = append(fired, k)
+		}
+	}
+	for k := range p.firing {
+		if _, ok := firing[k]; !ok {
+			resolved = append(resolved, k)
+		}
+	}
+	sort.Strings(resolved)
+
+	if len(firing) == 0 && len(resolved) == 0 {
+		p.firing = firing
+		return nil
+	}
+	var err error
+	switch p.format {
+	case alertFormatAlertmanager:
+		// Firing alerts are sent again with every inventory, so they don't time out in the Alertmanager.
+		err = p.post(ctx, p.alertmanagerAlerts(inv, firing, resolved))
+	case alertFormatSlack:
+		if len(fired) == 0 && len(resolved) == 0 {
+			// Slack only gets the changes.
+			return nil
+		}
+		err = p.post(ctx, map[string]string{"text": slackText(inv.Node, fired, resolved)})
+	}
+	if err != nil {
+		return err
+	}
+	p.firing = firing
+	return nil
+}
+
+// alertmanagerAlerts returns the firing and resolved alerts.
+// Firing alerts end after three resync periods, in case nudl stops without resolving them.
+func (p *alertPublisher) alertmanagerAlerts(inv inventory, firing map[string]time.Time, resolved []string) []alertmanagerAlert {
+	as := make([]alertmanagerAlert, 0, len(firing)+len(resolved))
+	alert := func(k string, startsAt, endsAt time.Time) alertmanagerAlert {
+		return alertmanagerAlert{
+			Labels: map[string]string{
+				"alertname": alertName,
+				"node":      inv.Node,
+				"device":    k,
+			},
+			Annotations: map[string]string{
+				"summary": fmt.Sprintf("Required device %s is missing on node %s", k, inv.Node),
+			},
+			StartsAt: startsAt,
+			EndsAt:   endsAt,
+		}
+	}
+	for _, k := range *requiredDevices {
+		if s, ok := firing[k]; ok {
+			as = append(as, alert(k, s, inv.Time.Add(3**resyncPeriod)))
+		}
+	}
+	for _, k := range resolved {
+		as = append(as, alert(k, p.firing[k], inv.Time))
+	}
+	return as
+}
+
+func slackText(node string, fired, resolved []string) string {
+	var b bytes.Buffer
+	for _, k := range fired {
+		fmt.Fprintf(&b, ":rotating_light: Required device `%s` is missing on node `%s`\n", k, node)
+	}
+	for _, k := range resolved {
+		fmt.Fprintf(&b, ":white_check_mark: Required device `%s` is attached again on node `%s`\n", k, node)
+	}
+	return b.String()
+}
+
+func (p *alertPublisher) post(ctx context.Context, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("alert receiver responded with status %s", res.Status)
+	}
+	return nil
+}
+
+func (p *alertPublisher) PublishEvents(_ context.Context, _ []event) error {
+	return nil
+}
+
+func (p *alertPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertPublisherAlertmanager(t *testing.T) {
+	*requiredDevices = []string{"a", "b"}
+	defer func() { *requiredDevices = []string{} }()
+	var got []alertmanagerAlert
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		requests++
+		got = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+	p, err := newAlertPublisher()
+	require.NoError(t, err)
+	p.url = srv.URL
+
+	start := time.Now().Truncate(time.Second)
+	require.NoError(t, p.PublishInventory(context.Background(), inventory{Node: "node", Time: start, Devices: []device{{Key: "a"}}}))
+	require.Len(t, got, 1)
+	assert.Equal(t, "b", got[0].Labels["device"])
+	assert.True(t, got[0].EndsAt.After(start))
+
+	end := start.Add(time.Minute)
+	require.NoError(t, p.PublishInventory(context.Background(), inventory{Node: "node", Time: end, Devices: []device{{Key: "a"}, {Key: "b"}}}))
+	require.Len(t, got, 1)
+	assert.Equal(t, "b", got[0].Labels["device"])
+	assert.True(t, got[0].StartsAt.Equal(start))
+	assert.True(t, got[0].EndsAt.Equal(end))
+
+	// Nothing is sent without firing or resolved alerts.
+	require.NoError(t, p.PublishInventory(context.Background(), inventory{Node: "node", Time: end, Devices: []device{{Key: "a"}, {Key: "b"}}}))
+	assert.Equal(t, 2, requests)
+}
+
+func TestAlertPublisherSlack(t *testing.T) {
+	*requiredDevices = []string{"a"}
+	*alertFormat = alertFormatSlack
+	defer func() {
+		*requiredDevices = []string{}
+		*alertFormat = alertFormatAlertmanager
+	}()
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+	p, err := newAlertPublisher()
+	require.NoError(t, err)
+	p.url = srv.URL
+
+	for _, ds := range [][]device{nil, nil, {{Key: "a"}}, {{Key: "a"}}} {
+		require.NoError(t, p.PublishInventory(context.Background(), inventory{Node: "node", Time: time.Now(), Devices: ds}))
+	}
+	// Only the transitions are sent to Slack.
+	assert.Equal(t, 2, requests)
+}
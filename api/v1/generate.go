@@ -0,0 +1,10 @@
+// Package v1 contains the gRPC API of nudl generated from inventory.proto.
+//
+// The code is generated with protoc v5.28.3, which has to be installed, and the pinned plugins:
+//
+//	go generate ./api/v1
+package v1
+
+//go:generate go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.34.2
+//go:generate go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative ../../api/v1/inventory.proto
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errFieldManagerConflict is returned if another field manager owns a label or annotation that nudl applies with a different value.
+// Retrying does not resolve the conflict.
+var errFieldManagerConflict = stderrors.New("labels or annotations are owned by another field manager")
+
+// managedAnnotationKeys returns the keys of the annotations that are applied together with the labels.
+// The taints and cordon annotations are not applied: they record which taints and which cordon nudl added,
+// so they are written by the same strategic merge patch as spec.taints and spec.unschedulable and never disagree with them.
+// Applying their current value as well would make a stale read revert a concurrent taint or cordon patch.
+// They are removed on clean up by untaint and uncordon.
+func managedAnnotationKeys() []string {
+	return []string{kubevirtAnnotationKey(), ttlAnnotationKey(), detailsAnnotationKey(), inventoryAnnotationKey(), lastSeenAnnotationKey(), podDevicesAnnotationKey(), labelSnapshotAnnotationKey(), ownerAnnotationKey()}
+}
+
+// nodeApplyConfiguration returns the labels and the managed annotations that nudl owns on the node.
+// The annotations are the current ones with the changes in na applied, a nil value deletes an annotation.
+func nodeApplyConfiguration(name string, current map[string]string, nl labels, na map[string]*string) *applycorev1.NodeApplyConfiguration {
+	as := make(map[string]string)
+	for _, k := range managedAnnotationKeys() {
+		if v, ok := current[k]; ok {
+			as[k] = v
+		}
+	}
+	for k, v := range na {
+		if v == nil {
+			delete(as, k)
+			continue
+		}
+		as[k] = *v
+	}
+	return applycorev1.Node(name).WithLabels(nl).WithAnnotations(as)
+}
+
+// metadataChanged returns true if applying the labels and annotations changes the node.
+// Labels with the prefix that are not in nl are removed, so they are a change as well.
+func metadataChanged(node *v1.Node, nl labels, na map[string]*string) bool {
+	current := filter(node.Labels)
+	if len(current) != len(nl) {
+		return true
+	}
+	for k, v := range nl {
+		if cv, ok := current[k]; !ok || cv != v {
+			return true
+		}
+	}
+	for k, v := range na {
+		cv, ok := node.Annotations[k]
+		if ok != (v != nil) || (v != nil && cv != *v) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyNode applies the labels and annotations to the node with server-side apply and the field manager nudl.
+// Labels and annotations that nudl applied before and are not in the configuration anymore are removed by the api server,
+// labels and annotations of other field managers are not touched.
+// If another field manager owns a label with a different value, the apply is not forced and the conflict is returned.
+// Labels with the prefix and managed annotations that nudl does not own, e.g. because they were patched by an older version,
+// are deleted with a patch.
+func applyNode(ctx context.Context, clientset kubernetes.Interface, node *v1.Node, nl labels, na map[string]*string, logger log.Logger) (*v1.Node, error) {
+	c := nodeApplyConfiguration(node.Name, node.Annotations, nl, na)
+	nn, err := clientset.CoreV1().Nodes().Apply(ctx, c, metav1.ApplyOptions{FieldManager: fieldManager})
+	if isFieldManagerConflict(err) {
+		return nil, fmt.Errorf("%w: %w", errFieldManagerConflict, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stale := make(map[string]*string)
+	for _, k := range managedAnnotationKeys() {
+		_, applied := c.Annotations[k]
+		if _, ok := nn.Annotations[k]; ok && !applied {
+			stale[k] = nil
+		}
+	}
+	// Deleted annotations that nudl does not manage, e.g. of gc-on-start, are not removed by the apply.
+	for k, v := range na {
+		if _, ok := nn.Annotations[k]; ok && v == nil {
+			stale[k] = nil
+		}
+	}
+	staleLabels := false
+	for k := range filter(nn.Labels) {
+		if _, ok := nl[k]; !ok {
+			staleLabels = true
+			break
+		}
+	}
+	if len(stale) == 0 && !staleLabels {
+		return nn, nil
+	}
+	patch, err := labelPatch(nn.Labels, nl, stale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch: %w", err)
+	}
+	level.Debug(logger).Log("msg", "deleting labels and annotations that are not owned by nudl", "patch", string(patch))
+	return clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+}
+
+// isFieldManagerConflict returns true if err is a conflict of an apply with other field managers.
+func isFieldManagerConflict(err error) bool {
+	if !errors.IsConflict(err) {
+		return false
+	}
+	var status errors.APIStatus
+	if !stderrors.As(err, &status) || status.Status().Details == nil {
+		return false
+	}
+	for _, c := range status.Status().Details.Causes {
+		if c.Type == metav1.CauseTypeFieldManagerConflict {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNodeApplyConfiguration(t *testing.T) {
+	current := map[string]string{
+		"other":                 "x",
+		kubevirtAnnotationKey(): "[]",
+		detailsAnnotationKey():  "[]",
+		taintsAnnotation():      "[]",
+		cordonAnnotation():      "Tuner",
+	}
+	details := `[{"vendorId":"046d"}]`
+	c := nodeApplyConfiguration("node1", current, labels{"nudl.squat.ai/Logitech_Receiver": "true"}, map[string]*string{
+		kubevirtAnnotationKey(): nil,
+		detailsAnnotationKey():  &details,
+	})
+	assert.Equal(t, "node1", *c.Name)
+	assert.Equal(t, map[string]string{"nudl.squat.ai/Logitech_Receiver": "true"}, c.Labels)
+	// Annotations of other components are not owned by nudl,
+	// and the taints and cordon annotations are patched together with the spec.
+	assert.Equal(t, map[string]string{detailsAnnotationKey(): details}, c.Annotations)
+}
+
+func TestApplyNodeConflict(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	clientset.PrependReactor("patch", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		err := apierrors.NewApplyConflict([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "kubectl"`,
+			Field:   `.metadata.labels.nudl\.squat\.ai/Logitech_Receiver`,
+		}}, `Apply failed with 1 conflict: conflict with "kubectl"`)
+		return true, nil, err
+	})
+	_, err := applyNode(context.Background(), clientset, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, labels{"nudl.squat.ai/Logitech_Receiver": "true"}, nil, log.NewNopLogger())
+	require.Error(t, err)
+	assert.True(t, apierrors.IsConflict(err))
+	assert.ErrorIs(t, err, errFieldManagerConflict)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-kit/log"
+	flag "github.com/spf13/pflag"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var auditLogPath = flag.String("audit-log", "", "path of a file to append an audit record to for every change of the labels, - writes the records to stdout. Changes are not audited if empty.")
+
+// auditor writes the audit records.
+// It is only accessed from the reconciliation loop and the clean up.
+var auditor = struct {
+	logger log.Logger
+	// user is the Kubernetes user that nudl acts as.
+	user string
+}{logger: log.NewNopLogger()}
+
+// setupAudit opens the audit log and looks up the user of the clientset.
+// The returned function closes the audit log.
+func setupAudit(ctx context.Context, clientset kubernetes.Interface) (func() error, error) {
+	if *auditLogPath == "" {
+		return func() error { return nil }, nil
+	}
+	var w io.WriteCloser = nopWriteCloser{os.Stdout}
+	if *auditLogPath != "-" {
+		f, err := os.OpenFile(*auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open audit log: %w", err)
+		}
+		w = f
+	}
+	auditor.logger = log.With(log.NewJSONLogger(log.NewSyncWriter(w)), "ts", log.DefaultTimestampUTC, "audit", true)
+	auditor.user = "unknown"
+	// The user is best effort, SelfSubjectReviews are available since Kubernetes 1.28.
+	if r, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{}); err == nil {
+		auditor.user = r.Status.UserInfo.Username
+	}
+	return w.Close, nil
+}
+
+// audit writes a record of the labels that were added, changed or removed by a patch of the node.
+// Patches without changes are only recorded if they failed.
+func audit(node, action string, current, ul labels, err error) {
+	c := diffLabels(current, ul)
+	if len(c.Added) == 0 && len(c.Removed) == 0 && err == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = err.Error()
+	}
+	auditor.logger.Log(
+		"node", node,
+		"action", action,
+		"user", auditor.user,
+		"hostname", *hostname,
+		"added", c.Added,
+		"removed", c.Removed,
+		"result", result,
+	)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
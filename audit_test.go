@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	var buf bytes.Buffer
+	auditor.logger = log.NewJSONLogger(&buf)
+	defer func() { auditor.logger = log.NewNopLogger() }()
+
+	current := labels{"nudl.squat.ai/a": "true", "nudl.squat.ai/b": "true"}
+	audit("node", "label", current, current, nil)
+	assert.Zero(t, buf.Len())
+
+	audit("node", "label", current, labels{"nudl.squat.ai/a": "true", "nudl.squat.ai/c": "true"}, nil)
+	var r struct {
+		Node    string `json:"node"`
+		Added   labels `json:"added"`
+		Removed labels `json:"removed"`
+		Result  string `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &r))
+	assert.Equal(t, "node", r.Node)
+	assert.Equal(t, labels{"nudl.squat.ai/c": "true"}, r.Added)
+	assert.Equal(t, labels{"nudl.squat.ai/b": "true"}, r.Removed)
+	assert.Equal(t, "success", r.Result)
+
+	buf.Reset()
+	audit("node", "label", current, current, errors.New("forbidden"))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &r))
+	assert.Equal(t, "forbidden", r.Result)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	failureBackoffMax = flag.Duration("failure-backoff-max", 5*time.Minute, "maximum time between two reconciliations after consecutive failures; the update interval is doubled for every failed reconciliation and reset by a successful one, 0 disables the backoff")
+
+	reconcileBackoffGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nudl_reconcile_backoff_seconds",
+			Help: "Time until the next reconciliation after consecutive failures, 0 if the last reconciliation succeeded",
+		},
+	)
+)
+
+// backoffInterval returns the interval doubled for every consecutive failure, at most failure-backoff-max.
+// An interval that is already longer than failure-backoff-max, e.g. steady-update-time, is not changed.
+func backoffInterval(interval time.Duration, failures int) time.Duration {
+	if *failureBackoffMax <= 0 || interval >= *failureBackoffMax {
+		return interval
+	}
+	for i := 0; i < failures && interval < *failureBackoffMax; i++ {
+		interval *= 2
+	}
+	return min(interval, *failureBackoffMax)
+}
+
+// countFailure counts the consecutive failed reconciliations, a successful reconciliation resets them.
+func (lb *labeler) countFailure(err *error) {
+	if *err == nil {
+		lb.failures = 0
+		reconcileBackoffGauge.Set(0)
+		return
+	}
+	lb.failures++
+	reconcileBackoffGauge.Set(lb.nextInterval().Seconds())
+}
+
+// nextInterval returns the time until the next reconciliation, backed off after consecutive failures.
+func (lb *labeler) nextInterval() time.Duration {
+	return backoffInterval(lb.updateInterval(), lb.failures)
+}
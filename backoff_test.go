@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestBackoffInterval(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		max      time.Duration
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{name: "no failures", max: time.Minute, interval: 10 * time.Second, failures: 0, want: 10 * time.Second},
+		{name: "doubled", max: time.Minute, interval: 10 * time.Second, failures: 2, want: 40 * time.Second},
+		{name: "capped", max: time.Minute, interval: 10 * time.Second, failures: 100, want: time.Minute},
+		{name: "longer interval", max: time.Minute, interval: 5 * time.Minute, failures: 3, want: 5 * time.Minute},
+		{name: "disabled", max: 0, interval: 10 * time.Second, failures: 3, want: 10 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			old := *failureBackoffMax
+			*failureBackoffMax = tc.max
+			t.Cleanup(func() { *failureBackoffMax = old })
+			assert.Equal(t, tc.want, backoffInterval(tc.interval, tc.failures))
+		})
+	}
+}
+
+func TestLabelerBackoff(t *testing.T) {
+	oldHostname, oldMax := *hostname, *failureBackoffMax
+	*hostname, *failureBackoffMax = "node", time.Minute
+	t.Cleanup(func() { *hostname, *failureBackoffMax = oldHostname, oldMax })
+
+	var scanErr error
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return nil, scanErr
+	}}
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}})
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	ctx := context.Background()
+
+	scanErr = errors.New("libusb failed")
+	require.Error(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, 2**updateTime, lb.nextInterval())
+	require.Error(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, 4**updateTime, lb.nextInterval())
+
+	scanErr = nil
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, *updateTime, lb.nextInterval())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+)
+
+var metadataBudget = flag.Int("metadata-budget", 0, "maximum size in bytes of the labels and annotations managed by nudl, entries with the lowest priority are pruned to stay within the budget, 0 disables the budget")
+
+var (
+	metadataBytesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nudl_metadata_bytes",
+			Help: "Size in bytes of the labels and annotations managed by nudl",
+		},
+	)
+	metadataPrunedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nudl_metadata_pruned",
+			Help: "Number of labels and annotations that were pruned to stay within the metadata budget",
+		},
+	)
+)
+
+// derivedLabelSuffixes are the suffixes of labels that describe a device in addition to its presence.
+var derivedLabelSuffixes = []string{".driver", ".total", ".free"}
+
+// metadataPriority returns the priority of a managed label or annotation, entries with lower priorities are pruned first.
+// Annotations are pruned first, then labels that describe devices, then the labels of the devices.
+func metadataPriority(k string, annotation bool) int {
+	if annotation {
+		return 0
+	}
+	if strings.HasPrefix(k, sprintLabelKey("sriov")) {
+		return 1
+	}
+	for _, s := range derivedLabelSuffixes {
+		if strings.HasSuffix(k, s) {
+			return 1
+		}
+	}
+	return 2
+}
+
+// metadataSize returns the size in bytes of the labels and the annotations that are set.
+func metadataSize(nl labels, na map[string]*string) int {
+	n := 0
+	for k, v := range nl {
+		n += len(k) + len(v)
+	}
+	for k, v := range na {
+		if v != nil {
+			n += len(k) + len(*v)
+		}
+	}
+	return n
+}
+
+// withUnchangedAnnotations adds the managed annotations of the node that are not patched, because they did not change,
+// so they count towards the budget and can be pruned.
+func withUnchangedAnnotations(current map[string]string, na map[string]*string) map[string]*string {
+	for _, k := range managedAnnotationKeys() {
+		v, ok := current[k]
+		if _, patched := na[k]; ok && !patched {
+			na = mergeAnnotations(na, map[string]*string{k: &v})
+		}
+	}
+	return na
+}
+
+// pruneMetadata removes the entries with the lowest priority from the labels and deletes the annotations,
+// until their size is within metadata-budget, and returns the keys of the pruned entries.
+// Entries with the same priority are pruned in reverse lexical order, so the result is deterministic.
+func pruneMetadata(nl labels, na map[string]*string) []string {
+	size := metadataSize(nl, na)
+	if *metadataBudget <= 0 || size <= *metadataBudget {
+		return nil
+	}
+	type entry struct {
+		key        string
+		annotation bool
+		priority   int
+	}
+	es := make([]entry, 0, len(nl)+len(na))
+	for k := range nl {
+		es = append(es, entry{k, false, metadataPriority(k, false)})
+	}
+	for k, v := range na {
+		if v != nil {
+			es = append(es, entry{k, true, metadataPriority(k, true)})
+		}
+	}
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].priority != es[j].priority {
+			return es[i].priority < es[j].priority
+		}
+		return es[i].key > es[j].key
+	})
+	var pruned []string
+	for _, e := range es {
+		if size <= *metadataBudget {
+			break
+		}
+		if e.annotation {
+			size -= len(e.key) + len(*na[e.key])
+			na[e.key] = nil
+		} else {
+			size -= len(e.key) + len(nl[e.key])
+			delete(nl, e.key)
+		}
+		pruned = append(pruned, e.key)
+	}
+	return pruned
+}
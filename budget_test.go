@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneMetadata(t *testing.T) {
+	old := *metadataBudget
+	t.Cleanup(func() { *metadataBudget = old })
+
+	annotation := `[{"resourceName":"nudl.squat.ai/Uno"}]`
+	newMetadata := func() (labels, map[string]*string) {
+		return labels{
+			"nudl.squat.ai/Uno":          "true",
+			"nudl.squat.ai/Uno.driver":   "cdc_acm",
+			"nudl.squat.ai/Uno.total":    "1",
+			"nudl.squat.ai/Receiver":     "true",
+			"nudl.squat.ai/sriov":        "true",
+			"nudl.squat.ai/sriov.eth0.x": "8",
+		}, map[string]*string{
+			"nudl.squat.ai/kubevirt-usb-host-devices": &annotation,
+			"nudl.squat.ai/deleted":                   nil,
+		}
+	}
+
+	*metadataBudget = 0
+	nl, na := newMetadata()
+	assert.Empty(t, pruneMetadata(nl, na))
+	assert.Len(t, nl, 6)
+
+	// The annotation and the labels that describe devices are pruned first.
+	nl, na = newMetadata()
+	*metadataBudget = len("nudl.squat.ai/Uno") + len("nudl.squat.ai/Receiver") + 2*len("true")
+	assert.Equal(t, []string{
+		"nudl.squat.ai/kubevirt-usb-host-devices",
+		"nudl.squat.ai/sriov.eth0.x",
+		"nudl.squat.ai/sriov",
+		"nudl.squat.ai/Uno.total",
+		"nudl.squat.ai/Uno.driver",
+	}, pruneMetadata(nl, na))
+	assert.Equal(t, labels{"nudl.squat.ai/Uno": "true", "nudl.squat.ai/Receiver": "true"}, nl)
+	assert.Nil(t, na["nudl.squat.ai/kubevirt-usb-host-devices"])
+	assert.Equal(t, *metadataBudget, metadataSize(nl, na))
+}
+
+func TestWithUnchangedAnnotations(t *testing.T) {
+	current := map[string]string{kubevirtAnnotationKey(): "[]", "other": "x"}
+	na := withUnchangedAnnotations(current, nil)
+	assert.Len(t, na, 1)
+	assert.Equal(t, "[]", *na[kubevirtAnnotationKey()])
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// verifySHA256 returns an error if want is not a hex encoded SHA-256 checksum
+// or if it is not the checksum of data. The case of the hex digits is ignored.
+func verifySHA256(data []byte, want string) error {
+	if b, err := hex.DecodeString(want); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("%q is not a hex encoded SHA-256 checksum", want)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum %s does not match %s", got, strings.ToLower(want))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySHA256(t *testing.T) {
+	// usbIDsSum is the SHA-256 checksum of "usb.ids".
+	const usbIDsSum = "d23cfd4e0bd4613235967bfc57788352a1b85ad1d7517dad5c1ee0c6b7583a16"
+	for _, tc := range []struct {
+		name string
+		data string
+		want string
+		err  bool
+	}{
+		{name: "match", data: "usb.ids", want: usbIDsSum},
+		{name: "upper case", data: "usb.ids", want: strings.ToUpper(usbIDsSum)},
+		{name: "mismatch", data: "poisoned", want: usbIDsSum, err: true},
+		{name: "short", data: "usb.ids", want: usbIDsSum[:62], err: true},
+		{name: "not hex", data: "usb.ids", want: strings.Repeat("z", 64), err: true},
+		{name: "empty", data: "usb.ids", want: "", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifySHA256([]byte(tc.data), tc.want)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	classes   = flag.StringSlice("class", []string{}, "list of usb classes, only devices with one of these classes or interfaces of these classes are considered for labeling, e.g. hid, cdc, mass-storage or hex codes like 03 or 02:02 with subclass")
+	noClasses = flag.StringSlice("no-class", []string{}, "list of usb classes, devices with one of these classes or interfaces of these classes are not considered for labeling, e.g. hub")
+)
+
+// usbClassNames maps names of usb classes to their codes.
+var usbClassNames = map[string]uint8{
+	"audio":               0x01,
+	"cdc":                 0x02,
+	"hid":                 0x03,
+	"physical":            0x05,
+	"image":               0x06,
+	"printer":             0x07,
+	"mass-storage":        0x08,
+	"hub":                 0x09,
+	"cdc-data":            0x0a,
+	"smart-card":          0x0b,
+	"content-security":    0x0d,
+	"video":               0x0e,
+	"personal-healthcare": 0x0f,
+	"audio-video":         0x10,
+	"billboard":           0x11,
+	"diagnostic":          0xdc,
+	"wireless":            0xe0,
+	"misc":                0xef,
+	"application":         0xfe,
+	"vendor-specific":     0xff,
+}
+
+// classSpec matches a usb class and optionally a subclass.
+type classSpec struct {
+	class    uint8
+	subClass uint8
+	// anySubClass is true if the subclass was not given.
+	anySubClass bool
+}
+
+// parseClassSpec parses a class name or a hex class code with an optional subclass, e.g. hid, 03 or 0x02:0x02.
+func parseClassSpec(s string) (classSpec, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := usbClassNames[s]; ok {
+		return classSpec{class: c, anySubClass: true}, nil
+	}
+	class, subClass, hasSubClass := strings.Cut(s, ":")
+	c, err := strconv.ParseUint(strings.TrimPrefix(class, "0x"), 16, 8)
+	if err != nil {
+		return classSpec{}, fmt.Errorf("invalid usb class %q", s)
+	}
+	cs := classSpec{class: uint8(c), anySubClass: !hasSubClass}
+	if hasSubClass {
+		sc, err := strconv.ParseUint(strings.TrimPrefix(subClass, "0x"), 16, 8)
+		if err != nil {
+			return classSpec{}, fmt.Errorf("invalid usb subclass in %q", s)
+		}
+		cs.subClass = uint8(sc)
+	}
+	return cs, nil
+}
+
+// parseClassSpecs parses a list of classes.
+func parseClassSpecs(ss []string) ([]classSpec, error) {
+	cs := make([]classSpec, 0, len(ss))
+	for _, s := range ss {
+		c, err := parseClassSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// matchesClass returns true if the device or one of its interfaces has one of the classes.
+func matchesClass(d device, cs []classSpec) bool {
+	for _, pair := range d.Classes {
+		var class, subClass uint8
+		if _, err := fmt.Sscanf(pair, "%02x:%02x", &class, &subClass); err != nil {
+			continue
+		}
+		for _, c := range cs {
+			if c.class == class && (c.anySubClass || c.subClass == subClass) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filteredByClass returns true if the usb device does not have one of the classes in class or has one of the classes in no-class.
+// Pci devices and device nodes are not filtered by class.
+func filteredByClass(d device) bool {
+	if !isUSB(d) {
+		return false
+	}
+	// The flags are validated on start.
+	if cs, _ := parseClassSpecs(*classes); len(cs) > 0 && !matchesClass(d, cs) {
+		return true
+	}
+	cs, _ := parseClassSpecs(*noClasses)
+	return matchesClass(d, cs)
+}
+
+// formatClasses returns the sorted and unique class and subclass pairs, e.g. 03:01.
+func formatClasses(pairs [][2]uint8) []string {
+	set := make(map[string]struct{}, len(pairs))
+	for _, p := range pairs {
+		set[fmt.Sprintf("%02x:%02x", p[0], p[1])] = struct{}{}
+	}
+	cs := make([]string, 0, len(set))
+	for c := range set {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	return cs
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClassSpec(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		want classSpec
+		err  bool
+	}{
+		{spec: "hid", want: classSpec{class: 0x03, anySubClass: true}},
+		{spec: "Mass-Storage", want: classSpec{class: 0x08, anySubClass: true}},
+		{spec: "0x0e", want: classSpec{class: 0x0e, anySubClass: true}},
+		{spec: "02:02", want: classSpec{class: 0x02, subClass: 0x02}},
+		{spec: "keyboard", err: true},
+		{spec: "02:zz", err: true},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			c, err := parseClassSpec(tc.spec)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, c)
+		})
+	}
+}
+
+func TestFilteredByClass(t *testing.T) {
+	keyboard := device{ID: "046d_c52b", Classes: []string{"00:00", "03:01"}}
+	serial := device{ID: "2341_0043", Classes: []string{"02:00", "02:02", "0a:00"}}
+	hub := device{ID: "1d6b_0002", Classes: []string{"09:00"}}
+	gpu := device{ID: "pci-10de_2204", Class: "030000"}
+	defer func() { *classes, *noClasses = nil, nil }()
+
+	*classes = []string{"hid", "02:02"}
+	assert.False(t, filteredByClass(keyboard))
+	assert.False(t, filteredByClass(serial))
+	assert.True(t, filteredByClass(hub))
+	assert.False(t, filteredByClass(gpu))
+
+	*classes, *noClasses = nil, []string{"hub"}
+	assert.False(t, filteredByClass(keyboard))
+	assert.True(t, filteredByClass(hub))
+	assert.True(t, filtered(hub))
+}
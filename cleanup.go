@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	cleanupNodes    = flag.StringSlice("node", nil, "names of the nodes that nudl cleanup cleans up")
+	cleanupAllNodes = flag.Bool("all-nodes", false, "clean up all nodes with nudl cleanup")
+	cleanupPrefixes = flag.StringSlice("prefix", nil, "prefixes of the labels, annotations, taints and extended resources that nudl cleanup removes; defaults to label-prefix, the extra label prefixes and migrate-from-prefix")
+)
+
+// validateCleanup returns an error if the nodes or prefixes of nudl cleanup are invalid.
+func validateCleanup() error {
+	if *cleanupAllNodes && len(*cleanupNodes) > 0 {
+		return fmt.Errorf("node and all-nodes are mutually exclusive")
+	}
+	for _, p := range *cleanupPrefixes {
+		if errs := validation.IsDNS1123Subdomain(p); len(errs) > 0 {
+			return fmt.Errorf("invalid --prefix %q: %s", p, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// cleanupPrefixList returns the prefixes that nudl cleanup removes.
+func cleanupPrefixList() []string {
+	if len(*cleanupPrefixes) > 0 {
+		return *cleanupPrefixes
+	}
+	ps := []string{*labelPrefix}
+	for _, s := range *extraLabelPrefixes {
+		p, _, _ := strings.Cut(s, ",")
+		ps = append(ps, strings.TrimSpace(p))
+	}
+	if *migrateFromPrefix != "" {
+		ps = append(ps, *migrateFromPrefix)
+	}
+	return ps
+}
+
+// hasAnyPrefix returns true if the key has one of the prefixes and is not preserved.
+func hasAnyPrefix(k string, prefixes []string) bool {
+	if preserved(k) {
+		return false
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(k, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupPatches returns a strategic merge patch that removes the labels, annotations and taints with the prefixes from the node
+// and a strategic merge patch for its status that removes the extended resources with the prefixes.
+// A node that nudl cordoned for missing devices is uncordoned.
+// A patch is nil if the node does not need to be patched.
+func cleanupPatches(node *v1.Node, prefixes []string) ([]byte, []byte, error) {
+	metadata := make(map[string]interface{})
+	ls := make(map[string]*string)
+	for k := range node.Labels {
+		if hasAnyPrefix(k, prefixes) {
+			ls[k] = nil
+		}
+	}
+	as := make(map[string]*string)
+	uncordon := false
+	for k := range node.Annotations {
+		if hasAnyPrefix(k, prefixes) {
+			as[k] = nil
+			_, name, _ := strings.Cut(k, "/")
+			uncordon = uncordon || (name == "cordoned-for-missing-devices" && node.Spec.Unschedulable)
+		}
+	}
+	if len(ls) > 0 {
+		metadata["labels"] = ls
+	}
+	if len(as) > 0 {
+		metadata["annotations"] = as
+	}
+	spec := make(map[string]interface{})
+	taints := make([]v1.Taint, 0, len(node.Spec.Taints))
+	for _, t := range node.Spec.Taints {
+		if !hasAnyPrefix(t.Key, prefixes) {
+			taints = append(taints, t)
+		}
+	}
+	if len(taints) != len(node.Spec.Taints) {
+		// Taints have no merge key, so the whole list is replaced.
+		// The resource version makes the patch fail, if the taints were changed concurrently.
+		spec["taints"] = taints
+		if node.ResourceVersion != "" {
+			metadata["resourceVersion"] = node.ResourceVersion
+		}
+	}
+	if uncordon {
+		spec["unschedulable"] = false
+	}
+	var patch, statusPatch []byte
+	if len(metadata) > 0 || len(spec) > 0 {
+		p := make(map[string]interface{})
+		if len(metadata) > 0 {
+			p["metadata"] = metadata
+		}
+		if len(spec) > 0 {
+			p["spec"] = spec
+		}
+		var err error
+		if patch, err = json.Marshal(p); err != nil {
+			return nil, nil, err
+		}
+	}
+	capacity := make(map[string]*string)
+	for name := range node.Status.Capacity {
+		if hasAnyPrefix(string(name), prefixes) {
+			capacity[string(name)] = nil
+		}
+	}
+	if len(capacity) > 0 {
+		var err error
+		if statusPatch, err = json.Marshal(map[string]interface{}{
+			"status": map[string]interface{}{
+				"capacity": capacity,
+			},
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return patch, statusPatch, nil
+}
+
+// cleanupResult is printed for every node that nudl cleanup patches or would patch with dry-run.
+type cleanupResult struct {
+	Node        string          `json:"node"`
+	Patch       json.RawMessage `json:"patch,omitempty"`
+	StatusPatch json.RawMessage `json:"statusPatch,omitempty"`
+}
+
+// cleanupNode removes the labels, annotations, taints and extended resources with the prefixes from the node.
+// A node that a nudl instance still labels is not cleaned up, because the instance would label it again.
+func cleanupNode(ctx context.Context, clientset kubernetes.Interface, name string, prefixes []string, now time.Time, w io.Writer, logger log.Logger) error {
+	node, err := getNamedNode(ctx, clientset, name)
+	if err != nil {
+		return err
+	}
+	if o, _ := checkOwner(node.Annotations, "", now); o != nil {
+		return fmt.Errorf("not cleaning up node %q, because nudl instance %s still labels it", name, o.ID)
+	}
+	patch, statusPatch, err := cleanupPatches(node, prefixes)
+	if err != nil {
+		return fmt.Errorf("failed to create clean up patch for node %q: %w", name, err)
+	}
+	if patch == nil && statusPatch == nil {
+		level.Info(logger).Log("msg", "node has nothing to clean up", "node", name)
+		return nil
+	}
+	if !*dryRun {
+		if patch != nil {
+			if _, err := clientset.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+				return fmt.Errorf("could not patch node %q: %w", name, err)
+			}
+			audit(name, "clean", filterPrefixes(node.Labels, prefixes), nil, nil)
+		}
+		if statusPatch != nil {
+			if _, err := clientset.CoreV1().Nodes().PatchStatus(ctx, name, statusPatch); err != nil {
+				return fmt.Errorf("failed to patch node status of %q: %w", name, err)
+			}
+		}
+		level.Info(logger).Log("msg", "successfully cleaned up node", "node", name)
+	}
+	if err := json.NewEncoder(w).Encode(cleanupResult{Node: name, Patch: patch, StatusPatch: statusPatch}); err != nil {
+		return fmt.Errorf("could not print patch: %w", err)
+	}
+	return nil
+}
+
+// filterPrefixes returns the labels with the prefixes.
+func filterPrefixes(ls map[string]string, prefixes []string) labels {
+	l := make(labels)
+	for k, v := range ls {
+		if hasAnyPrefix(k, prefixes) {
+			l[k] = v
+		}
+	}
+	return l
+}
+
+// cleanup cleans up the nodes of node, or all nodes with all-nodes, and returns the errors of all nodes.
+func cleanup(ctx context.Context, clientset kubernetes.Interface, w io.Writer, logger log.Logger) error {
+	names := *cleanupNodes
+	if *cleanupAllNodes {
+		nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("could not list nodes: %w", err)
+		}
+		names = make([]string, 0, len(nodes.Items))
+		for _, n := range nodes.Items {
+			names = append(names, n.Name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("nudl cleanup requires node or all-nodes")
+	}
+	prefixes := cleanupPrefixList()
+	var errs []error
+	for _, name := range names {
+		errs = append(errs, retryNodeUpdate(ctx, "cleanup", func() error {
+			return cleanupNode(ctx, clientset, name, prefixes, time.Now(), w, log.With(logger, "node", name))
+		}, logger))
+	}
+	return errors.Join(errs...)
+}
+
+// runCleanup removes the labels, annotations, taints and extended resources of nudl from nodes,
+// e.g. after nudl was uninstalled or the prefix was changed.
+func runCleanup(logger log.Logger) error {
+	config, err := newKubeConfig(logger)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("could not create kubernetes clientset: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	return cleanup(ctx, clientset, os.Stdout, logger)
+}
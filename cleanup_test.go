@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCleanup(t *testing.T) {
+	oldNodes, oldAll, oldPrefixes, oldPreserve := *cleanupNodes, *cleanupAllNodes, *cleanupPrefixes, *preserveLabels
+	t.Cleanup(func() {
+		*cleanupNodes, *cleanupAllNodes, *cleanupPrefixes, *preserveLabels = oldNodes, oldAll, oldPrefixes, oldPreserve
+	})
+	*preserveLabels = []string{"nudl.squat.ai/pinned"}
+
+	node := func(name string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					"other":                           "x",
+					"nudl.squat.ai/Logitech_Receiver": "true",
+					"nudl.squat.ai/pinned":            "true",
+					"squat.ai/Logitech_Receiver":      "true",
+				},
+				Annotations: map[string]string{
+					"other": "x",
+					"nudl.squat.ai/cordoned-for-missing-devices": "10c4_ea60",
+					// The heartbeat of the owner is expired.
+					"nudl.squat.ai/owner": `{"id":"a","heartbeat":"2024-05-01T12:00:00Z"}`,
+				},
+			},
+			Spec: v1.NodeSpec{
+				Unschedulable: true,
+				Taints: []v1.Taint{
+					{Key: "nudl.squat.ai/missing", Effect: v1.TaintEffectNoSchedule},
+					{Key: "example.com/other", Effect: v1.TaintEffectNoExecute},
+				},
+			},
+			Status: v1.NodeStatus{Capacity: v1.ResourceList{
+				"nudl.squat.ai/zigbee": resource.MustParse("1"),
+				v1.ResourceCPU:         resource.MustParse("4"),
+			}},
+		}
+	}
+	clientset := fake.NewSimpleClientset(node("node1"), node("node2"))
+	ctx := context.Background()
+
+	// Both flags are mutually exclusive and one of them is required.
+	*cleanupNodes, *cleanupAllNodes = []string{"node1"}, true
+	assert.Error(t, validateCleanup())
+	*cleanupNodes, *cleanupAllNodes = nil, false
+	assert.Error(t, cleanup(ctx, clientset, &bytes.Buffer{}, log.NewNopLogger()))
+
+	*cleanupNodes = []string{"node1"}
+	var out bytes.Buffer
+	require.NoError(t, cleanup(ctx, clientset, &out, log.NewNopLogger()))
+	assert.Contains(t, out.String(), `"node":"node1"`)
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"other": "x", "nudl.squat.ai/pinned": "true", "squat.ai/Logitech_Receiver": "true"}, n.Labels)
+	assert.Equal(t, map[string]string{"other": "x"}, n.Annotations)
+	assert.False(t, n.Spec.Unschedulable)
+	assert.Equal(t, []v1.Taint{{Key: "example.com/other", Effect: v1.TaintEffectNoExecute}}, n.Spec.Taints)
+	assert.Equal(t, v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}, n.Status.Capacity)
+	// The other node is not touched.
+	n, err = clientset.CoreV1().Nodes().Get(ctx, "node2", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, node("node2").Labels, n.Labels)
+
+	// A node without anything to clean up is not patched.
+	out.Reset()
+	require.NoError(t, cleanup(ctx, clientset, &out, log.NewNopLogger()))
+	assert.Empty(t, out.String())
+
+	// Other prefixes, e.g. a previous prefix, are cleaned up on all nodes.
+	*cleanupNodes, *cleanupAllNodes, *cleanupPrefixes = nil, true, []string{"squat.ai"}
+	require.NoError(t, validateCleanup())
+	require.NoError(t, cleanup(ctx, clientset, &out, log.NewNopLogger()))
+	for _, name := range []string{"node1", "node2"} {
+		n, err = clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, n.Labels, "squat.ai/Logitech_Receiver", name)
+	}
+	assert.Contains(t, n.Labels, "nudl.squat.ai/Logitech_Receiver")
+}
+
+func TestCleanupLiveOwner(t *testing.T) {
+	n := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node1",
+		Labels:      map[string]string{"nudl.squat.ai/Logitech_Receiver": "true"},
+		Annotations: map[string]string{ownerAnnotationKey(): fmt.Sprintf(`{"id":"a","heartbeat":%q}`, time.Now().Format(time.RFC3339))},
+	}}
+	clientset := fake.NewSimpleClientset(n)
+	err := cleanupNode(context.Background(), clientset, "node1", []string{"nudl.squat.ai"}, time.Now(), &bytes.Buffer{}, log.NewNopLogger())
+	assert.ErrorContains(t, err, "still labels it")
+}
+
+func TestCleanupDryRun(t *testing.T) {
+	old := *dryRun
+	*dryRun = true
+	t.Cleanup(func() { *dryRun = old })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node1",
+		Labels: map[string]string{"nudl.squat.ai/Logitech_Receiver": "true"},
+	}})
+	var out bytes.Buffer
+	require.NoError(t, cleanupNode(context.Background(), clientset, "node1", []string{"nudl.squat.ai"}, time.Now(), &out, log.NewNopLogger()))
+	assert.JSONEq(t, `{"node":"node1","patch":{"metadata":{"labels":{"nudl.squat.ai/Logitech_Receiver":null}}}}`, out.String())
+	n, err := clientset.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, n.Labels, "nudl.squat.ai/Logitech_Receiver")
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	cloudEventsModeBinary     = "binary"
+	cloudEventsModeStructured = "structured"
+
+	cloudEventTypeAttached      = "ai.squat.nudl.device.attached"
+	cloudEventTypeDetached      = "ai.squat.nudl.device.detached"
+	cloudEventTypeLabelsChanged = "ai.squat.nudl.labels.changed"
+	cloudEventTypeInventory     = "ai.squat.nudl.inventory"
+)
+
+var (
+	cloudEventsURL  = flag.String("cloudevents-url", "", "URL to send attach, detach and label change events to as CloudEvents over HTTP, e.g. a Knative broker. CloudEvents are disabled if empty.")
+	cloudEventsMode = flag.String("cloudevents-mode", cloudEventsModeBinary, fmt.Sprintf("content mode of the CloudEvents, possible values are: %s, %s", cloudEventsModeBinary, cloudEventsModeStructured))
+	cloudEventsTLS  = newTLSFlags("cloudevents", "CloudEvents receiver")
+)
+
+// cloudEvent is a CloudEvent with JSON data.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// labelChange is the data of a label change event.
+type labelChange struct {
+	Node    string `json:"node"`
+	Added   labels `json:"added,omitempty"`
+	Removed labels `json:"removed,omitempty"`
+}
+
+// cloudEventsPublisher sends events for attached and detached devices and changed labels.
+// The label changes are derived from the inventory, because the labels follow from the devices.
+type cloudEventsPublisher struct {
+	client *http.Client
+	url    string
+	mode   string
+	// labels are the labels of the previous inventory, nil before the first inventory.
+	labels labels
+}
+
+func newCloudEventsPublisher() (*cloudEventsPublisher, error) {
+	if *cloudEventsMode != cloudEventsModeBinary && *cloudEventsMode != cloudEventsModeStructured {
+		return nil, fmt.Errorf("CloudEvents mode %q unknown; possible values are: %s, %s", *cloudEventsMode, cloudEventsModeBinary, cloudEventsModeStructured)
+	}
+	client := &http.Client{}
+	if cloudEventsTLS.enabled() {
+		t, err := cloudEventsTLS.transport()
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = t
+	}
+	return &cloudEventsPublisher{client: client, url: *cloudEventsURL, mode: *cloudEventsMode}, nil
+}
+
+func (p *cloudEventsPublisher) Name() string {
+	return "cloudevents"
+}
+
+func (p *cloudEventsPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	l := createLabels(inv.Devices)
+	if p.labels == nil {
+		// The labels of the first inventory are not a change.
+		p.labels = l
+		return nil
+	}
+	c := diffLabels(p.labels, l)
+	if len(c.Added) == 0 && len(c.Removed) == 0 {
+		return nil
+	}
+	c.Node = inv.Node
+	ce, err := newCloudEvent(cloudEventTypeLabelsChanged, inv.Node, "", inv.Time, c)
+	if err != nil {
+		return err
+	}
+	if err := p.send(ctx, ce); err != nil {
+		return err
+	}
+	p.labels = l
+	return nil
+}
+
+func (p *cloudEventsPublisher) PublishEvents(ctx context.Context, es []event) error {
+	for _, e := range es {
+		t := cloudEventTypeAttached
+		if e.Type == eventDetached {
+			t = cloudEventTypeDetached
+		}
+		ce, err := newCloudEvent(t, e.Node, e.Device.Key, e.Time, e)
+		if err != nil {
+			return err
+		}
+		if err := p.send(ctx, ce); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newCloudEvent(typ, node, subject string, t time.Time, data interface{}) (cloudEvent, error) {
+	d, err := json.Marshal(data)
+	if err != nil {
+		return cloudEvent{}, err
+	}
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          fmt.Sprintf("/nudl/nodes/%s", node),
+		Type:            typ,
+		Subject:         subject,
+		Time:            t,
+		DataContentType: "application/json",
+		Data:            d,
+	}, nil
+}
+
+// send sends the event with the HTTP protocol binding.
+func (p *cloudEventsPublisher) send(ctx context.Context, ce cloudEvent) error {
+	var body []byte
+	h := http.Header{}
+	switch p.mode {
+	case cloudEventsModeBinary:
+		body = ce.Data
+		h.Set("Content-Type", ce.DataContentType)
+		h.Set("ce-specversion", ce.SpecVersion)
+		h.Set("ce-id", ce.ID)
+		h.Set("ce-source", ce.Source)
+		h.Set("ce-type", ce.Type)
+		h.Set("ce-time", ce.Time.Format(time.RFC3339Nano))
+		if ce.Subject != "" {
+			h.Set("ce-subject", ce.Subject)
+		}
+	case cloudEventsModeStructured:
+		var err error
+		if body, err = json.Marshal(ce); err != nil {
+			return err
+		}
+		h.Set("Content-Type", "application/cloudevents+json")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = h
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("CloudEvents receiver responded with status %s", res.Status)
+	}
+	return nil
+}
+
+func (p *cloudEventsPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+// diffLabels returns the labels that were added or changed, and the labels that were removed.
+func diffLabels(previous, current labels) labelChange {
+	var c labelChange
+	for k, v := range current {
+		if pv, ok := previous[k]; !ok || pv != v {
+			if c.Added == nil {
+				c.Added = make(labels)
+			}
+			c.Added[k] = v
+		}
+	}
+	for k, v := range previous {
+		if _, ok := current[k]; !ok {
+			if c.Removed == nil {
+				c.Removed = make(labels)
+			}
+			c.Removed[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudEventsPublisher(t *testing.T) {
+	var headers []http.Header
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		headers = append(headers, r.Header)
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+	p, err := newCloudEventsPublisher()
+	require.NoError(t, err)
+	p.url = srv.URL
+	ctx := context.Background()
+	a := device{ID: "a_a", Key: "a"}
+
+	require.NoError(t, p.PublishInventory(ctx, inventory{Node: "node", Time: time.Now()}))
+	require.NoError(t, p.PublishEvents(ctx, []event{{Node: "node", Time: time.Now(), Type: eventAttached, Device: a}}))
+	require.NoError(t, p.PublishInventory(ctx, inventory{Node: "node", Time: time.Now(), Devices: []device{a}}))
+	require.Len(t, headers, 2)
+
+	assert.Equal(t, cloudEventTypeAttached, headers[0].Get("ce-type"))
+	assert.Equal(t, "/nudl/nodes/node", headers[0].Get("ce-source"))
+	assert.Equal(t, "a", headers[0].Get("ce-subject"))
+	var e event
+	require.NoError(t, json.Unmarshal(bodies[0], &e))
+	assert.Equal(t, a, e.Device)
+
+	assert.Equal(t, cloudEventTypeLabelsChanged, headers[1].Get("ce-type"))
+	var c labelChange
+	require.NoError(t, json.Unmarshal(bodies[1], &c))
+	assert.Equal(t, labels{"nudl.squat.ai/a": "true"}, c.Added)
+
+	p.mode = cloudEventsModeStructured
+	require.NoError(t, p.PublishInventory(ctx, inventory{Node: "node", Time: time.Now()}))
+	require.Len(t, bodies, 3)
+	assert.Equal(t, "application/cloudevents+json", headers[2].Get("Content-Type"))
+	var ce cloudEvent
+	require.NoError(t, json.Unmarshal(bodies[2], &ce))
+	assert.Equal(t, cloudEventTypeLabelsChanged, ce.Type)
+	require.NoError(t, json.Unmarshal(ce.Data, &c))
+	assert.Equal(t, labels{"nudl.squat.ai/a": "true"}, c.Removed)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+)
+
+var resolveCollisions = flag.Bool("resolve-collisions", false, "additionally label every device whose label key is shared with other devices with a key suffixed by its serial number or port")
+
+var collisionGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "nudl_label_key_collisions",
+		Help: "Number of label keys that are generated by several devices",
+	},
+)
+
+var productCollisionCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nudl_label_key_product_collisions_total",
+		Help: "Number of label keys that were generated by different products and disambiguated with the ids of the products",
+	},
+	[]string{"key"},
+)
+
+// knownProductCollisions are the keys of the product collisions that were already logged and counted.
+var knownProductCollisions sync.Map
+
+// disambiguateKeys appends the id of the product to the keys of devices, whose key is generated by different products,
+// e.g. two products whose names are identical after sanitizing, so one product does not hide the other.
+// The keys only depend on the devices and not on their order, and identical devices keep sharing their key.
+// Every collision is logged and counted once.
+func disambiguateKeys(ds []device, logger log.Logger) []device {
+	if len(ds) == 0 {
+		return ds
+	}
+	ids := make(map[string]map[string]bool)
+	for _, d := range ds {
+		if ids[d.Key] == nil {
+			ids[d.Key] = make(map[string]bool)
+		}
+		ids[d.Key][d.ID] = true
+	}
+	nds := make([]device, 0, len(ds))
+	for _, d := range ds {
+		if len(ids[d.Key]) < 2 {
+			nds = append(nds, d)
+			continue
+		}
+		if _, known := knownProductCollisions.LoadOrStore(d.Key, true); !known {
+			productCollisionCounter.WithLabelValues(d.Key).Inc()
+			level.Warn(logger).Log("msg", "different products generate the same label key, appending their ids", "key", d.Key, "ids", strings.Join(sortedKeys(ids[d.Key]), ","))
+		}
+		d.Key = idKey(d.Key, d.ID)
+		nds = append(nds, d)
+	}
+	return nds
+}
+
+// idKey appends the id to the key and shortens the key, so the result is not longer than a label name.
+func idKey(key, id string) string {
+	return suffixKey(key, "_"+id)
+}
+
+// suffixKey appends the suffix to the key and shortens the key, so the result is not longer than a label name,
+// e.g. for the .driver label of a device whose key already has the maximum length.
+func suffixKey(key, suffix string) string {
+	if len(key)+len(suffix) > maxLabelNameLength {
+		key = strings.TrimRight(key[:maxLabelNameLength-len(suffix)], "-_.")
+	}
+	return key + suffix
+}
+
+// sortedKeys returns the keys of the set in order.
+func sortedKeys(set map[string]bool) []string {
+	ks := make([]string, 0, len(set))
+	for k := range set {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// collisions returns the devices that are not filtered grouped by their label keys,
+// for every key that is generated by several devices, e.g. identical devices or devices with identical sanitized names.
+func collisions(ds []device) map[string][]device {
+	byKey := make(map[string][]device)
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		byKey[d.Key] = append(byKey[d.Key], d)
+	}
+	for k, g := range byKey {
+		if len(g) < 2 {
+			delete(byKey, k)
+		}
+	}
+	return byKey
+}
+
+// resolvedKeys returns a key for every device of a collision that is unique and deterministic.
+// The key is suffixed with the serial number, or the port if the serial number is unknown or not unique.
+// Devices without either are numbered in the order of their ids.
+// The keys are in the order of sortedCollision.
+func resolvedKeys(key string, ds []device) []string {
+	sorted := sortedCollision(ds)
+	serials := make(map[string]int, len(sorted))
+	for _, d := range sorted {
+		serials[d.Serial]++
+	}
+	keys := make([]string, 0, len(sorted))
+	for i, d := range sorted {
+		var suffix string
+		switch {
+		case d.Serial != "" && serials[d.Serial] == 1:
+			suffix = d.Serial
+		case d.Port != "":
+			suffix = "port-" + d.Port
+		default:
+			suffix = strconv.Itoa(i + 1)
+		}
+		keys = append(keys, key+"_"+string(regTrim.ReplaceAll([]byte(suffix), []byte("-"))))
+	}
+	return keys
+}
+
+// sortedCollision returns the devices of a collision sorted by id, serial number and port.
+func sortedCollision(ds []device) []device {
+	sorted := append([]device{}, ds...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+		if sorted[i].Serial != sorted[j].Serial {
+			return sorted[i].Serial < sorted[j].Serial
+		}
+		return sorted[i].Port < sorted[j].Port
+	})
+	return sorted
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestCollisions(t *testing.T) {
+	ds := []device{
+		{ID: "2341_0043", Key: "Uno", Port: "1-2"},
+		{ID: "2341_0043", Key: "Uno", Port: "1-3"},
+		{ID: "10c4_ea60", Key: "CP2102", Serial: "0001"},
+		{ID: "10c4_ea61", Key: "CP2102", Serial: "0001", Port: "2-1"},
+		{ID: "046d_c52b", Key: "Receiver"},
+	}
+	cs := collisions(ds)
+	assert.Len(t, cs, 2)
+	assert.Equal(t, []string{"Uno_port-1-2", "Uno_port-1-3"}, resolvedKeys("Uno", cs["Uno"]))
+	// The serial number is not unique, so the port is used, or the index if there is no port.
+	assert.Equal(t, []string{"CP2102_1", "CP2102_port-2-1"}, resolvedKeys("CP2102", cs["CP2102"]))
+	assert.Equal(t, []string{"Uno_A", "Uno_B"}, resolvedKeys("Uno", []device{
+		{ID: "2341_0043", Key: "Uno", Serial: "B", Port: "1-2"},
+		{ID: "2341_0043", Key: "Uno", Serial: "A", Port: "1-3"},
+	}))
+
+	*resolveCollisions = true
+	t.Cleanup(func() { *resolveCollisions = false })
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Uno":             "true",
+		"nudl.squat.ai/Uno_port-1-2":    "true",
+		"nudl.squat.ai/Uno_port-1-3":    "true",
+		"nudl.squat.ai/CP2102":          "true",
+		"nudl.squat.ai/CP2102_1":        "true",
+		"nudl.squat.ai/CP2102_port-2-1": "true",
+		"nudl.squat.ai/Receiver":        "true",
+	}, createLabels(ds))
+}
+
+func TestDisambiguateKeys(t *testing.T) {
+	ds := []device{
+		{ID: "1a86_7523", Key: "QinHeng_Serial"},
+		{ID: "2341_0043", Key: "Uno", Port: "1-2"},
+		{ID: "1a86_55d4", Key: "QinHeng_Serial"},
+		{ID: "2341_0043", Key: "Uno", Port: "1-3"},
+		{ID: "1a86_7523", Key: "QinHeng_Serial", Port: "1-4"},
+	}
+	assert.Equal(t, []device{
+		{ID: "1a86_7523", Key: "QinHeng_Serial_1a86_7523"},
+		{ID: "2341_0043", Key: "Uno", Port: "1-2"},
+		{ID: "1a86_55d4", Key: "QinHeng_Serial_1a86_55d4"},
+		{ID: "2341_0043", Key: "Uno", Port: "1-3"},
+		{ID: "1a86_7523", Key: "QinHeng_Serial_1a86_7523", Port: "1-4"},
+	}, disambiguateKeys(ds, log.NewNopLogger()))
+	// The collision is only counted once.
+	disambiguateKeys(ds, log.NewNopLogger())
+	var m dto.Metric
+	assert.NoError(t, productCollisionCounter.WithLabelValues("QinHeng_Serial").Write(&m))
+	assert.Equal(t, 1.0, m.GetCounter().GetValue())
+
+	long := strings.Repeat("a", 60)
+	assert.Equal(t, []device{
+		{ID: "pci-8086_1533", Key: strings.Repeat("a", 49) + "_pci-8086_1533"},
+		{ID: "pci-8086_1539", Key: strings.Repeat("a", 49) + "_pci-8086_1539"},
+	}, disambiguateKeys([]device{{ID: "pci-8086_1533", Key: long}, {ID: "pci-8086_1539", Key: long}}, log.NewNopLogger()))
+	assert.Empty(t, disambiguateKeys(nil, log.NewNopLogger()))
+}
+
+func TestSuffixKey(t *testing.T) {
+	assert.Equal(t, "Uno.driver", suffixKey("Uno", ".driver"))
+	// A key with the maximum length is shortened, so the label name is still valid.
+	k := suffixKey(strings.Repeat("a", maxLabelNameLength), ".driver")
+	assert.Equal(t, strings.Repeat("a", 56)+".driver", k)
+	assert.Empty(t, validation.IsQualifiedName(sprintLabelKey(k)))
+	// The shortened key does not end with a separator.
+	k = suffixKey(strings.Repeat("a", 55)+"_bbbbbbb", ".driver")
+	assert.Equal(t, strings.Repeat("a", 55)+".driver", k)
+	assert.Empty(t, validation.IsQualifiedName(sprintLabelKey(k)))
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+var configFile = flag.String("config", "", "YAML or JSON file with options whose keys are the flag names, flags on the command line take precedence; the file is reloaded when it changes")
+
+// configLoader sets the flags from a config file.
+type configLoader struct {
+	path string
+	// cmdline holds the flags that were set on the command line, which are never overwritten.
+	cmdline map[string]bool
+	// defaults holds the values of the flags before the config file was loaded.
+	defaults flagValues
+	// set holds the options of the last loaded config file.
+	set map[string]bool
+	// levels is the logger whose level is changed when the config file changes log-level, if it is not nil.
+	levels *levelLogger
+}
+
+// newConfigLoader must be called after the flags are parsed and before the config is loaded.
+func newConfigLoader(path string) *configLoader {
+	cmdline := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		cmdline[f.Name] = true
+	})
+	return &configLoader{path: path, cmdline: cmdline, defaults: captureFlags()}
+}
+
+// mapFlags are the values of the flags with maps, because flag.Value.Set merges them and can not reset them.
+var mapFlags = map[string]*map[string]string{
+	"device-resources": deviceResources,
+}
+
+// flagValues holds the values of flags by their names:
+// a string for a scalar, a []string for a list or a map[string]string for a map.
+type flagValues map[string]interface{}
+
+// captureFlags returns the current values of all flags.
+func captureFlags() flagValues {
+	vs := make(flagValues)
+	flag.VisitAll(func(f *flag.Flag) {
+		switch v := f.Value.(type) {
+		case flag.SliceValue:
+			vs[f.Name] = append([]string(nil), v.GetSlice()...)
+		default:
+			if m, ok := mapFlags[f.Name]; ok {
+				vs[f.Name] = maps.Clone(*m)
+				return
+			}
+			vs[f.Name] = v.String()
+		}
+	})
+	return vs
+}
+
+// restoreFlag sets a flag to a captured value.
+func restoreFlag(f *flag.Flag, v interface{}) error {
+	switch v := v.(type) {
+	case []string:
+		return f.Value.(flag.SliceValue).Replace(v)
+	case map[string]string:
+		*mapFlags[f.Name] = maps.Clone(v)
+		return nil
+	default:
+		return f.Value.Set(v.(string))
+	}
+}
+
+// restoreFlags sets the flags to the captured values.
+func restoreFlags(vs flagValues) {
+	for name, v := range vs {
+		// The captured values were valid, so they can be set again.
+		restoreFlag(flag.Lookup(name), v)
+	}
+}
+
+// load reads the config file and sets the flags.
+// Options that were removed from the file are reset to the values before the first load.
+// Lists replace the values, maps are merged with the values before the first load.
+// If the file can not be loaded, the flags are not changed.
+func (c *configLoader) load() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("could not parse config file: %w", err)
+	}
+	var options map[string]interface{}
+	if err := json.Unmarshal(data, &options); err != nil {
+		return fmt.Errorf("could not parse config file: %w", err)
+	}
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if f := flag.Lookup(name); f == nil || name == "config" {
+			return fmt.Errorf("unknown option %q in config file", name)
+		}
+	}
+	prev := captureFlags()
+	set := make(map[string]bool, len(names))
+	for name := range c.set {
+		if _, ok := options[name]; !ok {
+			restoreFlag(flag.Lookup(name), c.defaults[name])
+		}
+	}
+	for _, name := range names {
+		if c.cmdline[name] {
+			continue
+		}
+		f := flag.Lookup(name)
+		restoreFlag(f, c.defaults[name])
+		if err := setFlag(f, options[name]); err != nil {
+			restoreFlags(prev)
+			return fmt.Errorf("invalid option %q in config file: %w", name, err)
+		}
+		set[name] = true
+	}
+	c.set = set
+	return nil
+}
+
+// configMu guards the flags against reloads of the config file.
+// Go routines that read flags concurrently to the reconciliation loop, e.g. http handlers, scanners and publishers, hold the read lock.
+var configMu sync.RWMutex
+
+// configLockTimeout is how long a reload waits for the readers of the flags, e.g. a wedged scanner.
+var configLockTimeout = 10 * time.Second
+
+// lockConfig acquires the write lock of the flags and returns false if the readers do not finish within the timeout.
+func lockConfig(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !configMu.TryLock() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// withConfigReadLock holds the read lock of the flags while a request is served.
+func withConfigReadLock(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		configMu.RLock()
+		defer configMu.RUnlock()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// startupOnlyFlags are read once at startup, e.g. to create servers, clients, publishers and scanners,
+// so they can not be changed by reloading the config file.
+// The prefixes are startup-only, because the labels and annotations of the previous prefix would be orphaned on the node,
+// including the owner, taint and cordon annotations that the clean up relies on.
+var startupOnlyFlags = map[string]bool{
+	"dev-root":              true,
+	"enable-lifecycle":      true,
+	"extra-label-prefix":    true,
+	"fixture-file":          true,
+	"hostname":              true,
+	"hotplug":               true,
+	"kubeconfig":            true,
+	"label-prefix":          true,
+	"log-format":            true,
+	"migrate-from-prefix":   true,
+	"mode":                  true,
+	"node-cache":            true,
+	"node-events":           true,
+	"once":                  true,
+	"patch-strategy":        true,
+	"pod-resources-socket":  true,
+	"publish-queue-size":    true,
+	"publish-retries":       true,
+	"publish-retry-backoff": true,
+	"publish-timeout":       true,
+	"record-file":           true,
+	"remote-devices":        true,
+	"replay":                true,
+	"scanner":               true,
+	"scanner-exec":          true,
+	"shutdown-timeout":      true,
+	"sysfs-root":            true,
+	"udev-root":             true,
+	"usb-backend":           true,
+	"usb-debug":             true,
+	"usb-inventory":         true,
+}
+
+// startupOnlyPrefixes are the prefixes of the flags of servers, clients and publishers that are read once at startup.
+var startupOnlyPrefixes = []string{
+	"admission-", "akri-", "alert-", "cloudevents-", "database-", "generic-device-plugin-", "grpc-", "kafka-", "kube-api-",
+	"listen-", "metrics-", "mqtt-", "nats-", "nfd-", "otlp-", "pushgateway-", "scan-dev", "scan-gpio", "scan-i2c", "scan-pci",
+	"scan-sound", "scan-storage", "scan-thunderbolt", "sink", "usb-ids-", "webhook-",
+}
+
+func isStartupOnly(name string) bool {
+	if startupOnlyFlags[name] {
+		return true
+	}
+	for _, p := range startupOnlyPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the changed config file and validates the configuration.
+// An invalid configuration is rejected and the previous values are restored, so a bad reload does not affect the running instance.
+// Changes of startup-only options are ignored with a warning.
+// The flags are changed under the write lock of configMu, so the readers of other go routines never see a partial configuration.
+// The cached device names are reset, because they depend on flags like human-readable.
+// A changed log-level is applied to the level logger; a level that was set with /-/loglevel is kept otherwise.
+func (c *configLoader) reload(logger log.Logger) error {
+	if !lockConfig(configLockTimeout) {
+		return fmt.Errorf("could not reload config file: the configuration is still in use after %s, e.g. by a wedged scanner", configLockTimeout)
+	}
+	defer configMu.Unlock()
+	prev, prevSet := captureFlags(), c.set
+	if err := c.load(); err != nil {
+		return err
+	}
+	var ignored []string
+	for name, v := range captureFlags() {
+		if isStartupOnly(name) && !reflect.DeepEqual(v, prev[name]) {
+			restoreFlag(flag.Lookup(name), prev[name])
+			ignored = append(ignored, name)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		level.Warn(logger).Log("msg", "ignoring changed options that are only read at startup, restart to apply them", "options", strings.Join(ignored, ","))
+	}
+	if err := validateConfig(); err != nil {
+		restoreFlags(prev)
+		c.set = prevSet
+		return err
+	}
+	if c.levels != nil && prev["log-level"] != *logLevel {
+		// The level was validated with the configuration.
+		if err := c.levels.setLevel(*logLevel); err != nil {
+			return err
+		}
+	}
+	resetNameCache()
+	return nil
+}
+
+// setFlag sets the flag to a value of the config file.
+func setFlag(f *flag.Flag, v interface{}) error {
+	switch v := v.(type) {
+	case []interface{}:
+		vs := make([]string, 0, len(v))
+		for _, e := range v {
+			vs = append(vs, fmt.Sprint(e))
+		}
+		if sv, ok := f.Value.(flag.SliceValue); ok {
+			return sv.Replace(vs)
+		}
+		return f.Value.Set(strings.Join(vs, ","))
+	case map[string]interface{}:
+		vs := make([]string, 0, len(v))
+		for k, e := range v {
+			vs = append(vs, fmt.Sprintf("%s=%v", k, e))
+		}
+		sort.Strings(vs)
+		return f.Value.Set(strings.Join(vs, ","))
+	case float64:
+		return f.Value.Set(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return f.Value.Set(fmt.Sprint(v))
+	}
+}
+
+// watch sends to ch whenever the config file changes until the context is cancelled.
+// The directory is watched, because a mounted ConfigMap is updated by replacing a symlink.
+func (c *configLoader) watch(ctx context.Context, ch chan<- struct{}, logger log.Logger) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("could not watch config file: %w", err)
+	}
+	defer w.Close()
+	if err := w.Add(filepath.Dir(c.path)); err != nil {
+		return fmt.Errorf("could not watch config file: %w", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-w.Errors:
+			level.Warn(logger).Log("msg", "error watching config file", "err", err)
+		case e := <-w.Events:
+			if e.Name != c.path && filepath.Base(e.Name) != "..data" {
+				continue
+			}
+			level.Debug(logger).Log("msg", "config file changed", "event", e.Op.String())
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
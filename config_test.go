@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigLoader(t *testing.T) {
+	oldNoContain, oldUpdateTime, oldUsbDebug, oldResources := *noContain, *updateTime, *usbDebug, *deviceResources
+	t.Cleanup(func() {
+		*noContain, *updateTime, *usbDebug, *deviceResources = oldNoContain, oldUpdateTime, oldUsbDebug, oldResources
+	})
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+no-contain: [hub, receiver]
+update-time: 30s
+usb-debug: 2
+device-resources:
+  "2341_0043": squat.ai/serial
+`), 0o644))
+	c := &configLoader{path: path, cmdline: map[string]bool{"usb-debug": true}, defaults: captureFlags()}
+	require.NoError(t, c.load())
+	assert.Equal(t, []string{"hub", "receiver"}, *noContain)
+	assert.Equal(t, 30*time.Second, *updateTime)
+	// Flags on the command line take precedence.
+	assert.Equal(t, oldUsbDebug, *usbDebug)
+	assert.Equal(t, map[string]string{"2341_0043": "squat.ai/serial"}, *deviceResources)
+
+	// Lists are replaced on reload.
+	require.NoError(t, os.WriteFile(path, []byte(`{"no-contain": ["hub"]}`), 0o644))
+	require.NoError(t, c.load())
+	assert.Equal(t, []string{"hub"}, *noContain)
+
+	// Removed options are reset.
+	require.NoError(t, os.WriteFile(path, []byte(`{"no-contain": ["hub"]}`), 0o644))
+	require.NoError(t, c.load())
+	assert.Equal(t, oldUpdateTime, *updateTime)
+	assert.Equal(t, oldResources, *deviceResources)
+
+	require.NoError(t, os.WriteFile(path, []byte(`unknown-option: true`), 0o644))
+	assert.Error(t, c.load())
+	require.NoError(t, os.WriteFile(path, []byte(`{"no-contain": ["receiver"], "update-time": "soon"}`), 0o644))
+	assert.Error(t, c.load())
+	assert.Equal(t, []string{"hub"}, *noContain)
+}
+
+func TestConfigLoaderReload(t *testing.T) {
+	oldHuman, oldValue, oldNoContain := *humanReadable, *labelValue, *noContain
+	t.Cleanup(func() {
+		*humanReadable, *labelValue, *noContain = oldHuman, oldValue, oldNoContain
+		setUSBIDs(nil)
+	})
+	*humanReadable = false
+	setUSBIDs(map[usbID]*usbVendor{0x2341: {name: "Arduino SA", products: map[usbID]string{0x0043: "Uno R3"}}})
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`no-contain: [hub]`), 0o644))
+	c := &configLoader{path: path, defaults: captureFlags()}
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	id := deviceID{vendor: 0x2341, product: 0x0043}
+	assert.Equal(t, "2341_0043", lookupName(id).key)
+
+	// The cached keys are generated again.
+	require.NoError(t, os.WriteFile(path, []byte(`{"no-contain": [hub], "human-readable": true}`), 0o644))
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, "Arduino-SA_Uno-R3", lookupName(id).key)
+
+	// An invalid configuration is rejected and the previous one is kept.
+	require.NoError(t, os.WriteFile(path, []byte(`{"human-readable": false, "label-value": "maybe"}`), 0o644))
+	err := c.reload(log.NewNopLogger())
+	require.Error(t, err)
+	assert.True(t, isConfigError(err))
+	assert.True(t, *humanReadable)
+	assert.Equal(t, oldValue, *labelValue)
+	assert.Equal(t, []string{"hub"}, *noContain)
+
+	// Removed options are reset.
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0o644))
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	assert.False(t, *humanReadable)
+	assert.ElementsMatch(t, oldNoContain, *noContain)
+	assert.Equal(t, "2341_0043", lookupName(id).key)
+}
+
+func TestConfigLoaderReloadStartupOnly(t *testing.T) {
+	oldAddr, oldStrategy, oldNoContain := *addr, *patchStrategy, *noContain
+	oldPrefix, oldExtra, oldMigrate := *labelPrefix, *extraLabelPrefixes, *migrateFromPrefix
+	t.Cleanup(func() {
+		*addr, *patchStrategy, *noContain = oldAddr, oldStrategy, oldNoContain
+		*labelPrefix, *extraLabelPrefixes, *migrateFromPrefix = oldPrefix, oldExtra, oldMigrate
+	})
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`{"no-contain": [hub], "listen-address": ":9999", "patch-strategy": "json"}`), 0o644))
+	c := &configLoader{path: path, defaults: captureFlags()}
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, []string{"hub"}, *noContain)
+	assert.Equal(t, oldAddr, *addr)
+	assert.Equal(t, oldStrategy, *patchStrategy)
+
+	// A changed prefix would orphan the labels and annotations of the previous prefix.
+	require.NoError(t, os.WriteFile(path, []byte(`{"label-prefix": "devic.es", "extra-label-prefix": [internal.example.com], "migrate-from-prefix": "squat.ai"}`), 0o644))
+	var b strings.Builder
+	require.NoError(t, c.reload(log.NewLogfmtLogger(&b)))
+	assert.Equal(t, oldPrefix, *labelPrefix)
+	assert.Equal(t, oldExtra, *extraLabelPrefixes)
+	assert.Equal(t, oldMigrate, *migrateFromPrefix)
+	assert.Contains(t, b.String(), "extra-label-prefix,label-prefix,migrate-from-prefix")
+}
+
+func TestConfigLoaderReloadLogLevel(t *testing.T) {
+	oldLevel := *logLevel
+	t.Cleanup(func() { *logLevel = oldLevel })
+	*logLevel = logLevelInfo
+	var b strings.Builder
+	ll, err := newLevelLogger(log.NewLogfmtLogger(&b), *logLevel)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`log-level: debug`), 0o644))
+	c := &configLoader{path: path, defaults: captureFlags(), levels: ll}
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, logLevelDebug, ll.getLevel())
+	level.Debug(ll).Log("msg", "shown")
+	assert.Equal(t, "level=debug msg=shown\n", b.String())
+
+	// A level that was set at runtime is kept if the config file does not change log-level.
+	require.NoError(t, ll.setLevel(logLevelWarn))
+	require.NoError(t, os.WriteFile(path, []byte(`{"log-level": "debug", "no-contain": [hub]}`), 0o644))
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, logLevelWarn, ll.getLevel())
+
+	// An invalid level is rejected and the previous level is kept.
+	require.NoError(t, os.WriteFile(path, []byte(`log-level: verbose`), 0o644))
+	assert.Error(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, logLevelDebug, *logLevel)
+	assert.Equal(t, logLevelWarn, ll.getLevel())
+
+	// A removed level is reset.
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0o644))
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, logLevelInfo, ll.getLevel())
+}
+
+func TestConfigLoaderReloadLocked(t *testing.T) {
+	oldTimeout, oldNoContain := configLockTimeout, *noContain
+	t.Cleanup(func() {
+		configLockTimeout, *noContain = oldTimeout, oldNoContain
+	})
+	configLockTimeout = 20 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`no-contain: [hub]`), 0o644))
+	c := &configLoader{path: path, defaults: captureFlags()}
+
+	// A reader, e.g. a wedged scanner, holds the lock, so the flags are not changed.
+	configMu.RLock()
+	assert.Error(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, oldNoContain, *noContain)
+	configMu.RUnlock()
+
+	require.NoError(t, c.reload(log.NewNopLogger()))
+	assert.Equal(t, []string{"hub"}, *noContain)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// maxInventorySize limits the size of an inventory that is received from an agent.
+const maxInventorySize = 1 << 20
+
+// maxNodeNameLength is the maximum length of the name of a node, a DNS subdomain.
+const maxNodeNameLength = 253
+
+const (
+	modeAgent      = "agent"
+	modeController = "controller"
+)
+
+var (
+	mode                 = flag.String("mode", modeAgent, fmt.Sprintf("%s scans and labels the node, %s aggregates the inventories of the agents like the controller command", modeAgent, modeController))
+	controllerSyncTime   = flag.Duration("controller-sync-time", 30*time.Second, "period after which the controller reads the NodeUSBInventory custom resources of the agents, if usb-inventory is set")
+	controllerMaxDevices = flag.Int("controller-max-devices", 1000, "maximum number of devices in an inventory that the controller accepts, so an agent can not store or export an unbounded number of devices")
+	controllerInsecure   = flag.Bool("controller-insecure", false, "run the controller without webhook-secret-file, metrics-bearer-token-file and metrics-client-ca-file, so it accepts inventories from anyone who can reach it")
+
+	controllerNodesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nudl_controller_nodes",
+			Help: "Number of nodes the controller received an inventory from",
+		},
+	)
+	controllerInventoryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nudl_controller_inventories_total",
+			Help: "Number of inventories received by the controller",
+		},
+		[]string{"success"},
+	)
+	controllerDevicesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nudl_controller_devices",
+			Help: "Number of devices attached to all nodes",
+		},
+		[]string{"id", "key"},
+	)
+)
+
+// aggregator holds the latest inventory of every node.
+// The agents send their inventories with the webhook publisher.
+type aggregator struct {
+	// secret is the secret that the agents sign the inventories with, signatures are not verified if nil.
+	secret []byte
+	// store persists the inventories, if it is not nil.
+	store  *inventoryStore
+	logger log.Logger
+
+	mu          sync.RWMutex
+	inventories map[string]inventory
+}
+
+func newAggregator(secret []byte, store *inventoryStore, logger log.Logger) *aggregator {
+	return &aggregator{secret: secret, store: store, logger: logger, inventories: make(map[string]inventory)}
+}
+
+// ServeHTTP receives an inventory.
+// Inventories that could not be stored are rejected, so the agent retries.
+func (a *aggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	inv, status, err := a.receive(r)
+	if err != nil {
+		level.Warn(a.logger).Log("msg", "could not receive inventory", "err", err)
+		controllerInventoryCounter.With(prometheus.Labels{"success": "false"}).Inc()
+		http.Error(w, err.Error(), status)
+		return
+	}
+	controllerInventoryCounter.With(prometheus.Labels{"success": "true"}).Inc()
+	level.Debug(a.logger).Log("msg", "received inventory", "node", inv.Node, "devices", len(inv.Devices))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateControllerAuth returns an error if the controller would accept inventories from anyone who can reach it,
+// which could forge the history of the devices and the label values of nudl_controller_devices, unless controller-insecure is set.
+func validateControllerAuth() error {
+	if *webhookSecretFile == "" && *metricsBearerTokenFile == "" && *metricsClientCAFile == "" && !*controllerInsecure {
+		return errors.New("the controller requires webhook-secret-file, metrics-bearer-token-file or metrics-client-ca-file to authenticate the agents; set controller-insecure to accept inventories from anyone")
+	}
+	return nil
+}
+
+// validateInventory returns an error if the inventory has more than controller-max-devices devices,
+// or a node name, device id or key that is longer than a label allows,
+// so an inventory can not fill the database or the metrics with arbitrary values.
+func validateInventory(inv inventory) error {
+	if inv.Node == "" {
+		return errors.New("inventory without node")
+	}
+	if len(inv.Node) > maxNodeNameLength {
+		return fmt.Errorf("node name is longer than %d characters", maxNodeNameLength)
+	}
+	if len(inv.Devices) > *controllerMaxDevices {
+		return fmt.Errorf("inventory has %d devices, more than controller-max-devices %d", len(inv.Devices), *controllerMaxDevices)
+	}
+	for _, d := range inv.Devices {
+		if len(d.ID) > maxLabelNameLength || len(d.Key) > maxLabelNameLength {
+			return fmt.Errorf("device id or key is longer than %d characters", maxLabelNameLength)
+		}
+	}
+	return nil
+}
+
+func (a *aggregator) receive(r *http.Request) (inventory, int, error) {
+	var inv inventory
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInventorySize))
+	if err != nil {
+		return inv, http.StatusBadRequest, fmt.Errorf("could not read body: %w", err)
+	}
+	if a.secret != nil {
+		sig, _ := strings.CutPrefix(r.Header.Get(webhookSignatureHeader), "sha256=")
+		if !hmac.Equal([]byte(sig), []byte(sign(a.secret, body))) {
+			return inv, http.StatusUnauthorized, fmt.Errorf("invalid signature")
+		}
+	}
+	if err := json.Unmarshal(body, &inv); err != nil {
+		return inv, http.StatusBadRequest, fmt.Errorf("could not decode inventory: %w", err)
+	}
+	if err := validateInventory(inv); err != nil {
+		return inv, http.StatusBadRequest, err
+	}
+	if err := a.add(r.Context(), inv); err != nil {
+		return inv, http.StatusInternalServerError, err
+	}
+	return inv, http.StatusNoContent, nil
+}
+
+// add stores the inventory of a node and updates the metrics.
+func (a *aggregator) add(ctx context.Context, inv inventory) error {
+	if a.store != nil {
+		if err := a.store.upsert(ctx, inv); err != nil {
+			return fmt.Errorf("could not store inventory: %w", err)
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inventories[inv.Node] = inv
+	a.updateMetrics()
+	return nil
+}
+
+// updateMetrics sets the number of nodes and devices.
+// The mutex must be held.
+func (a *aggregator) updateMetrics() {
+	controllerNodesGauge.Set(float64(len(a.inventories)))
+	controllerDevicesGauge.Reset()
+	for _, inv := range a.inventories {
+		for _, d := range inv.Devices {
+			controllerDevicesGauge.WithLabelValues(d.ID, d.Key).Inc()
+		}
+	}
+}
+
+// syncUSBInventories adds the inventories of the NodeUSBInventory custom resources of the agents.
+// Nodes whose NodeUSBInventory was deleted since the previous sync are removed, the stored history is kept.
+func (a *aggregator) syncUSBInventories(ctx context.Context, client dynamic.Interface, previous map[string]struct{}) (map[string]struct{}, error) {
+	l, err := client.Resource(usbInventoryResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return previous, fmt.Errorf("could not list NodeUSBInventories: %w", err)
+	}
+	current := make(map[string]struct{}, len(l.Items))
+	for i := range l.Items {
+		inv, err := inventoryFromUSBInventory(&l.Items[i])
+		if err == nil {
+			err = validateInventory(inv)
+		}
+		if err != nil {
+			level.Warn(a.logger).Log("msg", "ignoring NodeUSBInventory", "name", l.Items[i].GetName(), "err", err)
+			continue
+		}
+		if err := a.add(ctx, inv); err != nil {
+			return previous, err
+		}
+		current[inv.Node] = struct{}{}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for n := range previous {
+		if _, ok := current[n]; !ok {
+			delete(a.inventories, n)
+		}
+	}
+	a.updateMetrics()
+	return current, nil
+}
+
+// runUSBInventorySync syncs the NodeUSBInventories every controller-sync-time.
+func (a *aggregator) runUSBInventorySync(ctx context.Context, client dynamic.Interface) error {
+	t := time.NewTicker(*controllerSyncTime)
+	defer t.Stop()
+	var nodes map[string]struct{}
+	for {
+		var err error
+		if nodes, err = a.syncUSBInventories(ctx, client, nodes); err != nil {
+			level.Warn(a.logger).Log("msg", "could not sync NodeUSBInventories", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// inventoryFromUSBInventory returns the inventory of a NodeUSBInventory.
+func inventoryFromUSBInventory(u *unstructured.Unstructured) (inventory, error) {
+	inv := inventory{Node: u.GetName()}
+	if n, _, _ := unstructured.NestedString(u.Object, "spec", "nodeName"); n != "" {
+		inv.Node = n
+	}
+	if ts, ok, _ := unstructured.NestedString(u.Object, "status", "lastUpdated"); ok {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return inv, fmt.Errorf("invalid lastUpdated: %w", err)
+		}
+		inv.Time = t
+	}
+	ds, _, err := unstructured.NestedSlice(u.Object, "status", "devices")
+	if err != nil {
+		return inv, fmt.Errorf("invalid devices: %w", err)
+	}
+	for _, v := range ds {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return inv, fmt.Errorf("invalid device %v", v)
+		}
+		field := func(k string) string {
+			s, _ := m[k].(string)
+			return s
+		}
+		inv.Devices = append(inv.Devices, device{
+			ID:          field("id"),
+			Key:         field("key"),
+			Description: field("description"),
+			Serial:      field("serial"),
+			Speed:       field("speed"),
+			Port:        field("port"),
+		})
+	}
+	return inv, nil
+}
+
+// runController runs nudl as a central controller that aggregates the inventories of the agents.
+// The agents send their inventories with the webhook publisher or, if usb-inventory is set,
+// the controller reads their NodeUSBInventory custom resources.
+func runController(logger log.Logger) error {
+	if err := validateControllerAuth(); err != nil {
+		return err
+	}
+	if *controllerInsecure {
+		level.Warn(logger).Log("msg", "the controller accepts inventories from anyone who can reach it, because controller-insecure is set")
+	}
+	var secret []byte
+	if *webhookSecretFile != "" {
+		s, err := os.ReadFile(*webhookSecretFile)
+		if err != nil {
+			return fmt.Errorf("could not read webhook secret file: %w", err)
+		}
+		secret = []byte(strings.TrimSpace(string(s)))
+	}
+	var store *inventoryStore
+	if *databaseDSN != "" {
+		var err error
+		if store, err = openInventoryStore(context.Background(), *databaseDriver, *databaseDSN); err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+	a := newAggregator(secret, store, logger)
+	var client dynamic.Interface
+	if *usbInventory {
+		config, err := newKubeConfig(logger)
+		if err != nil {
+			return err
+		}
+		if client, err = dynamic.NewForConfig(config); err != nil {
+			return fmt.Errorf("could not create dynamic client: %w", err)
+		}
+	}
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		controllerNodesGauge,
+		controllerInventoryCounter,
+		controllerDevicesGauge,
+		panicCounter,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m := http.NewServeMux()
+	m.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
+	m.Handle("/api/v1/inventories", a)
+	m.HandleFunc("/api/v1/devices", a.serveDevices)
+	// The agents authenticate with the metrics auth, e.g. with the client certificate of the webhook publisher.
+	h, err := newMetricsAuth(m)
+	if err != nil {
+		return err
+	}
+	tc, err := metricsServerTLSConfig()
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: *addr, Handler: h, TLSConfig: tc}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		l, err := listen(ctx, *addr, logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("could not start controller server: %w", err)
+		}
+		level.Info(logger).Log("msg", "starting controller", "address", *addr, "tls", tc != nil)
+		if tc != nil {
+			// The certificate is in the TLS config.
+			err = srv.ServeTLS(l, "", "")
+		} else {
+			err = srv.Serve(l)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("controller server failed: %w", err)
+		}
+		return nil
+	})
+	if client != nil {
+		g.Go(func() error {
+			return a.runUSBInventorySync(ctx, client)
+		})
+	}
+	g.Go(func() error {
+		<-ctx.Done()
+		level.Info(logger).Log("msg", "shutting down controller")
+		sctx, scancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer scancel()
+		return srv.Shutdown(sctx)
+	})
+	return g.Wait()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// deviceRecord is a device on a node in the REST API of the controller.
+type deviceRecord struct {
+	Node        string `json:"node"`
+	ID          string `json:"id"`
+	Vendor      string `json:"vendor,omitempty"`
+	Product     string `json:"product,omitempty"`
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Present     bool   `json:"present"`
+	// AttachedAt and DetachedAt are only known if the controller stores the history.
+	AttachedAt *time.Time `json:"attachedAt,omitempty"`
+	LastSeen   time.Time  `json:"lastSeen"`
+	DetachedAt *time.Time `json:"detachedAt,omitempty"`
+}
+
+// deviceFilter filters the device records, empty fields match everything.
+type deviceFilter struct {
+	node    string
+	vendor  string
+	product string
+	// present is nil to match present and detached devices.
+	present *bool
+}
+
+func (f deviceFilter) match(r deviceRecord) bool {
+	return (f.node == "" || f.node == r.Node) &&
+		(f.vendor == "" || f.vendor == r.Vendor) &&
+		(f.product == "" || f.product == r.Product) &&
+		(f.present == nil || *f.present == r.Present)
+}
+
+type deviceList struct {
+	Items []deviceRecord `json:"items"`
+	// NextPageToken is set if there are more items.
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+
+// serveDevices lists the devices of all nodes.
+// The query parameters node, vendor, product and present filter the devices,
+// pageSize and pageToken paginate them.
+// Detached devices are only listed if the controller stores the history.
+func (a *aggregator) serveDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	f := deviceFilter{node: q.Get("node"), vendor: q.Get("vendor"), product: q.Get("product")}
+	if p := q.Get("present"); p != "" {
+		b, err := strconv.ParseBool(p)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid present: %v", err), http.StatusBadRequest)
+			return
+		}
+		f.present = &b
+	}
+	size := defaultPageSize
+	if s := q.Get("pageSize"); s != "" {
+		var err error
+		if size, err = strconv.Atoi(s); err != nil || size < 1 || size > maxPageSize {
+			http.Error(w, fmt.Sprintf("pageSize must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+			return
+		}
+	}
+	offset := 0
+	if t := q.Get("pageToken"); t != "" {
+		var err error
+		if offset, err = strconv.Atoi(t); err != nil || offset < 0 {
+			http.Error(w, "invalid pageToken", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Request one more record to know if there is a next page.
+	rs, err := a.listDevices(r.Context(), f, offset, size+1)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not list devices: %v", err), http.StatusInternalServerError)
+		return
+	}
+	l := deviceList{Items: rs}
+	if len(rs) > size {
+		l.Items = rs[:size]
+		l.NextPageToken = strconv.Itoa(offset + size)
+	}
+	if l.Items == nil {
+		l.Items = []deviceRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+// listDevices returns the filtered device records sorted by node and id.
+func (a *aggregator) listDevices(ctx context.Context, f deviceFilter, offset, limit int) ([]deviceRecord, error) {
+	if a.store != nil {
+		return a.store.list(ctx, f, offset, limit)
+	}
+	a.mu.RLock()
+	var rs []deviceRecord
+	for _, inv := range a.inventories {
+		for _, d := range inv.Devices {
+			r := newDeviceRecord(inv.Node, d)
+			r.Present = true
+			r.LastSeen = inv.Time
+			if f.match(r) {
+				rs = append(rs, r)
+			}
+		}
+	}
+	a.mu.RUnlock()
+	sort.SliceStable(rs, func(i, j int) bool {
+		if rs[i].Node != rs[j].Node {
+			return rs[i].Node < rs[j].Node
+		}
+		return rs[i].ID < rs[j].ID
+	})
+	if offset >= len(rs) {
+		return nil, nil
+	}
+	rs = rs[offset:]
+	if len(rs) > limit {
+		rs = rs[:limit]
+	}
+	return rs, nil
+}
+
+func newDeviceRecord(node string, d device) deviceRecord {
+	r := deviceRecord{Node: node, ID: d.ID, Key: d.Key, Description: d.Description}
+	r.Vendor, r.Product, _ = vendorProduct(d)
+	return r
+}
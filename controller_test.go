@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestAggregator(t *testing.T) {
+	secret := []byte("secret")
+	a := newAggregator(secret, nil, log.NewNopLogger())
+	body, err := json.Marshal(inventory{Node: "node", Devices: []device{{ID: "a_a"}}})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		method    string
+		body      []byte
+		signature string
+		want      int
+	}{
+		{name: "method", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "invalid signature", method: http.MethodPost, body: body, signature: "sha256=00", want: http.StatusUnauthorized},
+		{name: "invalid body", method: http.MethodPost, body: []byte("{"), signature: "sha256=" + sign(secret, []byte("{")), want: http.StatusBadRequest},
+		{name: "valid", method: http.MethodPost, body: body, signature: "sha256=" + sign(secret, body), want: http.StatusNoContent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/api/v1/inventories", bytes.NewReader(tc.body))
+			r.Header.Set(webhookSignatureHeader, tc.signature)
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, r)
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+	assert.Len(t, a.inventories["node"].Devices, 1)
+}
+
+func TestAggregatorLimits(t *testing.T) {
+	old := *controllerMaxDevices
+	*controllerMaxDevices = 2
+	t.Cleanup(func() { *controllerMaxDevices = old })
+	a := newAggregator(nil, nil, log.NewNopLogger())
+
+	for _, tc := range []struct {
+		name string
+		inv  inventory
+		want int
+	}{
+		{name: "valid", inv: inventory{Node: "node", Devices: []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}}, want: http.StatusNoContent},
+		{name: "without node", inv: inventory{Devices: []device{{ID: "046d_c52b"}}}, want: http.StatusBadRequest},
+		{name: "long node", inv: inventory{Node: strings.Repeat("n", 254)}, want: http.StatusBadRequest},
+		{name: "too many devices", inv: inventory{Node: "many", Devices: []device{{ID: "a_a"}, {ID: "b_b"}, {ID: "c_c"}}}, want: http.StatusBadRequest},
+		{name: "long id", inv: inventory{Node: "long", Devices: []device{{ID: strings.Repeat("a", 64)}}}, want: http.StatusBadRequest},
+		{name: "long key", inv: inventory{Node: "long", Devices: []device{{ID: "a_a", Key: strings.Repeat("k", 64)}}}, want: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(tc.inv)
+			require.NoError(t, err)
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/inventories", bytes.NewReader(body)))
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+	assert.Len(t, a.inventories, 1)
+}
+
+func TestValidateControllerAuth(t *testing.T) {
+	oldSecret, oldToken, oldCA, oldInsecure := *webhookSecretFile, *metricsBearerTokenFile, *metricsClientCAFile, *controllerInsecure
+	t.Cleanup(func() {
+		*webhookSecretFile, *metricsBearerTokenFile, *metricsClientCAFile, *controllerInsecure = oldSecret, oldToken, oldCA, oldInsecure
+	})
+	*webhookSecretFile, *metricsBearerTokenFile, *metricsClientCAFile, *controllerInsecure = "", "", "", false
+
+	// The flag is namespaced, so it is not mistaken for disabling TLS verification.
+	assert.NotNil(t, flag.Lookup("controller-insecure"))
+	assert.Nil(t, flag.Lookup("insecure"))
+
+	// The controller does not start without authentication.
+	err := validateControllerAuth()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "controller-insecure")
+	assert.Error(t, runController(log.NewNopLogger()))
+	*controllerInsecure = true
+	assert.NoError(t, validateControllerAuth())
+	*controllerInsecure = false
+	*webhookSecretFile = "/etc/nudl/secret"
+	assert.NoError(t, validateControllerAuth())
+	*webhookSecretFile, *metricsClientCAFile = "", "ca.pem"
+	assert.NoError(t, validateControllerAuth())
+	*metricsClientCAFile, *metricsBearerTokenFile = "", "token"
+	assert.NoError(t, validateControllerAuth())
+}
+
+func TestAggregatorDevices(t *testing.T) {
+	a := newAggregator(nil, nil, log.NewNopLogger())
+	a.inventories["b"] = inventory{Node: "b", Time: time.Now(), Devices: []device{{ID: "046d_c52b"}, {ID: "1a86_7523"}}}
+	a.inventories["a"] = inventory{Node: "a", Time: time.Now(), Devices: []device{{ID: "046d_c52b"}}}
+
+	list := func(query string) (deviceList, int) {
+		w := httptest.NewRecorder()
+		a.serveDevices(w, httptest.NewRequest(http.MethodGet, "/api/v1/devices?"+query, nil))
+		var l deviceList
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&l))
+		}
+		return l, w.Code
+	}
+
+	l, code := list("pageSize=2")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, l.Items, 2)
+	assert.Equal(t, "a", l.Items[0].Node)
+	assert.Equal(t, "046d", l.Items[0].Vendor)
+	require.NotEmpty(t, l.NextPageToken)
+	l, _ = list("pageSize=2&pageToken=" + l.NextPageToken)
+	assert.Len(t, l.Items, 1)
+	assert.Empty(t, l.NextPageToken)
+
+	l, _ = list("vendor=046d&node=b")
+	assert.Len(t, l.Items, 1)
+	l, _ = list("present=false")
+	assert.Empty(t, l.Items)
+	_, code = list("pageSize=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAggregatorUSBInventories(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{usbInventoryResource: "NodeUSBInventoryList"},
+		usbInventoryObject(inventory{Node: "a", Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Devices: []device{{ID: "046d_c52b", Key: "logitech", Port: "1-1"}}}),
+		usbInventoryObject(inventory{Node: "b", Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Devices: []device{{ID: "046d_c52b", Key: "logitech", Port: "1-2"}}}),
+	)
+	a := newAggregator(nil, nil, log.NewNopLogger())
+	ctx := context.Background()
+
+	nodes, err := a.syncUSBInventories(ctx, client, nil)
+	require.NoError(t, err)
+	assert.Len(t, nodes, 2)
+	assert.Equal(t, []device{{ID: "046d_c52b", Key: "logitech", Port: "1-1"}}, a.inventories["a"].Devices)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), a.inventories["a"].Time)
+	var m dto.Metric
+	require.NoError(t, controllerDevicesGauge.WithLabelValues("046d_c52b", "logitech").Write(&m))
+	assert.Equal(t, 2.0, m.GetGauge().GetValue())
+
+	// The inventory of an agent that shut down is removed.
+	require.NoError(t, client.Resource(usbInventoryResource).Delete(ctx, "b", metav1.DeleteOptions{}))
+	_, err = a.syncUSBInventories(ctx, client, nodes)
+	require.NoError(t, err)
+	assert.NotContains(t, a.inventories, "b")
+	require.NoError(t, controllerDevicesGauge.WithLabelValues("046d_c52b", "logitech").Write(&m))
+	assert.Equal(t, 1.0, m.GetGauge().GetValue())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+)
+
+var cordonMissing = flag.Bool("cordon-missing", false, "cordon the node while a device in --required-devices is missing and uncordon it when all are present again")
+
+// cordonAnnotation marks a node that was cordoned by nudl and holds the missing devices,
+// so a node that was cordoned by an administrator is never uncordoned.
+func cordonAnnotation() string {
+	return sprintLabelKey("cordoned-for-missing-devices")
+}
+
+// cordonPatch returns a strategic merge patch that cordons the node if devices are missing,
+// or uncordons it if it was cordoned by nudl and no device is missing.
+// It returns nil if the node does not need to be patched.
+func cordonPatch(node *v1.Node, missing []string) ([]byte, error) {
+	key := cordonAnnotation()
+	cordoned, byNudl := node.Annotations[key]
+	var spec map[string]interface{}
+	var annotation *string
+	switch {
+	case len(missing) > 0 && !node.Spec.Unschedulable:
+		spec = map[string]interface{}{"unschedulable": true}
+		v := strings.Join(missing, ",")
+		annotation = &v
+	case len(missing) > 0 && byNudl && cordoned != strings.Join(missing, ","):
+		// Keep the annotation up to date with the missing devices.
+		v := strings.Join(missing, ",")
+		annotation = &v
+	case len(missing) == 0 && byNudl:
+		spec = map[string]interface{}{"unschedulable": false}
+	default:
+		return nil, nil
+	}
+	p := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{key: annotation},
+		},
+	}
+	if spec != nil {
+		p["spec"] = spec
+	}
+	return json.Marshal(p)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	readStringDescriptors   = flag.Bool("read-string-descriptors", false, "open the devices to read their manufacturer and product string descriptors, which name devices more accurately than usb.ids; devices that can not be opened, e.g. without root, are named from the strings in sysfs or from usb.ids")
+	stringDescriptorTimeout = flag.Duration("string-descriptor-timeout", 2*time.Second, "timeout for reading the string descriptors of an opened device, e.g. the serial number with include-serial; a device that does not answer in time is named from usb.ids")
+)
+
+// parens removes parentheses from string descriptors, which would break the format of usb.ids.
+var parens = strings.NewReplacer("(", "", ")", "")
+
+// stringName returns the name of a device from its manufacturer and product strings in the format of usb.ids,
+// e.g. "Arduino Uno (Arduino www.arduino.cc)". A missing string is taken from the name n of usb.ids.
+func stringName(id deviceID, n deviceName, manufacturer, product string) deviceName {
+	manufacturer, product = strings.TrimSpace(parens.Replace(manufacturer)), strings.TrimSpace(parens.Replace(product))
+	if manufacturer == "" && product == "" {
+		return n
+	}
+	if m := regParse.FindStringSubmatch(n.description); m != nil {
+		if product == "" {
+			product = m[1]
+		}
+		if manufacturer == "" {
+			manufacturer = m[2]
+		}
+	}
+	dev := fmt.Sprintf("%s (%s)", product, manufacturer)
+	return deviceName{description: dev, key: sanitizeKey(id, dev)}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringName(t *testing.T) {
+	desc := deviceID{vendor: 0x2341, product: 0x0043}
+	n := deviceName{description: "Uno R3 (CDC ACM) (Arduino SA)", key: "Arduino-SA_Uno-R3-CDC-ACM"}
+
+	assert.Equal(t, n, stringName(desc, n, "", " "))
+	assert.Equal(t, deviceName{description: "Arduino Uno (Arduino www.arduino.cc)", key: "Arduino-www.arduino.cc_Arduino-Uno"}, stringName(desc, n, "Arduino (www.arduino.cc)", "Arduino Uno\n"))
+	// A missing string is taken from usb.ids.
+	assert.Equal(t, deviceName{description: "Arduino Uno (Arduino SA)", key: "Arduino-SA_Arduino-Uno"}, stringName(desc, n, "", "Arduino Uno"))
+
+	*humanReadable = false
+	defer func() { *humanReadable = true }()
+	assert.Equal(t, "2341_0043", stringName(desc, n, "Arduino", "Uno").key)
+}
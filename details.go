@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	publishModeLabels      = "labels"
+	publishModeAnnotations = "annotations"
+	publishModeBoth        = "both"
+)
+
+var publishMode = flag.String("publish-mode", publishModeLabels, fmt.Sprintf("how the devices are published on the node: %s for the device labels, %s for an annotation with the full device details, or %s", publishModeLabels, publishModeAnnotations, publishModeBoth))
+
+// deviceDetails is an entry of the device details annotation.
+type deviceDetails struct {
+	VendorID    string `json:"vendorId"`
+	ProductID   string `json:"productId"`
+	Vendor      string `json:"vendor,omitempty"`
+	Product     string `json:"product,omitempty"`
+	Description string `json:"description,omitempty"`
+	Port        string `json:"port,omitempty"`
+	Serial      string `json:"serial,omitempty"`
+	Class       string `json:"class,omitempty"`
+}
+
+// publishLabels returns true if the devices are published as labels.
+func publishLabels() bool {
+	return *publishMode != publishModeAnnotations
+}
+
+// publishAnnotations returns true if the devices are published in the device details annotation.
+func publishAnnotations() bool {
+	return *publishMode == publishModeAnnotations || *publishMode == publishModeBoth
+}
+
+// detailsAnnotationKey returns the key of the annotation that holds the details of every device.
+func detailsAnnotationKey() string {
+	return sprintLabelKey("devices")
+}
+
+// devicesDetails returns the details of every device that is not filtered, sorted by port and id.
+func devicesDetails(ds []device) []deviceDetails {
+	dds := make([]deviceDetails, 0, len(ds))
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		dd := deviceDetails{
+			Description: d.Description,
+			Port:        d.Port,
+			Serial:      d.Serial,
+			Class:       d.Class,
+		}
+		dd.VendorID, dd.ProductID, _ = vendorProduct(d)
+		if regParse.MatchString(d.Description) {
+			dd.Product = regParse.ReplaceAllString(d.Description, "$1")
+			dd.Vendor = regParse.ReplaceAllString(d.Description, "$2")
+		}
+		dds = append(dds, dd)
+	}
+	sort.SliceStable(dds, func(i, j int) bool {
+		if dds[i].Port != dds[j].Port {
+			return dds[i].Port < dds[j].Port
+		}
+		return dds[i].VendorID+dds[i].ProductID < dds[j].VendorID+dds[j].ProductID
+	})
+	return dds
+}
+
+// detailsAnnotations returns the annotations to patch.
+// The annotation is deleted if the devices are only published as labels or the node is cleaned up.
+func detailsAnnotations(current map[string]string, ds []device, clean bool) (map[string]*string, error) {
+	k := detailsAnnotationKey()
+	_, exists := current[k]
+	if !publishAnnotations() || clean {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	data, err := json.Marshal(devicesDetails(ds))
+	if err != nil {
+		return nil, err
+	}
+	v := string(data)
+	if current[k] == v {
+		return nil, nil
+	}
+	return map[string]*string{k: &v}, nil
+}
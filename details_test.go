@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetailsAnnotations(t *testing.T) {
+	*publishMode = publishModeBoth
+	defer func() { *publishMode = publishModeLabels }()
+	k := detailsAnnotationKey()
+	ds := []device{
+		{ID: "2341_0043", Key: "2341_0043", Description: "Uno R3 (CDC ACM) (Arduino SA)", Port: "1-2", Serial: "7573530303235", Class: "02"},
+		{ID: "1d6b_0002", Key: "1d6b_0002", Description: "2.0 root hub (Linux Foundation)", Port: "usb1", Class: "09"},
+	}
+	want := `[{"vendorId":"2341","productId":"0043","vendor":"Arduino SA","product":"Uno R3 (CDC ACM)","description":"Uno R3 (CDC ACM) (Arduino SA)","port":"1-2","serial":"7573530303235","class":"02"},` +
+		`{"vendorId":"1d6b","productId":"0002","vendor":"Linux Foundation","product":"2.0 root hub","description":"2.0 root hub (Linux Foundation)","port":"usb1","class":"09"}]`
+
+	a, err := detailsAnnotations(nil, ds, false)
+	require.NoError(t, err)
+	require.NotNil(t, a[k])
+	assert.Equal(t, want, *a[k])
+
+	a, err = detailsAnnotations(map[string]string{k: want}, ds, false)
+	require.NoError(t, err)
+	assert.Empty(t, a)
+
+	a, err = detailsAnnotations(map[string]string{k: want}, ds, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{k: nil}, a)
+
+	*publishMode = publishModeLabels
+	a, err = detailsAnnotations(map[string]string{k: want}, ds, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{k: nil}, a)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// devPrefix is the prefix of the ids and keys of device nodes, so they can not be confused with usb devices.
+const devPrefix = "dev-"
+
+var (
+	scanDev     = flag.Bool("scan-dev", false, "additionally label the node with the device nodes in --dev-root that match --dev-patterns, e.g. nudl.squat.ai/dev-video0=true for a webcam, regardless of the bus")
+	devRoot     = flag.String("dev-root", "/dev", "path of the device nodes for scan-dev")
+	devPatterns = flag.StringSlice("dev-patterns", []string{"video*", "ttyUSB*", "ttyACM*", "hidraw*"}, "shell patterns of the names of the device nodes that are labeled, if scan-dev is set")
+)
+
+// isDev returns true for device nodes.
+func isDev(d device) bool {
+	return strings.HasPrefix(d.ID, devPrefix)
+}
+
+// isUSB returns true for usb devices.
+func isUSB(d device) bool {
+	return !isPCI(d) && !isDev(d) && !isI2C(d) && !isGPIO(d) && !isSound(d) && !isStorage(d) && !isThunderbolt(d)
+}
+
+// devScanner scans the device nodes, e.g. /dev/video0, by their names.
+type devScanner struct {
+	root      string
+	sysfsRoot string
+	patterns  []string
+}
+
+func newDevScanner(root, sysfsRoot string, patterns []string) (*devScanner, error) {
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid dev pattern %q: %w", p, err)
+		}
+	}
+	return &devScanner{root: root, sysfsRoot: sysfsRoot, patterns: patterns}, nil
+}
+
+func (*devScanner) Name() string {
+	return "dev"
+}
+
+// Scan returns the device nodes that match the patterns.
+// Directories, e.g. /dev/v4l, are not descended into.
+func (s *devScanner) Scan(_ context.Context) ([]device, error) {
+	es, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, fmt.Errorf("could not list device nodes: %w", err)
+	}
+	var ds []device
+	for _, e := range es {
+		if e.IsDir() || !s.matches(e.Name()) {
+			continue
+		}
+		id := devPrefix + regTrim.ReplaceAllString(e.Name(), "-")
+		ds = append(ds, device{
+			ID:          id,
+			Key:         id,
+			Description: s.describe(e.Name()),
+			Port:        e.Name(),
+		})
+	}
+	return ds, nil
+}
+
+func (s *devScanner) matches(name string) bool {
+	for _, p := range s.patterns {
+		// The patterns are validated on start.
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns a description of a device node in the format of usbid, e.g. "HD Pro Webcam C920 (video0)".
+// The name of video devices is read from sysfs, if it is available.
+func (s *devScanner) describe(name string) string {
+	if data, err := os.ReadFile(filepath.Join(s.sysfsRoot, "class", "video4linux", name, "name")); err == nil {
+		if n := strings.TrimSpace(string(data)); n != "" {
+			return fmt.Sprintf("%s (%s)", n, name)
+		}
+	}
+	return fmt.Sprintf("Unknown (%s)", name)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevScanner(t *testing.T) {
+	root, sysfs := t.TempDir(), t.TempDir()
+	for _, n := range []string{"video0", "ttyACM0", "ttyS0", "hidraw1"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, n), nil, 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "video"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(sysfs, "class", "video4linux", "video0"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sysfs, "class", "video4linux", "video0", "name"), []byte("HD Pro Webcam C920\n"), 0o644))
+
+	s, err := newDevScanner(root, sysfs, []string{"video*", "ttyACM*", "hidraw*"})
+	require.NoError(t, err)
+	ds, err := s.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []device{
+		{ID: "dev-hidraw1", Key: "dev-hidraw1", Description: "Unknown (hidraw1)", Port: "hidraw1"},
+		{ID: "dev-ttyACM0", Key: "dev-ttyACM0", Description: "Unknown (ttyACM0)", Port: "ttyACM0"},
+		{ID: "dev-video0", Key: "dev-video0", Description: "HD Pro Webcam C920 (video0)", Port: "video0"},
+	}, ds)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/dev-hidraw1": "true",
+		"nudl.squat.ai/dev-ttyACM0": "true",
+		"nudl.squat.ai/dev-video0":  "true",
+	}, createLabels(ds))
+	assert.False(t, isUSB(ds[0]))
+
+	_, err = newDevScanner(root, sysfs, []string{"video["})
+	assert.Error(t, err)
+}
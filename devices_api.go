@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// scannedDevice is a device of the last scan in the device API.
+type scannedDevice struct {
+	device
+	// Filtered is true if the device is not labeled, e.g. because of no-contain or class.
+	Filtered bool `json:"filtered"`
+}
+
+// scanResult is the response of the device API.
+type scanResult struct {
+	Node    string          `json:"node"`
+	Time    time.Time       `json:"time"`
+	Devices []scannedDevice `json:"devices"`
+}
+
+// devicesAPI serves the devices of the last successful scan as JSON on /api/v1/devices,
+// including the devices that are filtered out of labeling, so other node agents do not have to parse the labels.
+type devicesAPI struct {
+	mu   sync.RWMutex
+	last *scanResult
+}
+
+// update replaces the devices of the last scan.
+func (a *devicesAPI) update(ds []device, t time.Time) {
+	r := &scanResult{Node: *hostname, Time: t, Devices: make([]scannedDevice, 0, len(ds))}
+	for _, d := range ds {
+		r.Devices = append(r.Devices, scannedDevice{device: d, Filtered: filtered(d)})
+	}
+	a.mu.Lock()
+	a.last = r
+	a.mu.Unlock()
+}
+
+func (a *devicesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.mu.RLock()
+	last := a.last
+	a.mu.RUnlock()
+	if last == nil {
+		http.Error(w, "the devices were not scanned yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(last)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevicesAPI(t *testing.T) {
+	oldHostname, oldNoContain := *hostname, *noContain
+	*hostname, *noContain = "node1", []string{"hub"}
+	t.Cleanup(func() { *hostname, *noContain = oldHostname, oldNoContain })
+
+	a := &devicesAPI{}
+	get := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(method, "/api/v1/devices", nil))
+		return w
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, get(http.MethodGet).Code)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a.update([]device{
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)", Port: "1-2"},
+		{ID: "1d6b_0002", Key: "Linux-Foundation_2.0-root-hub", Description: "2.0 root hub (Linux Foundation)"},
+	}, now)
+	w := get(http.MethodGet)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"node":"node1","time":"2024-05-01T12:00:00Z","devices":[
+		{"id":"2341_0043","key":"Arduino-SA_Uno-R3","description":"Uno R3 (Arduino SA)","port":"1-2","filtered":false},
+		{"id":"1d6b_0002","key":"Linux-Foundation_2.0-root-hub","description":"2.0 root hub (Linux Foundation)","filtered":true}
+	]}`, w.Body.String())
+	var r scanResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+	assert.Equal(t, "2341_0043", r.Devices[0].ID)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, get(http.MethodPost).Code)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	flag "github.com/spf13/pflag"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	doctorPass = "PASS"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+
+	// maxUSBIDsAge is the age after which the usb.ids database is considered outdated.
+	maxUSBIDsAge = 365 * 24 * time.Hour
+)
+
+var udevRoot = flag.String("udev-root", "/run/udev", "path of the udev database that libusb enumerates the usb devices with, checked by the doctor command")
+
+// doctorResult is the result of a check of the doctor command.
+// The remedy is printed if the check does not pass.
+type doctorResult struct {
+	status  string
+	message string
+	remedy  string
+}
+
+// doctorCheck is a check of the runtime environment.
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context) doctorResult
+}
+
+// doctorEnv is the environment that the doctor command checks.
+type doctorEnv struct {
+	devRoot   string
+	sysfsRoot string
+	udevRoot  string
+	euid      int
+	now       time.Time
+	// clientset is nil, if no kubeconfig could be created.
+	clientset kubernetes.Interface
+	// kubeErr is the error of the kubeconfig, if clientset is nil.
+	kubeErr error
+}
+
+// runDoctor checks the runtime environment and writes the report to stdout.
+func runDoctor(logger log.Logger) error {
+	env := doctorEnv{
+		devRoot:   *devRoot,
+		sysfsRoot: *sysfsRoot,
+		udevRoot:  *udevRoot,
+		euid:      os.Geteuid(),
+		now:       time.Now(),
+	}
+	if needsKubeConfig() {
+		config, err := newKubeConfig(logger)
+		if err == nil {
+			env.clientset, err = kubernetes.NewForConfig(config)
+		}
+		env.kubeErr = err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	return doctor(ctx, os.Stdout, env)
+}
+
+// doctor runs all checks of the runtime environment, unlike the selftest also after a failed check,
+// and prints a remedy for every check that does not pass.
+func doctor(ctx context.Context, w io.Writer, env doctorEnv) error {
+	checks := []doctorCheck{
+		{"usb device nodes", env.checkDeviceNodes},
+		{"sysfs", env.checkSysfs},
+		{"udev", env.checkUdev},
+		{"privileges", env.checkPrivileges},
+		{"usb.ids", env.checkUSBIDs},
+		{"kubernetes api", env.checkNode},
+		{"rbac", env.checkRBAC},
+	}
+	failed := 0
+	for _, c := range checks {
+		r := c.run(ctx)
+		fmt.Fprintf(w, "%s %s: %s\n", r.status, c.name, r.message)
+		if r.status != doctorPass && r.remedy != "" {
+			fmt.Fprintf(w, "     fix: %s\n", r.remedy)
+		}
+		if r.status == doctorFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d doctor checks failed", failed)
+	}
+	return nil
+}
+
+// checkDeviceNodes checks that the usb device nodes are mounted and readable, which libusb needs.
+func (e doctorEnv) checkDeviceNodes(_ context.Context) doctorResult {
+	dir := filepath.Join(e.devRoot, "bus", "usb")
+	fail := doctorFail
+	if sysfsBackend() {
+		fail = doctorWarn
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if sysfsBackend() {
+			return doctorResult{status: doctorPass, message: fmt.Sprintf("%s is not needed with the sysfs backend", dir)}
+		}
+		return doctorResult{status: fail, message: fmt.Sprintf("%s is not available: %v", dir, err),
+			remedy: "mount /dev/bus/usb of the host into the container with a hostPath volume, or set --usb-backend=sysfs to scan sysfs instead"}
+	}
+	var node string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			node = path
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return doctorResult{status: fail, message: fmt.Sprintf("could not list %s: %v", dir, err),
+			remedy: "run the container as root with privileged: true in the securityContext, or set --usb-backend=sysfs"}
+	}
+	if node == "" {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("%s contains no device nodes", dir),
+			remedy: "mount /dev/bus/usb of the host instead of an empty directory, e.g. with a hostPath volume"}
+	}
+	f, err := os.Open(node)
+	if err != nil {
+		return doctorResult{status: fail, message: fmt.Sprintf("could not open %s: %v", node, err),
+			remedy: "run the container as root with privileged: true in the securityContext, or set --usb-backend=sysfs"}
+	}
+	f.Close()
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("%s is mounted and readable", dir)}
+}
+
+// checkSysfs checks that the usb devices are listed in sysfs, which the sysfs backend and most labels of devices need.
+func (e doctorEnv) checkSysfs(_ context.Context) doctorResult {
+	dir := filepath.Join(e.sysfsRoot, "bus", "usb", "devices")
+	if _, err := os.Stat(dir); err != nil {
+		status := doctorWarn
+		if sysfsBackend() {
+			status = doctorFail
+		}
+		return doctorResult{status: status, message: fmt.Sprintf("%s is not available: %v", dir, err),
+			remedy: "mount /sys of the host read-only and set --sysfs-root to the mount path"}
+	}
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("%s is available", dir)}
+}
+
+// checkUdev checks that the udev database is available, which libusb needs to enumerate the devices in a container.
+func (e doctorEnv) checkUdev(_ context.Context) doctorResult {
+	if sysfsBackend() {
+		return doctorResult{status: doctorPass, message: "udev is not needed with the sysfs backend"}
+	}
+	if _, err := os.Stat(filepath.Join(e.udevRoot, "data")); err != nil {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("the udev database in %s is not available, so libusb may not find any devices", e.udevRoot),
+			remedy: "mount /run/udev of the host read-only, or set --usb-backend=sysfs to scan sysfs instead"}
+	}
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("the udev database in %s is available", e.udevRoot)}
+}
+
+// checkPrivileges checks that libusb can open the devices.
+func (e doctorEnv) checkPrivileges(_ context.Context) doctorResult {
+	switch {
+	case sysfsBackend():
+		return doctorResult{status: doctorPass, message: fmt.Sprintf("running as uid %d with the sysfs backend", e.euid)}
+	case e.euid == 0:
+		return doctorResult{status: doctorPass, message: "running as root"}
+	}
+	return doctorResult{status: doctorWarn, message: fmt.Sprintf("running as uid %d, so libusb can only open devices with matching permissions", e.euid),
+		remedy: "set runAsUser: 0 and privileged: true in the securityContext, or set --usb-backend=sysfs"}
+}
+
+// checkUSBIDs checks that the usb.ids database is recent enough to name new devices.
+func (e doctorEnv) checkUSBIDs(_ context.Context) doctorResult {
+	remedy := "set --usb-ids-path=/usr/share/hwdata/usb.ids with the database of the host, or --usb-ids-url=https://www.linux-usb.org/usb.ids"
+	switch {
+	case *usbIDsURL != "":
+		return doctorResult{status: doctorPass, message: fmt.Sprintf("usb.ids is downloaded from %s every %s", *usbIDsURL, *usbIDsRefresh)}
+	case *usbIDsPath != "":
+		fi, err := os.Stat(*usbIDsPath)
+		if err != nil {
+			return doctorResult{status: doctorFail, message: fmt.Sprintf("could not read %s: %v", *usbIDsPath, err), remedy: remedy}
+		}
+		if age := e.now.Sub(fi.ModTime()); age > maxUSBIDsAge {
+			return doctorResult{status: doctorWarn, message: fmt.Sprintf("%s was modified %d days ago", *usbIDsPath, int(age.Hours()/24)), remedy: "update the usb.ids package of the host, e.g. hwdata"}
+		}
+		return doctorResult{status: doctorPass, message: fmt.Sprintf("%s is recent", *usbIDsPath)}
+	}
+	updated, ok := embeddedUSBIDsUpdate()
+	if !ok {
+		return doctorResult{status: doctorWarn, message: "nudl was built without cgo and has no embedded usb.ids, so devices are not named", remedy: remedy}
+	}
+	if age := e.now.Sub(updated); age > maxUSBIDsAge {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("the embedded usb.ids is from %s, so recent devices are not named", updated.Format(time.DateOnly)), remedy: remedy}
+	}
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("the embedded usb.ids is from %s", updated.Format(time.DateOnly))}
+}
+
+// checkNode checks that the api server is reachable and the node of hostname exists.
+func (e doctorEnv) checkNode(ctx context.Context) doctorResult {
+	if !needsKubeConfig() {
+		return doctorResult{status: doctorPass, message: fmt.Sprintf("not needed with the %s sink", *sinkName)}
+	}
+	if e.clientset == nil {
+		return doctorResult{status: doctorFail, message: fmt.Sprintf("could not create a kubeconfig: %v", e.kubeErr),
+			remedy: "run nudl in a pod with a service account, or set --kubeconfig"}
+	}
+	if *hostname == "" {
+		return doctorResult{status: doctorFail, message: "hostname is not set",
+			remedy: "set --hostname, or the NODE_NAME environment variable from the downward API field spec.nodeName"}
+	}
+	if _, err := getNamedNode(ctx, e.clientset, *hostname); err != nil {
+		return doctorResult{status: doctorFail, message: fmt.Sprintf("could not get node %s: %v", *hostname, err),
+			remedy: "check that --hostname is the name of the node, e.g. from the downward API field spec.nodeName, and that the api server is reachable"}
+	}
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("node %s exists", *hostname)}
+}
+
+// requiredPermissions returns the permissions that the enabled features need.
+func requiredPermissions() []authorizationv1.ResourceAttributes {
+	ps := []authorizationv1.ResourceAttributes{
+		{Resource: "nodes", Verb: "get"},
+		{Resource: "nodes", Verb: "patch"},
+	}
+	if *nodeCacheEnabled || *nodeSelector != "" {
+		ps = append(ps, authorizationv1.ResourceAttributes{Resource: "nodes", Verb: "list"})
+	}
+	if *nodeCacheEnabled {
+		ps = append(ps, authorizationv1.ResourceAttributes{Resource: "nodes", Verb: "watch"})
+	}
+	if *extendedResources || *rulesFile != "" || *nodeConditions || *healthCondition {
+		ps = append(ps, authorizationv1.ResourceAttributes{Resource: "nodes", Subresource: "status", Verb: "patch"})
+	}
+	if *nodeEvents {
+		ps = append(ps, authorizationv1.ResourceAttributes{Resource: "events", Verb: "create"})
+	}
+	if instancePod() != "" {
+		// The pod of the owner is looked up to detect an owner that was killed.
+		ps = append(ps, authorizationv1.ResourceAttributes{Resource: "pods", Verb: "get"})
+	}
+	return ps
+}
+
+// checkRBAC checks that the service account has the permissions that the enabled features need.
+func (e doctorEnv) checkRBAC(ctx context.Context) doctorResult {
+	if *sinkName != sinkKubernetes {
+		return doctorResult{status: doctorPass, message: fmt.Sprintf("not checked with the %s sink", *sinkName)}
+	}
+	if e.clientset == nil {
+		return doctorResult{status: doctorFail, message: "could not check the permissions without a kubeconfig"}
+	}
+	var missing []string
+	var errs []error
+	for _, p := range requiredPermissions() {
+		r, err := e.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &p},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !r.Status.Allowed {
+			res := p.Resource
+			if p.Subresource != "" {
+				res += "/" + p.Subresource
+			}
+			missing = append(missing, p.Verb+" "+res)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return doctorResult{status: doctorFail, message: fmt.Sprintf("could not review the permissions: %v", err)}
+	}
+	if len(missing) > 0 {
+		return doctorResult{status: doctorFail, message: "missing permissions to " + strings.Join(missing, ", "),
+			remedy: "grant the permissions to the service account of nudl in its ClusterRole, see example.yaml"}
+	}
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("all %d required permissions are granted", len(requiredPermissions()))}
+}
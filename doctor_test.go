@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDoctor(t *testing.T) {
+	if !libusbAvailable {
+		t.Skip("the checks of the libusb backend need cgo")
+	}
+	oldHostname, oldEvents := *hostname, *nodeEvents
+	*hostname = "node1"
+	*nodeEvents = true
+	t.Cleanup(func() { *hostname, *nodeEvents = oldHostname, oldEvents })
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "dev", "bus", "usb", "001"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dev", "bus", "usb", "001", "001"), nil, 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sys", "bus", "usb", "devices"), 0o755))
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		r := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		r.Status.Allowed = r.Spec.ResourceAttributes.Resource != "events"
+		return true, r, nil
+	})
+	updated, _ := embeddedUSBIDsUpdate()
+	env := doctorEnv{
+		devRoot:   filepath.Join(root, "dev"),
+		sysfsRoot: filepath.Join(root, "sys"),
+		udevRoot:  filepath.Join(root, "udev"),
+		euid:      1000,
+		now:       updated.Add(24 * time.Hour),
+		clientset: clientset,
+	}
+	w := &bytes.Buffer{}
+	require.Error(t, doctor(context.Background(), w, env))
+	out := w.String()
+	assert.Contains(t, out, "PASS usb device nodes:")
+	assert.Contains(t, out, "PASS sysfs:")
+	assert.Contains(t, out, "WARN udev:")
+	assert.Contains(t, out, "WARN privileges: running as uid 1000")
+	assert.Contains(t, out, "PASS usb.ids:")
+	assert.Contains(t, out, "PASS kubernetes api: node node1 exists")
+	assert.Contains(t, out, "FAIL rbac: missing permissions to create events\n     fix: ")
+
+	*nodeEvents = false
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "udev", "data"), 0o755))
+	env.euid = 0
+	w.Reset()
+	require.NoError(t, doctor(context.Background(), w, env), w.String())
+	assert.NotContains(t, w.String(), "fix:")
+
+	env.now = updated.Add(2 * maxUSBIDsAge)
+	w.Reset()
+	require.NoError(t, doctor(context.Background(), w, env))
+	assert.Contains(t, w.String(), "WARN usb.ids:")
+
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "dev")))
+	w.Reset()
+	require.Error(t, doctor(context.Background(), w, env))
+	assert.Contains(t, w.String(), "FAIL usb device nodes:")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// noDriver is the value of the driver label of a device without a bound kernel driver.
+const noDriver = "none"
+
+var driverLabels = flag.Bool("driver-labels", false, "label every device with the kernel drivers that are bound to its interfaces, read from sysfs at --sysfs-root")
+
+// sysfsName returns the name of the sysfs directory of a usb device, e.g. usb1 for a root hub or 1-2.3.
+// The path holds the port numbers from the root hub of the bus to the device.
+func sysfsName(bus int, path []int) string {
+	if len(path) == 0 {
+		return fmt.Sprintf("usb%d", bus)
+	}
+	ports := make([]string, 0, len(path))
+	for _, p := range path {
+		ports = append(ports, strconv.Itoa(p))
+	}
+	return fmt.Sprintf("%d-%s", bus, strings.Join(ports, "."))
+}
+
+// addDriverLabels adds a label <key>.driver with the bound kernel drivers for every device that is labeled,
+// e.g. cdc_acm, so workloads that need raw access know whether they must detach the driver first.
+// Multiple drivers, e.g. of identical devices or of different interfaces, are joined with a dot.
+func addDriverLabels(l labels, ds []device) {
+	drivers := make(map[string]map[string]struct{})
+	for _, d := range ds {
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		if drivers[d.Key] == nil {
+			drivers[d.Key] = make(map[string]struct{})
+		}
+		for _, dr := range d.Drivers {
+			drivers[d.Key][dr] = struct{}{}
+		}
+	}
+	for k, set := range drivers {
+		v := noDriver
+		if len(set) > 0 {
+			ds := make([]string, 0, len(set))
+			for dr := range set {
+				ds = append(ds, dr)
+			}
+			sort.Strings(ds)
+			v = strings.Join(ds, ".")
+		}
+		l[sprintLabelKey(suffixKey(k, ".driver"))] = v
+	}
+}
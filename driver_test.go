@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSysfsName(t *testing.T) {
+	assert.Equal(t, "usb1", sysfsName(1, nil))
+	assert.Equal(t, "1-2", sysfsName(1, []int{2}))
+	assert.Equal(t, "3-1.4.2", sysfsName(3, []int{1, 4, 2}))
+}
+
+func TestDriverLabels(t *testing.T) {
+	*driverLabels = true
+	t.Cleanup(func() { *driverLabels = false })
+
+	ds := []device{
+		{ID: "10c4_ea60", Key: "CP2102", Drivers: []string{"cp210x"}},
+		{ID: "2341_0043", Key: "Uno", Drivers: []string{"cdc_acm"}},
+		{ID: "2341_0043", Key: "Uno"},
+		{ID: "046d_c52b", Key: "Receiver"},
+		{ID: "1d6b_0002", Key: "root_hub", Description: "2.0 root hub", Drivers: []string{"hub"}},
+		{ID: "0403_6001", Key: strings.Repeat("a", maxLabelNameLength), Drivers: []string{"ftdi_sio"}},
+	}
+	old := *noContain
+	*noContain = []string{"hub"}
+	t.Cleanup(func() { *noContain = old })
+	assert.Equal(t, labels{
+		"nudl.squat.ai/CP2102":                                     "true",
+		"nudl.squat.ai/CP2102.driver":                              "cp210x",
+		"nudl.squat.ai/Uno":                                        "true",
+		"nudl.squat.ai/Uno.driver":                                 "cdc_acm",
+		"nudl.squat.ai/Receiver":                                   "true",
+		"nudl.squat.ai/Receiver.driver":                            "none",
+		"nudl.squat.ai/" + strings.Repeat("a", maxLabelNameLength): "true",
+		"nudl.squat.ai/" + strings.Repeat("a", 56) + ".driver":     "ftdi_sio",
+	}, createLabels(ds))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	flag "github.com/spf13/pflag"
+)
+
+var replay = flag.String("replay", "", "file written with nudl dump or --record-file, or the output of lsusb, whose devices are scanned instead of the devices of the node, so the whole labeling pipeline runs against them; replaces --scanner")
+
+// runDump scans the devices of --scanner once and writes them to stdout as a fixture file,
+// which runs the whole pipeline against the devices with --replay, e.g. to reproduce a bug report without the hardware.
+// Neither a kubeconfig nor a cluster is needed.
+func runDump(logger log.Logger) error {
+	s, err := newScanner(logger)
+	if err != nil {
+		return err
+	}
+	ds, err := runScanner(context.Background(), s, logger)
+	if err != nil {
+		return fmt.Errorf("scanner %s failed: %w", s.Name(), err)
+	}
+	return writeDump(os.Stdout, ds)
+}
+
+// writeDump writes the usb devices as an indented fixture file.
+// The descriptions are dumped, so the keys are generated from the same names regardless of the usb.ids of the replay.
+func writeDump(w io.Writer, ds []device) error {
+	f := fixture{Devices: []fixtureDevice{}}
+	for _, d := range ds {
+		if !isUSB(d) {
+			continue
+		}
+		vendor, product, _ := strings.Cut(d.ID, "_")
+		f.Devices = append(f.Devices, fixtureDevice{
+			Vendor:      vendor,
+			Product:     product,
+			Description: d.Description,
+			Serial:      d.Serial,
+			Class:       d.Class,
+			Classes:     d.Classes,
+			Port:        d.Port,
+			Speed:       d.Speed,
+			Drivers:     d.Drivers,
+			Version:     d.Version,
+		})
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(f)
+}
+
+// newReplay returns the scanner for the file to replay:
+// a replayScanner for the scans of --record-file, which are JSON lines with a time,
+// or a fixtureScanner for the output of nudl dump, any other fixture file or the output of lsusb.
+func newReplay(path string) (scanner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read replay file: %w", err)
+	}
+	var r struct {
+		Time *time.Time `json:"time"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&r); err == nil && r.Time != nil {
+		return newReplayScanner(path)
+	}
+	return newFixtureScanner(path)
+}
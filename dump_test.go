@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpReplay(t *testing.T) {
+	// The description is not in the usb.ids of nudl and generates a key that is too long for a label.
+	long := "Very Long Product Name Of A Device With A Long Name (Very Long Vendor Name Of A Vendor)"
+	desc := deviceID{vendor: 0x1234, product: 0x5678}
+	ds := []device{
+		{ID: "1234_5678", Key: sanitizeKey(desc, long), Description: long, Port: "1-2.3", Speed: "high", Class: "00", Classes: []string{"00:00", "03:01"}, Drivers: []string{"usbhid"}, Serial: "A1"},
+		{ID: "pci-8086_1533", Key: "pci-Intel-Corporation_I210", Description: "I210 (Intel Corporation)"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeDump(&buf, ds))
+
+	path := filepath.Join(t.TempDir(), "dump.json")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	// --replay selects the fixture scanner for a dump.
+	old := *replay
+	t.Cleanup(func() { *replay = old })
+	*replay = path
+	s, err := newScanner(log.NewNopLogger())
+	require.NoError(t, err)
+	assert.IsType(t, &fixtureScanner{}, s)
+	rds, err := s.Scan(context.Background())
+	require.NoError(t, err)
+	// Only usb devices are dumped.
+	assert.Equal(t, ds[:1], rds)
+}
+
+func TestNewReplay(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	s, err := newReplay(write("scans.jsonl", `{"time":"2024-05-01T12:00:00Z","devices":[{"id":"046d_c52b","key":"Logitech_Receiver"}]}
+{"time":"2024-05-01T12:00:10Z","devices":[],"error":"LIBUSB_ERROR_IO"}
+`))
+	require.NoError(t, err)
+	assert.IsType(t, &replayScanner{}, s)
+
+	s, err = newReplay(write("fixture.json", `{"devices":[{"vendor":"046d","product":"c52b"}]}`))
+	require.NoError(t, err)
+	assert.IsType(t, &fixtureScanner{}, s)
+
+	s, err = newReplay(write("lsusb.txt", "Bus 001 Device 002: ID 046d:c52b Logitech, Inc. Unifying Receiver\n"))
+	require.NoError(t, err)
+	assert.IsType(t, &fixtureScanner{}, s)
+
+	_, err = newReplay(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// The classes of errors, so failures can be alerted on and restart policies can distinguish them.
+const (
+	errorClassScan         = "scan"
+	errorClassForbidden    = "forbidden"
+	errorClassNodeNotFound = "node-not-found"
+	errorClassInvalidLabel = "invalid-label"
+	errorClassOther        = "other"
+)
+
+// exitCodes are the exit codes of the error classes.
+// Exit code 2 is used for invalid flags.
+var exitCodes = map[string]int{
+	errorClassOther:        1,
+	errorClassScan:         3,
+	errorClassForbidden:    4,
+	errorClassNodeNotFound: 5,
+	errorClassInvalidLabel: 6,
+}
+
+var (
+	// errNodeNotFound is returned if the node of the instance does not exist.
+	errNodeNotFound = errors.New("node not found")
+	// errInvalidLabel is returned if a label key or value is invalid.
+	errInvalidLabel = errors.New("invalid label")
+)
+
+var errorsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nudl_errors_total",
+		Help: "Number of failed reconciliations by the class of the error",
+	},
+	[]string{"class"},
+)
+
+// scanError is returned if a scanner fails, e.g. because the usb subsystem is unavailable.
+type scanError struct {
+	scanner string
+	err     error
+}
+
+func (e *scanError) Error() string {
+	return fmt.Sprintf("scanner %s failed: %v", e.scanner, e.err)
+}
+
+func (e *scanError) Unwrap() error {
+	return e.err
+}
+
+// classifyError returns the class of the error.
+func classifyError(err error) string {
+	var se *scanError
+	switch {
+	case errors.As(err, &se):
+		return errorClassScan
+	case errors.Is(err, errNodeNotFound):
+		return errorClassNodeNotFound
+	case apierrors.IsForbidden(err):
+		return errorClassForbidden
+	case errors.Is(err, errInvalidLabel) || apierrors.IsInvalid(err):
+		return errorClassInvalidLabel
+	}
+	return errorClassOther
+}
+
+// countError counts the error by its class.
+func countError(err error) {
+	errorsCounter.WithLabelValues(classifyError(err)).Inc()
+}
+
+// exitCode returns the exit code of the class of the error.
+// An invalid configuration exits like invalid flags.
+func exitCode(err error) int {
+	if isConfigError(err) {
+		return 2
+	}
+	return exitCodes[classifyError(err)]
+}
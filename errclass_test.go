@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassifyError(t *testing.T) {
+	nodes := schema.GroupResource{Resource: "nodes"}
+	for _, tc := range []struct {
+		err   error
+		class string
+		code  int
+	}{
+		{err: errors.New("boom"), class: errorClassOther, code: 1},
+		{err: fmt.Errorf("failed to scan and label: %w", &scanError{scanner: "usb", err: errors.New("libusb: not found")}), class: errorClassScan, code: 3},
+		{err: fmt.Errorf("failed to patch node: %w", apierrors.NewForbidden(nodes, "node1", errors.New("rbac"))), class: errorClassForbidden, code: 4},
+		{err: fmt.Errorf("%w: %w", errNodeNotFound, apierrors.NewNotFound(nodes, "node1")), class: errorClassNodeNotFound, code: 5},
+		{err: apierrors.NewInvalid(schema.GroupKind{Kind: "Node"}, "node1", nil), class: errorClassInvalidLabel, code: 6},
+		{err: fmt.Errorf("%w: key %q", errInvalidLabel, "a/b/c"), class: errorClassInvalidLabel, code: 6},
+	} {
+		assert.Equal(t, tc.class, classifyError(tc.err), tc.err.Error())
+		assert.Equal(t, tc.code, exitCode(tc.err), tc.err.Error())
+	}
+	assert.Equal(t, "scanner usb failed: boom", (&scanError{scanner: "usb", err: errors.New("boom")}).Error())
+}
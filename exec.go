@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	scannerExecs = flag.StringArray("scanner-exec", []string{}, "path to a program that is run on every scan and prints additional labels as lines of <key>=<value> or <key> for true to stdout, e.g. rack=a1, which are sanitized and labeled with the label prefix; it runs with --scan-timeout and the environment variables NUDL_NODE_NAME and NUDL_LABEL_PREFIX; can be repeated")
+
+	execFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nudl_scanner_exec_failures_total",
+			Help: "Number of failed runs of the programs of scanner-exec",
+		},
+		[]string{"program"},
+	)
+)
+
+// validateScannerExecs returns an error if a program of scanner-exec is not an executable file.
+func validateScannerExecs() error {
+	for _, p := range *scannerExecs {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("invalid --scanner-exec: %w", err)
+		}
+		if fi.IsDir() || fi.Mode()&0o111 == 0 {
+			return fmt.Errorf("invalid --scanner-exec: %q is not executable", p)
+		}
+	}
+	return nil
+}
+
+// execLabeler runs the programs of scanner-exec and keeps the labels of their last successful runs.
+// It must not be used concurrently.
+type execLabeler struct {
+	programs []string
+	// last holds the labels of the last successful run of every program.
+	last map[string]labels
+}
+
+func newExecLabeler(programs []string) *execLabeler {
+	return &execLabeler{programs: programs, last: make(map[string]labels)}
+}
+
+// labels runs all programs and returns their labels.
+// A program that fails keeps the labels of its last successful run, so a flaky script does not remove its labels or block the labeling.
+func (el *execLabeler) labels(ctx context.Context, logger log.Logger) labels {
+	l := make(labels)
+	for _, p := range el.programs {
+		pl, err := runExec(ctx, p)
+		if err != nil {
+			execFailuresCounter.WithLabelValues(p).Inc()
+			level.Error(logger).Log("msg", "scanner program failed, keeping its previous labels", "program", p, "err", err)
+		} else {
+			el.last[p] = pl
+		}
+		for k, v := range el.last[p] {
+			l[k] = v
+		}
+	}
+	return l
+}
+
+// runExec runs the program with scan-timeout and parses its labels.
+func runExec(ctx context.Context, program string) (labels, error) {
+	ctx, cancel := context.WithTimeout(ctx, *scanTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, program)
+	cmd.Env = append(os.Environ(), "NUDL_NODE_NAME="+*hostname, "NUDL_LABEL_PREFIX="+*labelPrefix)
+	out, err := cmd.Output()
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) && len(ee.Stderr) > 0 {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return nil, err
+	}
+	return parseExecLabels(out)
+}
+
+// parseExecLabels parses lines of <key>=<value> or <key>, which is labeled with true.
+// Empty lines and lines starting with # are ignored.
+// Keys and values are sanitized like the keys of devices and the values of value-template.
+func parseExecLabels(out []byte) (labels, error) {
+	l := make(labels)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			v = "true"
+		}
+		k = regTrim.ReplaceAllString(strings.TrimSpace(k), "-")
+		if len(k) > maxLabelNameLength {
+			k = k[:maxLabelNameLength]
+		}
+		k = strings.Trim(k, "-_.")
+		if k == "" {
+			return nil, fmt.Errorf("invalid label in line %q", line)
+		}
+		v = regTrim.ReplaceAllString(strings.TrimSpace(v), "-")
+		if len(v) > maxLabelValueLength {
+			v = v[:maxLabelValueLength]
+		}
+		l[sprintLabelKey(k)] = strings.Trim(v, "-_.")
+	}
+	return l, s.Err()
+}
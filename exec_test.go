@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecLabels(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		exp  labels
+		err  bool
+	}{
+		{
+			name: "pairs and flags",
+			out:  "rack=a1\n\n# comment\n  gpu \nrow = 3\n",
+			exp: labels{
+				"nudl.squat.ai/rack": "a1",
+				"nudl.squat.ai/gpu":  "true",
+				"nudl.squat.ai/row":  "3",
+			},
+		},
+		{
+			name: "sanitized",
+			out:  "my rack!=Room 4/B\n",
+			exp:  labels{"nudl.squat.ai/my-rack": "Room-4-B"},
+		},
+		{
+			name: "empty key",
+			out:  "=a1\n",
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := parseExecLabels([]byte(tc.out))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, l)
+		})
+	}
+}
+
+func TestExecLabelerKeepsLabelsOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "detect-rack")
+	require.NoError(t, os.WriteFile(p, []byte("#!/bin/sh\necho rack=a1\necho node=$NUDL_NODE_NAME\n"), 0o755))
+	el := newExecLabeler([]string{p})
+
+	l := el.labels(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "a1", l["nudl.squat.ai/rack"])
+	assert.Contains(t, l, "nudl.squat.ai/node")
+
+	require.NoError(t, os.WriteFile(p, []byte("#!/bin/sh\necho broken >&2\nexit 1\n"), 0o755))
+	_, err := runExec(context.Background(), p)
+	assert.ErrorContains(t, err, "broken")
+	assert.Equal(t, l, el.labels(context.Background(), log.NewNopLogger()))
+}
+
+func TestValidateScannerExecs(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "script")
+	require.NoError(t, os.WriteFile(p, []byte("#!/bin/sh\n"), 0o644))
+	defer func(s []string) { *scannerExecs = s }(*scannerExecs)
+
+	*scannerExecs = []string{p}
+	assert.Error(t, validateScannerExecs())
+	*scannerExecs = []string{dir}
+	assert.Error(t, validateScannerExecs())
+	*scannerExecs = []string{filepath.Join(dir, "missing")}
+	assert.Error(t, validateScannerExecs())
+	require.NoError(t, os.Chmod(p, 0o755))
+	*scannerExecs = []string{p}
+	assert.NoError(t, validateScannerExecs())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var extendedResources = flag.Bool("extended-resources", false, "advertise the number of devices as extended resources in the capacity of the node, e.g. nudl.squat.ai/Arduino-SA_Uno-R3: 2, so pods can request devices without a device plugin")
+
+// extendedResourceCounts returns the number of devices by resource name.
+// If only is set, only those devices are advertised.
+func extendedResourceCounts(ds []device) map[string]int64 {
+	counts := make(map[string]int64, len(ds))
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		counts[sprintLabelKey(d.Key)]++
+	}
+	if len(*only) == 0 {
+		return counts
+	}
+	oc := make(map[string]int64, len(*only))
+	for _, str := range *only {
+		if !isOnlyPattern(str) {
+			str = onlyKey(str, ds)
+		}
+		for k, n := range counts {
+			if onlyMatches(sprintLabelKey(str), k) {
+				oc[k] = n
+			}
+		}
+	}
+	return oc
+}
+
+// capacityPatch returns a strategic merge patch for the status of the node,
+// that sets the extended resources of the devices, if extended-resources is set, and of the rules of rules-file,
+// and removes the extended resources with the label prefix of absent devices.
+// If clean is true, all extended resources with the label prefix are removed.
+// It returns nil if the node does not need to be patched.
+func capacityPatch(node *v1.Node, ds []device, clean bool) ([]byte, error) {
+	desired := make(map[string]int64)
+	if !clean {
+		if *extendedResources {
+			desired = extendedResourceCounts(ds)
+		}
+		for name, n := range ruleResourceCounts(ds) {
+			desired[name] += n
+		}
+	}
+	capacity := make(map[string]*string)
+	for name, n := range desired {
+		if errs := validation.IsQualifiedName(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid extended resource name %q: %s", name, strings.Join(errs, "; "))
+		}
+		if q, ok := node.Status.Capacity[v1.ResourceName(name)]; ok && q.Cmp(*resource.NewQuantity(n, resource.DecimalSI)) == 0 {
+			continue
+		}
+		v := strconv.FormatInt(n, 10)
+		capacity[name] = &v
+	}
+	for name := range node.Status.Capacity {
+		if _, ok := desired[string(name)]; !ok && strings.HasPrefix(string(name), *labelPrefix+"/") {
+			capacity[string(name)] = nil
+		}
+	}
+	if len(capacity) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"capacity": capacity,
+		},
+	})
+}
+
+// advertise updates the extended resources of the node.
+func (lb *labeler) advertise(ctx context.Context, node *v1.Node, ds []device, clean bool, logger log.Logger) error {
+	patch, err := capacityPatch(node, ds, clean)
+	if err != nil {
+		return fmt.Errorf("failed to create capacity patch for node %q: %w", node.Name, err)
+	}
+	if patch == nil {
+		return nil
+	}
+	if _, err := lb.clientset.CoreV1().Nodes().PatchStatus(ctx, node.Name, patch); err != nil {
+		return fmt.Errorf("failed to patch node status: %w", err)
+	}
+	level.Debug(logger).Log("msg", "updated extended resources", "patch", string(patch))
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestCapacityPatch(t *testing.T) {
+	*extendedResources = true
+	t.Cleanup(func() { *extendedResources = false })
+	n := &v1.Node{Status: v1.NodeStatus{Capacity: v1.ResourceList{
+		v1.ResourceCPU:                      resource.MustParse("4"),
+		"nudl.squat.ai/Arduino-SA_Uno-R3":   resource.MustParse("2"),
+		"nudl.squat.ai/Silicon-Labs_CP210x": resource.MustParse("1"),
+		"example.com/not-managed-by-nudl":   resource.MustParse("1"),
+	}}}
+	ds := []device{
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3"},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3"},
+		{ID: "046d_c52b", Key: "Logitech-Inc._Unifying-Receiver"},
+	}
+
+	p, err := capacityPatch(n, ds, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":{"capacity":{"nudl.squat.ai/Logitech-Inc._Unifying-Receiver":"1","nudl.squat.ai/Silicon-Labs_CP210x":null}}}`, string(p))
+
+	p, err = capacityPatch(n, ds[:2], false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":{"capacity":{"nudl.squat.ai/Silicon-Labs_CP210x":null}}}`, string(p))
+
+	p, err = capacityPatch(n, ds, true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":{"capacity":{"nudl.squat.ai/Arduino-SA_Uno-R3":null,"nudl.squat.ai/Silicon-Labs_CP210x":null}}}`, string(p))
+
+	delete(n.Status.Capacity, "nudl.squat.ai/Silicon-Labs_CP210x")
+	p, err = capacityPatch(n, ds[:2], false)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+}
+
+func TestLabelerExtendedResources(t *testing.T) {
+	oldHostname := *hostname
+	*hostname, *extendedResources = "node1", true
+	t.Cleanup(func() { *hostname, *extendedResources = oldHostname, false })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	ds := []device{{ID: "2341_0043", Key: "Arduino-SA_Uno-R3"}, {ID: "2341_0043", Key: "Arduino-SA_Uno-R3"}}
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return ds, nil
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	ctx := context.Background()
+	capacity := func() v1.ResourceList {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return n.Status.Capacity
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	q := capacity()["nudl.squat.ai/Arduino-SA_Uno-R3"]
+	assert.Equal(t, int64(2), q.Value())
+
+	ds = ds[:1]
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	q = capacity()["nudl.squat.ai/Arduino-SA_Uno-R3"]
+	assert.Equal(t, int64(1), q.Value())
+
+	require.NoError(t, lb.cleanUp(ctx, log.NewNopLogger()))
+	assert.NotContains(t, capacity(), v1.ResourceName("nudl.squat.ai/Arduino-SA_Uno-R3"))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// fallbackRejected means that the human readable key is not a valid label key, e.g. because it ends with a replaced character,
+	// so the api server rejects it, unless it is fixed with key-sanitizers or device-names-file.
+	fallbackRejected = "rejected"
+	// fallbackHex means that the human readable key is too long and the hex key is used.
+	fallbackHex = "hex"
+	// fallbackTruncated means that the human readable key is too long and the names are shortened.
+	fallbackTruncated = "truncated"
+	// fallbackHashed means that the human readable key is too long and a hash is appended to a prefix.
+	fallbackHashed = "hashed"
+)
+
+var fallbacksCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nudl_label_key_fallbacks_total",
+		Help: "Number of devices whose human readable label key was rejected or shortened",
+	},
+	[]string{"reason"},
+)
+
+// keyFallback is a device whose human readable label key was rejected or shortened.
+type keyFallback struct {
+	// ID is the hex key of the device, e.g. 10c4_ea60 or pci-8086_1533.
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	// HumanKey is the human readable key before it was rejected or shortened.
+	HumanKey string `json:"humanKey"`
+	// Key is the key that is used instead.
+	Key       string    `json:"key"`
+	Reason    string    `json:"reason"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// fallbacksResult is the response of the fallbacks API.
+type fallbacksResult struct {
+	Node      string        `json:"node"`
+	Fallbacks []keyFallback `json:"fallbacks"`
+}
+
+// fallbackTracker records the devices whose human readable keys were rejected or shortened
+// and serves them on /api/v1/fallbacks, so they can be named in device-names-file.
+// Every device is recorded and counted once.
+type fallbackTracker struct {
+	mu        sync.RWMutex
+	fallbacks map[string]keyFallback
+	now       func() time.Time
+}
+
+func newFallbackTracker() *fallbackTracker {
+	return &fallbackTracker{fallbacks: make(map[string]keyFallback), now: time.Now}
+}
+
+// keyFallbacks are the fallbacks of all generated keys.
+// The keys are generated where the devices are named, which has no access to the labeler.
+var keyFallbacks = newFallbackTracker()
+
+// record records a fallback of the device with the hex key.
+func (t *fallbackTracker) record(hexKey, description, humanKey, key, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.fallbacks[hexKey]; ok && f.Reason == reason && f.HumanKey == humanKey {
+		return
+	}
+	t.fallbacks[hexKey] = keyFallback{ID: hexKey, Description: description, HumanKey: humanKey, Key: key, Reason: reason, FirstSeen: t.now().UTC().Truncate(time.Second)}
+	fallbacksCounter.WithLabelValues(reason).Inc()
+}
+
+// list returns the fallbacks in the order of their ids.
+func (t *fallbackTracker) list() []keyFallback {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	fs := make([]keyFallback, 0, len(t.fallbacks))
+	for _, f := range t.fallbacks {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool { return fs[i].ID < fs[j].ID })
+	return fs
+}
+
+// deviceNames returns the fallbacks of usb devices in the format of device-names-file,
+// with the keys that are used now as a starting point for shorter names.
+func (t *fallbackTracker) deviceNames() map[string]string {
+	names := make(map[string]string)
+	for _, f := range t.list() {
+		vendor, product, ok := strings.Cut(f.ID, "_")
+		if !ok || !regDeviceNameID.MatchString(vendor+":"+product) {
+			continue
+		}
+		names[vendor+":"+product] = f.Key
+	}
+	return names
+}
+
+// ServeHTTP serves the fallbacks as JSON, or with ?format=device-names as a YAML file for device-names-file.
+func (t *fallbackTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fallbacksResult{Node: *hostname, Fallbacks: t.list()})
+	case "device-names":
+		data, err := yaml.Marshal(t.deviceNames())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(data)
+	default:
+		http.Error(w, "unknown format, possible values are: device-names", http.StatusBadRequest)
+	}
+}
+
+// validKey returns true if the key without prefix is a valid label key.
+func validKey(k string) bool {
+	return len(validation.IsQualifiedName(k)) == 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackTracker(t *testing.T) {
+	oldFallbacks, oldHostname := keyFallbacks, *hostname
+	keyFallbacks, *hostname = newFallbackTracker(), "node1"
+	t.Cleanup(func() { keyFallbacks, *hostname = oldFallbacks, oldHostname })
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	keyFallbacks.now = func() time.Time { return now }
+
+	long := strings.Repeat("p", 60)
+	assert.Equal(t, "Arduino-SA_Uno-R3", limitKey("", "Arduino-SA", "Uno-R3", "2341_0043", "Uno R3 (Arduino SA)"))
+	assert.Equal(t, "04f2_b420", limitKey("", "Chicony", long, "04f2_b420", "camera (Chicony)"))
+	assert.Equal(t, "pci-NVIDIA_RTX-", limitKey(pciPrefix, "NVIDIA", "RTX-", "pci-10de_2204", "RTX] (NVIDIA)"))
+	// Every device is recorded once.
+	limitKey("", "Chicony", long, "04f2_b420", "camera (Chicony)")
+	assert.Equal(t, []keyFallback{
+		{ID: "04f2_b420", Description: "camera (Chicony)", HumanKey: "Chicony_" + long, Key: "04f2_b420", Reason: fallbackHex, FirstSeen: now},
+		{ID: "pci-10de_2204", Description: "RTX] (NVIDIA)", HumanKey: "pci-NVIDIA_RTX-", Key: "pci-NVIDIA_RTX-", Reason: fallbackRejected, FirstSeen: now},
+	}, keyFallbacks.list())
+	// Only usb devices can be named in device-names-file.
+	assert.Equal(t, map[string]string{"04f2:b420": "04f2_b420"}, keyFallbacks.deviceNames())
+
+	w := httptest.NewRecorder()
+	keyFallbacks.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/fallbacks", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var res fallbacksResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "node1", res.Node)
+	assert.Len(t, res.Fallbacks, 2)
+
+	w = httptest.NewRecorder()
+	keyFallbacks.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/fallbacks?format=device-names", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "04f2:b420: 04f2_b420\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	keyFallbacks.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/fallbacks?format=csv", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	keyFallbacks.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/fallbacks", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var firmwareLabels = flag.Bool("firmware-labels", false, "add a label <key>.firmware with the lowest device release number (bcdDevice) of the devices of every label, e.g. 1.0.4, so workloads can require a firmware version")
+
+// bcdVersion returns the device release number in the format major.minor.subminor, e.g. 1.0.4 for 0x0104.
+func bcdVersion(b uint16) string {
+	return fmt.Sprintf("%d.%d.%d", (b>>12)*10+(b>>8)&0xf, (b>>4)&0xf, b&0xf)
+}
+
+// lsusbVersion returns the version of a bcdDevice in the output of lsusb, e.g. 1.0.4 for 1.04.
+func lsusbVersion(s string) (string, error) {
+	major, minor, ok := strings.Cut(s, ".")
+	m, err := strconv.Atoi(major)
+	if !ok || err != nil || len(minor) != 2 || minor[0] < '0' || minor[0] > '9' || minor[1] < '0' || minor[1] > '9' {
+		return "", fmt.Errorf("invalid version %q", s)
+	}
+	return fmt.Sprintf("%d.%c.%c", m, minor[0], minor[1]), nil
+}
+
+// versionLess returns true if the version a is lower than b.
+// Unparsable parts are compared as 0.
+func versionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// addFirmwareLabels adds a label <key>.firmware with the lowest version of the devices of every label whose version is known,
+// so a required minimum version holds for every device of the label.
+func addFirmwareLabels(l labels, ds []device) {
+	versions := make(map[string]string)
+	for _, d := range ds {
+		if d.Version == "" || filtered(d) {
+			continue
+		}
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		if v, ok := versions[d.Key]; !ok || versionLess(d.Version, v) {
+			versions[d.Key] = d.Version
+		}
+	}
+	for k, v := range versions {
+		l[sprintLabelKey(suffixKey(k, ".firmware"))] = v
+	}
+}
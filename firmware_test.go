@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBCDVersion(t *testing.T) {
+	assert.Equal(t, "1.0.4", bcdVersion(0x0104))
+	assert.Equal(t, "12.0.3", bcdVersion(0x1203))
+	assert.Equal(t, "0.0.0", bcdVersion(0))
+
+	v, err := lsusbVersion("1.04")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.4", v)
+	_, err = lsusbVersion("1.4")
+	assert.Error(t, err)
+
+	assert.True(t, versionLess("1.0.4", "1.1.0"))
+	assert.True(t, versionLess("2.0.0", "10.0.0"))
+	assert.False(t, versionLess("1.0.4", "1.0.4"))
+}
+
+func TestAddFirmwareLabels(t *testing.T) {
+	ds := []device{
+		{ID: "10c4_ea60", Key: "CP210x", Version: "1.0.4"},
+		{ID: "10c4_ea60", Key: "CP210x", Version: "1.0.0"},
+		{ID: "2341_0043", Key: "Arduino", Version: "0.0.1"},
+		{ID: "046d_c52b", Key: "Receiver"},
+	}
+	l := labels{
+		"nudl.squat.ai/CP210x":   "2",
+		"nudl.squat.ai/Arduino":  "false",
+		"nudl.squat.ai/Receiver": "true",
+	}
+	addFirmwareLabels(l, ds)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/CP210x":          "2",
+		"nudl.squat.ai/CP210x.firmware": "1.0.0",
+		"nudl.squat.ai/Arduino":         "false",
+		"nudl.squat.ai/Receiver":        "true",
+	}, l)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var inventoryAnnotation = flag.Bool("inventory-annotation", false, "annotate the node with a compact JSON inventory of the devices with their names, ids and the time they were first seen, e.g. for fleet dashboards")
+
+// inventoryEntry is a device in the inventory annotation and the inventory API.
+type inventoryEntry struct {
+	Name      string    `json:"name"`
+	ID        string    `json:"id"`
+	Port      string    `json:"port,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// nodeInventory is the response of the inventory API.
+type nodeInventory struct {
+	Node    string           `json:"node"`
+	Devices []inventoryEntry `json:"devices"`
+}
+
+// inventoryAnnotationKey returns the key of the annotation that holds the inventory.
+func inventoryAnnotationKey() string {
+	return sprintLabelKey("inventory")
+}
+
+// firstSeenKey identifies a device across scans by its id and port.
+func firstSeenKey(id, port string) string {
+	return id + "@" + port
+}
+
+// firstSeenTracker records when the devices that are not filtered were seen for the first time
+// and serves them as the inventory on /api/v1/inventory.
+// A device that is removed and attached again is seen for the first time again.
+type firstSeenTracker struct {
+	mu      sync.RWMutex
+	seen    map[string]time.Time
+	entries []inventoryEntry
+	// restored is true once the times were restored from the annotation of the node.
+	restored bool
+}
+
+func newFirstSeenTracker() *firstSeenTracker {
+	return &firstSeenTracker{seen: make(map[string]time.Time)}
+}
+
+// update records the devices of a scan.
+func (t *firstSeenTracker) update(ds []device, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen := make(map[string]time.Time, len(ds))
+	entries := make([]inventoryEntry, 0, len(ds))
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		k := firstSeenKey(d.ID, d.Port)
+		fs, ok := t.seen[k]
+		if !ok {
+			fs = now.UTC().Truncate(time.Second)
+		}
+		seen[k] = fs
+		name := d.Description
+		if name == "" {
+			name = d.Key
+		}
+		entries = append(entries, inventoryEntry{Name: name, ID: d.ID, Port: d.Port, FirstSeen: fs})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].ID != entries[j].ID {
+			return entries[i].ID < entries[j].ID
+		}
+		return entries[i].Port < entries[j].Port
+	})
+	t.seen, t.entries = seen, entries
+}
+
+// restore sets the first seen times of the attached devices to the earlier times in the annotation,
+// so the times survive a restart of nudl.
+// The annotation is only read once, because it still holds the devices that were removed since.
+func (t *firstSeenTracker) restore(annotation string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.restored {
+		return
+	}
+	t.restored = true
+	var entries []inventoryEntry
+	if json.Unmarshal([]byte(annotation), &entries) != nil {
+		return
+	}
+	for _, e := range entries {
+		k := firstSeenKey(e.ID, e.Port)
+		if fs, ok := t.seen[k]; ok && e.FirstSeen.Before(fs) {
+			t.seen[k] = e.FirstSeen
+		}
+	}
+	for i, e := range t.entries {
+		t.entries[i].FirstSeen = t.seen[firstSeenKey(e.ID, e.Port)]
+	}
+}
+
+// inventory returns the devices of the last scan.
+func (t *firstSeenTracker) inventory() []inventoryEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]inventoryEntry(nil), t.entries...)
+}
+
+func (t *firstSeenTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodeInventory{Node: *hostname, Devices: t.inventory()})
+}
+
+// inventoryAnnotations returns the annotations to patch.
+// The annotation is deleted if inventory-annotation is not set or the node is cleaned up.
+func (t *firstSeenTracker) inventoryAnnotations(current map[string]string, clean bool) (map[string]*string, error) {
+	k := inventoryAnnotationKey()
+	v, exists := current[k]
+	if !*inventoryAnnotation || clean {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	t.restore(v)
+	data, err := json.Marshal(t.inventory())
+	if err != nil {
+		return nil, err
+	}
+	if v == string(data) {
+		return nil, nil
+	}
+	s := string(data)
+	return map[string]*string{k: &s}, nil
+}
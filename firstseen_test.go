@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirstSeenTracker(t *testing.T) {
+	oldHostname, oldNoContain, oldAnnotation := *hostname, *noContain, *inventoryAnnotation
+	*hostname, *noContain, *inventoryAnnotation = "node1", []string{"hub"}, true
+	t.Cleanup(func() { *hostname, *noContain, *inventoryAnnotation = oldHostname, oldNoContain, oldAnnotation })
+
+	arduino := device{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)", Port: "1-2"}
+	hub := device{ID: "1d6b_0002", Key: "Linux-Foundation_2.0-root-hub", Description: "2.0 root hub (Linux Foundation)"}
+	receiver := device{ID: "046d_c52b", Key: "Logitech_Receiver", Port: "1-3"}
+	t1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	tr := newFirstSeenTracker()
+	tr.update([]device{arduino, hub}, t1)
+	tr.update([]device{arduino, hub, receiver}, t2)
+	assert.Equal(t, []inventoryEntry{
+		{Name: "Logitech_Receiver", ID: "046d_c52b", Port: "1-3", FirstSeen: t2},
+		{Name: "Uno R3 (Arduino SA)", ID: "2341_0043", Port: "1-2", FirstSeen: t1},
+	}, tr.inventory())
+
+	// A device that was removed is seen for the first time again.
+	tr.update([]device{receiver}, t2)
+	tr.update([]device{arduino, receiver}, t2)
+	assert.Equal(t, t2, tr.inventory()[1].FirstSeen)
+
+	// Earlier times in the annotation are restored once.
+	a, err := tr.inventoryAnnotations(map[string]string{
+		inventoryAnnotationKey(): `[{"name":"Uno R3 (Arduino SA)","id":"2341_0043","port":"1-2","firstSeen":"2024-05-01T12:00:00Z"}]`,
+	}, false)
+	require.NoError(t, err)
+	require.Contains(t, a, inventoryAnnotationKey())
+	assert.JSONEq(t, `[
+		{"name":"Logitech_Receiver","id":"046d_c52b","port":"1-3","firstSeen":"2024-05-01T13:00:00Z"},
+		{"name":"Uno R3 (Arduino SA)","id":"2341_0043","port":"1-2","firstSeen":"2024-05-01T12:00:00Z"}
+	]`, *a[inventoryAnnotationKey()])
+	a, err = tr.inventoryAnnotations(map[string]string{inventoryAnnotationKey(): *a[inventoryAnnotationKey()]}, false)
+	require.NoError(t, err)
+	assert.Empty(t, a)
+
+	a, err = tr.inventoryAnnotations(map[string]string{inventoryAnnotationKey(): "[]"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{inventoryAnnotationKey(): nil}, a)
+
+	w := httptest.NewRecorder()
+	tr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/inventory", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"node":"node1","devices":[
+		{"name":"Logitech_Receiver","id":"046d_c52b","port":"1-3","firstSeen":"2024-05-01T13:00:00Z"},
+		{"name":"Uno R3 (Arduino SA)","id":"2341_0043","port":"1-2","firstSeen":"2024-05-01T12:00:00Z"}
+	]}`, w.Body.String())
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var fixtureFile = flag.String("fixture-file", "", "JSON file with the devices and the timed attach and detach steps, or the output of lsusb or lsusb -v, for --scanner=fixture")
+
+// fixtureDevice is a device in a fixture file identified by its hexadecimal vendor and product id.
+type fixtureDevice struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	// Description is the name of the device in the format of usb.ids, e.g. "Unifying Receiver (Logitech, Inc.)".
+	// By default, the device is named with the usb.ids of nudl.
+	Description string `json:"description,omitempty"`
+	// Serial is the serial number, if it is known.
+	Serial string `json:"serial,omitempty"`
+	// Class is the device class in hex, e.g. ef, if it is known.
+	Class string `json:"class,omitempty"`
+	// Classes are the sorted class and subclass pairs of the device and its interfaces in hex, e.g. 03:01, if they are known.
+	Classes []string `json:"classes,omitempty"`
+	// Port is the port path, e.g. 1-2.3, Speed is the negotiated speed, e.g. high,
+	// and Drivers are the kernel drivers of the interfaces, if they are known.
+	Port    string   `json:"port,omitempty"`
+	Speed   string   `json:"speed,omitempty"`
+	Drivers []string `json:"drivers,omitempty"`
+	// Version is the device release number, e.g. 1.0.4, if it is known.
+	Version string `json:"version,omitempty"`
+}
+
+// fixtureStep attaches and detaches devices after a duration since the start of the scanner.
+type fixtureStep struct {
+	After  string          `json:"after"`
+	Attach []fixtureDevice `json:"attach"`
+	Detach []fixtureDevice `json:"detach"`
+
+	after time.Duration
+}
+
+// fixture is the content of a fixture file.
+type fixture struct {
+	// Devices are attached from the start.
+	Devices []fixtureDevice `json:"devices"`
+	// Steps are applied in the order of their durations.
+	Steps []fixtureStep `json:"steps"`
+}
+
+// fixtureScanner returns the devices of a fixture instead of scanning real hardware,
+// so the whole pipeline can be tested and demonstrated without devices.
+type fixtureScanner struct {
+	fixture fixture
+	start   time.Time
+}
+
+// newFixtureScanner reads and validates a fixture file.
+// A file that is not JSON is parsed as the output of lsusb, so the devices of bug reports can be replayed.
+func newFixtureScanner(path string) (*fixtureScanner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read fixture file: %w", err)
+	}
+	var f fixture
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("could not parse fixture file: %w", err)
+		}
+	} else if f.Devices, err = parseLsusb(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("could not parse fixture file: %w", err)
+	}
+	ds := append([]fixtureDevice{}, f.Devices...)
+	for i := range f.Steps {
+		if f.Steps[i].after, err = time.ParseDuration(f.Steps[i].After); err != nil {
+			return nil, fmt.Errorf("step %d has an invalid duration: %w", i, err)
+		}
+		ds = append(ds, f.Steps[i].Attach...)
+		ds = append(ds, f.Steps[i].Detach...)
+	}
+	for _, d := range ds {
+		if _, err := d.id(); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(f.Steps, func(i, j int) bool {
+		return f.Steps[i].after < f.Steps[j].after
+	})
+	return &fixtureScanner{fixture: f, start: time.Now()}, nil
+}
+
+func (*fixtureScanner) Name() string {
+	return "fixture"
+}
+
+// Scan returns the devices that are attached at the time of the scan.
+// A detach step removes one device with the given ids, if there is one.
+func (s *fixtureScanner) Scan(_ context.Context) ([]device, error) {
+	attached := append([]fixtureDevice{}, s.fixture.Devices...)
+	elapsed := time.Since(s.start)
+	for _, st := range s.fixture.Steps {
+		if st.after > elapsed {
+			break
+		}
+		attached = append(attached, st.Attach...)
+		for _, d := range st.Detach {
+			for i := range attached {
+				if attached[i].Vendor == d.Vendor && attached[i].Product == d.Product {
+					attached = append(attached[:i], attached[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	ds := make([]device, 0, len(attached))
+	for _, d := range attached {
+		id, err := d.id()
+		if err != nil {
+			return nil, err
+		}
+		n := lookupName(id)
+		if d.Description != "" {
+			n = deviceName{description: d.Description, key: sanitizeKey(id, d.Description)}
+		}
+		fd := device{
+			ID:          id.String(),
+			Key:         n.key,
+			Description: n.description,
+			Serial:      d.Serial,
+			Class:       d.Class,
+			Classes:     d.Classes,
+			Port:        d.Port,
+			Speed:       d.Speed,
+			Drivers:     d.Drivers,
+			Version:     d.Version,
+		}
+		if *includeSerial && d.Serial != "" {
+			fd.Key = serialKey(fd.Key, d.Serial)
+		}
+		ds = append(ds, fd)
+	}
+	return ds, nil
+}
+
+// regLsusbDevice matches the first line of a device in the output of lsusb, e.g. "Bus 001 Device 002: ID 046d:c52b Logitech, Inc. Unifying Receiver".
+var regLsusbDevice = regexp.MustCompile(`^Bus [0-9]+ Device [0-9]+: ID ([0-9a-fA-F]{4}):([0-9a-fA-F]{4})`)
+
+// parseLsusb returns the devices in the output of lsusb.
+// The verbose output of lsusb -v additionally contains the serial numbers, the versions and the classes of the devices and their interfaces.
+func parseLsusb(r io.Reader) ([]fixtureDevice, error) {
+	var ds []fixtureDevice
+	// pairs are the classes of the current device, the first pair is the class of the device.
+	var pairs [][2]uint8
+	var iface bool
+	finish := func() {
+		if len(ds) > 0 && len(pairs) > 0 {
+			ds[len(ds)-1].Class = fmt.Sprintf("%02x", pairs[0][0])
+			ds[len(ds)-1].Classes = formatClasses(pairs)
+		}
+		pairs, iface = nil, false
+	}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if m := regLsusbDevice.FindStringSubmatch(line); m != nil {
+			finish()
+			ds = append(ds, fixtureDevice{Vendor: strings.ToLower(m[1]), Product: strings.ToLower(m[2])})
+			continue
+		}
+		if len(ds) == 0 {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "bDeviceClass", "bInterfaceClass":
+			c, err := strconv.ParseUint(fields[1], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid class in line %q: %w", line, err)
+			}
+			iface = fields[0] == "bInterfaceClass"
+			if !iface && len(pairs) > 0 {
+				continue
+			}
+			pairs = append(pairs, [2]uint8{uint8(c), 0})
+		case "bDeviceSubClass", "bInterfaceSubClass":
+			c, err := strconv.ParseUint(fields[1], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subclass in line %q: %w", line, err)
+			}
+			if len(pairs) > 0 && (fields[0] == "bInterfaceSubClass") == iface {
+				pairs[len(pairs)-1][1] = uint8(c)
+			}
+		case "bcdDevice":
+			v, err := lsusbVersion(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid bcdDevice in line %q: %w", line, err)
+			}
+			ds[len(ds)-1].Version = v
+		case "iSerial":
+			if len(fields) > 2 {
+				ds[len(ds)-1].Serial = strings.Join(fields[2:], " ")
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+	if len(ds) == 0 {
+		return nil, errors.New("no devices found in the output of lsusb")
+	}
+	return ds, nil
+}
+
+// id returns the vendor and product id of the fixture device.
+func (d fixtureDevice) id() (deviceID, error) {
+	vendor, err := strconv.ParseUint(d.Vendor, 16, 16)
+	if err != nil {
+		return deviceID{}, fmt.Errorf("invalid vendor id %q: %w", d.Vendor, err)
+	}
+	product, err := strconv.ParseUint(d.Product, 16, 16)
+	if err != nil {
+		return deviceID{}, fmt.Errorf("invalid product id %q: %w", d.Product, err)
+	}
+	return deviceID{vendor: usbID(vendor), product: usbID(product)}, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestFixtureScanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "devices": [{"vendor": "046d", "product": "c52b"}],
+  "steps": [
+    {"after": "1h", "detach": [{"vendor": "0781", "product": "5581"}]},
+    {"after": "1m", "attach": [{"vendor": "0781", "product": "5581"}], "detach": [{"vendor": "046d", "product": "c52b"}]}
+  ]
+}`), 0o644))
+	s, err := newFixtureScanner(path)
+	require.NoError(t, err)
+
+	ids := func() []string {
+		ds, err := s.Scan(context.Background())
+		require.NoError(t, err)
+		ids := make([]string, 0, len(ds))
+		for _, d := range ds {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"046d_c52b"}, ids())
+	s.start = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, []string{"0781_5581"}, ids())
+	s.start = time.Now().Add(-2 * time.Hour)
+	assert.Empty(t, ids())
+}
+
+func TestFixtureScannerInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"json":     `[`,
+		"lsusb":    `no devices`,
+		"vendor":   `{"devices": [{"vendor": "xyz", "product": "c52b"}]}`,
+		"duration": `{"steps": [{"after": "soon"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "devices.json")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+			_, err := newFixtureScanner(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// testLsusb is an excerpt of the output of lsusb -v.
+const testLsusb = `
+Bus 001 Device 001: ID 1d6b:0002 Linux Foundation 2.0 root hub
+Device Descriptor:
+  bLength                18
+  bDeviceClass            9 Hub
+  bDeviceSubClass         0
+  bDeviceProtocol         1 Single TT
+  idVendor           0x1d6b Linux Foundation
+  iSerial                 1 0000:00:14.0
+    Interface Descriptor:
+      bInterfaceClass         9 Hub
+      bInterfaceSubClass      0
+Bus 001 Device 003: ID 046d:c52b Logitech, Inc. Unifying Receiver
+Device Descriptor:
+  bDeviceClass            0
+  bDeviceSubClass         0
+  bcdDevice           12.03
+  iSerial                 0
+    Interface Descriptor:
+      bInterfaceClass         3 Human Interface Device
+      bInterfaceSubClass      1 Boot Interface Subclass
+    Interface Descriptor:
+      bInterfaceClass         3 Human Interface Device
+      bInterfaceSubClass      0
+`
+
+func TestParseLsusb(t *testing.T) {
+	ds, err := parseLsusb(strings.NewReader(testLsusb))
+	require.NoError(t, err)
+	assert.Equal(t, []fixtureDevice{
+		{Vendor: "1d6b", Product: "0002", Serial: "0000:00:14.0", Class: "09", Classes: []string{"09:00"}},
+		{Vendor: "046d", Product: "c52b", Class: "00", Classes: []string{"00:00", "03:00", "03:01"}, Version: "12.0.3"},
+	}, ds)
+
+	ds, err = parseLsusb(strings.NewReader("Bus 002 Device 004: ID 0781:5581 SanDisk Corp. Ultra\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []fixtureDevice{{Vendor: "0781", Product: "5581"}}, ds)
+}
+
+// TestLabelerLsusb labels a node with the devices of a bug report without hardware.
+func TestLabelerLsusb(t *testing.T) {
+	if !libusbAvailable {
+		t.Skip("the embedded usb.ids needs cgo")
+	}
+	oldHostname, oldClasses := *hostname, *classes
+	*hostname, *classes = "node1", []string{"hid"}
+	t.Cleanup(func() { *hostname, *classes = oldHostname, oldClasses })
+
+	path := filepath.Join(t.TempDir(), "lsusb.txt")
+	require.NoError(t, os.WriteFile(path, []byte(testLsusb), 0o644))
+	s, err := newFixtureScanner(path)
+	require.NoError(t, err)
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	ctx := context.Background()
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	// The hub is not a hid device.
+	assert.Equal(t, map[string]string{"nudl.squat.ai/Logitech--Inc._Unifying-Receiver": "true"}, n.Labels)
+}
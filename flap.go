@@ -0,0 +1,97 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+)
+
+var (
+	flapThreshold = flag.Int("flap-threshold", 0, "number of times a device must appear or disappear within flap-window to be labeled with <key>.flapping=true, e.g. because of a faulty cable; 0 disables the flap detection")
+	flapWindow    = flag.Duration("flap-window", 10*time.Minute, "time window in which the appearances and disappearances of a device are counted for flap-threshold")
+)
+
+var deviceFlappingGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "nudl_device_flapping",
+		Help: "1 if a device appeared or disappeared more than flap-threshold times within flap-window, 0 otherwise",
+	},
+	[]string{"key"},
+)
+
+// flapDetector tracks the presence of the devices over time and detects devices that flap.
+// A flapDetector must not be used concurrently.
+type flapDetector struct {
+	clock clock.PassiveClock
+	// present are the keys of the devices that were present in the previous scan, nil before the first scan.
+	present map[string]bool
+	// changes are the times when the devices appeared or disappeared within the window.
+	changes map[string][]time.Time
+}
+
+func newFlapDetector(c clock.PassiveClock) *flapDetector {
+	return &flapDetector{clock: c, changes: make(map[string][]time.Time)}
+}
+
+// update records the devices that appeared or disappeared since the previous scan.
+func (f *flapDetector) update(ds []device) {
+	if *flapThreshold <= 0 {
+		return
+	}
+	now := f.clock.Now()
+	present := make(map[string]bool, len(ds))
+	for _, d := range ds {
+		if !filtered(d) {
+			present[d.Key] = true
+		}
+	}
+	if f.present != nil {
+		for k := range present {
+			if !f.present[k] {
+				f.changes[k] = append(f.changes[k], now)
+			}
+		}
+		for k := range f.present {
+			if !present[k] {
+				f.changes[k] = append(f.changes[k], now)
+			}
+		}
+	}
+	f.present = present
+	for k, ts := range f.changes {
+		i := 0
+		for i < len(ts) && now.Sub(ts[i]) > *flapWindow {
+			i++
+		}
+		if i == len(ts) {
+			delete(f.changes, k)
+			deviceFlappingGauge.WithLabelValues(k).Set(0)
+			continue
+		}
+		f.changes[k] = ts[i:]
+	}
+	for k, ts := range f.changes {
+		v := 0.0
+		if len(ts) > *flapThreshold {
+			v = 1
+		}
+		deviceFlappingGauge.WithLabelValues(k).Set(v)
+	}
+}
+
+// labels returns the label <key>.flapping=true for every device that appeared or disappeared
+// more than flap-threshold times within flap-window.
+func (f *flapDetector) labels() labels {
+	l := make(labels)
+	if *flapThreshold <= 0 {
+		return l
+	}
+	for k, ts := range f.changes {
+		if len(ts) > *flapThreshold {
+			l[sprintLabelKey(suffixKey(k, ".flapping"))] = "true"
+		}
+	}
+	return l
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestFlapDetector(t *testing.T) {
+	*flapThreshold = 2
+	defer func() { *flapThreshold = 0 }()
+	c := testclock.NewFakePassiveClock(time.Now())
+	f := newFlapDetector(c)
+	uno := []device{{ID: "2341_0043", Key: "Arduino-SA_Uno-R3"}}
+	both := append([]device{{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x"}}, uno...)
+
+	f.update(both)
+	assert.Empty(t, f.labels())
+	for i, ds := range [][]device{uno, both, uno} {
+		c.SetTime(c.Now().Add(time.Minute))
+		f.update(ds)
+		if i < 2 {
+			assert.Empty(t, f.labels())
+		}
+	}
+	assert.Equal(t, labels{"nudl.squat.ai/Silicon-Labs_CP210x.flapping": "true"}, f.labels())
+
+	// The label is removed, when the changes are older than the window.
+	c.SetTime(c.Now().Add(*flapWindow - 3*time.Minute))
+	f.update(uno)
+	assert.Equal(t, labels{"nudl.squat.ai/Silicon-Labs_CP210x.flapping": "true"}, f.labels())
+	c.SetTime(c.Now().Add(2 * time.Minute))
+	f.update(uno)
+	assert.Empty(t, f.labels())
+}
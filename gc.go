@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	gcOnStart = flag.Bool("gc-on-start", false, "on the first labeling of a node, also remove the annotations with the label prefix that nudl does not write anymore, e.g. of a crashed instance with a different configuration or an older version, and log every removed label and annotation")
+	gcDryRun  = flag.Bool("gc-dry-run", false, "only log the annotations that gc-on-start would remove")
+)
+
+// knownAnnotationKeys returns the keys of all annotations with the label prefix that nudl writes to nodes.
+func knownAnnotationKeys() []string {
+	return append(managedAnnotationKeys(), cordonAnnotation(), taintsAnnotation())
+}
+
+// orphanedAnnotations returns the sorted keys of the annotations with a managed prefix that nudl does not write.
+// Preserved keys are never orphaned.
+func orphanedAnnotations(current map[string]string) []string {
+	known := knownAnnotationKeys()
+	var orphans []string
+	for k := range current {
+		if managedPrefix(k) && !preserved(k) && !slices.Contains(known, k) {
+			orphans = append(orphans, k)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// staleLabels returns the sorted keys of the labels with a managed prefix that are not in the new labels.
+func staleLabels(current map[string]string, nl labels) []string {
+	var stale []string
+	for k := range filter(current) {
+		if _, ok := nl[k]; !ok {
+			stale = append(stale, k)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// gcAnnotations returns the annotations to delete on the first labeling of a node, if gc-on-start is set,
+// and logs the labels and annotations that are removed.
+// Stale labels are always removed by the labeling, they are only logged.
+func gcAnnotations(current map[string]string, currentLabels map[string]string, nl labels, logger log.Logger) map[string]*string {
+	orphans := orphanedAnnotations(current)
+	stale := staleLabels(currentLabels, nl)
+	if len(orphans) == 0 && len(stale) == 0 {
+		level.Info(logger).Log("msg", "garbage collection found no stale labels or annotations")
+		return nil
+	}
+	if *gcDryRun {
+		level.Info(logger).Log("msg", "garbage collection would remove stale annotations, stale labels are removed by the labeling", "annotations", strings.Join(orphans, ","), "labels", strings.Join(stale, ","))
+		return nil
+	}
+	level.Info(logger).Log("msg", "garbage collection removes stale labels and annotations", "annotations", strings.Join(orphans, ","), "labels", strings.Join(stale, ","))
+	na := make(map[string]*string, len(orphans))
+	for _, k := range orphans {
+		na[k] = nil
+	}
+	return na
+}
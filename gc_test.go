@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestLabelerGCOnStart(t *testing.T) {
+	oldHostname, oldGC, oldDryRun := *hostname, *gcOnStart, *gcDryRun
+	*hostname, *gcOnStart, *gcDryRun = "node1", true, true
+	t.Cleanup(func() { *hostname, *gcOnStart, *gcDryRun = oldHostname, oldGC, oldDryRun })
+
+	annotations := map[string]string{
+		"nudl.squat.ai/old-feature": "x",
+		"other.io/annotation":       "y",
+		cordonAnnotation():          "Arduino",
+	}
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node1",
+		Labels:      map[string]string{"nudl.squat.ai/Receiver": "true"},
+		Annotations: annotations,
+	}})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "2341_0043", Key: "Arduino"}}, nil
+	}}
+	assert.Equal(t, []string{"nudl.squat.ai/old-feature"}, orphanedAnnotations(annotations))
+
+	ctx := context.Background()
+	get := func() *v1.Node {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return n
+	}
+	// A dry run only logs the orphaned annotations, stale labels are removed anyway.
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(metav1.Now().Time), nil, s)
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, map[string]string{"nudl.squat.ai/Arduino": "true"}, get().Labels)
+	assert.Contains(t, get().Annotations, "nudl.squat.ai/old-feature")
+
+	// The same instance labels the node again, as if it was restarted.
+	*gcDryRun = false
+	id := lb.id
+	lb = newLabeler(clientset, testclock.NewFakePassiveClock(metav1.Now().Time), nil, s)
+	lb.id = id
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.NotContains(t, get().Annotations, "nudl.squat.ai/old-feature")
+	assert.Equal(t, "y", get().Annotations["other.io/annotation"])
+	assert.Equal(t, "Arduino", get().Annotations[cordonAnnotation()])
+	assert.True(t, lb.collected["node1"])
+}
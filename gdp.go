@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/yaml"
+)
+
+// gdpConfigMapKey is the key of the generic-device-plugin configuration in the ConfigMap.
+const gdpConfigMapKey = "config.yaml"
+
+var (
+	gdpFile      = flag.String("generic-device-plugin-file", "", "path of a generic-device-plugin configuration file that is rendered with a device for every labeled usb device, selected by its vendor and product id")
+	gdpConfigMap = flag.String("generic-device-plugin-configmap", "", "name of a ConfigMap in --generic-device-plugin-namespace that the devices of all nodes are added to as generic-device-plugin configuration under the key "+gdpConfigMapKey)
+	gdpNamespace = flag.String("generic-device-plugin-namespace", "default", "namespace of the generic-device-plugin ConfigMap")
+)
+
+// gdpConfig is the configuration of the generic-device-plugin.
+type gdpConfig struct {
+	Devices []gdpDevice `json:"devices"`
+}
+
+// gdpDevice is a device of the generic-device-plugin, which is advertised as the resource squat.ai/<name>.
+type gdpDevice struct {
+	Name   string     `json:"name"`
+	Groups []gdpGroup `json:"groups"`
+}
+
+// gdpGroup is a group of devices that are allocated together.
+type gdpGroup struct {
+	USB []gdpUSBSpec `json:"usb"`
+}
+
+// gdpUSBSpec selects usb devices by their vendor and product id.
+type gdpUSBSpec struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+}
+
+// gdpDevices returns a device for every key of the usb devices that are not filtered, sorted by name.
+// Every usb device with the key is a group, so it can be allocated on its own.
+func gdpDevices(ds []device) []gdpDevice {
+	specs := make(map[string]map[gdpUSBSpec]struct{})
+	for _, d := range ds {
+		if filtered(d) || !isUSB(d) {
+			continue
+		}
+		vendor, product, ok := vendorProduct(d)
+		if !ok {
+			continue
+		}
+		if specs[d.Key] == nil {
+			specs[d.Key] = make(map[gdpUSBSpec]struct{})
+		}
+		specs[d.Key][gdpUSBSpec{Vendor: vendor, Product: product}] = struct{}{}
+	}
+	gds := make([]gdpDevice, 0, len(specs))
+	for k, set := range specs {
+		gds = append(gds, newGDPDevice(k, set))
+	}
+	sort.Slice(gds, func(i, j int) bool { return gds[i].Name < gds[j].Name })
+	return gds
+}
+
+func newGDPDevice(name string, set map[gdpUSBSpec]struct{}) gdpDevice {
+	gd := gdpDevice{Name: name}
+	for s := range set {
+		gd.Groups = append(gd.Groups, gdpGroup{USB: []gdpUSBSpec{s}})
+	}
+	sort.Slice(gd.Groups, func(i, j int) bool {
+		a, b := gd.Groups[i].USB[0], gd.Groups[j].USB[0]
+		return a.Vendor+a.Product < b.Vendor+b.Product
+	})
+	return gd
+}
+
+// mergeGDPDevices adds the devices to the configuration.
+// The selectors of devices with the same name are merged, devices of other nodes are kept.
+func mergeGDPDevices(c gdpConfig, gds []gdpDevice) gdpConfig {
+	specs := make(map[string]map[gdpUSBSpec]struct{})
+	for _, gd := range append(c.Devices, gds...) {
+		if specs[gd.Name] == nil {
+			specs[gd.Name] = make(map[gdpUSBSpec]struct{})
+		}
+		for _, g := range gd.Groups {
+			for _, s := range g.USB {
+				specs[gd.Name][s] = struct{}{}
+			}
+		}
+	}
+	merged := gdpConfig{Devices: make([]gdpDevice, 0, len(specs))}
+	for name, set := range specs {
+		merged.Devices = append(merged.Devices, newGDPDevice(name, set))
+	}
+	sort.Slice(merged.Devices, func(i, j int) bool { return merged.Devices[i].Name < merged.Devices[j].Name })
+	return merged
+}
+
+// gdpPublisher renders the generic-device-plugin configuration for the devices of the node
+// into a file and adds them to a ConfigMap.
+type gdpPublisher struct {
+	clientset kubernetes.Interface
+	// last is the configuration that was written to the file.
+	last []byte
+}
+
+func newGDPPublisher(config *rest.Config) (*gdpPublisher, error) {
+	p := &gdpPublisher{}
+	if *gdpConfigMap == "" {
+		return p, nil
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kubernetes clientset: %w", err)
+	}
+	p.clientset = clientset
+	return p, nil
+}
+
+func (*gdpPublisher) Name() string {
+	return "generic-device-plugin"
+}
+
+func (p *gdpPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	gds := gdpDevices(inv.Devices)
+	if *gdpFile != "" {
+		if err := p.writeFile(gds); err != nil {
+			return err
+		}
+	}
+	if *gdpConfigMap != "" {
+		return p.updateConfigMap(ctx, gds)
+	}
+	return nil
+}
+
+// writeFile replaces the file, if the configuration changed.
+func (p *gdpPublisher) writeFile(gds []gdpDevice) error {
+	data, err := yaml.Marshal(gdpConfig{Devices: gds})
+	if err != nil {
+		return fmt.Errorf("could not marshal generic-device-plugin configuration: %w", err)
+	}
+	if bytes.Equal(data, p.last) {
+		return nil
+	}
+	if err := writeFileAtomic(*gdpFile, data); err != nil {
+		return err
+	}
+	p.last = data
+	return nil
+}
+
+// updateConfigMap adds the devices to the ConfigMap, which is created if it does not exist.
+// Devices are never removed, because they can be attached to other nodes;
+// the generic-device-plugin advertises no devices for selectors that do not match.
+func (p *gdpPublisher) updateConfigMap(ctx context.Context, gds []gdpDevice) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := p.clientset.CoreV1().ConfigMaps(*gdpNamespace).Get(ctx, *gdpConfigMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			data, err := yaml.Marshal(mergeGDPDevices(gdpConfig{}, gds))
+			if err != nil {
+				return fmt.Errorf("could not marshal generic-device-plugin configuration: %w", err)
+			}
+			cm = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: *gdpConfigMap, Namespace: *gdpNamespace},
+				Data:       map[string]string{gdpConfigMapKey: string(data)},
+			}
+			if _, err := p.clientset.CoreV1().ConfigMaps(*gdpNamespace).Create(ctx, cm, metav1.CreateOptions{FieldManager: fieldManager}); err != nil {
+				return fmt.Errorf("could not create generic-device-plugin ConfigMap: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not get generic-device-plugin ConfigMap: %w", err)
+		}
+		var c gdpConfig
+		if err := yaml.Unmarshal([]byte(cm.Data[gdpConfigMapKey]), &c); err != nil {
+			return fmt.Errorf("could not parse generic-device-plugin configuration in ConfigMap %q: %w", *gdpConfigMap, err)
+		}
+		data, err := yaml.Marshal(mergeGDPDevices(c, gds))
+		if err != nil {
+			return fmt.Errorf("could not marshal generic-device-plugin configuration: %w", err)
+		}
+		if cm.Data[gdpConfigMapKey] == string(data) {
+			return nil
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string, 1)
+		}
+		cm.Data[gdpConfigMapKey] = string(data)
+		if _, err := p.clientset.CoreV1().ConfigMaps(*gdpNamespace).Update(ctx, cm, metav1.UpdateOptions{FieldManager: fieldManager}); err != nil {
+			return fmt.Errorf("could not update generic-device-plugin ConfigMap: %w", err)
+		}
+		return nil
+	})
+}
+
+func (*gdpPublisher) PublishEvents(_ context.Context, _ []event) error {
+	return nil
+}
+
+// Close keeps the configuration, so the generic-device-plugin keeps advertising the devices while nudl restarts.
+func (*gdpPublisher) Close() error {
+	return nil
+}
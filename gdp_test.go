@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGDPDevices(t *testing.T) {
+	ds := []device{
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3"},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3"},
+		{ID: "2341_0001", Key: "Arduino-SA_Uno-R3"},
+		{ID: "10c4_ea60", Key: "CP2102"},
+		{ID: "pci-10de_2204", Key: "pci-10de_2204"},
+		{ID: "dev-video0", Key: "dev-video0"},
+	}
+	assert.Equal(t, []gdpDevice{
+		{Name: "Arduino-SA_Uno-R3", Groups: []gdpGroup{
+			{USB: []gdpUSBSpec{{Vendor: "2341", Product: "0001"}}},
+			{USB: []gdpUSBSpec{{Vendor: "2341", Product: "0043"}}},
+		}},
+		{Name: "CP2102", Groups: []gdpGroup{{USB: []gdpUSBSpec{{Vendor: "10c4", Product: "ea60"}}}}},
+	}, gdpDevices(ds))
+}
+
+func TestGDPPublisherFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	*gdpFile = path
+	defer func() { *gdpFile = "" }()
+
+	p := &gdpPublisher{}
+	require.NoError(t, p.PublishInventory(context.Background(), inventory{Devices: []device{{ID: "10c4_ea60", Key: "CP2102"}}}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `devices:
+- groups:
+  - usb:
+    - product: ea60
+      vendor: 10c4
+  name: CP2102
+`, string(data))
+}
+
+func TestGDPPublisherConfigMap(t *testing.T) {
+	*gdpConfigMap = "generic-device-plugin"
+	defer func() { *gdpConfigMap = "" }()
+	clientset := fake.NewSimpleClientset()
+	p := &gdpPublisher{clientset: clientset}
+	ctx := context.Background()
+
+	require.NoError(t, p.PublishInventory(ctx, inventory{Devices: []device{{ID: "10c4_ea60", Key: "CP2102"}}}))
+	// The devices of another node are added, the devices of the first node are kept.
+	require.NoError(t, p.PublishInventory(ctx, inventory{Devices: []device{{ID: "2341_0043", Key: "Uno"}, {ID: "10c4_ea70", Key: "CP2102"}}}))
+
+	cm, err := clientset.CoreV1().ConfigMaps("default").Get(ctx, "generic-device-plugin", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, `devices:
+- groups:
+  - usb:
+    - product: ea60
+      vendor: 10c4
+  - usb:
+    - product: ea70
+      vendor: 10c4
+  name: CP2102
+- groups:
+  - usb:
+    - product: "0043"
+      vendor: "2341"
+  name: Uno
+`, cm.Data[gdpConfigMapKey])
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+)
+
+var removalGracePeriod = flag.Duration("removal-grace-period", 0, "time a device must be absent in consecutive scans before its label is removed, so a device that resets momentarily, e.g. for a firmware update, does not evict pods; 0 removes labels immediately")
+
+// graceTracker keeps devices that disappeared for removal-grace-period, so their labels are not removed immediately.
+// A graceTracker must not be used concurrently.
+type graceTracker struct {
+	clock clock.PassiveClock
+	// seen are the devices by their identity and the time they were seen the last time.
+	seen map[string]seenDevice
+}
+
+type seenDevice struct {
+	device device
+	last   time.Time
+}
+
+func newGraceTracker(c clock.PassiveClock) *graceTracker {
+	return &graceTracker{clock: c, seen: make(map[string]seenDevice)}
+}
+
+// deviceIdentity identifies a single device by its id, port and serial number.
+func deviceIdentity(d device) string {
+	return d.ID + "@" + d.Port + "@" + d.Serial
+}
+
+// retain returns the scanned devices and the devices that disappeared less than removal-grace-period ago.
+func (g *graceTracker) retain(ds []device) []device {
+	if *removalGracePeriod <= 0 {
+		return ds
+	}
+	now := g.clock.Now()
+	present := make(map[string]struct{}, len(ds))
+	for _, d := range ds {
+		id := deviceIdentity(d)
+		present[id] = struct{}{}
+		g.seen[id] = seenDevice{device: d, last: now}
+	}
+	rs := ds
+	for id, s := range g.seen {
+		if _, ok := present[id]; ok {
+			continue
+		}
+		if now.Sub(s.last) >= *removalGracePeriod {
+			delete(g.seen, id)
+			continue
+		}
+		if len(rs) == len(ds) {
+			// Do not modify the scanned devices.
+			rs = append([]device{}, ds...)
+		}
+		rs = append(rs, s.device)
+	}
+	return rs
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestGraceTracker(t *testing.T) {
+	uno := device{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Port: "1-2"}
+	cp := device{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x", Port: "1-3"}
+	c := testclock.NewFakePassiveClock(time.Now())
+	g := newGraceTracker(c)
+	assert.Equal(t, []device{uno}, g.retain([]device{uno}), "disabled")
+
+	*removalGracePeriod = time.Minute
+	defer func() { *removalGracePeriod = 0 }()
+	assert.Equal(t, []device{uno, cp}, g.retain([]device{uno, cp}))
+	c.SetTime(c.Now().Add(30 * time.Second))
+	ds := []device{cp}
+	assert.ElementsMatch(t, []device{uno, cp}, g.retain(ds))
+	assert.Equal(t, []device{cp}, ds)
+	c.SetTime(c.Now().Add(30 * time.Second))
+	assert.Equal(t, []device{cp}, g.retain([]device{cp}))
+	// The device is not retained again after it was removed.
+	assert.Equal(t, []device{cp}, g.retain([]device{cp}))
+}
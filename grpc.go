@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	apiv1 "github.com/leonnicolas/nudl/api/v1"
+)
+
+// grpcWatchBuffer is the number of messages that are buffered for a watcher before it is disconnected.
+const grpcWatchBuffer = 64
+
+var (
+	grpcAddress        = flag.String("grpc-address", "", "address to serve the inventory gRPC API on, e.g. :9090 or unix:///run/nudl/nudl.sock. The API is disabled if empty.")
+	grpcCertFile       = flag.String("grpc-cert-file", "", "path to a certificate to serve the gRPC API with TLS")
+	grpcKeyFile        = flag.String("grpc-key-file", "", "path to the key of the certificate of the gRPC API")
+	grpcClientCAFile   = flag.String("grpc-client-ca-file", "", "path to a CA certificate to require and verify client certificates of the gRPC API")
+	grpcClientSPIFFEID = flag.String("grpc-client-spiffe-id", "", "SPIFFE ID that client certificates of the gRPC API must have as URI SAN")
+)
+
+// grpcPublisher serves the published inventory and events over gRPC.
+type grpcPublisher struct {
+	apiv1.UnimplementedInventoryServer
+	server *grpc.Server
+
+	mu sync.Mutex
+	// inventory is the last published inventory, nil before the first publication.
+	inventory *apiv1.InventorySnapshot
+	watchers  map[chan *apiv1.WatchResponse]struct{}
+}
+
+func newGRPCPublisher(logger log.Logger) (*grpcPublisher, error) {
+	var opts []grpc.ServerOption
+	if *grpcCertFile != "" || *grpcKeyFile != "" {
+		c, err := grpcServerTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(c)))
+	} else if *grpcClientCAFile != "" || *grpcClientSPIFFEID != "" {
+		return nil, fmt.Errorf("client certificates of the gRPC API require grpc-cert-file and grpc-key-file")
+	}
+	l, err := listenAddress(*grpcAddress)
+	if err != nil {
+		return nil, err
+	}
+	return serveGRPC(l, logger, opts...), nil
+}
+
+// grpcServerTLSConfig creates the TLS config of the gRPC server.
+// If a client CA is set, clients must present a certificate that is signed by it.
+func grpcServerTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(*grpcCertFile, *grpcKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load gRPC certificate: %w", err)
+	}
+	c := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if *grpcClientCAFile != "" {
+		pool, err := loadCertPool(*grpcClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if *grpcClientSPIFFEID != "" {
+		if c.ClientCAs == nil {
+			return nil, fmt.Errorf("grpc-client-spiffe-id requires grpc-client-ca-file")
+		}
+		verifySPIFFEID(c, *grpcClientSPIFFEID, true)
+	}
+	return c, nil
+}
+
+// serveGRPC serves the gRPC API on the listener in the background.
+func serveGRPC(l net.Listener, logger log.Logger, opts ...grpc.ServerOption) *grpcPublisher {
+	p := &grpcPublisher{
+		server:   grpc.NewServer(opts...),
+		watchers: make(map[chan *apiv1.WatchResponse]struct{}),
+	}
+	apiv1.RegisterInventoryServer(p.server, p)
+	go func() {
+		level.Info(logger).Log("msg", "starting gRPC server", "address", *grpcAddress)
+		if err := p.server.Serve(l); err != nil {
+			level.Error(logger).Log("msg", "gRPC server failed", "err", err)
+		}
+	}()
+	return p
+}
+
+func (p *grpcPublisher) Name() string {
+	return "grpc"
+}
+
+func (p *grpcPublisher) PublishInventory(_ context.Context, inv inventory) error {
+	pi := &apiv1.InventorySnapshot{
+		Node:    inv.Node,
+		Time:    timestamppb.New(inv.Time),
+		Devices: make([]*apiv1.Device, 0, len(inv.Devices)),
+	}
+	for _, d := range inv.Devices {
+		pi.Devices = append(pi.Devices, toAPIDevice(d))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inventory = pi
+	p.broadcast(&apiv1.WatchResponse{Response: &apiv1.WatchResponse_Inventory{Inventory: pi}})
+	return nil
+}
+
+func (p *grpcPublisher) PublishEvents(_ context.Context, es []event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range es {
+		t := apiv1.Event_TYPE_ATTACHED
+		if e.Type == eventDetached {
+			t = apiv1.Event_TYPE_DETACHED
+		}
+		p.broadcast(&apiv1.WatchResponse{Response: &apiv1.WatchResponse_Event{Event: &apiv1.Event{
+			Node:   e.Node,
+			Time:   timestamppb.New(e.Time),
+			Type:   t,
+			Device: toAPIDevice(e.Device),
+		}}})
+	}
+	return nil
+}
+
+// broadcast sends the message to all watchers.
+// Watchers that are too slow to receive the messages are disconnected, so publishing never blocks.
+// The caller must hold the lock.
+func (p *grpcPublisher) broadcast(r *apiv1.WatchResponse) {
+	for w := range p.watchers {
+		select {
+		case w <- r:
+		default:
+			delete(p.watchers, w)
+			close(w)
+		}
+	}
+}
+
+func (p *grpcPublisher) List(_ context.Context, _ *apiv1.ListRequest) (*apiv1.InventorySnapshot, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inventory == nil {
+		return nil, status.Error(codes.Unavailable, "no inventory was published yet")
+	}
+	return p.inventory, nil
+}
+
+func (p *grpcPublisher) Watch(_ *apiv1.WatchRequest, stream apiv1.Inventory_WatchServer) error {
+	w := make(chan *apiv1.WatchResponse, grpcWatchBuffer)
+	p.mu.Lock()
+	if p.inventory != nil {
+		w <- &apiv1.WatchResponse{Response: &apiv1.WatchResponse_Inventory{Inventory: p.inventory}}
+	}
+	p.watchers[w] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if _, ok := p.watchers[w]; ok {
+			delete(p.watchers, w)
+			close(w)
+		}
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case r, ok := <-w:
+			if !ok {
+				return status.Error(codes.Unavailable, "watch was closed")
+			}
+			if err := stream.Send(r); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close disconnects all watchers and stops the server.
+func (p *grpcPublisher) Close() error {
+	p.mu.Lock()
+	for w := range p.watchers {
+		delete(p.watchers, w)
+		close(w)
+	}
+	p.mu.Unlock()
+	p.server.GracefulStop()
+	return nil
+}
+
+func toAPIDevice(d device) *apiv1.Device {
+	return &apiv1.Device{Id: d.ID, Key: d.Key, Description: d.Description}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	apiv1 "github.com/leonnicolas/nudl/api/v1"
+)
+
+func TestGRPCPublisher(t *testing.T) {
+	l := bufconn.Listen(1 << 16)
+	p := serveGRPC(l, log.NewNopLogger())
+	defer p.Close()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := apiv1.NewInventoryClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = client.List(ctx, &apiv1.ListRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	a := device{ID: "a_a", Key: "a", Description: "A"}
+	now := time.Now()
+	require.NoError(t, p.PublishInventory(ctx, inventory{Node: "node", Time: now, Devices: []device{a}}))
+	inv, err := client.List(ctx, &apiv1.ListRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "node", inv.Node)
+	require.Len(t, inv.Devices, 1)
+	assert.Equal(t, "a_a", inv.Devices[0].Id)
+
+	stream, err := client.Watch(ctx, &apiv1.WatchRequest{})
+	require.NoError(t, err)
+	r, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Len(t, r.GetInventory().GetDevices(), 1)
+
+	require.NoError(t, p.PublishEvents(ctx, []event{{Node: "node", Time: now, Type: eventDetached, Device: a}}))
+	r, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, apiv1.Event_TYPE_DETACHED, r.GetEvent().GetType())
+	assert.Equal(t, "a", r.GetEvent().GetDevice().GetKey())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+)
+
+var livenessIntervals = flag.Int("liveness-intervals", 5, "number of update intervals without a successful reconciliation after which /healthz fails, so a wedged agent is restarted, 0 disables the check")
+
+// health tracks the state of the labeler for the readiness and liveness probes.
+// It is safe for concurrent use, because the probes are served concurrently to the reconciliation.
+type health struct {
+	clock clock.PassiveClock
+	mu    sync.Mutex
+	// nodeErr is the error of the last attempt to get the node, or errNotYet.
+	nodeErr error
+	// scanned is true after the first successful scan.
+	scanned bool
+	// wedged are the scanners whose scans timed out and did not return yet.
+	wedged []string
+	// since is the time of the last successful reconciliation, or the start.
+	since time.Time
+	// deadline is the time until which a reconciliation must succeed.
+	deadline time.Time
+}
+
+var errNotYet = errors.New("not attempted yet")
+
+func newHealth(c clock.PassiveClock) *health {
+	now := c.Now()
+	return &health{
+		clock:    c,
+		nodeErr:  errNotYet,
+		since:    now,
+		deadline: now.Add(time.Duration(*livenessIntervals) * *updateTime),
+	}
+}
+
+// gotNode records the result of getting the node.
+func (h *health) gotNode(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nodeErr = err
+}
+
+// scanSucceeded records a successful scan.
+func (h *health) scanSucceeded() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.scanned = true
+}
+
+// scannersWedged records the scanners whose scans timed out and did not return yet.
+func (h *health) scannersWedged(names []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.wedged = names
+}
+
+// reconciled records a successful reconciliation, the next one is expected within liveness-intervals update intervals.
+func (h *health) reconciled(interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.since = h.clock.Now()
+	h.deadline = h.since.Add(time.Duration(*livenessIntervals) * interval)
+}
+
+// ready returns an error unless the node was fetched successfully and the devices were scanned at least once.
+// It is degraded while a scan is wedged, even though the labels of the previous scan are kept.
+func (h *health) ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.nodeErr != nil {
+		return fmt.Errorf("could not get node: %w", h.nodeErr)
+	}
+	if !h.scanned {
+		return fmt.Errorf("no successful scan yet")
+	}
+	if len(h.wedged) > 0 {
+		return fmt.Errorf("scans of %s timed out and are still running", strings.Join(h.wedged, ", "))
+	}
+	return nil
+}
+
+// live returns an error if no reconciliation succeeded within liveness-intervals update intervals.
+func (h *health) live() error {
+	if *livenessIntervals == 0 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clock.Now().After(h.deadline) {
+		return fmt.Errorf("no successful reconciliation since %s", h.since.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// healthHandler returns an http handler that responds with 503 if check fails.
+func healthHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestHealth(t *testing.T) {
+	c := testclock.NewFakePassiveClock(time.Now())
+	h := newHealth(c)
+
+	assert.Error(t, h.ready())
+	h.gotNode(nil)
+	assert.Error(t, h.ready())
+	h.scanSucceeded()
+	assert.NoError(t, h.ready())
+	h.scannersWedged([]string{"usb"})
+	assert.EqualError(t, h.ready(), "scans of usb timed out and are still running")
+	h.scannersWedged(nil)
+	assert.NoError(t, h.ready())
+	h.gotNode(errors.New("forbidden"))
+	assert.Error(t, h.ready())
+
+	assert.NoError(t, h.live())
+	c.SetTime(c.Now().Add(time.Duration(*livenessIntervals)**updateTime + time.Second))
+	assert.Error(t, h.live())
+	h.reconciled(time.Minute)
+	c.SetTime(c.Now().Add(time.Duration(*livenessIntervals-1) * time.Minute))
+	assert.NoError(t, h.live())
+	c.SetTime(c.Now().Add(2 * time.Minute))
+	assert.Error(t, h.live())
+
+	*livenessIntervals = 0
+	defer func() { *livenessIntervals = 5 }()
+	assert.NoError(t, h.live())
+}
+
+func TestHealthHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthHandler(func() error { return nil }).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	healthHandler(func() error { return errors.New("no scan") }).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "no scan\n", w.Body.String())
+}
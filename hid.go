@@ -0,0 +1,148 @@
+package main
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+var hidDetail = flag.Bool("hid-detail", false, "add labels <key>.hid-<kind>=true, e.g. hid-scanner for barcode scanners or hid-keyboard, from the usages of the application collections in the HID report descriptors of the devices in sysfs at --sysfs-root, so devices of the same class can be told apart")
+
+// hidItemSizes are the sizes of the data of short items by the size code.
+var hidItemSizes = [4]int{0, 1, 2, 4}
+
+// hidApplications returns the usages of the top level application collections of a HID report descriptor,
+// with the usage page in the upper 16 bits. A truncated descriptor returns the usages found before the end.
+func hidApplications(desc []byte) []uint32 {
+	var apps []uint32
+	var page uint32
+	var pages []uint32
+	var usages []uint32
+	depth := 0
+	for i := 0; i < len(desc); {
+		b := desc[i]
+		if b == 0xfe {
+			// Long items are reserved and only skipped.
+			if i+1 >= len(desc) {
+				break
+			}
+			i += 3 + int(desc[i+1])
+			continue
+		}
+		size := hidItemSizes[b&0x3]
+		if i+1+size > len(desc) {
+			break
+		}
+		var data uint32
+		for j := 0; j < size; j++ {
+			data |= uint32(desc[i+1+j]) << (8 * j)
+		}
+		i += 1 + size
+		switch kind, tag := (b>>2)&0x3, b>>4; kind {
+		case 0: // main
+			switch tag {
+			case 0xa: // collection
+				if data == 0x01 && depth == 0 && len(usages) > 0 {
+					apps = append(apps, usages[0])
+				}
+				depth++
+			case 0xc: // end collection
+				if depth > 0 {
+					depth--
+				}
+			}
+			usages = usages[:0]
+		case 1: // global
+			switch tag {
+			case 0x0: // usage page
+				page = data
+			case 0xa: // push
+				pages = append(pages, page)
+			case 0xb: // pop
+				if len(pages) > 0 {
+					page, pages = pages[len(pages)-1], pages[:len(pages)-1]
+				}
+			}
+		case 2: // local
+			if tag == 0x0 {
+				// A usage with 4 bytes holds its own usage page.
+				if size < 4 {
+					data |= page << 16
+				}
+				usages = append(usages, data)
+			}
+		}
+	}
+	return apps
+}
+
+// hidKind returns the kind of a device with the usage of an application collection, e.g. scanner, or an empty string.
+func hidKind(usage uint32) string {
+	switch page, u := usage>>16, usage&0xffff; page {
+	case 0x01: // generic desktop
+		switch u {
+		case 0x02:
+			return "mouse"
+		case 0x04:
+			return "joystick"
+		case 0x05:
+			return "gamepad"
+		case 0x06:
+			return "keyboard"
+		case 0x07:
+			return "keypad"
+		}
+	case 0x0c:
+		return "consumer-control"
+	case 0x0d: // digitizers
+		switch u {
+		case 0x02:
+			return "pen"
+		case 0x04:
+			return "touchscreen"
+		case 0x05:
+			return "touchpad"
+		}
+	case 0x20:
+		return "sensor"
+	case 0x84, 0x85: // power device and battery system
+		return "ups"
+	case 0x8c:
+		return "scanner"
+	case 0x8d:
+		return "scale"
+	case 0x8e:
+		return "magnetic-stripe-reader"
+	}
+	return ""
+}
+
+// hidKinds returns the sorted kinds of the application collections of the HID report descriptors.
+func hidKinds(descs ...[]byte) []string {
+	set := make(map[string]bool)
+	for _, desc := range descs {
+		for _, u := range hidApplications(desc) {
+			if k := hidKind(u); k != "" {
+				set[k] = true
+			}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return sortedKeys(set)
+}
+
+// addHIDLabels adds a label <key>.hid-<kind>=true for every kind of the devices of every label that is labeled,
+// e.g. a barcode scanner in the HID point of sale mode is labeled hid-scanner, unlike a keyboard.
+func addHIDLabels(l labels, ds []device) {
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		for _, k := range d.HIDKinds {
+			l[sprintLabelKey(suffixKey(d.Key, ".hid-"+k))] = "true"
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// keyboardHIDDescriptor is the start of the report descriptor of a boot keyboard.
+var keyboardHIDDescriptor = []byte{
+	0x05, 0x01, // usage page (generic desktop)
+	0x09, 0x06, // usage (keyboard)
+	0xa1, 0x01, // collection (application)
+	0x05, 0x07, // usage page (keyboard)
+	0x19, 0xe0, // usage minimum
+	0x29, 0xe7, // usage maximum
+	0x81, 0x02, // input
+	0xc0, // end collection
+}
+
+// scannerHIDDescriptor is the report descriptor of a barcode scanner in the HID point of sale mode,
+// which also reports the consumer control usages of a vendor page with an extended usage.
+var scannerHIDDescriptor = []byte{
+	0x06, 0x8c, 0x00, // usage page (bar code scanner)
+	0x09, 0x02, // usage (bar code badge reader)
+	0xa1, 0x01, // collection (application)
+	0x09, 0x12, // usage
+	0xa1, 0x02, // collection (logical)
+	0x81, 0x02, // input
+	0xc0,             // end collection
+	0xc0,             // end collection
+	0x06, 0x00, 0xff, // usage page (vendor)
+	0x0b, 0x01, 0x00, 0x0c, 0x00, // usage (consumer control) with its own usage page
+	0xa1, 0x01, // collection (application)
+	0xc0,             // end collection
+	0x06, 0x00, 0xff, // usage page (vendor)
+	0x09, 0x01, // usage
+	0xa1, 0x01, // collection (application)
+	0xc0, // end collection
+}
+
+func TestHIDKinds(t *testing.T) {
+	assert.Equal(t, []uint32{0x00010006}, hidApplications(keyboardHIDDescriptor))
+	assert.Equal(t, []string{"keyboard"}, hidKinds(keyboardHIDDescriptor))
+	assert.Equal(t, []string{"consumer-control", "scanner"}, hidKinds(scannerHIDDescriptor))
+	assert.Equal(t, []string{"consumer-control", "keyboard", "scanner"}, hidKinds(keyboardHIDDescriptor, scannerHIDDescriptor))
+	// A truncated descriptor returns the applications before the end.
+	assert.Equal(t, []string{"scanner"}, hidKinds(scannerHIDDescriptor[:20]))
+	assert.Nil(t, hidKinds(nil))
+}
+
+func TestAddHIDLabels(t *testing.T) {
+	ds := []device{
+		{ID: "0c2e_0b61", Key: "Honeywell_Scanner", HIDKinds: []string{"consumer-control", "scanner"}},
+		{ID: "046d_c31c", Key: "Logitech_Keyboard", HIDKinds: []string{"keyboard"}},
+	}
+	l := labels{"nudl.squat.ai/Honeywell_Scanner": "true", "nudl.squat.ai/Logitech_Keyboard": "false"}
+	addHIDLabels(l, ds)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Honeywell_Scanner":                      "true",
+		"nudl.squat.ai/Honeywell_Scanner.hid-consumer-control": "true",
+		"nudl.squat.ai/Honeywell_Scanner.hid-scanner":          "true",
+		"nudl.squat.ai/Logitech_Keyboard":                      "false",
+	}, l)
+}
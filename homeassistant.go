@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	haPayloadOn  = "ON"
+	haPayloadOff = "OFF"
+)
+
+var (
+	mqttHomeAssistant       = flag.Bool("mqtt-homeassistant", false, "publish Home Assistant MQTT discovery messages, so attached devices appear as binary sensors")
+	mqttHomeAssistantPrefix = flag.String("mqtt-homeassistant-prefix", "homeassistant", "Home Assistant MQTT discovery prefix")
+	mqttDeviceStateTopic    = flag.String("mqtt-device-state-topic", "nudl/{node}/devices/{device}/state", "MQTT topic for the retained state of a device for Home Assistant, {node} and {device} are replaced with the hostname and the device id")
+)
+
+// regHAID matches characters that are not allowed in Home Assistant node and object ids.
+var regHAID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// haDiscoveryConfig is the discovery config of a Home Assistant binary sensor.
+type haDiscoveryConfig struct {
+	Name        string   `json:"name"`
+	UniqueID    string   `json:"unique_id"`
+	StateTopic  string   `json:"state_topic"`
+	PayloadOn   string   `json:"payload_on"`
+	PayloadOff  string   `json:"payload_off"`
+	DeviceClass string   `json:"device_class"`
+	Device      haDevice `json:"device"`
+}
+
+// haDevice is the Home Assistant device, i.e. the node, the binary sensors belong to.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// publishHomeAssistant announces new devices to Home Assistant
+// and publishes the state of all devices that were announced by this process.
+// Announced devices that are not attached anymore are turned off instead of removed,
+// so Home Assistant can show that a device is missing.
+func (p *mqttPublisher) publishHomeAssistant(ctx context.Context, inv inventory) error {
+	nodeID := regHAID.ReplaceAllString(inv.Node, "_")
+	present := make(map[string]struct{}, len(inv.Devices))
+	for _, d := range inv.Devices {
+		present[d.ID] = struct{}{}
+		if _, ok := p.announced[d.ID]; ok {
+			continue
+		}
+		objectID := regHAID.ReplaceAllString(d.ID, "_")
+		c := haDiscoveryConfig{
+			Name:        d.Description,
+			UniqueID:    fmt.Sprintf("nudl_%s_%s", nodeID, objectID),
+			StateTopic:  haStateTopic(d.ID),
+			PayloadOn:   haPayloadOn,
+			PayloadOff:  haPayloadOff,
+			DeviceClass: "plug",
+			Device: haDevice{
+				Identifiers:  []string{fmt.Sprintf("nudl_%s", nodeID)},
+				Name:         inv.Node,
+				Manufacturer: "nudl",
+			},
+		}
+		topic := fmt.Sprintf("%s/binary_sensor/%s/%s/config", *mqttHomeAssistantPrefix, nodeID, objectID)
+		if err := p.publish(ctx, topic, true, c); err != nil {
+			return fmt.Errorf("could not publish discovery config for device %s: %w", d.ID, err)
+		}
+		p.announced[d.ID] = struct{}{}
+	}
+	for id := range p.announced {
+		state := haPayloadOff
+		if _, ok := present[id]; ok {
+			state = haPayloadOn
+		}
+		if err := waitMQTT(ctx, p.client.Publish(haStateTopic(id), p.qos, true, state)); err != nil {
+			return fmt.Errorf("could not publish state of device %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// haStateTopic returns the state topic of a device.
+func haStateTopic(id string) string {
+	return strings.ReplaceAll(mqttTopic(*mqttDeviceStateTopic), "{device}", regHAID.ReplaceAllString(id, "_"))
+}
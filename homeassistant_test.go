@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMQTTMessage is a message published with the fakeMQTTClient.
+type fakeMQTTMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  string
+}
+
+// fakeMQTTClient records the published messages.
+// Calling any other method of the client panics.
+type fakeMQTTClient struct {
+	mqtt.Client
+	published []fakeMQTTMessage
+}
+
+func (c *fakeMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	var p string
+	switch v := payload.(type) {
+	case string:
+		p = v
+	case []byte:
+		p = string(v)
+	}
+	c.published = append(c.published, fakeMQTTMessage{topic: topic, qos: qos, retained: retained, payload: p})
+	return doneToken{}
+}
+
+// doneToken is a completed mqtt.Token without an error.
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+
+func (doneToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+func TestPublishHomeAssistant(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+	c := &fakeMQTTClient{}
+	p := &mqttPublisher{client: c, qos: 1, announced: make(map[string]struct{})}
+	inv := inventory{Node: "node.example/a", Devices: []device{
+		{ID: "usb/1d6b.0002", Description: "Linux Foundation 2.0 root hub"},
+		{ID: "046d_c52b", Description: "Logitech Unifying Receiver"},
+	}}
+
+	require.NoError(t, p.publishHomeAssistant(context.Background(), inv))
+	configs := map[string]fakeMQTTMessage{}
+	states := map[string]fakeMQTTMessage{}
+	for _, m := range c.published {
+		if m.payload == haPayloadOn || m.payload == haPayloadOff {
+			states[m.topic] = m
+		} else {
+			configs[m.topic] = m
+		}
+	}
+	require.Len(t, configs, 2)
+	m, ok := configs["homeassistant/binary_sensor/node_example_a/usb_1d6b_0002/config"]
+	require.True(t, ok, "the node and object ids are sanitized")
+	assert.True(t, m.retained)
+	var cfg haDiscoveryConfig
+	require.NoError(t, json.Unmarshal([]byte(m.payload), &cfg))
+	assert.Equal(t, "nudl_node_example_a_usb_1d6b_0002", cfg.UniqueID)
+	assert.Equal(t, "nudl/node/devices/usb_1d6b_0002/state", cfg.StateTopic)
+	assert.Equal(t, "Linux Foundation 2.0 root hub", cfg.Name)
+	assert.Equal(t, []string{"nudl_node_example_a"}, cfg.Device.Identifiers)
+	assert.True(t, configs["homeassistant/binary_sensor/node_example_a/046d_c52b/config"].retained)
+	assert.Equal(t, map[string]fakeMQTTMessage{
+		"nudl/node/devices/usb_1d6b_0002/state": {topic: "nudl/node/devices/usb_1d6b_0002/state", qos: 1, retained: true, payload: haPayloadOn},
+		"nudl/node/devices/046d_c52b/state":     {topic: "nudl/node/devices/046d_c52b/state", qos: 1, retained: true, payload: haPayloadOn},
+	}, states)
+
+	// The discovery config is only published once,
+	// a missing device is turned off instead of removed.
+	c.published = nil
+	inv.Devices = inv.Devices[1:]
+	require.NoError(t, p.publishHomeAssistant(context.Background(), inv))
+	assert.ElementsMatch(t, []fakeMQTTMessage{
+		{topic: "nudl/node/devices/usb_1d6b_0002/state", qos: 1, retained: true, payload: haPayloadOff},
+		{topic: "nudl/node/devices/046d_c52b/state", qos: 1, retained: true, payload: haPayloadOn},
+	}, c.published)
+}
+
+func TestHAStateTopic(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+	assert.Equal(t, "nudl/node/devices/a_b_c_d/state", haStateTopic("a/b.c+d"))
+	assert.Equal(t, "nudl/node/devices/046d_c52b/state", haStateTopic("046d_c52b"))
+}
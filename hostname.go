@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeNameDetector detects the name of the node nudl runs on.
+// The sources are injected, so the detection can be tested.
+type nodeNameDetector struct {
+	clientset kubernetes.Interface
+	getenv    func(string) string
+	hostname  func() (string, error)
+	// addrs returns the IP addresses of the pod.
+	addrs func() ([]net.IP, error)
+}
+
+func newNodeNameDetector(clientset kubernetes.Interface) *nodeNameDetector {
+	return &nodeNameDetector{clientset: clientset, getenv: os.Getenv, hostname: os.Hostname, addrs: podAddrs}
+}
+
+// podAddrs returns the address in the POD_IP environment variable, e.g. set with the downward API,
+// or the addresses of the network interfaces, which are the addresses of the node with host networking.
+func podAddrs() ([]net.IP, error) {
+	if ip := net.ParseIP(os.Getenv("POD_IP")); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	as, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, a := range as {
+		if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() {
+			ips = append(ips, n.IP)
+		}
+	}
+	return ips, nil
+}
+
+// detect returns the NODE_NAME environment variable, e.g. set with the downward API.
+// Otherwise it returns the node named like the hostname or the node that has an address of the pod.
+// If both exist, but are different nodes, it fails, because the node can not be determined reliably.
+func (d *nodeNameDetector) detect(ctx context.Context, logger log.Logger) (string, error) {
+	if n := d.getenv("NODE_NAME"); n != "" {
+		level.Info(logger).Log("msg", "using the node name from NODE_NAME", "node", n)
+		return n, nil
+	}
+	var errs []error
+	byHostname, err := d.hostname()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not get hostname: %w", err))
+	} else if _, err := d.clientset.CoreV1().Nodes().Get(ctx, byHostname, metav1.GetOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("could not get node %q named like the hostname: %w", byHostname, err))
+		byHostname = ""
+	}
+	byAddr, err := d.nodeByAddr(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	switch {
+	case byHostname != "" && byAddr != "" && byHostname != byAddr:
+		return "", fmt.Errorf("the hostname is %q, but node %q has the address of the pod; set --hostname or NODE_NAME", byHostname, byAddr)
+	case byHostname != "":
+		level.Info(logger).Log("msg", "using the hostname as the node name", "node", byHostname)
+		return byHostname, nil
+	case byAddr != "":
+		level.Info(logger).Log("msg", "using the node with the address of the pod", "node", byAddr)
+		return byAddr, nil
+	}
+	return "", fmt.Errorf("could not detect the node name; set --hostname or NODE_NAME: %w", errors.Join(errs...))
+}
+
+// nodeByAddr returns the name of the node that has one of the addresses of the pod.
+func (d *nodeNameDetector) nodeByAddr(ctx context.Context) (string, error) {
+	ips, err := d.addrs()
+	if err != nil {
+		return "", fmt.Errorf("could not get the addresses of the pod: %w", err)
+	}
+	nodes, err := d.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not list nodes: %w", err)
+	}
+	for _, n := range nodes.Items {
+		for _, a := range n.Status.Addresses {
+			addr := net.ParseIP(a.Address)
+			for _, ip := range ips {
+				if addr != nil && addr.Equal(ip) {
+					return n.Name, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("no node has one of the addresses %v", ips)
+}
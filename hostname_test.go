@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeNameDetector(t *testing.T) {
+	node := func(name, addr string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: addr}}},
+		}
+	}
+	for _, tc := range []struct {
+		name     string
+		env      string
+		hostname string
+		addr     string
+		want     string
+		err      bool
+	}{
+		{name: "env", env: "node1", hostname: "node2", addr: "10.0.0.2", want: "node1"},
+		{name: "hostname", hostname: "node1", addr: "10.0.0.1", want: "node1"},
+		{name: "hostname without matching address", hostname: "node2", addr: "10.0.0.9", want: "node2"},
+		{name: "address", hostname: "pod-abc", addr: "10.0.0.2", want: "node2"},
+		{name: "disagree", hostname: "node1", addr: "10.0.0.2", err: true},
+		{name: "nothing", hostname: "pod-abc", addr: "10.0.0.9", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &nodeNameDetector{
+				clientset: fake.NewSimpleClientset(node("node1", "10.0.0.1"), node("node2", "10.0.0.2")),
+				getenv: func(k string) string {
+					if k == "NODE_NAME" {
+						return tc.env
+					}
+					return ""
+				},
+				hostname: func() (string, error) { return tc.hostname, nil },
+				addrs:    func() ([]net.IP, error) { return []net.IP{net.ParseIP(tc.addr)}, nil },
+			}
+			got, err := d.detect(context.Background(), log.NewNopLogger())
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNodeNameDetectorErrors(t *testing.T) {
+	d := &nodeNameDetector{
+		clientset: fake.NewSimpleClientset(),
+		getenv:    func(string) string { return "" },
+		hostname:  func() (string, error) { return "", errors.New("no hostname") },
+		addrs:     func() ([]net.IP, error) { return nil, errors.New("no addresses") },
+	}
+	_, err := d.detect(context.Background(), log.NewNopLogger())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no hostname")
+	assert.Contains(t, err.Error(), "no addresses")
+}
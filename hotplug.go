@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var hotplug = flag.Bool("hotplug", false, "reconcile immediately when a usb device is attached or removed, in addition to every update-time; needs the host network namespace to receive the kernel uevents")
+
+var errHotplugUnsupported = errors.New("hotplug events are only supported on Linux")
+
+// uevent is a kernel uevent.
+type uevent map[string]string
+
+// parseUevent parses a kernel uevent, which consists of a header like add@/devices/...
+// and null separated KEY=VALUE pairs.
+func parseUevent(msg []byte) uevent {
+	parts := strings.Split(string(msg), "\x00")
+	e := make(uevent, len(parts))
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			e[k] = v
+		}
+	}
+	return e
+}
+
+// usbDeviceChanged returns true if a usb device was attached or removed.
+// Events of interfaces are ignored, because every device has at least one.
+func (e uevent) usbDeviceChanged() bool {
+	return e["SUBSYSTEM"] == "usb" && e["DEVTYPE"] == "usb_device" && (e["ACTION"] == "add" || e["ACTION"] == "remove")
+}
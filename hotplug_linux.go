@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"golang.org/x/sys/unix"
+)
+
+// hotplugPollInterval is the maximum time the watcher waits for a uevent before it checks whether the context is cancelled.
+const hotplugPollInterval = 500 * time.Millisecond
+
+// fromKernel returns true if the sender of a uevent is the kernel, whose port id is 0.
+// Any process in the network namespace can send messages to the multicast group,
+// e.g. to trigger endless rescans, so messages of other senders are dropped.
+func fromKernel(from unix.Sockaddr) bool {
+	sa, ok := from.(*unix.SockaddrNetlink)
+	return ok && sa.Pid == 0
+}
+
+// watchHotplug sends to ch whenever a usb device is attached or removed until the context is cancelled.
+// The send does not block, so several events are coalesced into one reconciliation.
+// A netlink socket can not be shut down to unblock a read, so the socket is non-blocking
+// and polled with a timeout, and the context is checked between the reads.
+func watchHotplug(ctx context.Context, ch chan<- struct{}, logger log.Logger) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return fmt.Errorf("could not open uevent socket: %w", err)
+	}
+	// The kernel multicasts uevents to group 1.
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("could not bind uevent socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if _, err := unix.Poll(fds, int(hotplugPollInterval.Milliseconds())); err != nil && err != unix.EINTR {
+			return fmt.Errorf("could not poll uevent socket: %w", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		n, from, err := unix.Recvfrom(fd, buf, 0)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			// The poll timed out or was interrupted.
+			continue
+		}
+		if err == unix.ENOBUFS {
+			// Events were dropped, so reconcile to be sure.
+			level.Warn(logger).Log("msg", "uevent buffer overflowed")
+		} else if err != nil {
+			return fmt.Errorf("could not receive uevent: %w", err)
+		} else if !fromKernel(from) {
+			level.Debug(logger).Log("msg", "ignoring uevent that was not sent by the kernel", "from", fmt.Sprintf("%+v", from))
+			continue
+		} else if e := parseUevent(buf[:n]); !e.usbDeviceChanged() {
+			continue
+		} else {
+			level.Debug(logger).Log("msg", "received usb hotplug event", "action", e["ACTION"], "devpath", e["DEVPATH"])
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"golang.org/x/sys/unix"
+)
+
+func TestFromKernel(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		from unix.Sockaddr
+		want bool
+	}{
+		{name: "kernel", from: &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}, want: true},
+		{name: "process", from: &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1, Pid: 4242}},
+		{name: "udev", from: &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 2, Pid: 311}},
+		{name: "unknown", from: nil},
+		{name: "unix socket", from: &unix.SockaddrUnix{Name: "/run/fake"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := fromKernel(tc.from); got != tc.want {
+				t.Errorf("fromKernel(%+v) = %v, want %v", tc.from, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWatchHotplugCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watchHotplug(ctx, make(chan struct{}, 1), log.NewNopLogger())
+	}()
+	select {
+	case err := <-done:
+		// The sandbox may not allow uevent sockets.
+		t.Skipf("could not watch uevents: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(2 * hotplugPollInterval):
+		t.Fatal("the watcher did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+
+	"github.com/go-kit/log"
+)
+
+func watchHotplug(_ context.Context, _ chan<- struct{}, _ log.Logger) error {
+	return errHotplugUnsupported
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUevent(t *testing.T) {
+	msg := strings.Join([]string{
+		"add@/devices/pci0000:00/0000:00:14.0/usb1/1-2",
+		"ACTION=add",
+		"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2",
+		"SUBSYSTEM=usb",
+		"DEVTYPE=usb_device",
+		"PRODUCT=2341/43/1",
+		"SEQNUM=4242",
+	}, "\x00")
+	e := parseUevent([]byte(msg))
+	assert.Equal(t, "/devices/pci0000:00/0000:00:14.0/usb1/1-2", e["DEVPATH"])
+	assert.True(t, e.usbDeviceChanged())
+
+	for _, e := range []uevent{
+		{"ACTION": "add", "SUBSYSTEM": "usb", "DEVTYPE": "usb_interface"},
+		{"ACTION": "bind", "SUBSYSTEM": "usb", "DEVTYPE": "usb_device"},
+		{"ACTION": "add", "SUBSYSTEM": "net"},
+	} {
+		assert.False(t, e.usbDeviceChanged(), e)
+	}
+}
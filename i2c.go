@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// i2cPrefix is the prefix of the ids and keys of i2c devices, so they can not be confused with usb devices.
+	i2cPrefix = "i2c-"
+	// gpioPrefix is the prefix of the ids and keys of gpio chips.
+	gpioPrefix = "gpio-"
+)
+
+var (
+	scanI2C  = flag.Bool("scan-i2c", false, "additionally label the node with the i2c devices in sysfs at --sysfs-root, e.g. nudl.squat.ai/i2c-bme280=true for a sensor, which needs the kernel driver or a device tree overlay for the device")
+	scanGPIO = flag.Bool("scan-gpio", false, "additionally label the node with the gpio chips in sysfs, e.g. nudl.squat.ai/gpio-mcp23017=true for an i2c gpio expander, if scan-i2c is set")
+)
+
+// validateI2C returns an error if scan-gpio is set without scan-i2c.
+func validateI2C() error {
+	if *scanGPIO && !*scanI2C {
+		return errors.New("--scan-gpio requires --scan-i2c")
+	}
+	return nil
+}
+
+// isI2C returns true for i2c devices.
+func isI2C(d device) bool {
+	return strings.HasPrefix(d.ID, i2cPrefix)
+}
+
+// isGPIO returns true for gpio chips.
+func isGPIO(d device) bool {
+	return strings.HasPrefix(d.ID, gpioPrefix)
+}
+
+// i2cScanner scans the i2c devices and, if gpio is true, the gpio chips by reading sysfs.
+type i2cScanner struct {
+	root string
+	gpio bool
+}
+
+func (*i2cScanner) Name() string {
+	return "i2c"
+}
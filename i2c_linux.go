@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// regI2CClient matches the names of i2c devices in sysfs, e.g. 1-0076 for the device at address 0x76 of bus 1.
+// Adapters, e.g. i2c-1, are not labeled.
+var regI2CClient = regexp.MustCompile(`^[0-9]+-[0-9a-f]{4}$`)
+
+// Scan returns the i2c devices, e.g. 1-0076, and the gpio chips, e.g. gpiochip496.
+// A missing bus or class, e.g. because the i2c or gpio drivers are not loaded, has no devices.
+func (s *i2cScanner) Scan(_ context.Context) ([]device, error) {
+	ds, err := s.scan(filepath.Join(s.root, "bus", "i2c", "devices"), i2cPrefix, "name", regI2CClient.MatchString)
+	if err != nil {
+		return nil, fmt.Errorf("could not scan i2c devices: %w", err)
+	}
+	if !s.gpio {
+		return ds, nil
+	}
+	gs, err := s.scan(filepath.Join(s.root, "class", "gpio"), gpioPrefix, "label", func(n string) bool {
+		return strings.HasPrefix(n, "gpiochip")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not scan gpio chips: %w", err)
+	}
+	return append(ds, gs...), nil
+}
+
+// scan returns the devices in dir whose names match and that are named by the file name,
+// e.g. "bme280 (1-0076)" for the i2c device 1-0076 with the name bme280.
+func (s *i2cScanner) scan(dir, prefix, name string, match func(string) bool) ([]device, error) {
+	es, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ds []device
+	for _, e := range es {
+		if !match(e.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), name))
+		if os.IsNotExist(err) {
+			// The device was removed while scanning.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		n := strings.TrimSpace(string(data))
+		if n == "" {
+			continue
+		}
+		id := prefix + strings.Trim(regTrim.ReplaceAllString(n, "-"), "-_.")
+		d := device{
+			ID:          id,
+			Key:         id,
+			Description: fmt.Sprintf("%s (%s)", n, e.Name()),
+			Port:        e.Name(),
+		}
+		if *driverLabels {
+			link, err := os.Readlink(filepath.Join(dir, e.Name(), "driver"))
+			if err == nil {
+				d.Drivers = []string{filepath.Base(link)}
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("could not read driver of %q: %w", e.Name(), err)
+			}
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestI2CScanner(t *testing.T) {
+	root := t.TempDir()
+	for dir, files := range map[string]map[string]string{
+		"bus/i2c/devices/1-0076":     {"name": "bme280\n"},
+		"bus/i2c/devices/1-0020":     {"name": "mcp23017\n"},
+		"bus/i2c/devices/i2c-1":      {"name": "bcm2835 (i2c@7e804000)\n"},
+		"class/gpio/gpiochip0":       {"label": "pinctrl-bcm2711\n"},
+		"class/gpio/gpiochip496":     {"label": "mcp23017\n"},
+		"class/gpio/gpio17":          {},
+		"bus/i2c/devices/1-0068":     {"name": "\n"},
+		"bus/i2c/drivers/bmp280-i2c": {},
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+		for f, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(root, dir, f), []byte(content), 0o644))
+		}
+	}
+	require.NoError(t, os.Symlink(filepath.Join("..", "..", "..", "bus", "i2c", "drivers", "bmp280-i2c"), filepath.Join(root, "bus", "i2c", "devices", "1-0076", "driver")))
+	*driverLabels = true
+	defer func() { *driverLabels = false }()
+
+	ds, err := (&i2cScanner{root: root}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []device{
+		{ID: "i2c-mcp23017", Key: "i2c-mcp23017", Description: "mcp23017 (1-0020)", Port: "1-0020"},
+		{ID: "i2c-bme280", Key: "i2c-bme280", Description: "bme280 (1-0076)", Port: "1-0076", Drivers: []string{"bmp280-i2c"}},
+	}, ds)
+
+	ds, err = (&i2cScanner{root: root, gpio: true}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []device{
+		{ID: "i2c-mcp23017", Key: "i2c-mcp23017", Description: "mcp23017 (1-0020)", Port: "1-0020"},
+		{ID: "i2c-bme280", Key: "i2c-bme280", Description: "bme280 (1-0076)", Port: "1-0076", Drivers: []string{"bmp280-i2c"}},
+		{ID: "gpio-pinctrl-bcm2711", Key: "gpio-pinctrl-bcm2711", Description: "pinctrl-bcm2711 (gpiochip0)", Port: "gpiochip0"},
+		{ID: "gpio-mcp23017", Key: "gpio-mcp23017", Description: "mcp23017 (gpiochip496)", Port: "gpiochip496"},
+	}, ds)
+	assert.False(t, isUSB(ds[0]))
+	assert.False(t, isUSB(ds[2]))
+	_, _, ok := vendorProduct(ds[0])
+	assert.False(t, ok)
+
+	// A node without i2c has no devices.
+	ds, err = (&i2cScanner{root: t.TempDir(), gpio: true}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+
+	*scanGPIO = true
+	defer func() { *scanGPIO = false }()
+	assert.Error(t, validateI2C())
+}
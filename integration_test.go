@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+// testLifecycleFixture attaches a receiver, then a flash drive after a minute and detaches the receiver after an hour.
+const testLifecycleFixture = `{
+  "devices": [{"vendor": "046d", "product": "c52b", "description": "Receiver (Logitech)"}],
+  "steps": [
+    {"after": "1m", "attach": [{"vendor": "0781", "product": "5581", "description": "Ultra (SanDisk)"}]},
+    {"after": "1h", "detach": [{"vendor": "046d", "product": "c52b"}]}
+  ]
+}`
+
+// TestLabelLifecycle runs the life cycle of the labels of virtual devices end-to-end against a fake api server with every patch strategy:
+// labels are merged with the labels of others, conflicts are retried, labels of detached devices are removed and the node is cleaned up.
+func TestLabelLifecycle(t *testing.T) {
+	for _, strategy := range []string{patchStrategyApply, patchStrategyStrategic, patchStrategyJSON} {
+		t.Run(strategy, func(t *testing.T) {
+			oldHostname, oldStrategy, oldBackoff := *hostname, *patchStrategy, *patchRetryBackoff
+			*hostname, *patchStrategy, *patchRetryBackoff = "node1", strategy, time.Millisecond
+			t.Cleanup(func() { *hostname, *patchStrategy, *patchRetryBackoff = oldHostname, oldStrategy, oldBackoff })
+
+			path := filepath.Join(t.TempDir(), "devices.json")
+			require.NoError(t, os.WriteFile(path, []byte(testLifecycleFixture), 0o644))
+			s, err := newFixtureScanner(path)
+			require.NoError(t, err)
+			clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:   "node1",
+				Labels: map[string]string{"other": "x", "nudl.squat.ai/stale": "true"},
+			}})
+			c := testclock.NewFakePassiveClock(time.Now())
+			lb := newLabeler(clientset, c, nil, s)
+			ctx := context.Background()
+			logger := log.NewNopLogger()
+			node := func() *v1.Node {
+				n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+				require.NoError(t, err)
+				return n
+			}
+			// advance moves the fixture and the clock forward, so the next reconcile scans and labels again.
+			advance := func(d time.Duration) {
+				s.start = s.start.Add(-d)
+				c.SetTime(c.Now().Add(d))
+			}
+
+			// Stale labels with the prefix are replaced, labels of others are kept.
+			require.NoError(t, lb.reconcile(ctx, logger))
+			assert.Equal(t, map[string]string{"other": "x", "nudl.squat.ai/Logitech_Receiver": "true"}, node().Labels)
+
+			// Labels that others add in the meantime are kept.
+			n := node()
+			n.Labels["team"] = "a"
+			_, err = clientset.CoreV1().Nodes().Update(ctx, n, metav1.UpdateOptions{})
+			require.NoError(t, err)
+
+			// A conflict is retried with the current node.
+			conflicts := 1
+			clientset.PrependReactor("patch", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+				if conflicts == 0 {
+					return false, nil, nil
+				}
+				conflicts--
+				return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node1", errors.New("the object has been modified"))
+			})
+			advance(2 * time.Minute)
+			require.NoError(t, lb.reconcile(ctx, logger))
+			assert.Zero(t, conflicts)
+			assert.Equal(t, map[string]string{
+				"other":                           "x",
+				"team":                            "a",
+				"nudl.squat.ai/Logitech_Receiver": "true",
+				"nudl.squat.ai/SanDisk_Ultra":     "true",
+			}, node().Labels)
+
+			// The label of a detached device is removed.
+			advance(time.Hour)
+			require.NoError(t, lb.reconcile(ctx, logger))
+			assert.Equal(t, map[string]string{"other": "x", "team": "a", "nudl.squat.ai/SanDisk_Ultra": "true"}, node().Labels)
+
+			// The clean up removes the labels and annotations with the prefix.
+			require.NoError(t, lb.cleanUp(ctx, logger))
+			n = node()
+			assert.Equal(t, map[string]string{"other": "x", "team": "a"}, n.Labels)
+			for k := range n.Annotations {
+				assert.False(t, strings.HasPrefix(k, *labelPrefix+"/"), k)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	usbInventory = flag.Bool("usb-inventory", false, "create a cluster-scoped NodeUSBInventory custom resource named after the node with the devices of the node, the CRD must be installed")
+
+	usbInventoryResource = schema.GroupVersionResource{Group: "nudl.squat.ai", Version: "v1alpha1", Resource: "nodeusbinventories"}
+)
+
+// usbInventoryPublisher applies a NodeUSBInventory with the devices of the node,
+// so other controllers can consume the devices without parsing label keys.
+type usbInventoryPublisher struct {
+	client dynamic.Interface
+}
+
+func newUSBInventoryPublisher(config *rest.Config) (*usbInventoryPublisher, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	return &usbInventoryPublisher{client: client}, nil
+}
+
+func (p *usbInventoryPublisher) Name() string {
+	return "usb-inventory"
+}
+
+// PublishInventory applies the spec and then the status, which is a subresource.
+func (p *usbInventoryPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	o := usbInventoryObject(inv)
+	status := o.Object["status"]
+	delete(o.Object, "status")
+	if _, err := p.client.Resource(usbInventoryResource).Apply(ctx, o.GetName(), o, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+		return fmt.Errorf("could not apply NodeUSBInventory %q: %w", o.GetName(), err)
+	}
+	o.Object["status"] = status
+	if _, err := p.client.Resource(usbInventoryResource).ApplyStatus(ctx, o.GetName(), o, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+		return fmt.Errorf("could not apply status of NodeUSBInventory %q: %w", o.GetName(), err)
+	}
+	return nil
+}
+
+func (p *usbInventoryPublisher) PublishEvents(_ context.Context, _ []event) error {
+	return nil
+}
+
+// Close deletes the NodeUSBInventory, unless in once mode or without cleanup-on-exit.
+func (p *usbInventoryPublisher) Close() error {
+	if keepOnExit() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *publishTimeout)
+	defer cancel()
+	if err := p.client.Resource(usbInventoryResource).Delete(ctx, *hostname, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete NodeUSBInventory: %w", err)
+	}
+	return nil
+}
+
+// usbInventoryObject returns a NodeUSBInventory with the usb devices that are not filtered, sorted by port and id.
+func usbInventoryObject(inv inventory) *unstructured.Unstructured {
+	ds := make([]device, 0, len(inv.Devices))
+	for _, d := range inv.Devices {
+		if !filtered(d) && isUSB(d) {
+			ds = append(ds, d)
+		}
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Port != ds[j].Port {
+			return ds[i].Port < ds[j].Port
+		}
+		return ds[i].ID < ds[j].ID
+	})
+	devices := make([]interface{}, 0, len(ds))
+	for _, d := range ds {
+		m := map[string]interface{}{
+			"id":          d.ID,
+			"key":         d.Key,
+			"description": d.Description,
+		}
+		if vendor, product, ok := vendorProduct(d); ok {
+			m["vendor"] = vendor
+			m["product"] = product
+		}
+		for k, v := range map[string]string{"serial": d.Serial, "speed": d.Speed, "port": d.Port} {
+			if v != "" {
+				m[k] = v
+			}
+		}
+		devices = append(devices, m)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": usbInventoryResource.GroupVersion().String(),
+		"kind":       "NodeUSBInventory",
+		"metadata": map[string]interface{}{
+			"name": inv.Node,
+		},
+		"spec": map[string]interface{}{
+			"nodeName": inv.Node,
+		},
+		"status": map[string]interface{}{
+			"devices":     devices,
+			"lastUpdated": inv.Time.UTC().Format(time.RFC3339),
+		},
+	}}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestUSBInventoryObject(t *testing.T) {
+	o := usbInventoryObject(inventory{
+		Node: "node",
+		Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Devices: []device{
+			{ID: "2341_0043", Key: "arduino", Description: "Arduino", Port: "1-2", Serial: "7573530303235", Speed: "full"},
+			{ID: "1d6b_0002", Key: "hub", Description: "Hub", Port: "usb1"},
+		},
+	})
+	assert.Equal(t, "node", o.GetName())
+	node, _, err := unstructured.NestedString(o.Object, "spec", "nodeName")
+	require.NoError(t, err)
+	assert.Equal(t, "node", node)
+	updated, _, err := unstructured.NestedString(o.Object, "status", "lastUpdated")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-02T03:04:05Z", updated)
+	ds, _, err := unstructured.NestedSlice(o.Object, "status", "devices")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": "2341_0043", "key": "arduino", "description": "Arduino", "vendor": "2341", "product": "0043", "port": "1-2", "serial": "7573530303235", "speed": "full"},
+		map[string]interface{}{"id": "1d6b_0002", "key": "hub", "description": "Hub", "vendor": "1d6b", "product": "0002", "port": "usb1"},
+	}, ds)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	kafkaSASLPlain       = "plain"
+	kafkaSASLSCRAMSHA256 = "scram-sha-256"
+	kafkaSASLSCRAMSHA512 = "scram-sha-512"
+)
+
+var (
+	kafkaBrokers        = flag.StringSlice("kafka-brokers", []string{}, "addresses of the Kafka brokers to publish the inventory and events to, e.g. kafka:9092. Kafka is disabled if empty.")
+	kafkaInventoryTopic = flag.String("kafka-inventory-topic", "nudl-inventory", "Kafka topic for the inventory, the inventory is not published if empty")
+	kafkaEventTopic     = flag.String("kafka-event-topic", "nudl-events", "Kafka topic for attach and detach events, events are not published if empty")
+	kafkaSASLMechanism  = flag.String("kafka-sasl-mechanism", "", fmt.Sprintf("SASL mechanism to authenticate with, possible values are: %s, %s, %s. SASL is disabled if empty.", kafkaSASLPlain, kafkaSASLSCRAMSHA256, kafkaSASLSCRAMSHA512))
+	kafkaUsername       = flag.String("kafka-username", "", "username for SASL")
+	kafkaPasswordFile   = flag.String("kafka-password-file", "", "path to a file containing the password for SASL")
+	kafkaTLS            = flag.Bool("kafka-tls", false, "connect to the Kafka brokers with TLS")
+	kafkaTLSFlags       = newTLSFlags("kafka", "Kafka brokers")
+	kafkaCloudEvents    = flag.Bool("kafka-cloudevents", false, "publish the messages as CloudEvents in the binary content mode of the Kafka protocol binding")
+)
+
+// kafkaPublisher publishes the inventory and events to Kafka topics.
+// The hostname is the key of all messages, so the messages of a node are ordered within a partition.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher() (*kafkaPublisher, error) {
+	t := &kafka.Transport{
+		ClientID: fmt.Sprintf("nudl-%s", *hostname),
+	}
+	if *kafkaTLS || kafkaTLSFlags.enabled() {
+		c, err := kafkaTLSFlags.config()
+		if err != nil {
+			return nil, err
+		}
+		t.TLS = c
+	}
+	if *kafkaSASLMechanism != "" {
+		m, err := kafkaSASL()
+		if err != nil {
+			return nil, err
+		}
+		t.SASL = m
+	}
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(*kafkaBrokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Messages are written synchronously, so there is no need to wait for a batch.
+		BatchTimeout: 10 * time.Millisecond,
+		Transport:    t,
+	}}, nil
+}
+
+func kafkaSASL() (sasl.Mechanism, error) {
+	var password string
+	if *kafkaPasswordFile != "" {
+		p, err := os.ReadFile(*kafkaPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read Kafka password file: %w", err)
+		}
+		password = strings.TrimSpace(string(p))
+	}
+	switch *kafkaSASLMechanism {
+	case kafkaSASLPlain:
+		return plain.Mechanism{Username: *kafkaUsername, Password: password}, nil
+	case kafkaSASLSCRAMSHA256:
+		return scram.Mechanism(scram.SHA256, *kafkaUsername, password)
+	case kafkaSASLSCRAMSHA512:
+		return scram.Mechanism(scram.SHA512, *kafkaUsername, password)
+	default:
+		return nil, fmt.Errorf("SASL mechanism %q unknown; possible values are: %s, %s, %s", *kafkaSASLMechanism, kafkaSASLPlain, kafkaSASLSCRAMSHA256, kafkaSASLSCRAMSHA512)
+	}
+}
+
+func (p *kafkaPublisher) Name() string {
+	return "kafka"
+}
+
+func (p *kafkaPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	if *kafkaInventoryTopic == "" {
+		return nil
+	}
+	m, err := kafkaMessage(*kafkaInventoryTopic, cloudEventTypeInventory, "", inv.Time, inv)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, m)
+}
+
+func (p *kafkaPublisher) PublishEvents(ctx context.Context, es []event) error {
+	if *kafkaEventTopic == "" || len(es) == 0 {
+		return nil
+	}
+	ms := make([]kafka.Message, 0, len(es))
+	for _, e := range es {
+		t := cloudEventTypeAttached
+		if e.Type == eventDetached {
+			t = cloudEventTypeDetached
+		}
+		m, err := kafkaMessage(*kafkaEventTopic, t, e.Device.Key, e.Time, e)
+		if err != nil {
+			return err
+		}
+		ms = append(ms, m)
+	}
+	return p.writer.WriteMessages(ctx, ms...)
+}
+
+// kafkaMessage creates a message with the JSON encoded value.
+// If kafka-cloudevents is set, the CloudEvents attributes are added as headers.
+func kafkaMessage(topic, typ, subject string, t time.Time, v interface{}) (kafka.Message, error) {
+	m := kafka.Message{Topic: topic, Key: []byte(*hostname)}
+	if !*kafkaCloudEvents {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return m, err
+		}
+		m.Value = data
+		return m, nil
+	}
+	ce, err := newCloudEvent(typ, *hostname, subject, t, v)
+	if err != nil {
+		return m, err
+	}
+	m.Value = ce.Data
+	m.Headers = []kafka.Header{
+		{Key: "content-type", Value: []byte(ce.DataContentType)},
+		{Key: "ce_specversion", Value: []byte(ce.SpecVersion)},
+		{Key: "ce_id", Value: []byte(ce.ID)},
+		{Key: "ce_source", Value: []byte(ce.Source)},
+		{Key: "ce_type", Value: []byte(ce.Type)},
+		{Key: "ce_time", Value: []byte(ce.Time.Format(time.RFC3339Nano))},
+	}
+	if ce.Subject != "" {
+		m.Headers = append(m.Headers, kafka.Header{Key: "ce_subject", Value: []byte(ce.Subject)})
+	}
+	return m, nil
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
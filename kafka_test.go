@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaMessage(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+	e := event{Node: "node", Time: time.Now(), Type: eventAttached, Device: device{ID: "a_a", Key: "a"}}
+
+	m, err := kafkaMessage("events", cloudEventTypeAttached, "a", e.Time, e)
+	require.NoError(t, err)
+	assert.Equal(t, "events", m.Topic)
+	assert.Equal(t, []byte("node"), m.Key)
+	assert.Empty(t, m.Headers)
+	var got event
+	require.NoError(t, json.Unmarshal(m.Value, &got))
+	assert.Equal(t, e.Device, got.Device)
+
+	*kafkaCloudEvents = true
+	defer func() { *kafkaCloudEvents = false }()
+	m, err = kafkaMessage("events", cloudEventTypeAttached, "a", e.Time, e)
+	require.NoError(t, err)
+	headers := make(map[string]string)
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	assert.Equal(t, cloudEventTypeAttached, headers["ce_type"])
+	assert.Equal(t, "/nudl/nodes/node", headers["ce_source"])
+	assert.Equal(t, "a", headers["ce_subject"])
+	require.NoError(t, json.Unmarshal(m.Value, &got))
+	assert.Equal(t, e.Device, got.Device)
+}
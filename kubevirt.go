@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	kubevirt               = flag.Bool("kubevirt", false, "annotate the node with the USB host devices in the format of the permittedHostDevices of KubeVirt")
+	kubevirtResourcePrefix = flag.String("kubevirt-resource-prefix", "nudl.squat.ai", "prefix of the KubeVirt resource names, the resource name of a device is <prefix>/<key>")
+)
+
+// kubevirtUSBHostDevice is an entry of permittedHostDevices.usb in the KubeVirt custom resource.
+type kubevirtUSBHostDevice struct {
+	ResourceName string                `json:"resourceName"`
+	Selectors    []kubevirtUSBSelector `json:"selectors"`
+}
+
+type kubevirtUSBSelector struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+}
+
+func kubevirtAnnotationKey() string {
+	return sprintLabelKey("kubevirt-usb-host-devices")
+}
+
+// kubevirtHostDevices returns one host device for every usb device model that is not filtered, sorted by the resource name.
+func kubevirtHostDevices(ds []device) []kubevirtUSBHostDevice {
+	m := make(map[string]kubevirtUSBHostDevice, len(ds))
+	for _, d := range ds {
+		if filtered(d) || !isUSB(d) {
+			continue
+		}
+		vendor, product, ok := strings.Cut(d.ID, "_")
+		if !ok {
+			continue
+		}
+		name := fmt.Sprintf("%s/%s", *kubevirtResourcePrefix, d.Key)
+		m[name] = kubevirtUSBHostDevice{
+			ResourceName: name,
+			Selectors:    []kubevirtUSBSelector{{Vendor: vendor, Product: product}},
+		}
+	}
+	hds := make([]kubevirtUSBHostDevice, 0, len(m))
+	for _, hd := range m {
+		hds = append(hds, hd)
+	}
+	sort.Slice(hds, func(i, j int) bool {
+		return hds[i].ResourceName < hds[j].ResourceName
+	})
+	return hds
+}
+
+// kubevirtAnnotations returns the annotations to patch.
+// The annotation is deleted if KubeVirt is disabled or the node is cleaned up.
+func kubevirtAnnotations(current map[string]string, ds []device, clean bool) (map[string]*string, error) {
+	k := kubevirtAnnotationKey()
+	_, exists := current[k]
+	if !*kubevirt || clean {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	data, err := json.Marshal(kubevirtHostDevices(ds))
+	if err != nil {
+		return nil, err
+	}
+	v := string(data)
+	if current[k] == v {
+		return nil, nil
+	}
+	return map[string]*string{k: &v}, nil
+}
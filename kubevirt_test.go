@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubevirtAnnotations(t *testing.T) {
+	*kubevirt = true
+	defer func() { *kubevirt = false }()
+	k := kubevirtAnnotationKey()
+	ds := []device{{ID: "046d_c52b", Key: "046d_c52b"}, {ID: "046d_c52b", Key: "046d_c52b"}, {ID: "1a86_7523", Key: "1a86_7523"}}
+	want := `[{"resourceName":"nudl.squat.ai/046d_c52b","selectors":[{"vendor":"046d","product":"c52b"}]},{"resourceName":"nudl.squat.ai/1a86_7523","selectors":[{"vendor":"1a86","product":"7523"}]}]`
+
+	a, err := kubevirtAnnotations(nil, ds, false)
+	require.NoError(t, err)
+	require.NotNil(t, a[k])
+	assert.Equal(t, want, *a[k])
+
+	a, err = kubevirtAnnotations(map[string]string{k: want}, ds, false)
+	require.NoError(t, err)
+	assert.Empty(t, a)
+
+	a, err = kubevirtAnnotations(map[string]string{k: want}, ds, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{k: nil}, a)
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/utils/clock"
+)
+
+// labeler scans the devices, labels the node with name hostname and publishes the devices.
+// The clientset, the scanners and the clock are injected, so the reconciliation can be tested with fakes.
+// A labeler must not be used concurrently.
+type labeler struct {
+	clientset  kubernetes.Interface
+	clock      clock.PassiveClock
+	scanners   []*scanRunner
+	dispatcher *dispatcher
+	problems   *problemDetector
+	presence   *presenceTracker
+	flaps      *flapDetector
+	grace      *graceTracker
+	unknown    *unknownDeviceLogger
+	// podResources is used to label the free devices, if device-resources is set.
+	podResources podresourcesv1.PodResourcesListerClient
+	// out receives the patches instead of the node, if dry-run is set.
+	out    io.Writer
+	health *health
+	// id identifies the instance in the owner annotation.
+	id string
+	// pod is the namespace and name of the pod of the instance in the owner annotation, if it is known.
+	pod string
+	// sink receives the labels instead of the node, if it is set.
+	sink sink
+	// devices serves the devices of the last successful scan.
+	devices *devicesAPI
+	// firstSeen serves the inventory of the last successful scan.
+	firstSeen *firstSeenTracker
+	// nodes caches the node, if node-cache is set.
+	nodes *nodeCache
+	// targets are the names of the nodes that were labeled in the last successful reconciliation, if nodes or node-selector is set.
+	targets []string
+
+	// fingerprint is the fingerprint of the devices that were labeled in the last successful reconciliation.
+	fingerprint uint64
+	synced      time.Time
+	// changed is the time when a change of the devices was detected the last time.
+	changed time.Time
+	// patched is the time of the last patch of the node, successful or not.
+	patched time.Time
+	// failures is the number of consecutive failed reconciliations.
+	failures int
+	// execs runs the programs of scanner-exec.
+	execs *execLabeler
+	// ready reports the health in the nudl_ready gauge and the NudlHealthy node condition.
+	ready *healthReporter
+	// collected holds the names of the nodes whose stale labels and annotations were removed, if gc-on-start is set.
+	collected map[string]bool
+}
+
+func newLabeler(clientset kubernetes.Interface, c clock.PassiveClock, publishers []publisher, scanners ...scanner) *labeler {
+	return &labeler{
+		clientset:  clientset,
+		clock:      c,
+		scanners:   newScanRunners(c, scanners...),
+		dispatcher: newDispatcher(c, publishers...),
+		problems:   newProblemDetector(c),
+		presence:   newPresenceTracker(),
+		flaps:      newFlapDetector(c),
+		grace:      newGraceTracker(c),
+		unknown:    newUnknownDeviceLogger(c),
+		out:        os.Stdout,
+		health:     newHealth(c),
+		id:         newInstanceID(),
+		pod:        instancePod(),
+		devices:    &devicesAPI{},
+		firstSeen:  newFirstSeenTracker(),
+		ready:      newHealthReporter(c),
+		execs:      newExecLabeler(*scannerExecs),
+		collected:  make(map[string]bool),
+	}
+}
+
+// resync makes the next reconciliation label the node, even if the devices did not change.
+func (lb *labeler) resync() {
+	lb.synced = time.Time{}
+}
+
+// updateInterval returns the time between two reconciliations.
+// After a change of the devices was detected, the node is reconciled every update-time for fast-update-window,
+// afterwards every steady-update-time.
+func (lb *labeler) updateInterval() time.Duration {
+	if *steadyUpdateTime > 0 && lb.clock.Since(lb.changed) > *fastUpdateWindow {
+		return *steadyUpdateTime
+	}
+	return *updateTime
+}
+
+// scanAndLabel scans and labels the node with name hostname or returns an error.
+// If the devices did not change since the last successful reconciliation,
+// the node is only labeled again after resync-period.
+func (lb *labeler) scanAndLabel(ctx context.Context, logger log.Logger) error {
+	// Scan devices.
+	ds, failed := scanAll(ctx, lb.scanners, logger)
+	err := errors.Join(failed...)
+	lb.problems.check(ctx, lb.clientset, ds, err, lb.scanners, logger)
+	var wedged []string
+	for _, r := range lb.scanners {
+		if r.wedged() {
+			wedged = append(wedged, r.Name())
+		}
+	}
+	lb.health.scannersWedged(wedged)
+	if len(failed) > 0 && len(failed) == len(lb.scanners) {
+		return fmt.Errorf("could not scan devices: %w", err)
+	}
+	if len(failed) > 0 {
+		// The devices of the other scanners are labeled, the failed scanners are reported in the metrics and node conditions.
+		level.Warn(logger).Log("msg", "some scanners failed, labeling the devices of the others", "err", err)
+	} else {
+		level.Debug(logger).Log("msg", "successfully scanned devices")
+	}
+	lb.health.scanSucceeded()
+	lb.devices.update(ds, lb.clock.Now())
+	lb.presence.update(ds)
+	lb.flaps.update(ds)
+	lb.unknown.update(ds, logger)
+	lb.dispatcher.dispatch(ds, logger)
+	collisionGauge.Set(float64(len(collisions(ds))))
+	// Devices that disappeared recently are still labeled, but the events above are published immediately.
+	ds = lb.grace.retain(ds)
+	lb.firstSeen.update(ds, lb.clock.Now())
+	fp := fingerprint(ds)
+	// Labels that do not depend on the devices alone are labeled immediately when they change, like attached devices.
+	sl := make(labels)
+	if *sriov {
+		l, err := sriovLabels(*sysfsRoot)
+		if err != nil {
+			return fmt.Errorf("could not read SR-IOV capabilities: %w", err)
+		}
+		for k, v := range l {
+			sl[k] = v
+		}
+	}
+	if lb.podResources != nil {
+		l, err := allocationLabels(ctx, lb.podResources, ds)
+		if err != nil {
+			return err
+		}
+		for k, v := range l {
+			sl[k] = v
+		}
+	}
+	for k, v := range lb.flaps.labels() {
+		sl[k] = v
+	}
+	for k, v := range lb.execs.labels(ctx, logger) {
+		sl[k] = v
+	}
+	fp ^= labelsFingerprint(sl)
+	// The labels with the previous prefix are removed as soon as the migration ends.
+	if migrating(lb.clock.Now()) {
+		fp = ^fp
+	}
+	if fp != lb.fingerprint {
+		lb.changed = lb.clock.Now()
+	}
+	// With a TTL, the labels are renewed after half of the TTL at the latest.
+	// The heartbeat of the owner annotation is renewed by a resync.
+	if fp == lb.fingerprint && lb.clock.Since(lb.synced) < *resyncPeriod && (*labelTTL == 0 || lb.clock.Since(lb.synced) < *labelTTL/2) {
+		level.Debug(logger).Log("msg", "devices did not change, skipping labeling")
+		return nil
+	}
+	// The fingerprint is not updated, so the node is patched by the first reconciliation after the rate limit.
+	if *minPatchInterval > 0 && !lb.patched.IsZero() && lb.clock.Since(lb.patched) < *minPatchInterval {
+		level.Debug(logger).Log("msg", "rate limiting node patch", "until", lb.patched.Add(*minPatchInterval))
+		rateLimitedPatchCounter.Inc()
+		return nil
+	}
+	if lb.sink != nil {
+		return lb.writeSink(ctx, fp, ds, sl)
+	}
+	names, err := lb.targetNodes(ctx)
+	if err != nil {
+		return err
+	}
+	// A node that fails does not prevent the other nodes from being labeled.
+	var errs []error
+	for _, name := range names {
+		// After a conflict, the cache can still hold the version of the node that caused it,
+		// so the retries get the node from the api server.
+		var conflict bool
+		if err := retryNodeUpdate(ctx, "label", func() error {
+			err := lb.labelNode(ctx, name, ds, sl, conflict, logger)
+			conflict = conflict || retryReason(err) == retryReasonConflict
+			return err
+		}, logger); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	lb.cleanUntargeted(ctx, names, logger)
+	lb.fingerprint = fp
+	lb.synced = lb.clock.Now()
+	return nil
+}
+
+// labelNode gets the node with the name and applies the labels and annotations.
+// The node is fetched again on every call, so a retry works with the latest version of the node;
+// with latest, it is fetched from the api server even if node-cache is set.
+func (lb *labeler) labelNode(ctx context.Context, name string, ds []device, sl labels, latest bool, logger log.Logger) error {
+	node, err := lb.getNode(ctx, name, latest)
+	lb.health.gotNode(err)
+	if err != nil {
+		return err
+	}
+	if o, err := checkOwner(node.ObjectMeta.Annotations, lb.id, lb.clock.Now()); err != nil {
+		gone, perr := ownerPodGone(ctx, lb.clientset, o)
+		if perr != nil {
+			level.Debug(logger).Log("msg", "could not get the pod of the other nudl instance", "owner", o.ID, "pod", o.Pod, "err", perr)
+		}
+		if !gone {
+			return err
+		}
+		level.Warn(logger).Log("msg", "taking over the node from another nudl instance whose pod does not exist anymore", "owner", o.ID, "pod", o.Pod, "heartbeat", o.Heartbeat)
+	} else if o != nil {
+		level.Warn(logger).Log("msg", "taking over the node from another nudl instance", "owner", o.ID, "heartbeat", o.Heartbeat)
+	}
+	nl := make(labels)
+	if publishLabels() {
+		nl = createLabels(ds)
+	}
+	for k, v := range sl {
+		nl[k] = v
+	}
+	addMigrationLabels(nl, lb.clock.Now())
+	nl = withoutPreserved(nl)
+	na, err := kubevirtAnnotations(node.ObjectMeta.Annotations, ds, false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	if expired, err := expiredLabels(node.ObjectMeta.Annotations, lb.clock.Now()); err != nil {
+		level.Warn(logger).Log("msg", "could not parse label expiry annotation", "err", err)
+	} else if len(expired) > 0 {
+		level.Warn(logger).Log("msg", "labels expired before they were renewed", "labels", strings.Join(expired, ","))
+	}
+	ta, err := ttlAnnotations(node.ObjectMeta.Annotations, nl, lb.clock.Now(), false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	na = mergeAnnotations(na, ta)
+	da, err := detailsAnnotations(node.ObjectMeta.Annotations, ds, false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	na = mergeAnnotations(na, da)
+	ia, err := lb.firstSeen.inventoryAnnotations(node.ObjectMeta.Annotations, false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	na = mergeAnnotations(na, ia)
+	la, err := lastSeenAnnotations(node.ObjectMeta.Annotations, nl, ds, false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	na = mergeAnnotations(na, la)
+	pa, err := podDevicesAnnotations(node.ObjectMeta.Annotations, ds, false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	na = mergeAnnotations(na, pa)
+	sa, err := snapshotAnnotations(node.ObjectMeta.Annotations, node.ObjectMeta.Labels, lb.clock.Now(), false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	na = mergeAnnotations(na, sa)
+	gc := *gcOnStart && !lb.collected[node.Name]
+	if gc {
+		na = mergeAnnotations(na, gcAnnotations(node.ObjectMeta.Annotations, node.ObjectMeta.Labels, nl, logger))
+	}
+	if *metadataBudget > 0 {
+		na = withUnchangedAnnotations(node.ObjectMeta.Annotations, na)
+	}
+	pruned := pruneMetadata(nl, na)
+	if len(pruned) > 0 {
+		level.Warn(logger).Log("msg", "pruned labels and annotations to stay within the metadata budget", "pruned", strings.Join(pruned, ","))
+	}
+	metadataPrunedGauge.Set(float64(len(pruned)))
+	metadataBytesGauge.Set(float64(metadataSize(nl, na)))
+	labelGauge.Set(float64(len(nl)))
+	if *dryRun {
+		return lb.printDryRun(node, nl, na)
+	}
+	// The owner is never pruned and not printed in a dry run, because the instance does not label the node.
+	oa, err := ownerAnnotations(node.ObjectMeta.Annotations, lb.id, lb.pod, lb.clock.Now(), false)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations for node %q: %w", node.Name, err)
+	}
+	na = mergeAnnotations(na, oa)
+	nn := node
+	if metadataChanged(node, nl, na) {
+		nn, err = writeNode(ctx, lb.clientset, node, nl, na, logger)
+		lb.patched = lb.clock.Now()
+		audit(node.Name, "label", filter(node.ObjectMeta.Labels), nl, err)
+		if err != nil {
+			return fmt.Errorf("failed to patch node: %w", err)
+		}
+		level.Debug(logger).Log("msg", fmt.Sprintf("patched labels: %v", nn.ObjectMeta.Labels))
+	} else {
+		level.Debug(logger).Log("msg", "labels and annotations did not change, skipping patch")
+		skippedPatchCounter.Inc()
+	}
+	if gc {
+		lb.collected[node.Name] = true
+	}
+	if *extendedResources || hasRuleResources() {
+		if err := lb.advertise(ctx, node, ds, false, logger); err != nil {
+			return err
+		}
+	}
+	if *rulesFile != "" {
+		if nn, err = lb.ruleTaint(ctx, nn, ds, logger); err != nil {
+			return err
+		}
+	}
+	if *taintWhenMissing != "" {
+		if err := lb.taint(ctx, nn, missingOnly(ds), logger); err != nil {
+			return err
+		}
+	}
+	if *cordonMissing {
+		if err := lb.cordon(ctx, node, missingDevices(ds), logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSink writes the labels to the sink instead of the node.
+func (lb *labeler) writeSink(ctx context.Context, fp uint64, ds []device, sl labels) error {
+	// No node is needed to be ready.
+	lb.health.gotNode(nil)
+	nl := createLabels(ds)
+	for k, v := range sl {
+		nl[k] = v
+	}
+	addMigrationLabels(nl, lb.clock.Now())
+	labelGauge.Set(float64(len(nl)))
+	if err := lb.sink.Write(ctx, nl); err != nil {
+		return fmt.Errorf("could not write labels: %w", err)
+	}
+	lb.fingerprint = fp
+	lb.synced = lb.clock.Now()
+	return nil
+}
+
+// taint taints the node if devices in only are missing and removes the taint when they are present again.
+func (lb *labeler) taint(ctx context.Context, node *v1.Node, missing []string, logger log.Logger) error {
+	// The flag is validated on start.
+	t, _ := parseTaint(*taintWhenMissing)
+	patch, err := taintPatch(node, t, len(missing) > 0)
+	if err != nil {
+		return fmt.Errorf("failed to create taint patch for node %q: %w", node.Name, err)
+	}
+	if patch == nil {
+		return nil
+	}
+	if _, err := lb.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+		return fmt.Errorf("failed to taint or untaint node: %w", err)
+	}
+	if len(missing) > 0 {
+		level.Info(logger).Log("msg", "tainted node, because devices are missing", "taint", t.ToString(), "missing", strings.Join(missing, ","))
+	} else {
+		level.Info(logger).Log("msg", "removed taint from node, because all devices are present", "taint", t.ToString())
+	}
+	return nil
+}
+
+// untaint removes the taints of taint-when-missing and the rules from the node, e.g. on clean up,
+// so the node is not left tainted for devices that nudl no longer watches.
+func (lb *labeler) untaint(ctx context.Context, node *v1.Node, logger log.Logger) error {
+	patch, err := untaintPatch(node, ownedTaints(node))
+	if err != nil {
+		return fmt.Errorf("failed to create taint patch for node %q: %w", node.Name, err)
+	}
+	if patch == nil {
+		return nil
+	}
+	if _, err := lb.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+		return fmt.Errorf("failed to untaint node: %w", err)
+	}
+	level.Info(logger).Log("msg", "removed the taints of nudl from node", "patch", string(patch))
+	return nil
+}
+
+// cordon cordons the node if required devices are missing and uncordons it when they are present again.
+func (lb *labeler) cordon(ctx context.Context, node *v1.Node, missing []string, logger log.Logger) error {
+	patch, err := cordonPatch(node, missing)
+	if err != nil {
+		return fmt.Errorf("failed to create cordon patch for node %q: %w", node.Name, err)
+	}
+	if patch == nil {
+		return nil
+	}
+	if _, err := lb.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+		return fmt.Errorf("failed to cordon or uncordon node: %w", err)
+	}
+	if len(missing) > 0 {
+		level.Info(logger).Log("msg", "cordoned node, because required devices are missing", "missing", strings.Join(missing, ","))
+	} else {
+		level.Info(logger).Log("msg", "uncordoned node, because all required devices are present")
+	}
+	return nil
+}
+
+// uncordon uncordons the node on clean up, if nudl cordoned it for missing devices.
+// A node that was cordoned by an administrator has no cordon annotation and stays cordoned.
+func (lb *labeler) uncordon(ctx context.Context, node *v1.Node, logger log.Logger) error {
+	if _, ok := node.Annotations[cordonAnnotation()]; !ok {
+		return nil
+	}
+	patch, err := cordonPatch(node, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create cordon patch for node %q: %w", node.Name, err)
+	}
+	if _, err := lb.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+		return fmt.Errorf("failed to uncordon node: %w", err)
+	}
+	level.Info(logger).Log("msg", "uncordoned node that nudl cordoned for missing devices")
+	return nil
+}
+
+// reconcile scans and labels the node and recovers from panics,
+// so a panic e.g. in gousb or usbid on an exotic device doesn't kill the process.
+func (lb *labeler) reconcile(ctx context.Context, logger log.Logger) (err error) {
+	defer func() {
+		lb.ready.reconciled(ctx, lb.clientset, err, lb.health.ready(), logger)
+	}()
+	// Deferred before recoverPanic, so it counts recovered panics as failures.
+	defer lb.countFailure(&err)
+	defer recoverPanic(logger, &err)
+	if err := lb.scanAndLabel(ctx, logger); err != nil {
+		return err
+	}
+	lb.health.reconciled(lb.updateInterval())
+	return nil
+}
+
+// cleanUp will remove all labels with the prefix labelPrefix from the node with name hostname or return an error.
+func (lb *labeler) cleanUp(ctx context.Context, logger log.Logger) error {
+	if lb.sink != nil {
+		if err := lb.sink.Clean(ctx); err != nil {
+			return fmt.Errorf("could not clean up labels: %w", err)
+		}
+		level.Info(logger).Log("msg", "successfully cleaned up labels", "sink", *sinkName)
+		return nil
+	}
+	names, err := lb.targetNodes(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		errs = append(errs, retryNodeUpdate(ctx, "clean", func() error {
+			return lb.cleanNode(ctx, name, logger)
+		}, logger))
+	}
+	return errors.Join(errs...)
+}
+
+// release removes the instance as the owner of the nodes, so another instance can label them right away,
+// e.g. the next run of once or a restarted pod, when the labels are kept on exit.
+func (lb *labeler) release(ctx context.Context, logger log.Logger) error {
+	if lb.sink != nil || *dryRun {
+		return nil
+	}
+	names, err := lb.targetNodes(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		node, err := getNamedNode(ctx, lb.clientset, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		patch, err := releaseOwnerPatch(node.Annotations, lb.id)
+		if err != nil || patch == nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := lb.clientset.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager}); err != nil {
+			errs = append(errs, fmt.Errorf("could not release node %q: %w", name, err))
+			continue
+		}
+		level.Debug(logger).Log("msg", "released node", "node", name)
+	}
+	return errors.Join(errs...)
+}
+
+// getNode returns the node with the name from the cache, if node-cache is set and latest is not, or from the api server.
+func (lb *labeler) getNode(ctx context.Context, name string, latest bool) (*v1.Node, error) {
+	if lb.nodes != nil && !latest {
+		return lb.nodes.get(ctx, lb.clientset)
+	}
+	return getNamedNode(ctx, lb.clientset, name)
+}
+
+// cleanNode gets the node with the name and removes the labels and annotations.
+// The node is always fetched from the api server, because the cache stops with the labeler.
+func (lb *labeler) cleanNode(ctx context.Context, name string, logger log.Logger) error {
+	node, err := getNamedNode(ctx, lb.clientset, name)
+	if err != nil {
+		return err
+	}
+	// During e.g. a rolling update, the labels of the node are managed by the new instance.
+	if o, _ := checkOwner(node.ObjectMeta.Annotations, lb.id, lb.clock.Now()); o != nil {
+		level.Info(logger).Log("msg", "not cleaning up the node, because another nudl instance labels it", "owner", o.ID)
+		return nil
+	}
+	na, err := kubevirtAnnotations(node.ObjectMeta.Annotations, nil, true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	ta, err := ttlAnnotations(node.ObjectMeta.Annotations, nil, lb.clock.Now(), true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	na = mergeAnnotations(na, ta)
+	da, err := detailsAnnotations(node.ObjectMeta.Annotations, nil, true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	na = mergeAnnotations(na, da)
+	ia, err := lb.firstSeen.inventoryAnnotations(node.ObjectMeta.Annotations, true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	na = mergeAnnotations(na, ia)
+	la, err := lastSeenAnnotations(node.ObjectMeta.Annotations, nil, nil, true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	na = mergeAnnotations(na, la)
+	pa, err := podDevicesAnnotations(node.ObjectMeta.Annotations, nil, true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	na = mergeAnnotations(na, pa)
+	sa, err := snapshotAnnotations(node.ObjectMeta.Annotations, node.ObjectMeta.Labels, lb.clock.Now(), true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	na = mergeAnnotations(na, sa)
+	oa, err := ownerAnnotations(node.ObjectMeta.Annotations, lb.id, lb.pod, lb.clock.Now(), true)
+	if err != nil {
+		return fmt.Errorf("failed to create annotations: %w", err)
+	}
+	na = mergeAnnotations(na, oa)
+	if *dryRun {
+		return lb.printDryRun(node, nil, na)
+	}
+	nn, err := writeNode(ctx, lb.clientset, node, nil, na, logger)
+	audit(node.Name, "clean", filter(node.ObjectMeta.Labels), nil, err)
+	if err != nil {
+		return fmt.Errorf("could not patch node: %w", err)
+	}
+	if err := lb.untaint(ctx, nn, logger); err != nil {
+		return err
+	}
+	if err := lb.uncordon(ctx, node, logger); err != nil {
+		return err
+	}
+	if *extendedResources || hasRuleResources() {
+		if err := lb.advertise(ctx, node, nil, true, logger); err != nil {
+			return err
+		}
+	}
+	level.Info(logger).Log("msg", "successfully cleaned node")
+	level.Debug(logger).Log("msg", fmt.Sprintf("labels of cleaned node: %v", nn.ObjectMeta.Labels))
+	return nil
+}
+
+// dryRunResult is printed instead of patching the node, if dry-run is set.
+type dryRunResult struct {
+	Node   string          `json:"node"`
+	Labels labels          `json:"labels"`
+	Patch  json.RawMessage `json:"patch"`
+}
+
+// printDryRun prints the labels and the equivalent strategic merge patch of the node as a JSON line.
+func (lb *labeler) printDryRun(node *v1.Node, nl labels, na map[string]*string) error {
+	patch, err := labelPatch(node.ObjectMeta.Labels, nl, na)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for node %q: %w", node.Name, err)
+	}
+	if err := json.NewEncoder(lb.out).Encode(dryRunResult{Node: node.Name, Labels: nl, Patch: patch}); err != nil {
+		return fmt.Errorf("could not print patch: %w", err)
+	}
+	return nil
+}
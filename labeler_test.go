@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestLabeler(t *testing.T) {
+	old := *hostname
+	*hostname = "node1"
+	t.Cleanup(func() { *hostname = old })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node1",
+		Labels: map[string]string{"other": "x", "nudl.squat.ai/stale": "true"},
+	}})
+	ds := []device{{ID: "046d_c52b", Key: "Logitech_Receiver", Description: "Receiver (Logitech, Inc.)"}}
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return ds, nil
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	lb := newLabeler(clientset, c, nil, s)
+	ctx := context.Background()
+
+	nodeLabels := func() map[string]string {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return n.Labels
+	}
+	// The fake clientset applies like a strategic merge patch, so labels that are not applied anymore are deleted with an additional patch.
+	// Only the applies are counted.
+	patches := func() int {
+		n := 0
+		for _, a := range clientset.Actions() {
+			if p, ok := a.(k8stesting.PatchAction); ok && p.GetPatchType() == types.ApplyPatchType {
+				n++
+			}
+		}
+		return n
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, map[string]string{"other": "x", "nudl.squat.ai/Logitech_Receiver": "true"}, nodeLabels())
+	assert.Equal(t, 1, patches())
+
+	// Unchanged devices are not labeled again before the resync.
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, 1, patches())
+	// The resync does not patch the node, if the labels did not change.
+	skipped := func() float64 {
+		var m dto.Metric
+		require.NoError(t, skippedPatchCounter.Write(&m))
+		return m.GetCounter().GetValue()
+	}
+	before := skipped()
+	c.SetTime(c.Now().Add(*resyncPeriod))
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, 1, patches())
+	assert.Equal(t, before+1, skipped())
+	// The heartbeat of the owner is renewed by the next resync, after half of the owner timeout.
+	c.SetTime(c.Now().Add(*resyncPeriod))
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, 2, patches())
+
+	// Changed devices are labeled immediately.
+	ds = nil
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, map[string]string{"other": "x"}, nodeLabels())
+	assert.Equal(t, 3, patches())
+	assert.Equal(t, *updateTime, lb.updateInterval())
+
+	ds = []device{{ID: "0781_5581", Key: "Ultra", Description: "Ultra (SanDisk Corp.)"}}
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	require.NoError(t, lb.cleanUp(ctx, log.NewNopLogger()))
+	assert.Equal(t, map[string]string{"other": "x"}, nodeLabels())
+}
+
+func TestLabelerMinPatchInterval(t *testing.T) {
+	oldHostname, oldInterval := *hostname, *minPatchInterval
+	*hostname, *minPatchInterval = "node1", time.Minute
+	t.Cleanup(func() { *hostname, *minPatchInterval = oldHostname, oldInterval })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	ds := []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return ds, nil
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	lb := newLabeler(clientset, c, nil, s)
+	ctx := context.Background()
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	// A flapping device is not patched again within the interval.
+	ds = nil
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"nudl.squat.ai/Logitech_Receiver": "true"}, n.Labels)
+
+	c.SetTime(c.Now().Add(time.Minute))
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	n, err = clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, n.Labels)
+}
+
+func TestLabelerCordonMissing(t *testing.T) {
+	oldHostname, oldCordon, oldRequired := *hostname, *cordonMissing, *requiredDevices
+	*hostname, *cordonMissing, *requiredDevices = "node1", true, []string{"Tuner"}
+	t.Cleanup(func() { *hostname, *cordonMissing, *requiredDevices = oldHostname, oldCordon, oldRequired })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	ds := []device{{ID: "2040_826d", Key: "Tuner"}}
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return ds, nil
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	ctx := context.Background()
+	node := func() *v1.Node {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return n
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.False(t, node().Spec.Unschedulable)
+
+	ds = nil
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.True(t, node().Spec.Unschedulable)
+	assert.Equal(t, "Tuner", node().Annotations[cordonAnnotation()])
+
+	ds = []device{{ID: "2040_826d", Key: "Tuner"}}
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.False(t, node().Spec.Unschedulable)
+	assert.NotContains(t, node().Annotations, cordonAnnotation())
+
+	// The node is uncordoned on clean up, if nudl cordoned it.
+	ds = nil
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.True(t, node().Spec.Unschedulable)
+	require.NoError(t, lb.cleanUp(ctx, log.NewNopLogger()))
+	assert.False(t, node().Spec.Unschedulable)
+	assert.NotContains(t, node().Annotations, cordonAnnotation())
+
+	// A node that an administrator cordoned stays cordoned.
+	n := node()
+	n.Spec.Unschedulable = true
+	_, err := clientset.CoreV1().Nodes().Update(ctx, n, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, lb.cleanUp(ctx, log.NewNopLogger()))
+	assert.True(t, node().Spec.Unschedulable)
+}
+
+func TestCordonPatchKeepsAdministratorCordon(t *testing.T) {
+	n := &v1.Node{Spec: v1.NodeSpec{Unschedulable: true}}
+	for _, missing := range [][]string{nil, {"Tuner"}} {
+		p, err := cordonPatch(n, missing)
+		require.NoError(t, err)
+		assert.Nil(t, p)
+	}
+}
+
+func TestLabelerDryRun(t *testing.T) {
+	oldHostname := *hostname
+	*hostname = "node1"
+	*dryRun = true
+	t.Cleanup(func() { *hostname, *dryRun = oldHostname, false })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node1",
+		Labels: map[string]string{"nudl.squat.ai/stale": "true"},
+	}})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver", Description: "Receiver (Logitech, Inc.)"}}, nil
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	var out bytes.Buffer
+	lb.out = &out
+
+	require.NoError(t, lb.reconcile(context.Background(), log.NewNopLogger()))
+	assert.JSONEq(t, `{"node":"node1","labels":{"nudl.squat.ai/Logitech_Receiver":"true"},"patch":{"metadata":{"labels":{"nudl.squat.ai/Logitech_Receiver":"true","nudl.squat.ai/stale":null}}}}`, out.String())
+	for _, a := range clientset.Actions() {
+		assert.NotEqual(t, "patch", a.GetVerb())
+	}
+
+	out.Reset()
+	require.NoError(t, lb.cleanUp(context.Background(), log.NewNopLogger()))
+	assert.JSONEq(t, `{"node":"node1","labels":null,"patch":{"metadata":{"labels":{"nudl.squat.ai/stale":null}}}}`, out.String())
+	for _, a := range clientset.Actions() {
+		assert.NotEqual(t, "patch", a.GetVerb())
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// labelValueLastSeen sets the value of the device labels to the time the devices were last seen.
+const labelValueLastSeen = "last-seen"
+
+var lastSeenAnnotation = flag.Bool("last-seen-annotation", false, "annotate the node with the time in RFC 3339 when the devices of every device label were last seen, also for absent devices of only")
+
+// lastSeenAnnotationKey returns the key of the annotation that holds the last seen times.
+func lastSeenAnnotationKey() string {
+	return sprintLabelKey("last-seen")
+}
+
+// stampLastSeen returns a copy of the devices that were seen at the time.
+func stampLastSeen(ds []device, t time.Time) []device {
+	sds := make([]device, len(ds))
+	for i, d := range ds {
+		d.LastSeen = t
+		sds[i] = d
+	}
+	return sds
+}
+
+// lastSeen returns the latest time the devices were seen, or the zero time.
+func lastSeen(ds []device) time.Time {
+	var t time.Time
+	for _, d := range ds {
+		if d.LastSeen.After(t) {
+			t = d.LastSeen
+		}
+	}
+	return t
+}
+
+// lastSeenValue returns the time the devices were last seen in Unix seconds, which can be compared with the Gt and Lt operators
+// of node affinities unlike an RFC 3339 time, or 0 if they were not seen.
+func lastSeenValue(ds []device) string {
+	t := lastSeen(ds)
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// lastSeenAnnotations returns the annotations to patch.
+// Device labels of absent devices, e.g. of only, keep the time of the current annotation.
+// The annotation is deleted if last-seen-annotation is not set or the node is cleaned up.
+func lastSeenAnnotations(current map[string]string, nl labels, ds []device, clean bool) (map[string]*string, error) {
+	k := lastSeenAnnotationKey()
+	v, exists := current[k]
+	if !*lastSeenAnnotation || clean {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	var previous map[string]time.Time
+	// A broken annotation is overwritten.
+	_ = json.Unmarshal([]byte(v), &previous)
+	seen := make(map[string]time.Time)
+	for _, d := range ds {
+		if filtered(d) || d.LastSeen.IsZero() {
+			continue
+		}
+		lk := sprintLabelKey(d.Key)
+		if _, ok := nl[lk]; ok && d.LastSeen.After(seen[lk]) {
+			seen[lk] = d.LastSeen.UTC().Truncate(time.Second)
+		}
+	}
+	for lk, t := range previous {
+		if _, ok := seen[lk]; !ok {
+			if _, ok := nl[lk]; ok {
+				seen[lk] = t
+			}
+		}
+	}
+	data, err := json.Marshal(seen)
+	if err != nil {
+		return nil, err
+	}
+	if v == string(data) {
+		return nil, nil
+	}
+	s := string(data)
+	return map[string]*string{k: &s}, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestLastSeenAnnotations(t *testing.T) {
+	oldAnnotation := *lastSeenAnnotation
+	*lastSeenAnnotation = true
+	t.Cleanup(func() { *lastSeenAnnotation = oldAnnotation })
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ds := stampLastSeen([]device{{ID: "2341_0043", Key: "Arduino"}}, now)
+	nl := labels{"nudl.squat.ai/Arduino": "true", "nudl.squat.ai/Receiver": "false"}
+	current := map[string]string{lastSeenAnnotationKey(): `{"nudl.squat.ai/Receiver":"2024-04-01T00:00:00Z","nudl.squat.ai/Gone":"2024-03-01T00:00:00Z"}`}
+	a, err := lastSeenAnnotations(current, nl, ds, false)
+	require.NoError(t, err)
+	require.Contains(t, a, lastSeenAnnotationKey())
+	// The absent device of only keeps its time, the time of a device that is not labeled anymore is dropped.
+	assert.JSONEq(t, `{"nudl.squat.ai/Arduino":"2024-05-01T12:00:00Z","nudl.squat.ai/Receiver":"2024-04-01T00:00:00Z"}`, *a[lastSeenAnnotationKey()])
+
+	a, err = lastSeenAnnotations(map[string]string{lastSeenAnnotationKey(): *a[lastSeenAnnotationKey()]}, nl, ds, false)
+	require.NoError(t, err)
+	assert.Empty(t, a)
+
+	a, err = lastSeenAnnotations(current, nil, nil, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{lastSeenAnnotationKey(): nil}, a)
+}
+
+func TestLabelerLastSeen(t *testing.T) {
+	oldHostname, oldLabelValue, oldOnly := *hostname, *labelValue, *only
+	*hostname, *labelValue, *only = "node1", labelValueLastSeen, []string{"Arduino", "Receiver"}
+	t.Cleanup(func() { *hostname, *labelValue, *only = oldHostname, oldLabelValue, oldOnly })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "2341_0043", Key: "Arduino"}}, nil
+	}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(now), nil, s)
+	ctx := context.Background()
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"nudl.squat.ai/Arduino":  "1714564800",
+		"nudl.squat.ai/Receiver": "0",
+	}, n.Labels)
+}
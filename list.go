@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-kit/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputWide  = "wide"
+	outputLsusb = "lsusb"
+)
+
+// listEntry is a device in the output of nudl list.
+type listEntry struct {
+	Bus         string   `json:"bus"`
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Port        string   `json:"port,omitempty"`
+	Address     int      `json:"address,omitempty"`
+	Class       string   `json:"class,omitempty"`
+	Classes     []string `json:"classes,omitempty"`
+	Speed       string   `json:"speed,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Serial      string   `json:"serial,omitempty"`
+	Drivers     []string `json:"drivers,omitempty"`
+	// Label is the key of the label of the device with the prefix, or empty if the device is not labeled, e.g. because of no-contain.
+	Label string `json:"label,omitempty"`
+}
+
+// runList scans the devices once and writes them with the keys of their labels to stdout.
+// Neither a kubeconfig nor a cluster is needed.
+func runList(logger log.Logger) error {
+	ds, err := scanOnce(logger)
+	if err != nil {
+		return err
+	}
+	return writeList(os.Stdout, ds, *output)
+}
+
+// listEntries returns the devices in the order of the scan with the keys of the labels they map to.
+func listEntries(ds []device) []listEntry {
+	l := createLabels(ds)
+	es := make([]listEntry, 0, len(ds))
+	for _, d := range ds {
+		e := listEntry{
+			Bus:         newLabelTemplateData(d).Bus,
+			ID:          d.ID,
+			Description: d.Description,
+			Port:        d.Port,
+			Address:     d.Address,
+			Class:       d.Class,
+			Classes:     d.Classes,
+			Speed:       d.Speed,
+			Version:     d.Version,
+			Serial:      d.Serial,
+			Drivers:     d.Drivers,
+		}
+		if k := sprintLabelKey(d.Key); !filtered(d) {
+			if _, ok := l[k]; ok {
+				e.Label = k
+			}
+		}
+		es = append(es, e)
+	}
+	return es
+}
+
+// writeList writes the devices in the format.
+func writeList(w io.Writer, ds []device, format string) error {
+	es := listEntries(ds)
+	switch format {
+	case outputTable, outputWide:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		if format == outputWide {
+			fmt.Fprintln(tw, "BUS\tPORT\tID\tCLASS\tSPEED\tVERSION\tSERIAL\tDRIVERS\tDESCRIPTION\tLABEL")
+		} else {
+			fmt.Fprintln(tw, "ID\tDESCRIPTION\tLABEL")
+		}
+		for _, e := range es {
+			label := e.Label
+			if label == "" {
+				label = "<none>"
+			}
+			if format == outputWide {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Bus, orNone(e.Port), e.ID, orNone(e.Class), orNone(e.Speed), orNone(e.Version), orNone(e.Serial), orNone(strings.Join(e.Drivers, ",")), e.Description, label)
+			} else {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", e.ID, e.Description, label)
+			}
+		}
+		return tw.Flush()
+	case outputLsusb:
+		for _, d := range ds {
+			if !isUSB(d) {
+				continue
+			}
+			fmt.Fprintln(w, lsusbLine(d))
+		}
+		return nil
+	case outputJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(es)
+	case outputYAML:
+		data, err := yaml.Marshal(es)
+		if err != nil {
+			return fmt.Errorf("could not marshal devices: %w", err)
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("output format %q unknown; possible values are: %s, %s, %s, %s, %s", format, outputTable, outputWide, outputLsusb, outputJSON, outputYAML)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// lsusbLine returns the line of a usb device in the format of lsusb, e.g. Bus 001 Device 004: ID 2341:0043 Arduino SA Uno R3,
+// which the fixture scanner can read again.
+// The device number is 0, if it is not known.
+func lsusbLine(d device) string {
+	vendor, product, _ := vendorProduct(d)
+	name := d.Description
+	if regParse.MatchString(d.Description) {
+		name = regParse.ReplaceAllString(d.Description, "$2 $1")
+	}
+	return fmt.Sprintf("Bus %03d Device %03d: ID %s:%s %s", usbBusNumber(d.Port), d.Address, vendor, product, name)
+}
+
+// usbBusNumber returns the number of the bus of a usb device from its port, e.g. 1 for 1-1.4 or usb1, or 0 if it is not known.
+func usbBusNumber(port string) int {
+	bus, _, _ := strings.Cut(strings.TrimPrefix(port, "usb"), "-")
+	n, _ := strconv.Atoi(bus)
+	return n
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteList(t *testing.T) {
+	old := *noContain
+	*noContain = []string{"hub"}
+	t.Cleanup(func() { *noContain = old })
+
+	ds := []device{
+		{ID: "1d6b_0002", Key: "Linux-Foundation_2.0-root-hub", Description: "2.0 root hub (Linux Foundation)", Port: "usb1", Address: 1, Class: "09"},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)", Port: "1-1.4", Address: 4, Class: "02", Speed: "full", Version: "0.0.1", Drivers: []string{"cdc_acm"}},
+		{ID: "pci-8086_1533", Key: "pci-Intel-Corporation_I210", Description: "I210 (Intel Corporation)", Port: "0000:03:00.0"},
+	}
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{format: outputTable, want: `ID             DESCRIPTION                      LABEL
+1d6b_0002      2.0 root hub (Linux Foundation)  <none>
+2341_0043      Uno R3 (Arduino SA)              nudl.squat.ai/Arduino-SA_Uno-R3
+pci-8086_1533  I210 (Intel Corporation)         nudl.squat.ai/pci-Intel-Corporation_I210
+`},
+		{format: outputWide, want: `BUS  PORT          ID             CLASS  SPEED  VERSION  SERIAL  DRIVERS  DESCRIPTION                      LABEL
+usb  usb1          1d6b_0002      09     -      -        -       -        2.0 root hub (Linux Foundation)  <none>
+usb  1-1.4         2341_0043      02     full   0.0.1    -       cdc_acm  Uno R3 (Arduino SA)              nudl.squat.ai/Arduino-SA_Uno-R3
+pci  0000:03:00.0  pci-8086_1533  -      -      -        -       -        I210 (Intel Corporation)         nudl.squat.ai/pci-Intel-Corporation_I210
+`},
+		{format: outputLsusb, want: `Bus 001 Device 001: ID 1d6b:0002 Linux Foundation 2.0 root hub
+Bus 001 Device 004: ID 2341:0043 Arduino SA Uno R3
+`},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeList(&buf, ds, tc.format))
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeList(&buf, ds[1:2], outputJSON))
+	assert.JSONEq(t, `[{"bus": "usb", "id": "2341_0043", "description": "Uno R3 (Arduino SA)", "port": "1-1.4", "address": 4, "class": "02",
+		"speed": "full", "version": "0.0.1", "drivers": ["cdc_acm"], "label": "nudl.squat.ai/Arduino-SA_Uno-R3"}]`, buf.String())
+
+	// The lsusb output can be read as a fixture.
+	buf.Reset()
+	require.NoError(t, writeList(&buf, ds, outputLsusb))
+	fds, err := parseLsusb(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	require.Len(t, fds, 2)
+	assert.Equal(t, "2341", fds[1].Vendor)
+	assert.Equal(t, "0043", fds[1].Product)
+
+	assert.Error(t, writeList(&bytes.Buffer{}, ds, "xml"))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	logFormatJSON   = "json"
+	logFormatLogfmt = "logfmt"
+)
+
+var logFormat = flag.String("log-format", logFormatJSON, fmt.Sprintf("format of the logs: %s or %s", logFormatJSON, logFormatLogfmt))
+
+// newFormatLogger returns a logger that writes in the format of log-format.
+func newFormatLogger(w io.Writer) (log.Logger, error) {
+	switch *logFormat {
+	case logFormatJSON:
+		return log.NewJSONLogger(log.NewSyncWriter(w)), nil
+	case logFormatLogfmt:
+		return log.NewLogfmtLogger(log.NewSyncWriter(w)), nil
+	default:
+		return nil, fmt.Errorf("log format %q unknown; possible values are: %s, %s", *logFormat, logFormatJSON, logFormatLogfmt)
+	}
+}
+
+// levelOption returns the filter option of a log level.
+func levelOption(l string) (level.Option, error) {
+	switch l {
+	case logLevelAll:
+		return level.AllowAll(), nil
+	case logLevelDebug:
+		return level.AllowDebug(), nil
+	case logLevelInfo:
+		return level.AllowInfo(), nil
+	case logLevelWarn:
+		return level.AllowWarn(), nil
+	case logLevelError:
+		return level.AllowError(), nil
+	case logLevelNone:
+		return level.AllowNone(), nil
+	default:
+		return nil, fmt.Errorf("log level %v unknown; possible values are: %s", l, availableLogLevels)
+	}
+}
+
+// levelLogger filters the logs by a level that can be changed at runtime.
+type levelLogger struct {
+	next     log.Logger
+	mu       sync.RWMutex
+	level    string
+	filtered log.Logger
+}
+
+func newLevelLogger(next log.Logger, l string) (*levelLogger, error) {
+	ll := &levelLogger{next: next}
+	if err := ll.setLevel(l); err != nil {
+		return nil, err
+	}
+	return ll, nil
+}
+
+func (l *levelLogger) Log(keyvals ...interface{}) error {
+	l.mu.RLock()
+	filtered := l.filtered
+	l.mu.RUnlock()
+	return filtered.Log(keyvals...)
+}
+
+func (l *levelLogger) getLevel() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level
+}
+
+func (l *levelLogger) setLevel(lvl string) error {
+	o, err := levelOption(lvl)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level, l.filtered = lvl, level.NewFilter(l.next, o)
+	return nil
+}
+
+// ServeHTTP returns the log level for GET requests and sets it to the body of PUT requests, e.g.
+// curl -X PUT -H "Authorization: Bearer $TOKEN" -d debug http://localhost:8080/-/loglevel
+func (l *levelLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		old := l.getLevel()
+		if err := l.setLevel(strings.TrimSpace(string(body))); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level.Info(l).Log("msg", "changed log level", "old", old, "new", l.getLevel())
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fmt.Fprintln(w, l.getLevel())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelLogger(t *testing.T) {
+	var buf bytes.Buffer
+	*logFormat = logFormatLogfmt
+	defer func() { *logFormat = logFormatJSON }()
+	fl, err := newFormatLogger(&buf)
+	require.NoError(t, err)
+	l, err := newLevelLogger(fl, logLevelInfo)
+	require.NoError(t, err)
+
+	level.Debug(l).Log("msg", "hidden")
+	assert.Empty(t, buf.String())
+
+	req := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(method, "/-/loglevel", strings.NewReader(body)))
+		return w
+	}
+	w := req(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "info\n", w.Body.String())
+
+	w = req(http.MethodPut, "verbose")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, logLevelInfo, l.getLevel())
+
+	w = req(http.MethodPut, "debug\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "debug\n", w.Body.String())
+	buf.Reset()
+	level.Debug(l).Log("msg", "shown")
+	assert.Equal(t, "level=debug msg=shown\n", buf.String())
+
+	w = req(http.MethodPost, "info")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	*logFormat = "xml"
+	_, err = newFormatLogger(&buf)
+	assert.Error(t, err)
+}
+
+func TestLevelLoggerLifecycle(t *testing.T) {
+	oldEnabled, oldToken, oldCA := *enableLifecycle, *metricsBearerTokenFile, *metricsClientCAFile
+	t.Cleanup(func() { *enableLifecycle, *metricsBearerTokenFile, *metricsClientCAFile = oldEnabled, oldToken, oldCA })
+	l, err := newLevelLogger(log.NewNopLogger(), logLevelInfo)
+	require.NoError(t, err)
+
+	put := func(header string) *httptest.ResponseRecorder {
+		m := http.NewServeMux()
+		handleLifecycle(m, "/-/loglevel", l)
+		h, err := newMetricsAuth(m)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, "/-/loglevel", strings.NewReader("debug"))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// The endpoint is not served by default.
+	assert.Equal(t, http.StatusNotFound, put("").Code)
+	assert.Equal(t, logLevelInfo, l.getLevel())
+
+	*enableLifecycle = true
+	*metricsBearerTokenFile = filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(*metricsBearerTokenFile, []byte("s3cret\n"), 0o600))
+	assert.Equal(t, http.StatusUnauthorized, put("").Code, "unauthenticated requests are rejected")
+	assert.Equal(t, logLevelInfo, l.getLevel())
+	assert.Equal(t, http.StatusOK, put("Bearer s3cret").Code)
+	assert.Equal(t, logLevelDebug, l.getLevel())
+}
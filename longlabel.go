@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	longLabelStrategyHex      = "hex"
+	longLabelStrategyTruncate = "truncate"
+	longLabelStrategyHash     = "hash"
+)
+
+var longLabelStrategy = flag.String("long-label-strategy", longLabelStrategyHex, fmt.Sprintf("how human readable label keys longer than 63 characters are shortened: %s uses the hex codes, %s shortens the vendor and product names, %s keeps a readable prefix and appends a hash", longLabelStrategyHex, longLabelStrategyTruncate, longLabelStrategyHash))
+
+// regVendorSuffix matches legal forms at the end of sanitized vendor names, e.g. -Co.--Ltd.
+var regVendorSuffix = regexp.MustCompile(`(?i)[-_.,]+(inc|corp|corporation|co|ltd|llc|gmbh|ag|limited|company)[-_.]*$`)
+
+// limitKey joins the sanitized vendor and product names of the description to a key with the given prefix.
+// If the key is too long for a label, it is shortened with long-label-strategy.
+// Shortened keys and keys that are not valid label keys are recorded in keyFallbacks.
+func limitKey(prefix, vendor, product, hexKey, description string) string {
+	k := fmt.Sprintf("%s%s_%s", prefix, vendor, product)
+	if len(k) <= maxLabelNameLength {
+		if !validKey(k) {
+			keyFallbacks.record(hexKey, description, k, k, fallbackRejected)
+		}
+		return k
+	}
+	var lk, reason string
+	switch *longLabelStrategy {
+	case longLabelStrategyTruncate:
+		lk, reason = truncateKey(prefix, vendor, product), fallbackTruncated
+	case longLabelStrategyHash:
+		h := sha256.Sum256([]byte(k))
+		lk, reason = strings.TrimRight(k[:maxLabelNameLength-9], "-_.")+"-"+hex.EncodeToString(h[:4]), fallbackHashed
+	default:
+		lk, reason = hexKey, fallbackHex
+	}
+	keyFallbacks.record(hexKey, description, k, lk, reason)
+	return lk
+}
+
+// truncateKey removes legal forms from the vendor name and then shortens the longer of the vendor and product names,
+// so both stay readable.
+func truncateKey(prefix, vendor, product string) string {
+	budget := maxLabelNameLength - len(prefix) - 1
+	for len(vendor)+len(product) > budget && regVendorSuffix.MatchString(vendor) {
+		vendor = regVendorSuffix.ReplaceAllString(vendor, "")
+	}
+	if len(vendor)+len(product) > budget {
+		half := budget / 2
+		switch {
+		case len(vendor) <= half:
+			product = product[:budget-len(vendor)]
+		case len(product) <= budget-half:
+			vendor = vendor[:budget-len(product)]
+		default:
+			vendor, product = vendor[:half], product[:budget-half]
+		}
+	}
+	return fmt.Sprintf("%s%s_%s", prefix, strings.TrimRight(vendor, "-_."), strings.TrimRight(product, "-_."))
+}
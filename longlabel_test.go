@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitKey(t *testing.T) {
+	vendor := "Chicony-Electronics-Co.--Ltd"
+	product := "Integrated-Camera-with-Infrared-Sensor-and-Microphone-Array"
+	defer func() { *longLabelStrategy = longLabelStrategyHex }()
+
+	assert.Equal(t, "Arduino-SA_Uno-R3", limitKey("", "Arduino-SA", "Uno-R3", "2341_0043", ""))
+	assert.Equal(t, "04f2_b420", limitKey("", vendor, product, "04f2_b420", ""))
+
+	*longLabelStrategy = longLabelStrategyTruncate
+	k := limitKey("", vendor, product, "04f2_b420", "")
+	assert.Equal(t, "Chicony-Electronics_Integrated-Camera-with-Infrared-Sensor-and", k)
+	assert.LessOrEqual(t, len(k), maxLabelNameLength)
+	k = limitKey(pciPrefix, strings.Repeat("v", 40), strings.Repeat("p", 40), "pci-04f2_b420", "")
+	assert.Equal(t, pciPrefix+strings.Repeat("v", 29)+"_"+strings.Repeat("p", 29), k)
+
+	*longLabelStrategy = longLabelStrategyHash
+	k = limitKey("", vendor, product, "04f2_b420", "")
+	assert.Len(t, k, maxLabelNameLength)
+	assert.True(t, strings.HasPrefix(k, "Chicony-Electronics-Co.--Ltd_Integrated-Camera-with-"), k)
+	assert.NotEqual(t, k, limitKey("", vendor, product+"-2", "04f2_b420", ""))
+}
@@ -8,31 +8,36 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
+	"github.com/coreos/go-systemd/v22/daemon"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/google/gousb"
-	"github.com/google/gousb/usbid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	flag "github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/clock"
 )
 
 type labels map[string]string
 
+const (
+	labelValueBool  = "bool"
+	labelValueCount = "count"
+)
+
 const (
 	logLevelAll   = "all"
 	logLevelDebug = "debug"
@@ -45,14 +50,25 @@ const (
 var (
 	usbDebug           = flag.Int("usb-debug", 0, "libusb debug level (0..3)")
 	humanReadable      = flag.Bool("human-readable", true, "use human readable label names instead of hex codes, possibly not all codes can be translated")
+	labelValue         = flag.String("label-value", labelValueBool, fmt.Sprintf("value of the device labels: %s for true, %s for the number of attached devices, %s for the time in Unix seconds when the devices were last seen, or %s for true, suspended or error by the power states of the devices", labelValueBool, labelValueCount, labelValueLastSeen, labelValueState))
+	dualLabels         = flag.Bool("dual-labels", false, "label every device with both the hex code and the human readable label name, so selectors keep working when one of them changes")
 	kubeconfig         = flag.String("kubeconfig", "", "path to kubeconfig")
-	hostname           = flag.String("hostname", "", "Hostname of the node on which this process is running")
+	hostname           = flag.String("hostname", "", "Hostname of the node on which this process is running. If empty, the NODE_NAME environment variable, the node named like the hostname or the node with the address of the pod is used")
 	noContain          = flag.StringSlice("no-contain", []string{}, "list of strings, usb devices containing these case-insensitive strings will not be considered for labeling")
-	only               = flag.StringSlice("only", []string{}, "list of strings in the format of <vendor id>_<product id>. These usb devices are considered for labeling only. If a provided device is not found, the label value will be set to false.")
+	only               = flag.StringSlice("only", []string{}, "list of strings in the format of <vendor id>_<product id> or label keys like Silicon-Labs_CP210x-UART-Bridge. These usb devices are considered for labeling only, ids are labeled with human readable keys if human-readable is set. If a provided device is not found, the label value will be set to false. A * matches any vendor or product id, e.g. 10c4_*, every matched device is labeled and the label <pattern>.matched, e.g. 10c4_any.matched, tells whether any device matched.")
 	logLevel           = flag.String("log-level", logLevelInfo, fmt.Sprintf("Log level to use. Possible values: %s", availableLogLevels))
 	updateTime         = flag.Duration("update-time", 10*time.Second, "renewal time for labels in seconds")
+	steadyUpdateTime   = flag.Duration("steady-update-time", 0, "renewal time for labels when no change was detected within fast-update-window, 0 always uses update-time")
+	fastUpdateWindow   = flag.Duration("fast-update-window", time.Minute, "time after a detected change of devices in which update-time is used instead of steady-update-time")
+	scanTimeout        = flag.Duration("scan-timeout", 5*time.Second, "timeout for each scanner, scanners run concurrently")
+	resyncPeriod       = flag.Duration("resync-period", 5*time.Minute, "period after which the node is labeled even if the devices did not change, 0 labels the node on every update")
+	minPatchInterval   = flag.Duration("min-patch-interval", 0, "minimum time between two patches of the node, e.g. to protect etcd from flapping devices, 0 disables the rate limit")
+	shutdownTimeout    = flag.Duration("shutdown-timeout", 20*time.Second, "maximum time to wait for running reconciliations and the clean up on shutdown, of which the reconciliations get at most half, should be lower than the terminationGracePeriodSeconds of the pod")
 	labelPrefix        = flag.String("label-prefix", "nudl.squat.ai", "prefix for labels")
-	addr               = flag.String("listen-address", ":8080", "listen address for prometheus metrics server")
+	once               = flag.Bool("once", false, "scan and label once and exit without removing the labels, e.g. in a CronJob")
+	cleanupOnExit      = flag.Bool("cleanup-on-exit", true, "remove the labels and the published custom resources on shutdown, disable to keep them across restarts of the pod")
+	dryRun             = flag.Bool("dry-run", false, "print the labels and the strategic merge patch of the node as JSON lines to stdout instead of patching the node")
+	addr               = flag.String("listen-address", ":8080", "listen address for prometheus metrics server, e.g. :8080 for IPv4 and IPv6, comma separated addresses like 10.0.0.5:8080,[fd00::5]:8080, unix:///run/nudl/metrics.sock, unix://@nudl for an abstract socket on Linux, or systemd:// for socket activation")
 	availableLogLevels = strings.Join([]string{
 		logLevelAll,
 		logLevelDebug,
@@ -77,6 +93,24 @@ var (
 			Help: "number of labels that are being managed",
 		},
 	)
+	rateLimitedPatchCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "nudl_rate_limited_patches_total",
+			Help: "Number of node patches that were delayed by min-patch-interval",
+		},
+	)
+	skippedPatchCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "nudl_patches_skipped_total",
+			Help: "Number of node patches that were skipped, because the labels and annotations did not change",
+		},
+	)
+	panicCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "nudl_recovered_panics_total",
+			Help: "Number of panics that were recovered from",
+		},
+	)
 )
 
 // Use global regexps to avoid compiling them multible times.
@@ -89,292 +123,649 @@ func sprintLabelKey(k string) string {
 	return fmt.Sprintf("%s/%s", *labelPrefix, k)
 }
 
-// genKey generates a key with prefix labelPrefix out of a device description.
-func genKey(desc *gousb.DeviceDesc) string {
-	var key string
-	if *humanReadable {
-		// parse vendor and device from usbid
-		dev := usbid.Describe(desc)
-		device := regParse.ReplaceAll([]byte(dev), []byte("$1"))
-		vendor := regParse.ReplaceAll([]byte(dev), []byte("$2"))
-		// Replace charackters not allowed in node labels.
-		vendor = regTrim.ReplaceAll([]byte(vendor), []byte("-"))
-		device = regTrim.ReplaceAll([]byte(device), []byte("-"))
-		key = fmt.Sprintf("%s_%s", vendor, device)
-	} else {
-		key = fmt.Sprintf("%s_%s", desc.Vendor.String(), desc.Product.String())
+// createLabels generates the labels for the scanned devices.
+// Devices that are filtered out are not considered.
+func createLabels(ds []device) labels {
+	groups := make(map[string][]device, len(ds))
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		groups[d.Key] = append(groups[d.Key], d)
+		if *dualLabels && d.ID != d.Key {
+			groups[d.ID] = append(groups[d.ID], d)
+		}
 	}
-	return sprintLabelKey(key)
-}
-
-// createLables is a wrapper function to pass it to gousb.Context.OpenDevices().
-// The returned function will always return false to not open any usb device.
-func createLabels(nl *labels) func(*gousb.DeviceDesc) bool {
-	return func(desc *gousb.DeviceDesc) bool {
-		// Filter the values that are not supposed to be used as labels.
-		for _, str := range *noContain {
-			if strings.Contains(strings.ToLower(usbid.Describe(desc)), strings.ToLower(str)) {
-				return false
+	if *resolveCollisions {
+		for k, g := range collisions(ds) {
+			sorted := sortedCollision(g)
+			for i, rk := range resolvedKeys(k, g) {
+				groups[rk] = append(groups[rk], sorted[i])
 			}
 		}
-		(*nl)[genKey(desc)] = "true"
-
-		return false
-	}
-}
-
-// scanUSB will return the labels from the scanned usb devices.
-func scanUSB() (labels, error) {
-	ctx := gousb.NewContext()
-	defer ctx.Close()
-
-	ctx.Debug(*usbDebug)
-
-	l := make(labels)
-	if _, err := ctx.OpenDevices(createLabels(&l)); err != nil {
-		return nil, err
 	}
 
+	value := ruleValueFunc(labelValueFunc())
+	l := make(labels, len(groups))
 	if len(*only) > 0 {
-		onlyLabels := make(labels)
 		for _, str := range *only {
-			_, ok := l[sprintLabelKey(str)]
-			onlyLabels[sprintLabelKey(str)] = fmt.Sprintf("%t", ok)
+			if !isOnlyPattern(str) {
+				k := onlyKey(str, ds)
+				l[sprintLabelKey(k)] = value(groups[k])
+				continue
+			}
+			// Every matched device is labeled, and the aggregate label tells whether any matched.
+			matched := false
+			for k, g := range groups {
+				if onlyMatches(str, k) || (len(g) > 0 && onlyMatches(str, g[0].ID)) {
+					l[sprintLabelKey(k)] = value(g)
+					matched = true
+				}
+			}
+			l[sprintLabelKey(onlyMatchedKey(str))] = strconv.FormatBool(matched)
+		}
+	} else {
+		for k, g := range groups {
+			l[sprintLabelKey(k)] = value(g)
 		}
-		return onlyLabels, nil
 	}
-	return l, nil
+	addRuleMultipleLabels(l, ds, value)
+	if *driverLabels {
+		addDriverLabels(l, ds)
+	}
+	if *vendorLabels {
+		addVendorLabels(l, ds)
+	}
+	if *remoteDevices == remoteDevicesLabel {
+		addRemoteLabels(l, ds)
+	}
+	if *portLabels {
+		addPortLabels(l, ds)
+	}
+	if *firmwareLabels {
+		addFirmwareLabels(l, ds)
+	}
+	if *scanStorage {
+		addStorageSizeLabels(l, ds)
+	}
+	if *scanThunderbolt {
+		addThunderboltLabels(l, ds)
+	}
+	if *powerStateLabels {
+		addPowerStateLabels(l, ds)
+	}
+	if *hidDetail {
+		addHIDLabels(l, ds)
+	}
+	addExtraPrefixLabels(l, ds)
+	return l
 }
 
-// filter will filter a map of strings by its prefix
+// filtered returns true if the device is not supposed to be used for labels.
+func filtered(d device) bool {
+	for _, str := range *noContain {
+		if strings.Contains(strings.ToLower(d.Description), strings.ToLower(str)) {
+			return true
+		}
+	}
+	if d.Remote && *remoteDevices == remoteDevicesExclude {
+		return true
+	}
+	if skippedByRule(d) || filteredByPort(d) || filteredByPreset(d) {
+		return true
+	}
+	return filteredByClass(d)
+}
+
+// filter will filter a map of strings by its prefix and the extra label prefixes
 // and return the filtered labels.
+// Preserved labels are not managed by nudl, so they are never deleted.
 func filter(m map[string]string) labels {
-	ret := make(labels)
+	ret := make(labels, len(m))
 	for k, v := range m {
-		if strings.HasPrefix(k, *labelPrefix) {
+		if managedPrefix(k) && !preserved(k) {
 			ret[k] = v
 		}
 	}
 	return ret
 }
 
-// merge merges labels into a map of strings
-// and returns a map, after deleting the keys
-// that start with the prefix labelPrefix.
-func merge(l map[string]string, ul labels) map[string]string {
+// labelPatch creates a strategic merge patch that sets the new labels
+// and deletes the current labels with the prefix labelPrefix that are not in the new labels.
+// The annotations are set, or deleted if their value is nil.
+// Creating the patch from the labels avoids marshalling the whole node twice.
+func labelPatch(current map[string]string, ul labels, annotations map[string]*string) ([]byte, error) {
+	ls := make(map[string]*string, len(ul))
 	// Delete old labels.
-	for k := range filter(l) {
+	for k := range filter(current) {
 		if _, e := ul[k]; !e {
-			delete(l, k)
+			ls[k] = nil
 		}
 	}
-	// Add new labels to map.
+	// Add new labels.
 	for k, v := range ul {
-		l[k] = v
+		if cv, e := current[k]; e && cv == v {
+			continue
+		}
+		ls[k] = &v
 	}
-	return l
+	metadata := map[string]interface{}{
+		"labels": ls,
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": metadata,
+	})
+}
+
+// keepOnExit returns true if the labels and the published custom resources are kept on shutdown.
+func keepOnExit() bool {
+	return *once || !*cleanupOnExit
 }
 
 // getNode returns the node with name hostname or an error.
-func getNode(ctx context.Context, clientset *kubernetes.Clientset) (*v1.Node, error) {
-	node, err := clientset.CoreV1().Nodes().Get(ctx, *hostname, metav1.GetOptions{})
+func getNode(ctx context.Context, clientset kubernetes.Interface) (*v1.Node, error) {
+	return getNamedNode(ctx, clientset, *hostname)
+}
+
+// getNamedNode returns the node with the name or an error.
+func getNamedNode(ctx context.Context, clientset kubernetes.Interface, name string) (*v1.Node, error) {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
 	if errors.IsNotFound(err) {
-		return nil, fmt.Errorf("node not found: %w", err)
+		return nil, fmt.Errorf("%w: %w", errNodeNotFound, err)
 	} else if err != nil {
 		return nil, fmt.Errorf("could not get node: %w", err)
 	}
 	return node, nil
 }
 
-// scanAndLabel scans and labels the node with name hostname or returns an error.
-func scanAndLabel(ctx context.Context, clientset *kubernetes.Clientset, logger log.Logger) error {
-	node, err := getNode(ctx, clientset)
-	if err != nil {
-		return err
-	}
-	oldData, err := json.Marshal(node)
-	if err != nil {
-		return err
+// recoverPanic recovers from a panic, logs it with its stack trace and sets err.
+// It must be deferred directly.
+func recoverPanic(logger log.Logger, err *error) {
+	if r := recover(); r != nil {
+		panicCounter.Inc()
+		level.Error(logger).Log("msg", "recovered from panic", "panic", r, "stack", string(debug.Stack()))
+		*err = fmt.Errorf("recovered from panic: %v", r)
 	}
-	// Scan usb device.
-	nl, err := scanUSB()
-	if err != nil {
-		return fmt.Errorf("couldn not scan usb devices: %w", err)
-	} else {
-		level.Debug(logger).Log("msg", "successfully scanned usb device")
-	}
-	labelGauge.Set(float64(len(nl)))
-	node.ObjectMeta.Labels = merge(node.ObjectMeta.Labels, nl)
-	newData, err := json.Marshal(node)
-	if err != nil {
-		return fmt.Errorf("failed to marshal labels: %w", err)
+}
+
+// newKubeConfig generates the in cluster config, or the config from kubeconfig if it is set,
+// with the rate limits of the flags.
+func newKubeConfig(logger log.Logger) (*rest.Config, error) {
+	if *kubeconfig == "" {
+		config, err := rest.InClusterConfig()
+		if err == rest.ErrNotInCluster {
+			return nil, fmt.Errorf("not in cluster: %w", err)
+		} else if err != nil {
+			return nil, err
+		}
+		level.Info(logger).Log("msg", "generated in cluster config")
+		configureRateLimits(config)
+		return config, nil
 	}
-	patch, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, v1.Node{})
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
 	if err != nil {
-		return fmt.Errorf("failed to create patch for node %q: %w", node.Name, err)
-	}
-	if nn, err := clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
-		return fmt.Errorf("failed to patch node: %w", err)
-	} else {
-		level.Debug(logger).Log("msg", fmt.Sprintf("patched labels: %v", nn.ObjectMeta.Labels))
+		return nil, fmt.Errorf("could not generate kubernetes config: %w", err)
 	}
-	return nil
+	level.Info(logger).Log("msg", fmt.Sprintf("generated config with kubeconfig: %s", *kubeconfig))
+	configureRateLimits(config)
+	return config, nil
 }
 
-// cleanUp will remove all labels with the prefix labelPrefix from the node with name hostname or return an error.
-func cleanUp(clientset *kubernetes.Clientset, logger log.Logger) error {
-	ctx := context.Background()
-	node, err := getNode(ctx, clientset)
-	if err != nil {
-		return err
+func Main() error {
+	flag.Parse()
+	var cl *configLoader
+	if *configFile != "" {
+		cl = newConfigLoader(*configFile)
+		if err := cl.load(); err != nil {
+			return err
+		}
 	}
-	oldData, err := json.Marshal(node)
+
+	logger, err := newFormatLogger(os.Stdout)
 	if err != nil {
 		return err
 	}
-	for k := range node.ObjectMeta.Labels {
-		if strings.HasPrefix(k, *labelPrefix) {
-			delete(node.ObjectMeta.Labels, k)
-		}
+	// The OTLP logger is swapped in once the hostname is known,
+	// because the hostname is an attribute of its resource.
+	var otlpSwap log.SwapLogger
+	if *otlpLogsEndpoint != "" {
+		logger = teeLogger{logger, &otlpSwap}
 	}
-	newData, err := json.Marshal(node)
+	ll, err := newLevelLogger(logger, *logLevel)
 	if err != nil {
 		return err
 	}
-
-	patch, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, v1.Node{})
-	if err != nil {
-		return fmt.Errorf("failed to create patch: %w", err)
-	}
-	if nn, err := clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
-		return fmt.Errorf("could not patch node: %w", err)
-	} else {
-		level.Info(logger).Log("msg", "successfully cleaned node")
-		level.Debug(logger).Log("msg", fmt.Sprintf("labels of cleaned node: %v", nn.ObjectMeta.Labels))
-	}
-	return nil
-}
-
-func Main() error {
-	flag.Parse()
-
-	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stdout))
-	switch *logLevel {
-	case logLevelAll:
-		logger = level.NewFilter(logger, level.AllowAll())
-	case logLevelDebug:
-		logger = level.NewFilter(logger, level.AllowDebug())
-	case logLevelInfo:
-		logger = level.NewFilter(logger, level.AllowInfo())
-	case logLevelWarn:
-		logger = level.NewFilter(logger, level.AllowWarn())
-	case logLevelError:
-		logger = level.NewFilter(logger, level.AllowError())
-	case logLevelNone:
-		logger = level.NewFilter(logger, level.AllowNone())
-	default:
-		return fmt.Errorf("log level %v unknown; possible values are: %s", *logLevel, availableLogLevels)
+	logger = ll
+	if cl != nil {
+		cl.levels = ll
 	}
 	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
 	logger = log.With(logger, "caller", log.DefaultCaller)
 
-	if len(*only) > 0 && *humanReadable {
-		return fmt.Errorf("only and human-readable flags are mutually exclusive")
+	if err := validateConfig(); err != nil {
+		// The rollback undoes a misconfiguration, so it must work with the misconfiguration.
+		if !*rollback {
+			if *labelSnapshot {
+				level.Error(logger).Log("msg", "the labels from before the first patch can be restored with --rollback")
+			}
+			return err
+		}
+		level.Warn(logger).Log("msg", "rolling back despite the invalid configuration", "err", err)
+	}
+	if *rollback {
+		return runRollback(logger)
+	}
+	if *mode == modeController {
+		return runController(logger)
+	}
+	switch flag.Arg(0) {
+	case "controller":
+		return runController(logger)
+	case "selftest":
+		return runSelftest(logger)
+	case "scan":
+		return runScan(logger)
+	case "dump":
+		return runDump(logger)
+	case "admission":
+		return runAdmission(logger)
+	case "doctor":
+		return runDoctor(logger)
+	case "list":
+		return runList(logger)
+	case "cleanup":
+		return runCleanup(logger)
 	}
-
-	// Create context to be able to cancel calls to the Kubernetes API in clean up.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 
 	// Create prometheus registry instead of using default one.
 	r := prometheus.NewRegistry()
 	r.MustRegister(
 		reconcilingCounter,
 		labelGauge,
+		scannerBackoffGauge,
+		reconcileBackoffGauge,
+		scanTimeoutCounter,
+		scannerWedgedGauge,
+		scannerFailedGauge,
+		scanDurationHistogram,
+		devicePresentGauge,
+		deviceFlappingGauge,
+		panicCounter,
+		rateLimitedPatchCounter,
+		skippedPatchCounter,
+		nodeUpdateRetryCounter,
+		collisionGauge,
+		unknownDevicesGauge,
+		productCollisionCounter,
+		metadataBytesGauge,
+		metadataPrunedGauge,
+		publishErrorCounter,
+		publishDroppedCounter,
+		publishQueueGauge,
+		lastSuccessGauge,
+		disabledFeatureGauge,
+		readyGauge,
+		execFailuresCounter,
+		fallbacksCounter,
+		errorsCounter,
 		collectors.NewGoCollector(),
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
+	// Every class is exported, so alerts on increases work from the first error.
+	for c := range exitCodes {
+		errorsCounter.WithLabelValues(c)
+	}
+	hc := newHealth(clock.RealClock{})
 	m := http.NewServeMux()
 	m.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
-	// Create a global variable for the metrics server to be able to stop it later.
+	m.Handle("/healthz", healthHandler(hc.live))
+	m.Handle("/readyz", healthHandler(hc.ready))
+	handleLifecycle(m, "/-/loglevel", ll)
+	rl := newReloader(clock.RealClock{})
+	handleLifecycle(m, "/-/reload", rl)
+	mh, err := newMetricsAuth(m)
+	if err != nil {
+		return err
+	}
+	mtls, err := metricsServerTLSConfig()
+	if err != nil {
+		return err
+	}
 	msrv := &http.Server{
-		Addr:    *addr,
-		Handler: m,
+		Addr:      *addr,
+		Handler:   withConfigReadLock(mh),
+		TLSConfig: mtls,
 	}
-	go func() {
-		level.Info(logger).Log("msg", "starting metrics server")
-		if err := msrv.ListenAndServe(); err != nil {
-			level.Error(logger).Log("msg", "could not start metrics server", "err", err)
-		}
-	}()
 
-	// Generate a kubeconfig.
+	// With the file and stdout sinks, neither a kubeconfig nor a cluster is needed.
 	var config *rest.Config
-	var err error
-	if *kubeconfig == "" {
-		config, err = rest.InClusterConfig()
-		if err == rest.ErrNotInCluster {
-			return fmt.Errorf("not in cluster: %w", err)
-		} else if err != nil {
+	var clientset kubernetes.Interface
+	if needsKubeConfig() {
+		c, err := newKubeConfig(logger)
+		if err != nil {
 			return err
 		}
-		level.Info(logger).Log("msg", "generated in cluster config")
-	} else {
-		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
+		// Create the clientset.
+		cs, err := kubernetes.NewForConfig(c)
 		if err != nil {
-			return fmt.Errorf("could not generate kubernetes config: %w", err)
+			return fmt.Errorf("could not create kubernetes clientset: %w", err)
 		}
-		level.Info(logger).Log("msg", fmt.Sprintf("generated config with kubeconfig: %s", *kubeconfig))
+		config, clientset = c, cs
+		if *hostname == "" {
+			n, err := newNodeNameDetector(clientset).detect(context.Background(), logger)
+			if err != nil {
+				return err
+			}
+			*hostname = n
+		}
+	}
+	if *otlpLogsEndpoint != "" {
+		ol, shutdown, err := newOTLPLogger(context.Background())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "could not flush OTLP logs: %v\n", err)
+			}
+		}()
+		otlpSwap.Swap(ol)
 	}
-	// Create the clientset.
-	clientset, err := kubernetes.NewForConfig(config)
+	sk, err := newSink(config)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
 
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	closeAudit, err := setupAudit(context.Background(), clientset)
+	if err != nil {
+		return err
+	}
+	defer closeAudit()
 
-	level.Info(logger).Log("msg", "start service", "no-contain", *noContain, "label-prefix", *labelPrefix)
-	// Use a mutex to avoid simultaneous updates at small update-time or slow network speed.
-	var mutex sync.Mutex
-	for {
+	if *once {
+		return runOnce(config, clientset, sk, logger)
+	}
+
+	// The context is cancelled when a signal is received or when any of the
+	// go routines in the group returns an error.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+		defer signal.Stop(ch)
 		select {
 		case s := <-ch:
 			level.Info(logger).Log("msg", fmt.Sprintf("received signal %v", s))
-			// Cancel the context for running scan and label routine.
 			cancel()
-			// Lock mutex to wait until the running scan and label routin is finished.
-			mutex.Lock()
-			if err := cleanUp(clientset, logger); err != nil {
-				level.Error(logger).Log("msg", "could not clean node", "err", err)
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		l, err := listen(ctx, *addr, logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
 			}
-			if err := msrv.Close(); err != nil {
-				level.Error(logger).Log("msg", "could not close metrics server", "err", err)
-			} else {
-				level.Info(logger).Log("msg", "closing metrics server")
+			return fmt.Errorf("could not start metrics server: %w", err)
+		}
+		level.Info(logger).Log("msg", "starting metrics server", "tls", mtls != nil)
+		if mtls != nil {
+			// The certificate is in the TLS config.
+			err = msrv.ServeTLS(l, "", "")
+		} else {
+			err = msrv.Serve(l)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("metrics server failed: %w", err)
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		level.Info(logger).Log("msg", "shutting down metrics server")
+		// Running scrapes and probes are finished, but not for longer than shutdown-timeout.
+		sctx, scancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer scancel()
+		if err := msrv.Shutdown(sctx); err != nil {
+			return fmt.Errorf("could not shut down metrics server: %w", err)
+		}
+		return nil
+	})
+
+	if *usbIDsPath != "" || *usbIDsURL != "" {
+		ul := newUSBIDsLoader()
+		ul.update(ctx, logger)
+		g.Go(func() error {
+			return ul.run(ctx, logger)
+		})
+	} else {
+		warnUnnamedDevices(logger)
+	}
+
+	scs, err := newScanners(logger)
+	if err != nil {
+		return err
+	}
+	publishers, err := newPublishers(config, logger)
+	if err != nil {
+		return err
+	}
+	lb := newLabeler(clientset, clock.RealClock{}, publishers, scs...)
+	lb.health = hc
+	lb.sink = sk
+	m.Handle("/api/v1/devices", lb.devices)
+	m.Handle("/api/v1/inventory", lb.firstSeen)
+	m.Handle("/api/v1/fallbacks", keyFallbacks)
+	if *nodeCacheEnabled && sk == nil {
+		lb.nodes = newNodeCache(clientset)
+		lb.nodes.start(ctx)
+	}
+	defer lb.dispatcher.close(logger)
+	if len(*deviceResources) > 0 {
+		client, conn, err := newPodResourcesClient(*podResourcesSocket)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		lb.podResources = client
+	}
+
+	wd, err := newSystemdWatchdog()
+	if err != nil {
+		return err
+	}
+	g.Go(func() error {
+		return wd.run(ctx, logger)
+	})
+
+	hotplugEvents := make(chan struct{}, 1)
+	if *hotplug {
+		g.Go(func() error {
+			err := watchHotplug(ctx, hotplugEvents, logger)
+			if err != nil {
+				// Polling is the fallback.
+				level.Warn(logger).Log("msg", "hotplug events are disabled", "err", err)
 			}
-			level.Info(logger).Log("msg", "shutting down")
-			os.Exit(130)
-		case <-time.After(*updateTime):
-			mutex.Lock()
-			// Use a go routine, so the time to update the labels doesn't influence the frequency of updates.
-			go func() {
-				defer mutex.Unlock()
-				if err := scanAndLabel(ctx, clientset, logger); err != nil {
-					level.Error(logger).Log("msg", "failed to scan and label", "err", err)
-					reconcilingCounter.With(prometheus.Labels{"success": "false"}).Inc()
-				} else {
-					reconcilingCounter.With(prometheus.Labels{"success": "true"}).Inc()
+			return nil
+		})
+	}
+
+	configChanged := make(chan struct{}, 1)
+	if cl != nil {
+		g.Go(func() error {
+			return cl.watch(ctx, configChanged, logger)
+		})
+	}
+	g.Go(func() error {
+		return rl.watchSignal(ctx, logger)
+	})
+
+	level.Info(logger).Log("msg", "start service", "no-contain", *noContain, "label-prefix", *labelPrefix)
+	notifySystemd(daemon.SdNotifyReady, logger)
+	g.Go(func() error {
+		// Reconcile in the loop, so that there are never simultaneous updates at small update-time or slow network speed.
+		// After consecutive failures, the update interval is backed off up to failure-backoff-max.
+		// The next reconciliation starts immediately if a reconciliation takes longer than the update interval,
+		// if a hotplug event is received, or if a reload is requested with SIGHUP or /-/reload.
+		// The first reconciliation is delayed by initial-delay and up to startup-jitter.
+		t := time.NewTimer(firstReconcileDelay())
+		defer t.Stop()
+		for {
+			var start time.Time
+			select {
+			case <-ctx.Done():
+				return nil
+			case start = <-t.C:
+			case <-hotplugEvents:
+				start = time.Now()
+				t.Stop()
+			case <-configChanged:
+				// The config is applied in the reconciliation loop, because most flags are read here.
+				if err := cl.reload(logger); err != nil {
+					level.Error(logger).Log("msg", "could not reload config file, keeping the previous configuration", "err", err)
+					continue
 				}
-			}()
+				level.Info(logger).Log("msg", "reloaded config file")
+				// Changed filters do not change the devices, so the node is labeled immediately.
+				lb.resync()
+				start = time.Now()
+				t.Stop()
+			case <-rl.ch:
+				// A failed reload of the config file does not prevent the rescan.
+				if cl != nil {
+					if err := cl.reload(logger); err != nil {
+						level.Error(logger).Log("msg", "could not reload config file, keeping the previous configuration", "err", err)
+					} else {
+						level.Info(logger).Log("msg", "reloaded config file")
+					}
+				}
+				lb.resync()
+				start = time.Now()
+				t.Stop()
+			}
+			wd.begin(start)
+			err := lb.reconcile(ctx, logger)
+			wd.end()
+			if err != nil {
+				if ctx.Err() != nil {
+					// The reconciliation was interrupted by the shutdown.
+					return nil
+				}
+				level.Error(logger).Log("msg", "failed to scan and label", "err", err, "class", classifyError(err), "failures", lb.failures, "next", lb.nextInterval())
+				reconcilingCounter.With(prometheus.Labels{"success": "false"}).Inc()
+				countError(err)
+			} else {
+				reconcilingCounter.With(prometheus.Labels{"success": "true"}).Inc()
+			}
+			t.Reset(time.Until(start.Add(lb.nextInterval())))
+		}
+	})
+
+	<-ctx.Done()
+	notifySystemd(daemon.SdNotifyStopping, logger)
+	// All calls in the reconciliation are context aware, so the go routines should return promptly.
+	// The deadline guarantees that the shutdown, including the clean up, finishes within shutdown-timeout.
+	// The go routines are waited for at most half of it, so the clean up always has the other half.
+	deadline := time.Now().Add(*shutdownTimeout)
+	wctx, wcancel := context.WithTimeout(context.Background(), *shutdownTimeout/2)
+	defer wcancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-wctx.Done():
+		level.Warn(logger).Log("msg", "timed out waiting for go routines to stop")
+	}
+	sctx, scancel := context.WithDeadline(context.Background(), deadline)
+	defer scancel()
+	if *cleanupOnExit {
+		if cerr := lb.cleanUp(sctx, logger); cerr != nil {
+			level.Error(logger).Log("msg", "could not clean node", "err", cerr)
+		}
+	} else {
+		level.Info(logger).Log("msg", "keeping labels, because cleanup-on-exit is disabled")
+		if rerr := lb.release(sctx, logger); rerr != nil {
+			level.Error(logger).Log("msg", "could not release node", "err", rerr)
+		}
+	}
+	lb.ready.stopped(sctx, lb.clientset, logger)
+	level.Info(logger).Log("msg", "shutting down")
+	return err
+}
+
+// runOnce scans and labels once, publishes the devices and pushes the metrics to the Pushgateway.
+// The labels are not removed, so that they are kept until the next run.
+func runOnce(config *rest.Config, clientset kubernetes.Interface, sk sink, logger log.Logger) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	if *usbIDsPath != "" || *usbIDsURL != "" {
+		newUSBIDsLoader().update(ctx, logger)
+	} else {
+		warnUnnamedDevices(logger)
+	}
+
+	scs, err := newScanners(logger)
+	if err != nil {
+		return err
+	}
+	publishers, err := newPublishers(config, logger)
+	if err != nil {
+		return err
+	}
+	lb := newLabeler(clientset, clock.RealClock{}, publishers, scs...)
+	lb.sink = sk
+	if len(*deviceResources) > 0 {
+		client, conn, err := newPodResourcesClient(*podResourcesSocket)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		lb.podResources = client
+	}
+	level.Info(logger).Log("msg", "run once", "no-contain", *noContain, "label-prefix", *labelPrefix)
+	err = lb.reconcile(ctx, logger)
+	if err != nil {
+		reconcilingCounter.With(prometheus.Labels{"success": "false"}).Inc()
+		countError(err)
+		err = fmt.Errorf("failed to scan and label: %w", err)
+	} else {
+		reconcilingCounter.With(prometheus.Labels{"success": "true"}).Inc()
+		lastSuccessGauge.SetToCurrentTime()
+	}
+	lb.dispatcher.close(logger)
+	// The next run is another instance, so it must not wait for the heartbeat of this one to time out.
+	rctx, rcancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer rcancel()
+	if rerr := lb.release(rctx, logger); rerr != nil {
+		level.Error(logger).Log("msg", "could not release node", "err", rerr)
+	}
+
+	if *pushgatewayURL != "" {
+		pctx, pcancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer pcancel()
+		if perr := pushMetrics(pctx, logger, reconcilingCounter, labelGauge, scanTimeoutCounter, scanDurationHistogram, devicePresentGauge, panicCounter, publishErrorCounter, lastSuccessGauge, errorsCounter); perr != nil {
+			level.Error(logger).Log("msg", "could not push metrics", "err", perr)
 		}
 	}
+	return err
 }
 
 func main() {
 	if err := Main(); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	metricsCertFile        = flag.String("metrics-cert-file", "", "path to a certificate to serve the metrics, health and API endpoints on --listen-address with TLS")
+	metricsKeyFile         = flag.String("metrics-key-file", "", "path to the key of the certificate of the metrics server")
+	metricsClientCAFile    = flag.String("metrics-client-ca-file", "", "path to a CA certificate to verify client certificates; requests without a certificate that is signed by it are rejected, except for the health probes")
+	metricsBearerTokenFile = flag.String("metrics-bearer-token-file", "", "path to a file with a token that requests must send in the Authorization header as bearer token, except for the health probes; with metrics-client-ca-file, either is accepted")
+)
+
+// validateMetricsTLS returns an error if the flags of the metrics server do not belong together.
+func validateMetricsTLS() error {
+	if (*metricsCertFile == "") != (*metricsKeyFile == "") {
+		return fmt.Errorf("metrics-cert-file and metrics-key-file must be set together")
+	}
+	if *metricsClientCAFile != "" && *metricsCertFile == "" {
+		return fmt.Errorf("metrics-client-ca-file requires metrics-cert-file and metrics-key-file")
+	}
+	return nil
+}
+
+// metricsServerTLSConfig creates the TLS config of the metrics server, or nil if TLS is disabled.
+// Client certificates are verified if they are given, so the health probes of the kubelet,
+// which do not present a certificate, still work; metricsAuth rejects the other requests without one.
+func metricsServerTLSConfig() (*tls.Config, error) {
+	if *metricsCertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(*metricsCertFile, *metricsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load metrics certificate: %w", err)
+	}
+	c := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if *metricsClientCAFile != "" {
+		pool, err := loadCertPool(*metricsClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return c, nil
+}
+
+// metricsAuth authenticates the requests to the metrics server with a verified client certificate or the bearer token,
+// if metrics-client-ca-file or metrics-bearer-token-file is set.
+// The health probes are never authenticated, because the kubelet can not authenticate them.
+type metricsAuth struct {
+	next       http.Handler
+	clientCert bool
+	token      []byte
+}
+
+// newMetricsAuth returns the handler that authenticates the requests to next.
+func newMetricsAuth(next http.Handler) (http.Handler, error) {
+	a := &metricsAuth{next: next, clientCert: *metricsClientCAFile != ""}
+	if *metricsBearerTokenFile != "" {
+		data, err := os.ReadFile(*metricsBearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read metrics bearer token: %w", err)
+		}
+		a.token = []byte(strings.TrimSpace(string(data)))
+		if len(a.token) == 0 {
+			return nil, fmt.Errorf("metrics bearer token file %q is empty", *metricsBearerTokenFile)
+		}
+	}
+	if !a.clientCert && a.token == nil {
+		return next, nil
+	}
+	return a, nil
+}
+
+func (a *metricsAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || a.authenticated(r) {
+		a.next.ServeHTTP(w, r)
+		return
+	}
+	if a.token != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+func (a *metricsAuth) authenticated(r *http.Request) bool {
+	if a.clientCert && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if a.token != nil {
+		t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(t), a.token) == 1
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsAuth(t *testing.T) {
+	oldToken, oldCA := *metricsBearerTokenFile, *metricsClientCAFile
+	t.Cleanup(func() { *metricsBearerTokenFile, *metricsClientCAFile = oldToken, oldCA })
+
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	h, err := newMetricsAuth(ok)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "without authentication, every request is allowed")
+
+	*metricsBearerTokenFile = filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(*metricsBearerTokenFile, []byte("s3cret\n"), 0o600))
+	*metricsClientCAFile = "ca.pem"
+	h, err = newMetricsAuth(ok)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		header string
+		cert   bool
+		code   int
+	}{
+		{name: "anonymous", path: "/metrics", code: http.StatusUnauthorized},
+		{name: "wrong token", path: "/metrics", header: "Bearer secret", code: http.StatusUnauthorized},
+		{name: "token", path: "/metrics", header: "Bearer s3cret", code: http.StatusOK},
+		{name: "client certificate", path: "/-/reload", cert: true, code: http.StatusOK},
+		{name: "liveness probe", path: "/healthz", code: http.StatusOK},
+		{name: "readiness probe", path: "/readyz", code: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				r.Header.Set("Authorization", tc.header)
+			}
+			if tc.cert {
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tc.code, w.Code)
+		})
+	}
+
+	*metricsClientCAFile = ""
+	require.NoError(t, os.WriteFile(*metricsBearerTokenFile, nil, 0o600))
+	_, err = newMetricsAuth(ok)
+	assert.Error(t, err)
+}
+
+func TestValidateMetricsTLS(t *testing.T) {
+	oldCert, oldKey, oldCA := *metricsCertFile, *metricsKeyFile, *metricsClientCAFile
+	t.Cleanup(func() { *metricsCertFile, *metricsKeyFile, *metricsClientCAFile = oldCert, oldKey, oldCA })
+
+	assert.NoError(t, validateMetricsTLS())
+	*metricsCertFile = "tls.crt"
+	assert.Error(t, validateMetricsTLS())
+	*metricsKeyFile = "tls.key"
+	*metricsClientCAFile = "ca.pem"
+	assert.NoError(t, validateMetricsTLS())
+	*metricsCertFile, *metricsKeyFile = "", ""
+	assert.Error(t, validateMetricsTLS())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	migrateFromPrefix = flag.String("migrate-from-prefix", "", "previous label prefix, whose labels are written as copies of the labels with label-prefix until migrate-until, so node affinities with the previous prefix keep working during the migration; afterwards, the labels with the previous prefix are removed")
+	migrateUntil      = flag.String("migrate-until", "", "end of the migration from migrate-from-prefix in RFC 3339, e.g. 2024-06-01T00:00:00Z; if it is empty, the labels are written with both prefixes until migrate-from-prefix is unset")
+)
+
+// validateMigration returns an error if the previous prefix or the end of the migration are invalid.
+func validateMigration() error {
+	if *migrateFromPrefix == "" {
+		if *migrateUntil != "" {
+			return fmt.Errorf("migrate-until requires migrate-from-prefix")
+		}
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(*migrateFromPrefix); len(errs) > 0 {
+		return fmt.Errorf("invalid --migrate-from-prefix %q: %s", *migrateFromPrefix, strings.Join(errs, "; "))
+	}
+	if *migrateFromPrefix == *labelPrefix {
+		return fmt.Errorf("migrate-from-prefix %q is the label-prefix", *migrateFromPrefix)
+	}
+	for _, s := range *extraLabelPrefixes {
+		if p, _, _ := strings.Cut(s, ","); strings.TrimSpace(p) == *migrateFromPrefix {
+			return fmt.Errorf("migrate-from-prefix %q is an extra-label-prefix", *migrateFromPrefix)
+		}
+	}
+	if _, err := migrationEnd(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// migrationEnd returns the end of the migration, or the zero time if the migration does not end.
+func migrationEnd() (time.Time, error) {
+	if *migrateUntil == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, *migrateUntil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --migrate-until: %w", err)
+	}
+	return t, nil
+}
+
+// migrating returns true if the labels are written with the previous prefix as well.
+func migrating(now time.Time) bool {
+	if *migrateFromPrefix == "" {
+		return false
+	}
+	// The flag is validated on start.
+	end, _ := migrationEnd()
+	return end.IsZero() || now.Before(end)
+}
+
+// addMigrationLabels adds a copy of every label with the label prefix with the previous prefix, while migrating.
+func addMigrationLabels(l labels, now time.Time) {
+	if !migrating(now) {
+		return
+	}
+	for k, v := range l {
+		if rest, ok := strings.CutPrefix(k, *labelPrefix+"/"); ok {
+			l[*migrateFromPrefix+"/"+rest] = v
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestValidateMigration(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		prefix string
+		until  string
+		err    bool
+	}{
+		{name: "unset"},
+		{name: "until without prefix", until: "2024-06-01T00:00:00Z", err: true},
+		{name: "valid", prefix: "squat.ai", until: "2024-06-01T00:00:00Z"},
+		{name: "without end", prefix: "squat.ai"},
+		{name: "invalid prefix", prefix: "squat.ai/", err: true},
+		{name: "label prefix", prefix: "nudl.squat.ai", err: true},
+		{name: "invalid end", prefix: "squat.ai", until: "tomorrow", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			*migrateFromPrefix, *migrateUntil = tc.prefix, tc.until
+			t.Cleanup(func() { *migrateFromPrefix, *migrateUntil = "", "" })
+			err := validateMigration()
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLabelerMigration(t *testing.T) {
+	end := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	oldHostname := *hostname
+	*hostname, *migrateFromPrefix, *migrateUntil = "node1", "squat.ai", end.Format(time.RFC3339)
+	t.Cleanup(func() { *hostname, *migrateFromPrefix, *migrateUntil = oldHostname, "", "" })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node1",
+		Labels: map[string]string{"squat.ai/Arduino-SA_Uno-R3": "true", "squat.ai-other/foo": "bar"},
+	}})
+	ds := []device{{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)"}}
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return ds, nil
+	}}
+	c := testclock.NewFakePassiveClock(end.Add(-time.Hour))
+	lb := newLabeler(clientset, c, nil, s)
+	ctx := context.Background()
+	nodeLabels := func() map[string]string {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return n.Labels
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, map[string]string{
+		"nudl.squat.ai/Arduino-SA_Uno-R3": "true",
+		"squat.ai/Arduino-SA_Uno-R3":      "true",
+		"squat.ai-other/foo":              "bar",
+	}, nodeLabels())
+
+	// The labels with the previous prefix are removed when the migration ends, even though the devices did not change.
+	c.SetTime(end)
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, map[string]string{
+		"nudl.squat.ai/Arduino-SA_Uno-R3": "true",
+		"squat.ai-other/foo":              "bar",
+	}, nodeLabels())
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	mqttBroker         = flag.String("mqtt-broker", "", "URL of the MQTT broker to publish the inventory and events to, e.g. tcp://broker:1883 or ssl://broker:8883. MQTT is disabled if empty.")
+	mqttClientID       = flag.String("mqtt-client-id", "", "MQTT client id, defaults to nudl-<hostname>")
+	mqttUsername       = flag.String("mqtt-username", "", "username for the MQTT broker")
+	mqttPasswordFile   = flag.String("mqtt-password-file", "", "path to a file containing the password for the MQTT broker")
+	mqttTLS            = newTLSFlags("mqtt", "MQTT broker")
+	mqttQoS            = flag.Int("mqtt-qos", 1, "MQTT quality of service (0..2)")
+	mqttInventoryTopic = flag.String("mqtt-inventory-topic", "nudl/{node}/inventory", "MQTT topic for the retained inventory, {node} is replaced with the hostname")
+	mqttEventTopic     = flag.String("mqtt-event-topic", "nudl/{node}/events", "MQTT topic for attach and detach events, {node} is replaced with the hostname")
+)
+
+// mqttPublisher publishes the inventory and events to an MQTT broker.
+type mqttPublisher struct {
+	client mqtt.Client
+	qos    byte
+	// announced holds the ids of the devices that were announced to Home Assistant.
+	announced map[string]struct{}
+}
+
+func newMQTTPublisher(logger log.Logger) (*mqttPublisher, error) {
+	if *mqttQoS < 0 || *mqttQoS > 2 {
+		return nil, fmt.Errorf("MQTT QoS must be 0, 1 or 2, got %d", *mqttQoS)
+	}
+	id := *mqttClientID
+	if id == "" {
+		id = fmt.Sprintf("nudl-%s", *hostname)
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(*mqttBroker).
+		SetClientID(id).
+		SetUsername(*mqttUsername).
+		SetAutoReconnect(true).
+		// Retry the initial connection in the background, messages are queued until the client is connected.
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(mqtt.Client) {
+			level.Info(logger).Log("msg", "connected to MQTT broker", "broker", *mqttBroker)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			level.Warn(logger).Log("msg", "lost connection to MQTT broker", "err", err)
+		})
+	if *mqttPasswordFile != "" {
+		p, err := os.ReadFile(*mqttPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read MQTT password file: %w", err)
+		}
+		opts.SetPassword(strings.TrimSpace(string(p)))
+	}
+	if mqttTLS.enabled() {
+		c, err := mqttTLS.config()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(c)
+	}
+	client := mqtt.NewClient(opts)
+	// The token is not awaited, because the connection is retried in the background.
+	client.Connect()
+	return &mqttPublisher{client: client, qos: byte(*mqttQoS), announced: make(map[string]struct{})}, nil
+}
+
+func (p *mqttPublisher) Name() string {
+	return "mqtt"
+}
+
+func (p *mqttPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	if err := p.publish(ctx, mqttTopic(*mqttInventoryTopic), true, inv); err != nil {
+		return err
+	}
+	if *mqttHomeAssistant {
+		return p.publishHomeAssistant(ctx, inv)
+	}
+	return nil
+}
+
+func (p *mqttPublisher) PublishEvents(ctx context.Context, es []event) error {
+	for _, e := range es {
+		if err := p.publish(ctx, mqttTopic(*mqttEventTopic), false, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *mqttPublisher) publish(ctx context.Context, topic string, retained bool, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return waitMQTT(ctx, p.client.Publish(topic, p.qos, retained, payload))
+}
+
+func (p *mqttPublisher) Close() error {
+	p.client.Disconnect(uint(time.Second / time.Millisecond))
+	return nil
+}
+
+// mqttTopic replaces the {node} placeholder in the topic with the hostname.
+func mqttTopic(topic string) string {
+	return strings.ReplaceAll(topic, "{node}", *hostname)
+}
+
+// waitMQTT waits until the token is done or the context is done.
+func waitMQTT(ctx context.Context, t mqtt.Token) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.Done():
+		return t.Error()
+	}
+}
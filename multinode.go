@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	nodeNames    = flag.StringSlice("nodes", nil, "names of the nodes that are labeled with the devices instead of the node of hostname, e.g. the nodes that use the devices of a usb device server")
+	nodeSelector = flag.String("node-selector", "", "label selector of the nodes that are labeled with the devices instead of the node of hostname, in addition to nodes, which needs the permission to list nodes")
+)
+
+// multiNode returns true if the devices label a set of nodes instead of the node of hostname.
+func multiNode() bool {
+	return len(*nodeNames) > 0 || *nodeSelector != ""
+}
+
+// validateNodes returns an error if the node selector is invalid,
+// or if the nodes are set with a feature that only works for the node of hostname.
+func validateNodes() error {
+	if !multiNode() {
+		return nil
+	}
+	if _, err := k8slabels.Parse(*nodeSelector); err != nil {
+		return fmt.Errorf("invalid --node-selector: %w", err)
+	}
+	if *nodeCacheEnabled {
+		return errors.New("node-cache watches only the node of hostname and is not available with nodes and node-selector")
+	}
+	if *sinkName != sinkKubernetes {
+		return fmt.Errorf("nodes and node-selector are not available with the %s sink", *sinkName)
+	}
+	return nil
+}
+
+// targetNodes returns the sorted names of the nodes that are labeled:
+// the nodes of nodes and the nodes that match node-selector, or the node of hostname.
+func (lb *labeler) targetNodes(ctx context.Context) ([]string, error) {
+	if !multiNode() {
+		return []string{*hostname}, nil
+	}
+	set := make(map[string]bool)
+	for _, n := range *nodeNames {
+		set[n] = true
+	}
+	if *nodeSelector != "" {
+		nodes, err := lb.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: *nodeSelector})
+		if err != nil {
+			return nil, fmt.Errorf("could not list the nodes of the node selector: %w", err)
+		}
+		for _, n := range nodes.Items {
+			set[n.Name] = true
+		}
+	}
+	return sortedKeys(set), nil
+}
+
+// cleanUntargeted removes the labels from the nodes that were labeled in the last reconciliation and are not labeled anymore,
+// e.g. because they do not match the node selector anymore, and remembers the nodes.
+// A node that can not be cleaned up, e.g. because it was deleted, is only logged.
+func (lb *labeler) cleanUntargeted(ctx context.Context, names []string, logger log.Logger) {
+	if !multiNode() {
+		return
+	}
+	current := make(map[string]bool, len(names))
+	for _, n := range names {
+		current[n] = true
+	}
+	for _, n := range lb.targets {
+		if current[n] {
+			continue
+		}
+		if err := lb.cleanNode(ctx, n, logger); err != nil {
+			level.Warn(logger).Log("msg", "could not clean up node that is not labeled anymore", "node", n, "err", err)
+		}
+	}
+	lb.targets = names
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestLabelerMultiNode(t *testing.T) {
+	oldHostname := *hostname
+	*hostname, *nodeNames, *nodeSelector = "server", []string{"node3"}, "usb-server=a"
+	t.Cleanup(func() { *hostname, *nodeNames, *nodeSelector = oldHostname, nil, "" })
+	require.NoError(t, validateNodes())
+
+	node := func(name string, l map[string]string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: l}}
+	}
+	clientset := fake.NewSimpleClientset(
+		node("server", nil),
+		node("node1", map[string]string{"usb-server": "a"}),
+		node("node2", map[string]string{"usb-server": "a"}),
+		node("node3", nil),
+	)
+	ds := []device{{ID: "046d_c52b", Key: "Logitech_Receiver", Description: "Receiver (Logitech, Inc.)"}}
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return ds, nil
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	ctx := context.Background()
+	labeled := func(name string) bool {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		return n.Labels["nudl.squat.ai/Logitech_Receiver"] == "true"
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.True(t, labeled("node1"))
+	assert.True(t, labeled("node2"))
+	assert.True(t, labeled("node3"))
+	assert.False(t, labeled("server"))
+
+	// A node that does not match the selector anymore is cleaned up.
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node2", metav1.GetOptions{})
+	require.NoError(t, err)
+	n.Labels["usb-server"] = "b"
+	_, err = clientset.CoreV1().Nodes().Update(ctx, n, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	lb.resync()
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.True(t, labeled("node1"))
+	assert.False(t, labeled("node2"))
+
+	require.NoError(t, lb.cleanUp(ctx, log.NewNopLogger()))
+	assert.False(t, labeled("node1"))
+	assert.False(t, labeled("node3"))
+
+	*nodeCacheEnabled = true
+	t.Cleanup(func() { *nodeCacheEnabled = false })
+	assert.Error(t, validateNodes())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+var deviceNamesFile = flag.String("device-names-file", "", "YAML or JSON file that maps <vendor id>:<product id> to a short name that is used as the label key of the device instead of the generated key, e.g. '\"10c4:ea60\": cp210x'; changes of the file are applied with the next scan")
+
+var regDeviceNameID = regexp.MustCompile(`^([0-9a-f]{4}):([0-9a-f]{4})$`)
+
+// loadDeviceNames reads the device names file and returns the names by device id, e.g. 10c4_ea60.
+func loadDeviceNames(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read device names file: %w", err)
+	}
+	var m map[string]string
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("could not parse device names file: %w", err)
+	}
+	names := make(map[string]string, len(m))
+	for id, name := range m {
+		sm := regDeviceNameID.FindStringSubmatch(strings.ToLower(id))
+		if sm == nil {
+			return nil, fmt.Errorf("invalid device %q in device names file, the format is <vendor id>:<product id>", id)
+		}
+		if errs := validation.IsQualifiedName(name); len(errs) > 0 || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid name %q of device %q in device names file: %s", name, id, strings.Join(errs, "; "))
+		}
+		names[sm[1]+"_"+sm[2]] = name
+	}
+	return names, nil
+}
+
+// deviceNamesCache holds the parsed device names file, so it is only read again when it changes.
+var deviceNamesCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	names   map[string]string
+}
+
+// cachedDeviceNames returns the names of the device names file and reads the file only if its path, size or modification time changed.
+func cachedDeviceNames(path string) (map[string]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read device names file: %w", err)
+	}
+	c := &deviceNamesCache
+	c.Lock()
+	defer c.Unlock()
+	if c.names != nil && c.path == path && c.modTime.Equal(fi.ModTime()) && c.size == fi.Size() {
+		return c.names, nil
+	}
+	names, err := loadDeviceNames(path)
+	if err != nil {
+		return nil, err
+	}
+	c.path, c.modTime, c.size, c.names = path, fi.ModTime(), fi.Size(), names
+	return names, nil
+}
+
+// applyDeviceNames returns the devices with the keys of the device names file, if it is set.
+// The names take precedence over label-template.
+func applyDeviceNames(ds []device) ([]device, error) {
+	if *deviceNamesFile == "" {
+		return ds, nil
+	}
+	names, err := cachedDeviceNames(*deviceNamesFile)
+	if err != nil {
+		return nil, err
+	}
+	nds := make([]device, 0, len(ds))
+	for _, d := range ds {
+		if n, ok := names[d.ID]; ok {
+			d.Key = n
+		}
+		nds = append(nds, d)
+	}
+	return nds, nil
+}
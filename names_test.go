@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadDeviceNames(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+		want map[string]string
+		err  bool
+	}{
+		{name: "yaml", file: "\"10c4:ea60\": cp210x\n\"2E8A:000A\": pico\n", want: map[string]string{"10c4_ea60": "cp210x", "2e8a_000a": "pico"}},
+		{name: "json", file: `{"10c4:ea60": "cp210x"}`, want: map[string]string{"10c4_ea60": "cp210x"}},
+		{name: "invalid id", file: `{"10c4_ea60": "cp210x"}`, err: true},
+		{name: "invalid name", file: `{"10c4:ea60": "cp210x usb"}`, err: true},
+		{name: "name with prefix", file: `{"10c4:ea60": "example.com/cp210x"}`, err: true},
+		{name: "too long", file: `{"10c4:ea60": "` + strings.Repeat("a", 64) + `"}`, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "names.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.file), 0o644))
+			names, err := loadDeviceNames(path)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, names)
+		})
+	}
+}
+
+func TestApplyDeviceNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`"10c4:ea60": cp210x`), 0o644))
+	*deviceNamesFile = path
+	defer func() { *deviceNamesFile = "" }()
+	ds := []device{{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x-UART-Bridge"}, {ID: "2341_0043", Key: "Arduino-SA_Uno-R3"}}
+	nds, err := applyDeviceNames(ds)
+	require.NoError(t, err)
+	assert.Equal(t, "cp210x", nds[0].Key)
+	assert.Equal(t, "Arduino-SA_Uno-R3", nds[1].Key)
+	assert.Equal(t, "Silicon-Labs_CP210x-UART-Bridge", ds[0].Key)
+}
+
+func TestCachedDeviceNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`"10c4:ea60": cp210x`), 0o644))
+	names, err := cachedDeviceNames(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"10c4_ea60": "cp210x"}, names)
+
+	// The cached names are returned while the file is unchanged.
+	deviceNamesCache.names["10c4_ea60"] = "cached"
+	names, err = cachedDeviceNames(path)
+	require.NoError(t, err)
+	assert.Equal(t, "cached", names["10c4_ea60"])
+
+	// A changed file is read again.
+	require.NoError(t, os.WriteFile(path, []byte(`"10c4:ea60": uart`), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	names, err = cachedDeviceNames(path)
+	require.NoError(t, err)
+	assert.Equal(t, "uart", names["10c4_ea60"])
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	natsURL              = flag.String("nats-url", "", "URL of the NATS server to publish the inventory and events to, e.g. nats://nats:4222. NATS is disabled if empty.")
+	natsCredentialsFile  = flag.String("nats-credentials-file", "", "path to a NATS credentials file")
+	natsTLS              = newTLSFlags("nats", "NATS server")
+	natsEventSubject     = flag.String("nats-event-subject", "nudl.{node}.events", "NATS subject for attach and detach events, {node} and {device} are replaced with the hostname and the key of the device")
+	natsInventorySubject = flag.String("nats-inventory-subject", "nudl.{node}.inventory", "NATS subject for the inventory, {node} is replaced with the hostname, the inventory is not published if empty")
+	natsJetStream        = flag.Bool("nats-jetstream", false, "publish with JetStream and wait for the acknowledgement, a stream must exist for the subjects")
+)
+
+// natsPublisher publishes the inventory and events to NATS subjects.
+type natsPublisher struct {
+	conn natsConn
+}
+
+// natsConn publishes messages to NATS subjects.
+type natsConn interface {
+	publish(ctx context.Context, subject string, data []byte) error
+	close() error
+}
+
+// coreNATSConn publishes with core NATS.
+type coreNATSConn struct {
+	conn *nats.Conn
+}
+
+func (c coreNATSConn) publish(ctx context.Context, subject string, data []byte) error {
+	if err := c.conn.Publish(subject, data); err != nil {
+		return err
+	}
+	// Flush to make sure the message was sent to the server.
+	return c.conn.FlushWithContext(ctx)
+}
+
+func (c coreNATSConn) close() error {
+	return c.conn.Drain()
+}
+
+// jetStreamConn publishes with JetStream and waits for the acknowledgement.
+type jetStreamConn struct {
+	coreNATSConn
+	js jetstream.JetStream
+}
+
+func (c jetStreamConn) publish(ctx context.Context, subject string, data []byte) error {
+	_, err := c.js.Publish(ctx, subject, data)
+	return err
+}
+
+func newNATSPublisher(logger log.Logger) (*natsPublisher, error) {
+	opts := []nats.Option{
+		nats.Name(fmt.Sprintf("nudl-%s", *hostname)),
+		// Connect in the background, if the server is not reachable on start up.
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ConnectHandler(func(*nats.Conn) {
+			level.Info(logger).Log("msg", "connected to NATS server", "url", *natsURL)
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			level.Warn(logger).Log("msg", "disconnected from NATS server", "err", err)
+		}),
+	}
+	if *natsCredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(*natsCredentialsFile))
+	}
+	if natsTLS.enabled() {
+		c, err := natsTLS.config()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Secure(c))
+	}
+	conn, err := nats.Connect(*natsURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !*natsJetStream {
+		return &natsPublisher{conn: coreNATSConn{conn: conn}}, nil
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not create JetStream context: %w", err)
+	}
+	return &natsPublisher{conn: jetStreamConn{coreNATSConn: coreNATSConn{conn: conn}, js: js}}, nil
+}
+
+func (p *natsPublisher) Name() string {
+	return "nats"
+}
+
+func (p *natsPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	if *natsInventorySubject == "" {
+		return nil
+	}
+	return p.publish(ctx, natsSubject(*natsInventorySubject, ""), inv)
+}
+
+func (p *natsPublisher) PublishEvents(ctx context.Context, es []event) error {
+	for _, e := range es {
+		if err := p.publish(ctx, natsSubject(*natsEventSubject, e.Device.Key), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *natsPublisher) publish(ctx context.Context, subject string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.conn.publish(ctx, subject, data)
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.close()
+}
+
+// regNATSToken matches the token separator, the wildcards and whitespace,
+// which are not allowed within a token of a subject.
+var regNATSToken = regexp.MustCompile(`[.*>\s]`)
+
+// natsSubject replaces the {node} and {device} placeholders in the subject with the hostname and the key of the device.
+// The values are sanitized, so each of them stays a single token of the subject.
+func natsSubject(subject, key string) string {
+	return strings.NewReplacer(
+		"{node}", regNATSToken.ReplaceAllString(*hostname, "_"),
+		"{device}", regNATSToken.ReplaceAllString(key, "_"),
+	).Replace(subject)
+}
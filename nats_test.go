@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATSConn records the published messages.
+type fakeNATSConn struct {
+	subjects []string
+	data     [][]byte
+	err      error
+	closed   bool
+}
+
+func (c *fakeNATSConn) publish(_ context.Context, subject string, data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.subjects = append(c.subjects, subject)
+	c.data = append(c.data, data)
+	return nil
+}
+
+func (c *fakeNATSConn) close() error {
+	c.closed = true
+	return nil
+}
+
+func TestNATSSubject(t *testing.T) {
+	*hostname = "node.example.com"
+	defer func() { *hostname = "" }()
+	for _, tc := range []struct {
+		name    string
+		subject string
+		key     string
+		want    string
+	}{
+		{name: "default", subject: "nudl.{node}.events", key: "a", want: "nudl.node_example_com.events"},
+		{name: "device", subject: "nudl.{node}.events.{device}", key: "1d6b_0002", want: "nudl.node_example_com.events.1d6b_0002"},
+		{name: "dots in key", subject: "nudl.{node}.events.{device}", key: "usb.1d6b.0002", want: "nudl.node_example_com.events.usb_1d6b_0002"},
+		{name: "wildcards in key", subject: "nudl.{node}.events.{device}", key: "a*b>c", want: "nudl.node_example_com.events.a_b_c"},
+		{name: "whitespace in key", subject: "nudl.{node}.events.{device}", key: "a b\tc", want: "nudl.node_example_com.events.a_b_c"},
+		{name: "no device", subject: "nudl.{node}.inventory", key: "", want: "nudl.node_example_com.inventory"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, natsSubject(tc.subject, tc.key))
+		})
+	}
+
+	*hostname = "node*>"
+	assert.Equal(t, "nudl.node__.events", natsSubject("nudl.{node}.events", ""))
+}
+
+func TestNATSPublisher(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+	old := *natsEventSubject
+	defer func() { *natsEventSubject = old }()
+	*natsEventSubject = "nudl.{node}.events.{device}"
+	c := &fakeNATSConn{}
+	p := &natsPublisher{conn: c}
+	ctx := context.Background()
+
+	es := []event{
+		{Node: "node", Time: time.Now(), Type: eventAttached, Device: device{ID: "a_a", Key: "a.a"}},
+		{Node: "node", Time: time.Now(), Type: eventDetached, Device: device{ID: "b_b", Key: "b"}},
+	}
+	require.NoError(t, p.PublishEvents(ctx, es))
+	assert.Equal(t, []string{"nudl.node.events.a_a", "nudl.node.events.b"}, c.subjects)
+	var got event
+	require.NoError(t, json.Unmarshal(c.data[0], &got))
+	assert.Equal(t, es[0].Device, got.Device)
+	assert.Equal(t, eventAttached, got.Type)
+
+	c.subjects, c.data = nil, nil
+	inv := inventory{Node: "node", Devices: []device{{ID: "a_a", Key: "a.a"}}}
+	require.NoError(t, p.PublishInventory(ctx, inv))
+	assert.Equal(t, []string{"nudl.node.inventory"}, c.subjects)
+	var gotInv inventory
+	require.NoError(t, json.Unmarshal(c.data[0], &gotInv))
+	assert.Equal(t, inv.Devices, gotInv.Devices)
+
+	// The inventory is not published without a subject.
+	oldInv := *natsInventorySubject
+	defer func() { *natsInventorySubject = oldInv }()
+	*natsInventorySubject = ""
+	c.subjects = nil
+	require.NoError(t, p.PublishInventory(ctx, inv))
+	assert.Empty(t, c.subjects)
+
+	c.err = errors.New("no responders")
+	assert.ErrorIs(t, p.PublishEvents(ctx, es), c.err)
+
+	require.NoError(t, p.Close())
+	assert.True(t, c.closed)
+}
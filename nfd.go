@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// nfdNodeNameLabel tells NFD to which node a NodeFeature belongs.
+	nfdNodeNameLabel = "nfd.node.kubernetes.io/node-name"
+	// nfdFeature is the name of the feature that holds the devices.
+	nfdFeature = "nudl.usb"
+)
+
+var (
+	nfdNodeFeature = flag.Bool("nfd-nodefeature", false, "create a NodeFeature custom resource of Node Feature Discovery with the devices and labels of the node")
+	nfdNamespace   = flag.String("nfd-namespace", "node-feature-discovery", "namespace of the NodeFeature")
+
+	nfdNodeFeatureResource = schema.GroupVersionResource{Group: "nfd.k8s-sigs.io", Version: "v1alpha1", Resource: "nodefeatures"}
+)
+
+// nfdPublisher creates or updates a NodeFeature with the devices of the node,
+// so NFD applies the labels and NodeFeatureRules can match the devices.
+type nfdPublisher struct {
+	client dynamic.Interface
+}
+
+func newNFDPublisher(config *rest.Config) (*nfdPublisher, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	return &nfdPublisher{client: client}, nil
+}
+
+func (p *nfdPublisher) Name() string {
+	return "nfd"
+}
+
+func (p *nfdPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	nf := nfdNodeFeatureObject(inv.Devices)
+	if _, err := p.client.Resource(nfdNodeFeatureResource).Namespace(*nfdNamespace).Apply(ctx, nf.GetName(), nf, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+		return fmt.Errorf("could not apply NodeFeature %q: %w", nf.GetName(), err)
+	}
+	return nil
+}
+
+func (p *nfdPublisher) PublishEvents(_ context.Context, _ []event) error {
+	return nil
+}
+
+// Close deletes the NodeFeature, so NFD removes the labels, unless in once mode or without cleanup-on-exit.
+func (p *nfdPublisher) Close() error {
+	if keepOnExit() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *publishTimeout)
+	defer cancel()
+	if err := p.client.Resource(nfdNodeFeatureResource).Namespace(*nfdNamespace).Delete(ctx, nfdNodeFeatureName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete NodeFeature: %w", err)
+	}
+	return nil
+}
+
+func nfdNodeFeatureName() string {
+	return fmt.Sprintf("nudl-%s", *hostname)
+}
+
+// nfdNodeFeatureObject returns a NodeFeature with an instance for every device and the labels of the devices.
+func nfdNodeFeatureObject(ds []device) *unstructured.Unstructured {
+	elements := make([]interface{}, 0, len(ds))
+	for _, d := range ds {
+		attrs := map[string]interface{}{
+			"id":          d.ID,
+			"key":         d.Key,
+			"description": d.Description,
+		}
+		if vendor, product, ok := vendorProduct(d); ok {
+			attrs["vendor"] = vendor
+			attrs["product"] = product
+		}
+		elements = append(elements, map[string]interface{}{"attributes": attrs})
+	}
+	return nfdNodeFeatureWithSpec(map[string]interface{}{
+		"features": map[string]interface{}{
+			"instances": map[string]interface{}{
+				nfdFeature: map[string]interface{}{
+					"elements": elements,
+				},
+			},
+		},
+		"labels": nfdLabels(createLabels(ds)),
+	})
+}
+
+func nfdLabels(l labels) map[string]interface{} {
+	ls := make(map[string]interface{}, len(l))
+	for k, v := range l {
+		ls[k] = v
+	}
+	return ls
+}
+
+func nfdNodeFeatureWithSpec(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": nfdNodeFeatureResource.GroupVersion().String(),
+		"kind":       "NodeFeature",
+		"metadata": map[string]interface{}{
+			"name":      nfdNodeFeatureName(),
+			"namespace": *nfdNamespace,
+			"labels": map[string]interface{}{
+				nfdNodeNameLabel: *hostname,
+			},
+		},
+		"spec": spec,
+	}}
+}
+
+// nfdSink applies the labels to a NodeFeature instead of the node,
+// so in clusters that run NFD, NFD is the only component that labels the nodes.
+type nfdSink struct {
+	client dynamic.Interface
+}
+
+func newNFDSink(config *rest.Config) (*nfdSink, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	return &nfdSink{client: client}, nil
+}
+
+func (s *nfdSink) Write(ctx context.Context, l labels) error {
+	nf := nfdNodeFeatureWithSpec(map[string]interface{}{"labels": nfdLabels(l)})
+	if _, err := s.client.Resource(nfdNodeFeatureResource).Namespace(*nfdNamespace).Apply(ctx, nf.GetName(), nf, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+		return fmt.Errorf("could not apply NodeFeature %q: %w", nf.GetName(), err)
+	}
+	return nil
+}
+
+// Clean deletes the NodeFeature, so NFD removes the labels.
+func (s *nfdSink) Clean(ctx context.Context) error {
+	if err := s.client.Resource(nfdNodeFeatureResource).Namespace(*nfdNamespace).Delete(ctx, nfdNodeFeatureName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete NodeFeature: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNFDNodeFeatureObject(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+
+	nf := nfdNodeFeatureObject([]device{{ID: "046d_c52b", Key: "logitech", Description: "Logitech"}})
+	assert.Equal(t, "nudl-node", nf.GetName())
+	assert.Equal(t, "node", nf.GetLabels()[nfdNodeNameLabel])
+	ls, _, err := unstructured.NestedStringMap(nf.Object, "spec", "labels")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"nudl.squat.ai/logitech": "true"}, ls)
+	es, _, err := unstructured.NestedSlice(nf.Object, "spec", "features", "instances", nfdFeature, "elements")
+	require.NoError(t, err)
+	require.Len(t, es, 1)
+	attrs, _, err := unstructured.NestedStringMap(es[0].(map[string]interface{}), "attributes")
+	require.NoError(t, err)
+	assert.Equal(t, "046d", attrs["vendor"])
+	assert.Equal(t, "c52b", attrs["product"])
+}
+
+func TestNFDSink(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{nfdNodeFeatureResource: "NodeFeatureList"})
+	// The fake client can not apply objects.
+	var applied []byte
+	client.PrependReactor("patch", "nodefeatures", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		applied = a.(k8stesting.PatchAction).GetPatch()
+		return true, nfdNodeFeatureWithSpec(map[string]interface{}{}), nil
+	})
+	s := &nfdSink{client: client}
+	ctx := context.Background()
+
+	require.NoError(t, s.Write(ctx, labels{"nudl.squat.ai/logitech": "true"}))
+	var nf unstructured.Unstructured
+	require.NoError(t, nf.UnmarshalJSON(applied))
+	assert.Equal(t, "nudl-node", nf.GetName())
+	ls, _, err := unstructured.NestedStringMap(nf.Object, "spec", "labels")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"nudl.squat.ai/logitech": "true"}, ls)
+	_, found, err := unstructured.NestedFieldNoCopy(nf.Object, "spec", "features")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// A missing NodeFeature is not an error.
+	require.NoError(t, s.Clean(ctx))
+}
+
+func TestNFDPublisherCloseKeepsNodeFeature(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{nfdNodeFeatureResource: "NodeFeatureList"})
+	p := &nfdPublisher{client: client}
+
+	*cleanupOnExit = false
+	require.NoError(t, p.Close())
+	*cleanupOnExit = true
+	assert.Empty(t, client.Actions())
+
+	require.NoError(t, p.Close())
+	require.Len(t, client.Actions(), 1)
+	assert.Equal(t, "delete", client.Actions()[0].GetVerb())
+}
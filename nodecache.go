@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var nodeCacheEnabled = flag.Bool("node-cache", false, "read the node from a cache that watches only the node of the instance instead of getting it from the api server on every update, which needs the permissions to list and watch nodes")
+
+// nodeCache watches the node of the instance with a field selector on its name,
+// so the node is not fetched from the api server on every update and the labels can be compared
+// with the cached node during brief outages of the api server.
+type nodeCache struct {
+	factory informers.SharedInformerFactory
+	lister  listerscorev1.NodeLister
+	synced  cache.InformerSynced
+}
+
+func newNodeCache(clientset kubernetes.Interface) *nodeCache {
+	f := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+		o.FieldSelector = fields.OneTermEqualSelector("metadata.name", *hostname).String()
+	}))
+	i := f.Core().V1().Nodes()
+	return &nodeCache{factory: f, lister: i.Lister(), synced: i.Informer().HasSynced}
+}
+
+// start starts the watch until the context is done.
+// It does not wait for the cache to sync, until then the node is fetched from the api server.
+func (c *nodeCache) start(ctx context.Context) {
+	c.factory.Start(ctx.Done())
+}
+
+// get returns a copy of the node from the cache,
+// or fetches the node from the api server, if the cache did not sync yet.
+func (c *nodeCache) get(ctx context.Context, clientset kubernetes.Interface) (*v1.Node, error) {
+	if !c.synced() {
+		return getNode(ctx, clientset)
+	}
+	node, err := c.lister.Get(*hostname)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", errNodeNotFound, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get node from cache: %w", err)
+	}
+	// Objects of the cache must not be modified.
+	return node.DeepCopy(), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestNodeCache(t *testing.T) {
+	old := *hostname
+	*hostname = "node1"
+	t.Cleanup(func() { *hostname = old })
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"a": "b"}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newNodeCache(clientset)
+	// The node is fetched from the api server until the cache synced.
+	node, err := c.get(ctx, clientset)
+	require.NoError(t, err)
+	assert.Equal(t, "node1", node.Name)
+
+	c.start(ctx)
+	require.True(t, cache.WaitForCacheSync(ctx.Done(), c.synced))
+	clientset.ClearActions()
+	node, err = c.get(ctx, clientset)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b"}, node.Labels)
+	for _, a := range clientset.Actions() {
+		assert.NotEqual(t, "get", a.GetVerb())
+	}
+
+	// The returned node is a copy.
+	node.Labels["a"] = "c"
+	node, err = c.get(ctx, clientset)
+	require.NoError(t, err)
+	assert.Equal(t, "b", node.Labels["a"])
+}
+
+func TestLabelerNodeCacheConflict(t *testing.T) {
+	oldHostname, oldStrategy, oldBackoff := *hostname, *patchStrategy, *patchRetryBackoff
+	*hostname, *patchStrategy, *patchRetryBackoff = "node1", patchStrategyJSON, time.Millisecond
+	t.Cleanup(func() { *hostname, *patchStrategy, *patchRetryBackoff = oldHostname, oldStrategy, oldBackoff })
+
+	// The cache is behind the api server, which changed the label since.
+	stale := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", ResourceVersion: "1", Labels: map[string]string{"nudl.squat.ai/Logitech_Receiver": "false"}}}
+	latest := stale.DeepCopy()
+	latest.ResourceVersion, latest.Labels["nudl.squat.ai/Logitech_Receiver"] = "2", "true"
+	clientset := fake.NewSimpleClientset(latest)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(stale))
+
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}, {ID: "0781_5581", Key: "Ultra"}}, nil
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	lb.nodes = &nodeCache{lister: listerscorev1.NewNodeLister(indexer), synced: func() bool { return true }}
+	ctx := context.Background()
+
+	// The patch of the stale node fails, and the retry gets the latest node from the api server.
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	var gets int
+	for _, a := range clientset.Actions() {
+		if a.GetVerb() == "get" && a.GetResource().Resource == "nodes" {
+			gets++
+		}
+	}
+	assert.Equal(t, 1, gets)
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "true", n.Labels["nudl.squat.ai/Ultra"])
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+var nodeEvents = flag.Bool("node-events", false, "record Kubernetes Events on the node when a device is attached or detached, so they show up in kubectl describe node")
+
+// nodeEventPublisher records Events on the node for attached and detached devices.
+type nodeEventPublisher struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+}
+
+func newNodeEventPublisher(config *rest.Config) (*nodeEventPublisher, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kubernetes clientset: %w", err)
+	}
+	b := record.NewBroadcaster()
+	b.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return &nodeEventPublisher{
+		broadcaster: b,
+		recorder:    b.NewRecorder(scheme.Scheme, v1.EventSource{Component: fieldManager, Host: *hostname}),
+	}, nil
+}
+
+func (*nodeEventPublisher) Name() string {
+	return "node-events"
+}
+
+func (*nodeEventPublisher) PublishInventory(_ context.Context, _ inventory) error {
+	return nil
+}
+
+// PublishEvents records an Event for every device that is not filtered.
+// The Events are sent asynchronously by the broadcaster, which also aggregates and rate limits them.
+func (p *nodeEventPublisher) PublishEvents(_ context.Context, es []event) error {
+	for _, e := range es {
+		if filtered(e.Device) {
+			continue
+		}
+		reason, msg := nodeEventReasonMessage(e)
+		p.recorder.Event(nodeReference(e.Node), v1.EventTypeNormal, reason, msg)
+	}
+	return nil
+}
+
+// Close flushes the Events.
+func (p *nodeEventPublisher) Close() error {
+	p.broadcaster.Shutdown()
+	return nil
+}
+
+// nodeReference returns the reference to the node that kubectl describe node uses to find its Events.
+// The uid is the name of the node like in the Events of the kubelet.
+func nodeReference(name string) *v1.ObjectReference {
+	return &v1.ObjectReference{Kind: "Node", Name: name, UID: types.UID(name)}
+}
+
+// nodeEventReasonMessage returns the reason and the message of the Event of an attached or detached device,
+// e.g. DeviceDetached and "USB device CP210x UART Bridge (Silicon Labs) 10c4_ea60 detached from port 1-2".
+func nodeEventReasonMessage(e event) (string, string) {
+	bus := "USB"
+	switch {
+	case isPCI(e.Device):
+		bus = "PCI"
+	case isDev(e.Device):
+		bus = "Device node"
+	case isI2C(e.Device):
+		bus = "I2C"
+	case isGPIO(e.Device):
+		bus = "GPIO"
+	case isSound(e.Device):
+		bus = "Sound"
+	case isStorage(e.Device):
+		bus = "Storage"
+	case isThunderbolt(e.Device):
+		bus = "Thunderbolt"
+	}
+	reason, verb, prep := "DeviceAttached", eventAttached, "to"
+	if e.Type != eventAttached {
+		reason, verb, prep = "DeviceDetached", eventDetached, "from"
+	}
+	msg := fmt.Sprintf("%s device %s %s %s", bus, e.Device.Description, e.Device.ID, verb)
+	if e.Device.Port != "" {
+		msg += fmt.Sprintf(" %s port %s", prep, e.Device.Port)
+	}
+	return reason, msg
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestNodeEventPublisher(t *testing.T) {
+	oldNoContain := *noContain
+	*noContain = []string{"hub"}
+	t.Cleanup(func() { *noContain = oldNoContain })
+
+	r := record.NewFakeRecorder(10)
+	p := &nodeEventPublisher{recorder: r}
+	now := time.Now()
+	require.NoError(t, p.PublishEvents(context.Background(), []event{
+		{Node: "node1", Time: now, Type: eventDetached, Device: device{ID: "10c4_ea60", Description: "CP210x UART Bridge (Silicon Labs)", Port: "1-2"}},
+		{Node: "node1", Time: now, Type: eventAttached, Device: device{ID: "1d6b_0002", Description: "2.0 root hub (Linux Foundation)"}},
+		{Node: "node1", Time: now, Type: eventAttached, Device: device{ID: "dev-video0", Description: "HD Pro Webcam C920 (video0)"}},
+	}))
+	close(r.Events)
+	var got []string
+	for e := range r.Events {
+		got = append(got, e)
+	}
+	assert.Equal(t, []string{
+		"Normal DeviceDetached USB device CP210x UART Bridge (Silicon Labs) 10c4_ea60 detached from port 1-2",
+		"Normal DeviceAttached Device node device HD Pro Webcam C920 (video0) dev-video0 attached",
+	}, got)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var regHexID = regexp.MustCompile(`^([0-9a-f]{4})_([0-9a-f]{4})$`)
+
+// isOnlyPattern returns true if an entry of only is a wildcard pattern, e.g. 10c4_* or *_ea60.
+func isOnlyPattern(s string) bool {
+	return strings.Contains(s, "*")
+}
+
+// onlyMatches returns true if the key matches the entry of only.
+func onlyMatches(s, key string) bool {
+	if !isOnlyPattern(s) {
+		return s == key
+	}
+	// The patterns are validated on start.
+	ok, _ := path.Match(s, key)
+	return ok
+}
+
+// onlyMatchedKey returns the key without prefix of the aggregate label of a pattern,
+// e.g. 10c4_any.matched for 10c4_*, because labels can not contain wildcards.
+func onlyMatchedKey(s string) string {
+	return suffixKey(strings.ReplaceAll(s, "*", "any"), ".matched")
+}
+
+// validateOnly returns an error if a pattern of only is malformed.
+// Only * is a wildcard, because the other metacharacters of path.Match would not be treated as a pattern
+// and can not be part of the key of the matched label.
+func validateOnly() error {
+	for _, s := range *only {
+		if i := strings.IndexAny(s, `?[]\`); i >= 0 {
+			return fmt.Errorf("invalid --only pattern %q: only * is supported as wildcard, not %q", s, s[i])
+		}
+	}
+	return nil
+}
+
+// onlyKey returns the label key without prefix of an entry of only that is not a pattern.
+// Entries can be label keys, e.g. Silicon-Labs_CP210x-UART-Bridge, or the ids of devices, e.g. 10c4_ea60.
+// If the keys are human readable, the id of a device is resolved to the key of the attached device,
+// or to the key generated from the usb.ids database, if the device is not attached and known.
+func onlyKey(s string, ds []device) string {
+	if !*humanReadable || *dualLabels {
+		return s
+	}
+	for _, d := range ds {
+		if d.Key == s {
+			return s
+		}
+	}
+	for _, d := range ds {
+		if d.ID == s && !filtered(d) {
+			return d.Key
+		}
+	}
+	sm := regHexID.FindStringSubmatch(s)
+	if sm == nil {
+		return s
+	}
+	if *deviceNamesFile != "" {
+		// The file is validated on start.
+		if names, err := cachedDeviceNames(*deviceNamesFile); err == nil && names[s] != "" {
+			return names[s]
+		}
+	}
+	vendor, _ := strconv.ParseUint(sm[1], 16, 16)
+	product, _ := strconv.ParseUint(sm[2], 16, 16)
+	n := lookupName(deviceID{vendor: usbID(vendor), product: usbID(product)})
+	// Unknown devices keep the id, because the generated key would not be readable.
+	if !regParse.MatchString(n.description) || strings.HasPrefix(n.description, "Unknown (") {
+		return s
+	}
+	return n.key
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnlyPatterns(t *testing.T) {
+	*humanReadable = false
+	*only = []string{"10c4_*", "*_6001", "2341_0043"}
+	defer func() { *humanReadable, *only = true, []string{} }()
+	ds := []device{{ID: "10c4_ea60", Key: "10c4_ea60"}, {ID: "10c4_ea70", Key: "10c4_ea70"}}
+	assert.Equal(t, labels{
+		"nudl.squat.ai/10c4_ea60":        "true",
+		"nudl.squat.ai/10c4_ea70":        "true",
+		"nudl.squat.ai/10c4_any.matched": "true",
+		"nudl.squat.ai/any_6001.matched": "false",
+		"nudl.squat.ai/2341_0043":        "false",
+	}, createLabels(ds))
+	assert.Equal(t, []string{"*_6001", "2341_0043"}, missingOnly(ds))
+	assert.Equal(t, map[string]int64{"nudl.squat.ai/10c4_ea60": 1, "nudl.squat.ai/10c4_ea70": 1}, extendedResourceCounts(ds))
+
+	assert.NoError(t, validateOnly())
+	for _, s := range []string{"10c4_[ea", "10c4_[e]a60", "10c4_ea6?", `10c4_ea6\0`} {
+		*only = []string{s}
+		assert.Error(t, validateOnly(), s)
+	}
+}
+
+func TestOnlyHumanReadable(t *testing.T) {
+	if !libusbAvailable {
+		t.Skip("the embedded usb.ids needs cgo")
+	}
+	*only = []string{"2341_0043", "Silicon-Labs_CP210x-UART-Bridge", "1d6b_0002"}
+	defer func() { *only = []string{} }()
+	ds := []device{
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3--CDC-ACM-", Description: "Uno R3 (CDC ACM) (Arduino SA)"},
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x-UART-Bridge", Description: "CP210x UART Bridge (Silicon Labs)"},
+	}
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Arduino-SA_Uno-R3--CDC-ACM-":     "true",
+		"nudl.squat.ai/Silicon-Labs_CP210x-UART-Bridge": "true",
+		"nudl.squat.ai/Linux-Foundation_2.0-root-hub":   "false",
+	}, createLabels(ds))
+	assert.Equal(t, []string{"1d6b_0002"}, missingOnly(ds))
+	assert.Equal(t, map[string]int64{"nudl.squat.ai/Arduino-SA_Uno-R3--CDC-ACM-": 1, "nudl.squat.ai/Silicon-Labs_CP210x-UART-Bridge": 1}, extendedResourceCounts(ds))
+}
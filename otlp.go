@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var otlpLogsEndpoint = flag.String("otlp-logs-endpoint", "", "URL of an OTLP/HTTP endpoint to export the logs to in addition to stdout, e.g. http://otel-collector:4318. Logs are not exported if empty.")
+
+// newOTLPLogger returns a logger that exports the logs over OTLP.
+// The returned function flushes the buffered logs and shuts the exporter down.
+func newOTLPLogger(ctx context.Context) (log.Logger, func(context.Context) error, error) {
+	exp, err := otlploghttp.New(ctx, otlploghttp.WithEndpointURL(*otlpLogsEndpoint))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create OTLP log exporter: %w", err)
+	}
+	res, err := otlpResource()
+	if err != nil {
+		return nil, nil, err
+	}
+	p := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
+		sdklog.WithResource(res),
+	)
+	return otlpLogger{logger: p.Logger("github.com/leonnicolas/nudl")}, p.Shutdown, nil
+}
+
+// otlpResource returns the resource of the exported logs.
+// It must be called after the hostname was detected.
+func otlpResource() (*resource.Resource, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("nudl"),
+		semconv.HostName(*hostname),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("could not create OTLP resource: %w", err)
+	}
+	return res, nil
+}
+
+// otlpLogger converts go-kit log lines into OTLP log records.
+// The msg becomes the body, the level the severity and all other key value pairs attributes.
+type otlpLogger struct {
+	logger otellog.Logger
+}
+
+func (l otlpLogger) Log(keyvals ...interface{}) error {
+	var r otellog.Record
+	r.SetObservedTimestamp(time.Now())
+	for i := 0; i < len(keyvals); i += 2 {
+		k := fmt.Sprint(keyvals[i])
+		var v interface{} = log.ErrMissingValue
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		switch {
+		case k == "msg":
+			r.SetBody(otellog.StringValue(fmt.Sprint(v)))
+		case k == "ts":
+			if t, ok := v.(time.Time); ok {
+				r.SetTimestamp(t)
+			}
+		case keyvals[i] == level.Key():
+			r.SetSeverityText(fmt.Sprint(v))
+			r.SetSeverity(otlpSeverity(v))
+		default:
+			r.AddAttributes(otellog.String(k, fmt.Sprint(v)))
+		}
+	}
+	l.logger.Emit(context.Background(), r)
+	return nil
+}
+
+func otlpSeverity(v interface{}) otellog.Severity {
+	switch v {
+	case level.DebugValue():
+		return otellog.SeverityDebug
+	case level.InfoValue():
+		return otellog.SeverityInfo
+	case level.WarnValue():
+		return otellog.SeverityWarn
+	case level.ErrorValue():
+		return otellog.SeverityError
+	}
+	return otellog.SeverityUndefined
+}
+
+// teeLogger logs to all loggers.
+type teeLogger []log.Logger
+
+func (t teeLogger) Log(keyvals ...interface{}) error {
+	var err error
+	for _, l := range t {
+		if lerr := l.Log(keyvals...); lerr != nil && err == nil {
+			err = lerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/logtest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestOTLPSeverity(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		v    interface{}
+		want otellog.Severity
+	}{
+		{name: "debug", v: level.DebugValue(), want: otellog.SeverityDebug},
+		{name: "info", v: level.InfoValue(), want: otellog.SeverityInfo},
+		{name: "warn", v: level.WarnValue(), want: otellog.SeverityWarn},
+		{name: "error", v: level.ErrorValue(), want: otellog.SeverityError},
+		{name: "string is not a level", v: "error", want: otellog.SeverityUndefined},
+		{name: "nil", v: nil, want: otellog.SeverityUndefined},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, otlpSeverity(tc.v))
+		})
+	}
+}
+
+func TestOTLPLoggerLog(t *testing.T) {
+	r := logtest.NewRecorder()
+	l := otlpLogger{logger: r.Logger("test")}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, level.Warn(l).Log("ts", ts, "msg", "device missing", "device", "1d6b:0002", "count", 2, "err", errors.New("gone"), "dangling"))
+
+	res := r.Result()
+	require.Len(t, res, 1)
+	require.Len(t, res[0].Records, 1)
+	rec := res[0].Records[0].Record
+	assert.Equal(t, otellog.StringValue("device missing"), rec.Body())
+	assert.Equal(t, ts, rec.Timestamp())
+	assert.False(t, rec.ObservedTimestamp().IsZero())
+	assert.Equal(t, otellog.SeverityWarn, rec.Severity())
+	assert.Equal(t, "warn", rec.SeverityText())
+
+	attrs := map[string]otellog.Value{}
+	rec.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	assert.Equal(t, map[string]otellog.Value{
+		"device":   otellog.StringValue("1d6b:0002"),
+		"count":    otellog.StringValue("2"),
+		"err":      otellog.StringValue("gone"),
+		"dangling": otellog.StringValue(log.ErrMissingValue.Error()),
+	}, attrs)
+}
+
+func TestOTLPResourceHostName(t *testing.T) {
+	old := *hostname
+	defer func() { *hostname = old }()
+	*hostname = "node-a"
+
+	res, err := otlpResource()
+	require.NoError(t, err)
+	v, ok := res.Set().Value(semconv.HostNameKey)
+	require.True(t, ok)
+	assert.Equal(t, "node-a", v.AsString())
+}
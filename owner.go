@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	takeover     = flag.Bool("takeover", false, "label the node even if another nudl instance labeled it recently, e.g. to replace an instance that is stuck")
+	ownerTimeout = flag.Duration("owner-timeout", 0, "time after which an owner that did not renew its heartbeat is considered dead, so another instance labels the node; the heartbeat is renewed after half of it; an owner whose pod does not exist anymore is considered dead immediately; 0 uses three times resync-period plus the longest of update-time, steady-update-time and min-patch-interval")
+)
+
+// errConcurrentWriter is returned if another nudl instance is labeling the node.
+var errConcurrentWriter = errors.New("another nudl instance is labeling the node")
+
+// owner is the nudl instance that labels a node.
+type owner struct {
+	ID string `json:"id"`
+	// Pod is the namespace and name of the pod of the instance, if the id is the uid of the pod.
+	Pod       string    `json:"pod,omitempty"`
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// ownerAnnotationKey returns the key of the annotation that holds the owner of the labels.
+func ownerAnnotationKey() string {
+	return sprintLabelKey("owner")
+}
+
+// newInstanceID returns the id of the nudl instance: the uid of the pod from the POD_UID environment variable,
+// e.g. set with the downward API field metadata.uid, so a container that is restarted in the same pod keeps its id,
+// or a random id.
+func newInstanceID() string {
+	if uid := os.Getenv("POD_UID"); uid != "" {
+		return uid
+	}
+	b := make([]byte, 8)
+	// crypto/rand does not fail on the supported platforms.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// instancePod returns the namespace and name of the pod of the instance, e.g. kube-system/nudl-x2k9v,
+// from the POD_NAMESPACE and POD_NAME environment variables, if the instance id is the uid of the pod.
+// Other instances use it to detect that the pod of the owner does not exist anymore.
+func instancePod() string {
+	ns, name := os.Getenv("POD_NAMESPACE"), os.Getenv("POD_NAME")
+	if os.Getenv("POD_UID") == "" || ns == "" || name == "" {
+		return ""
+	}
+	return ns + "/" + name
+}
+
+// ownerReconcileInterval returns the longest time between two reconciliations that get the node with unchanged devices:
+// the first reconciliation after resync-period, which may be delayed by the update interval or the rate limit.
+func ownerReconcileInterval() time.Duration {
+	return *resyncPeriod + max(*updateTime, *steadyUpdateTime, *minPatchInterval)
+}
+
+// ownerTimeoutDuration returns owner-timeout or, if it is not set, three times the reconcile interval,
+// so the heartbeat is only renewed with every other resync.
+func ownerTimeoutDuration() time.Duration {
+	if *ownerTimeout > 0 {
+		return *ownerTimeout
+	}
+	return 3 * ownerReconcileInterval()
+}
+
+// validateOwnerTimeout returns an error if the owner could time out between two heartbeats of a healthy instance.
+// The heartbeat is renewed by the first reconciliation that gets the node after half of owner-timeout,
+// so owner-timeout must be longer than twice the reconcile interval.
+// Only an agent with the kubernetes sink writes the owner annotation, and not in once mode, because the instance releases the node on exit.
+func validateOwnerTimeout() error {
+	if *ownerTimeout < 0 {
+		return errors.New("owner-timeout must not be negative")
+	}
+	if *mode != modeAgent || *sinkName != sinkKubernetes || *once || *ownerTimeout == 0 {
+		return nil
+	}
+	if limit := 2 * ownerReconcileInterval(); *ownerTimeout <= limit {
+		return fmt.Errorf("owner-timeout %s must be longer than twice resync-period plus the longest of update-time, steady-update-time and min-patch-interval, %s", *ownerTimeout, limit)
+	}
+	return nil
+}
+
+// checkOwner returns errConcurrentWriter if the annotations name another instance as the owner of the labels
+// whose heartbeat did not time out, unless takeover is set.
+// It returns the other owner, if there is one, so the takeover can be logged.
+func checkOwner(annotations map[string]string, id string, now time.Time) (*owner, error) {
+	v, ok := annotations[ownerAnnotationKey()]
+	if !ok {
+		return nil, nil
+	}
+	var o owner
+	if err := json.Unmarshal([]byte(v), &o); err != nil {
+		// A broken annotation is overwritten.
+		return nil, nil
+	}
+	if o.ID == id || now.Sub(o.Heartbeat) > ownerTimeoutDuration() {
+		return nil, nil
+	}
+	if !*takeover {
+		return &o, fmt.Errorf("%w: instance %s renewed its heartbeat at %s", errConcurrentWriter, o.ID, o.Heartbeat.Format(time.RFC3339))
+	}
+	return &o, nil
+}
+
+// ownerPodGone returns true if the pod of the owner does not exist anymore or is another pod with the same name,
+// e.g. after the owner was killed without a graceful shutdown, so its heartbeat did not time out yet.
+// The pod is looked up by name, because pods can not be selected by uid.
+// Without the pod of the owner, the owner is only considered dead after owner-timeout.
+func ownerPodGone(ctx context.Context, clientset kubernetes.Interface, o *owner) (bool, error) {
+	ns, name, ok := strings.Cut(o.Pod, "/")
+	if !ok {
+		return false, nil
+	}
+	p, err := clientset.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return string(p.UID) != o.ID || p.Status.Phase == v1.PodFailed || p.Status.Phase == v1.PodSucceeded, nil
+}
+
+// ownerAnnotations returns the annotation with the instance as the owner and the current time as the heartbeat.
+// The heartbeat is only renewed after half of the owner timeout, so unchanged labels do not cause a patch
+// on every reconciliation or resync.
+// It is deleted if the node is cleaned up.
+func ownerAnnotations(current map[string]string, id, pod string, now time.Time, clean bool) (map[string]*string, error) {
+	k := ownerAnnotationKey()
+	v, exists := current[k]
+	if clean {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	var o owner
+	if exists && json.Unmarshal([]byte(v), &o) == nil && o.ID == id && o.Pod == pod && now.Sub(o.Heartbeat) < ownerTimeoutDuration()/2 {
+		return nil, nil
+	}
+	data, err := json.Marshal(owner{ID: id, Pod: pod, Heartbeat: now.UTC().Truncate(time.Second)})
+	if err != nil {
+		return nil, err
+	}
+	v = string(data)
+	return map[string]*string{k: &v}, nil
+}
+
+// releaseOwnerPatch returns a strategic merge patch that deletes the owner annotation, if it names the instance.
+// It returns nil if another instance or no instance owns the node.
+func releaseOwnerPatch(annotations map[string]string, id string) ([]byte, error) {
+	var o owner
+	if v, ok := annotations[ownerAnnotationKey()]; !ok || json.Unmarshal([]byte(v), &o) != nil || o.ID != id {
+		return nil, nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{ownerAnnotationKey(): nil},
+		},
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestCheckOwner(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	annotations := func(id string, heartbeat time.Time) map[string]string {
+		a, err := ownerAnnotations(nil, id, "", heartbeat, false)
+		require.NoError(t, err)
+		return map[string]string{ownerAnnotationKey(): *a[ownerAnnotationKey()]}
+	}
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		takeover    bool
+		owner       bool
+		err         bool
+	}{
+		{name: "no owner"},
+		{name: "broken annotation", annotations: map[string]string{ownerAnnotationKey(): "{"}},
+		{name: "same instance", annotations: annotations("a", now)},
+		{name: "other instance", annotations: annotations("b", now.Add(-time.Minute)), owner: true, err: true},
+		{name: "takeover", annotations: annotations("b", now.Add(-time.Minute)), takeover: true, owner: true},
+		{name: "dead instance", annotations: annotations("b", now.Add(-ownerTimeoutDuration()-time.Second))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			*takeover = tc.takeover
+			t.Cleanup(func() { *takeover = false })
+			o, err := checkOwner(tc.annotations, "a", now)
+			assert.Equal(t, tc.owner, o != nil)
+			if tc.err {
+				assert.True(t, errors.Is(err, errConcurrentWriter))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLabelerConcurrentWriter(t *testing.T) {
+	old := *hostname
+	*hostname = "node1"
+	t.Cleanup(func() { *hostname = old })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}, nil
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	a := newLabeler(clientset, c, nil, s)
+	b := newLabeler(clientset, c, nil, s)
+	ctx := context.Background()
+	node := func() *v1.Node {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return n
+	}
+
+	require.NoError(t, a.reconcile(ctx, log.NewNopLogger()))
+	assert.Contains(t, node().Annotations[ownerAnnotationKey()], a.id)
+	assert.ErrorIs(t, b.reconcile(ctx, log.NewNopLogger()), errConcurrentWriter)
+
+	*takeover = true
+	require.NoError(t, b.reconcile(ctx, log.NewNopLogger()))
+	*takeover = false
+	assert.Contains(t, node().Annotations[ownerAnnotationKey()], b.id)
+
+	// The instance that was taken over does not clean up the labels of the new owner.
+	require.NoError(t, a.cleanUp(ctx, log.NewNopLogger()))
+	assert.Equal(t, "true", node().Labels["nudl.squat.ai/Logitech_Receiver"])
+
+	require.NoError(t, b.cleanUp(ctx, log.NewNopLogger()))
+	assert.NotContains(t, node().Labels, "nudl.squat.ai/Logitech_Receiver")
+	assert.NotContains(t, node().Annotations, ownerAnnotationKey())
+}
+
+func TestLabelerSequentialInstances(t *testing.T) {
+	old := *hostname
+	*hostname = "node1"
+	t.Cleanup(func() { *hostname = old })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}, nil
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	ctx := context.Background()
+
+	// An instance that keeps the labels on exit releases the node, e.g. a run of once.
+	a := newLabeler(clientset, c, nil, s)
+	require.NoError(t, a.reconcile(ctx, log.NewNopLogger()))
+	require.NoError(t, a.release(ctx, log.NewNopLogger()))
+	b := newLabeler(clientset, c, nil, s)
+	require.NoError(t, b.reconcile(ctx, log.NewNopLogger()))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, n.Annotations[ownerAnnotationKey()], b.id)
+	assert.Equal(t, "true", n.Labels["nudl.squat.ai/Logitech_Receiver"])
+
+	// A container that is restarted in the same pod, e.g. by the liveness probe, has the same id.
+	t.Setenv("POD_UID", "5f0c1b2e-8d1a-4f7e-9c3a-2b6d4e8f1a0c")
+	d := newLabeler(clientset, c, nil, s)
+	require.NoError(t, b.release(ctx, log.NewNopLogger()))
+	require.NoError(t, d.reconcile(ctx, log.NewNopLogger()))
+	e := newLabeler(clientset, c, nil, s)
+	assert.Equal(t, d.id, e.id)
+	require.NoError(t, e.reconcile(ctx, log.NewNopLogger()))
+
+	// Another instance does not release the node.
+	require.NoError(t, a.release(ctx, log.NewNopLogger()))
+	n, err = clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, n.Annotations[ownerAnnotationKey()], e.id)
+}
+
+func TestLabelerOwnerHeartbeat(t *testing.T) {
+	old := *hostname
+	*hostname = "node1"
+	t.Cleanup(func() { *hostname = old })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}, nil
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	lb := newLabeler(clientset, c, nil, s)
+	ctx := context.Background()
+	heartbeat := func() time.Time {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		var o owner
+		require.NoError(t, json.Unmarshal([]byte(n.Annotations[ownerAnnotationKey()]), &o))
+		return o.Heartbeat
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	first := heartbeat()
+	// Reconciliations before the resync do not renew the heartbeat.
+	c.SetTime(c.Now().Add(*updateTime))
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, first, heartbeat())
+	// The first resync does not renew the heartbeat, because it is younger than half of the owner timeout.
+	c.SetTime(c.Now().Add(*resyncPeriod))
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, first, heartbeat())
+	// The second resync renews it, before the owner times out.
+	c.SetTime(c.Now().Add(*resyncPeriod + *updateTime))
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.True(t, heartbeat().After(first))
+	assert.Less(t, c.Now().Sub(first), ownerTimeoutDuration())
+}
+
+func TestLabelerOwnerCrashed(t *testing.T) {
+	old := *hostname
+	*hostname = "node1"
+	t.Cleanup(func() { *hostname = old })
+
+	pod := func(name, uid string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: name, UID: types.UID(uid)}, Spec: v1.PodSpec{NodeName: "node1"}}
+	}
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, pod("nudl-a", "uid-a"), pod("nudl-b", "uid-b"))
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}, nil
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	ctx := context.Background()
+	newPodLabeler := func(name, uid string) *labeler {
+		t.Setenv("POD_NAMESPACE", "kube-system")
+		t.Setenv("POD_NAME", name)
+		t.Setenv("POD_UID", uid)
+		return newLabeler(clientset, c, nil, s)
+	}
+
+	a := newPodLabeler("nudl-a", "uid-a")
+	assert.Equal(t, "kube-system/nudl-a", a.pod)
+	require.NoError(t, a.reconcile(ctx, log.NewNopLogger()))
+
+	// While the pod of the owner exists, e.g. during a rolling update, another instance does not label the node.
+	b := newPodLabeler("nudl-b", "uid-b")
+	assert.ErrorIs(t, b.reconcile(ctx, log.NewNopLogger()), errConcurrentWriter)
+
+	// The pod of the owner was killed without releasing the node, e.g. by the OOM killer or a reboot of the node,
+	// so the next instance labels the node before the heartbeat of the owner times out.
+	require.NoError(t, clientset.CoreV1().Pods("kube-system").Delete(ctx, "nudl-a", metav1.DeleteOptions{}))
+	require.NoError(t, b.reconcile(ctx, log.NewNopLogger()))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, n.Annotations[ownerAnnotationKey()], `"id":"uid-b"`)
+	assert.Equal(t, "true", n.Labels["nudl.squat.ai/Logitech_Receiver"])
+
+	// A pod with the name of the owner but another uid is a new pod.
+	require.NoError(t, clientset.CoreV1().Pods("kube-system").Delete(ctx, "nudl-b", metav1.DeleteOptions{}))
+	_, err = clientset.CoreV1().Pods("kube-system").Create(ctx, pod("nudl-b", "uid-c"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, newPodLabeler("nudl-b", "uid-c").reconcile(ctx, log.NewNopLogger()))
+
+	// Without the pod of the owner, the owner is only considered dead after owner-timeout.
+	d := newLabeler(clientset, c, nil, s)
+	d.id, d.pod = "d", ""
+	*takeover = true
+	require.NoError(t, d.reconcile(ctx, log.NewNopLogger()))
+	*takeover = false
+	e := newLabeler(clientset, c, nil, s)
+	e.id, e.pod = "e", ""
+	assert.ErrorIs(t, e.reconcile(ctx, log.NewNopLogger()), errConcurrentWriter)
+	c.SetTime(c.Now().Add(ownerTimeoutDuration() + time.Second))
+	require.NoError(t, e.reconcile(ctx, log.NewNopLogger()))
+}
+
+func TestValidateOwnerTimeout(t *testing.T) {
+	oldTimeout, oldSteady, oldSink, oldOnce := *ownerTimeout, *steadyUpdateTime, *sinkName, *once
+	t.Cleanup(func() { *ownerTimeout, *steadyUpdateTime, *sinkName, *once = oldTimeout, oldSteady, oldSink, oldOnce })
+
+	// The default timeout is derived from the intervals, so it accepts any of them.
+	assert.NoError(t, validateOwnerTimeout())
+	*steadyUpdateTime = 5 * time.Minute
+	assert.NoError(t, validateOwnerTimeout())
+	assert.Equal(t, 30*time.Minute, ownerTimeoutDuration())
+
+	*ownerTimeout = 15 * time.Minute
+	assert.Error(t, validateOwnerTimeout())
+	*ownerTimeout = 21 * time.Minute
+	assert.NoError(t, validateOwnerTimeout())
+	assert.Equal(t, 21*time.Minute, ownerTimeoutDuration())
+
+	// Without the owner annotation, the timeout does not matter.
+	*ownerTimeout = time.Minute
+	assert.Error(t, validateOwnerTimeout())
+	*sinkName = sinkStdout
+	assert.NoError(t, validateOwnerTimeout())
+	*sinkName, *once = sinkKubernetes, true
+	assert.NoError(t, validateOwnerTimeout())
+
+	*ownerTimeout = -time.Minute
+	assert.Error(t, validateOwnerTimeout())
+}
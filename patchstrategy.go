@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	patchStrategyApply     = "apply"
+	patchStrategyStrategic = "strategic"
+	patchStrategyJSON      = "json"
+)
+
+var patchStrategy = flag.String("patch-strategy", patchStrategyApply, fmt.Sprintf("how the labels and annotations are written to the node: %s uses server-side apply, %s a strategic merge patch, %s a JSON patch with test operations on the replaced and removed labels and annotations, so changes of other controllers since the node was read cause a conflict that is retried with the latest node instead of being overwritten", patchStrategyApply, patchStrategyStrategic, patchStrategyJSON))
+
+// errNodeModified is returned if a test operation of a JSON patch failed, because the node was modified since it was read.
+var errNodeModified = stderrors.New("the labels or annotations of the node were modified concurrently")
+
+// validatePatchStrategy returns an error if the patch strategy is unknown.
+func validatePatchStrategy() error {
+	switch *patchStrategy {
+	case patchStrategyApply, patchStrategyStrategic, patchStrategyJSON:
+		return nil
+	}
+	return fmt.Errorf("patch strategy %q unknown; possible values are: %s, %s, %s", *patchStrategy, patchStrategyApply, patchStrategyStrategic, patchStrategyJSON)
+}
+
+// writeNode writes the labels and annotations to the node with patch-strategy.
+// Labels with the prefix that are not in nl are removed, and annotations with a nil value are deleted.
+func writeNode(ctx context.Context, clientset kubernetes.Interface, node *v1.Node, nl labels, na map[string]*string, logger log.Logger) (*v1.Node, error) {
+	switch *patchStrategy {
+	case patchStrategyStrategic:
+		patch, err := labelPatch(node.Labels, nl, na)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create patch: %w", err)
+		}
+		return clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	case patchStrategyJSON:
+		patch, err := jsonNodePatch(node.Labels, node.Annotations, nl, na)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create patch: %w", err)
+		}
+		nn, err := clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+		// The api server rejects a patch with a failed test as invalid, so it is only recognized by the message.
+		if err != nil && strings.Contains(err.Error(), "test failed") {
+			return nil, fmt.Errorf("%w: %w", errNodeModified, err)
+		}
+		return nn, err
+	default:
+		return applyNode(ctx, clientset, node, nl, na, logger)
+	}
+}
+
+// jsonPatchOperation is an operation of a JSON patch (RFC 6902).
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// jsonNodePatch creates a JSON patch that sets the new labels, removes the current labels with the prefix that are not in the new labels,
+// and sets or deletes the annotations.
+// Every replaced or removed value is tested first, added values can not be tested.
+func jsonNodePatch(currentLabels, currentAnnotations map[string]string, nl labels, na map[string]*string) ([]byte, error) {
+	ul := make(map[string]*string, len(nl))
+	for k := range filter(currentLabels) {
+		ul[k] = nil
+	}
+	for k, v := range nl {
+		ul[k] = &v
+	}
+	ops := jsonPatchOperations("/metadata/labels", currentLabels, ul)
+	ops = append(ops, jsonPatchOperations("/metadata/annotations", currentAnnotations, na)...)
+	if ops == nil {
+		ops = []jsonPatchOperation{}
+	}
+	return json.Marshal(ops)
+}
+
+// jsonPatchOperations returns the operations that change the map at the path from current to the new values, a nil value removes the key.
+func jsonPatchOperations(path string, current map[string]string, m map[string]*string) []jsonPatchOperation {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var ops []jsonPatchOperation
+	for _, k := range keys {
+		v := m[k]
+		p := path + "/" + escapeJSONPointer(k)
+		cv, ok := current[k]
+		switch {
+		case v == nil && ok:
+			ops = append(ops, jsonPatchOperation{Op: "test", Path: p, Value: cv}, jsonPatchOperation{Op: "remove", Path: p})
+		case v == nil:
+		case !ok:
+			ops = append(ops, jsonPatchOperation{Op: "add", Path: p, Value: *v})
+		case cv != *v:
+			ops = append(ops, jsonPatchOperation{Op: "test", Path: p, Value: cv}, jsonPatchOperation{Op: "replace", Path: p, Value: *v})
+		}
+	}
+	// Keys can only be added to an existing map.
+	if current == nil && len(ops) > 0 {
+		ops = append([]jsonPatchOperation{{Op: "add", Path: path, Value: map[string]string{}}}, ops...)
+	}
+	return ops
+}
+
+// escapeJSONPointer escapes a key for a JSON pointer (RFC 6901), e.g. nudl.squat.ai~1Arduino for nudl.squat.ai/Arduino.
+func escapeJSONPointer(k string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(k, "~", "~0"), "/", "~1")
+}
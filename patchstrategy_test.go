@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestJSONNodePatch(t *testing.T) {
+	v := "x"
+	patch, err := jsonNodePatch(
+		map[string]string{"nudl.squat.ai/old": "true", "nudl.squat.ai/count": "1", "other": "y"},
+		nil,
+		labels{"nudl.squat.ai/count": "2", "nudl.squat.ai/new": "true"},
+		map[string]*string{"nudl.squat.ai/devices": &v},
+	)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"op": "test", "path": "/metadata/labels/nudl.squat.ai~1count", "value": "1"},
+		{"op": "replace", "path": "/metadata/labels/nudl.squat.ai~1count", "value": "2"},
+		{"op": "add", "path": "/metadata/labels/nudl.squat.ai~1new", "value": "true"},
+		{"op": "test", "path": "/metadata/labels/nudl.squat.ai~1old", "value": "true"},
+		{"op": "remove", "path": "/metadata/labels/nudl.squat.ai~1old"},
+		{"op": "add", "path": "/metadata/annotations", "value": {}},
+		{"op": "add", "path": "/metadata/annotations/nudl.squat.ai~1devices", "value": "x"}
+	]`, string(patch))
+}
+
+func TestWriteNodeJSONPatch(t *testing.T) {
+	old := *patchStrategy
+	*patchStrategy = patchStrategyJSON
+	t.Cleanup(func() { *patchStrategy = old })
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"nudl.squat.ai/Arduino": "1"}}}
+	clientset := fake.NewSimpleClientset(node.DeepCopy())
+	ctx := context.Background()
+	nn, err := writeNode(ctx, clientset, node, labels{"nudl.squat.ai/Arduino": "2"}, nil, log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"nudl.squat.ai/Arduino": "2"}, nn.Labels)
+
+	// The node was modified since it was read, so the label is not overwritten.
+	_, err = writeNode(ctx, clientset, node, labels{"nudl.squat.ai/Arduino": "3"}, nil, log.NewNopLogger())
+	require.ErrorIs(t, err, errNodeModified)
+	assert.Equal(t, retryReasonConflict, retryReason(err))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "2", n.Labels["nudl.squat.ai/Arduino"])
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// pciPrefix is the prefix of the ids and keys of pci devices, so they can not be confused with usb devices.
+const pciPrefix = "pci-"
+
+var (
+	scanPCI = flag.Bool("scan-pci", false, "additionally label the node with the pci devices, e.g. GPUs, NICs and capture cards, read from sysfs at --sysfs-root")
+	pciIDs  = flag.String("pci-ids", "", "path to the pci.ids file to translate pci vendor and device codes into human readable names, by default well-known locations are searched")
+)
+
+// pciIDsPaths are searched for the pci.ids file, if pci-ids is not set.
+var pciIDsPaths = []string{"/usr/share/misc/pci.ids", "/usr/share/hwdata/pci.ids", "/usr/share/pci.ids"}
+
+// pciVendor holds the name and the device names of a pci vendor.
+type pciVendor struct {
+	name    string
+	devices map[uint16]string
+}
+
+// pciNames maps pci vendor ids to vendors.
+type pciNames map[uint16]pciVendor
+
+// describe returns a description of a pci device in the format of usbid, e.g. "I210 Gigabit Network Connection (Intel Corporation)",
+// so descriptions of pci and usb devices can be filtered and sanitized the same way.
+func (n pciNames) describe(vendor, device uint16) string {
+	v, ok := n[vendor]
+	if !ok {
+		return "Unknown (Unknown)"
+	}
+	d, ok := v.devices[device]
+	if !ok {
+		return fmt.Sprintf("Unknown (%s)", v.name)
+	}
+	return fmt.Sprintf("%s (%s)", d, v.name)
+}
+
+// loadPCINames reads the pci.ids file at path, or from the well-known locations if path is empty.
+// If path is empty and no file is found, no names are returned, so all devices are unknown.
+func loadPCINames(path string) (pciNames, error) {
+	if path == "" {
+		for _, p := range pciIDsPaths {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return pciNames{}, nil
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open pci.ids: %w", err)
+	}
+	defer f.Close()
+	n, err := parsePCINames(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %q: %w", path, err)
+	}
+	return n, nil
+}
+
+// parsePCINames parses the vendors and devices of a pci.ids file.
+// Subsystems and the device classes at the end of the file are ignored.
+func parsePCINames(r io.Reader) (pciNames, error) {
+	n := make(pciNames)
+	var vendor uint16
+	var inVendor bool
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The device classes follow the vendors.
+		if strings.HasPrefix(line, "C ") {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "\t\t"):
+			// Subsystem.
+		case strings.HasPrefix(line, "\t"):
+			if !inVendor {
+				continue
+			}
+			id, name, err := parsePCIIDLine(line[1:])
+			if err != nil {
+				return nil, err
+			}
+			n[vendor].devices[id] = name
+		default:
+			id, name, err := parsePCIIDLine(line)
+			if err != nil {
+				return nil, err
+			}
+			vendor, inVendor = id, true
+			n[vendor] = pciVendor{name: name, devices: make(map[uint16]string)}
+		}
+	}
+	return n, s.Err()
+}
+
+// parsePCIIDLine parses a line with a hex id and a name separated by two spaces, e.g. "8086  Intel Corporation".
+func parsePCIIDLine(line string) (uint16, string, error) {
+	id, name, ok := strings.Cut(line, "  ")
+	if !ok {
+		return 0, "", fmt.Errorf("invalid line %q", line)
+	}
+	v, err := strconv.ParseUint(id, 16, 16)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid id in line %q: %w", line, err)
+	}
+	return uint16(v), strings.TrimSpace(name), nil
+}
+
+// pciKey generates a key without prefix for a pci device like sanitizeKey for usb devices.
+func pciKey(vendor, device uint16, desc string) string {
+	hexKey := fmt.Sprintf("%s%04x_%04x", pciPrefix, vendor, device)
+	if !*humanReadable && !*dualLabels {
+		return hexKey
+	}
+	return humanKey(pciPrefix, desc, hexKey)
+}
+
+// pciScanner scans pci devices by reading sysfs.
+type pciScanner struct {
+	root  string
+	names pciNames
+}
+
+func newPCIScanner(root, ids string) (*pciScanner, error) {
+	names, err := loadPCINames(ids)
+	if err != nil {
+		return nil, err
+	}
+	return &pciScanner{root: root, names: names}, nil
+}
+
+func (*pciScanner) Name() string {
+	return "pci"
+}
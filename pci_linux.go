@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Scan returns the pci devices, e.g. 0000:01:00.0, including bridges.
+func (s *pciScanner) Scan(_ context.Context) ([]device, error) {
+	dir := filepath.Join(s.root, "bus", "pci", "devices")
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list pci devices: %w", err)
+	}
+	var ds []device
+	for _, e := range es {
+		vid, did, class, err := readPCIDesc(filepath.Join(dir, e.Name()))
+		if os.IsNotExist(err) {
+			// The device was removed while scanning.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		desc := s.names.describe(vid, did)
+		d := device{
+			ID:          fmt.Sprintf("%s%04x_%04x", pciPrefix, vid, did),
+			Key:         pciKey(vid, did, desc),
+			Description: desc,
+			Port:        e.Name(),
+			Class:       fmt.Sprintf("%06x", class),
+		}
+		if *driverLabels {
+			// The driver is bound to the pci device itself, not to its interfaces.
+			link, err := os.Readlink(filepath.Join(dir, e.Name(), "driver"))
+			if err == nil {
+				d.Drivers = []string{filepath.Base(link)}
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("could not read driver of %q: %w", e.Name(), err)
+			}
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// readPCIDesc reads the vendor and device ids and the class of a pci device from its sysfs directory.
+func readPCIDesc(dir string) (uint16, uint16, uint32, error) {
+	var vs [3]uint64
+	for i, f := range []string{"vendor", "device", "class"} {
+		data, err := os.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		bits := 16
+		if i == 2 {
+			bits = 24
+		}
+		v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, bits)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("could not parse %q: %w", filepath.Join(dir, f), err)
+		}
+		vs[i] = v
+	}
+	return uint16(vs[0]), uint16(vs[1]), uint32(vs[2]), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPCIScanner(t *testing.T) {
+	root := t.TempDir()
+	for name, files := range map[string]map[string]string{
+		"0000:00:00.0": {"vendor": "0x8086\n", "device": "0x1533\n", "class": "0x020000\n"},
+		"0000:01:00.0": {"vendor": "0x10de\n", "device": "0x2204\n", "class": "0x030000\n"},
+	} {
+		dir := filepath.Join(root, "bus", "pci", "devices", name)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		for f, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, f), []byte(content), 0o644))
+		}
+	}
+	require.NoError(t, os.Symlink(filepath.Join("..", "..", "bus", "pci", "drivers", "igb"), filepath.Join(root, "bus", "pci", "devices", "0000:00:00.0", "driver")))
+	*driverLabels = true
+	defer func() { *driverLabels = false }()
+
+	names, err := parsePCINames(strings.NewReader(testPCIIDs))
+	require.NoError(t, err)
+	ds, err := (&pciScanner{root: root, names: names}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []device{
+		{ID: "pci-8086_1533", Key: "pci-Intel-Corporation_I210-Gigabit-Network-Connection", Description: "I210 Gigabit Network Connection (Intel Corporation)", Port: "0000:00:00.0", Class: "020000", Drivers: []string{"igb"}},
+		{ID: "pci-10de_2204", Key: "pci-NVIDIA-Corporation_GA102--GeForce-RTX-3090-", Description: "GA102 [GeForce RTX 3090] (NVIDIA Corporation)", Port: "0000:01:00.0", Class: "030000"},
+	}, ds)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPCIIDs = `# List of PCI ID's
+10de  NVIDIA Corporation
+	2204  GA102 [GeForce RTX 3090]
+		10de 1454  GeForce RTX 3090 Founders Edition
+8086  Intel Corporation
+	1533  I210 Gigabit Network Connection
+
+C 00  Unclassified device [0000]
+	00  Non-VGA unclassified device
+`
+
+func TestPCINames(t *testing.T) {
+	n, err := parsePCINames(strings.NewReader(testPCIIDs))
+	require.NoError(t, err)
+	assert.Equal(t, "GA102 [GeForce RTX 3090] (NVIDIA Corporation)", n.describe(0x10de, 0x2204))
+	assert.Equal(t, "I210 Gigabit Network Connection (Intel Corporation)", n.describe(0x8086, 0x1533))
+	assert.Equal(t, "Unknown (Intel Corporation)", n.describe(0x8086, 0x0001))
+	assert.Equal(t, "Unknown (Unknown)", n.describe(0x1234, 0x0001))
+
+	_, err = parsePCINames(strings.NewReader("zzzz  Broken\n"))
+	assert.Error(t, err)
+}
+
+func TestPCIKey(t *testing.T) {
+	assert.Equal(t, "pci-NVIDIA-Corporation_GA102--GeForce-RTX-3090-", pciKey(0x10de, 0x2204, "GA102 [GeForce RTX 3090] (NVIDIA Corporation)"))
+
+	*humanReadable = false
+	defer func() { *humanReadable = true }()
+	assert.Equal(t, "pci-10de_2204", pciKey(0x10de, 0x2204, "GA102 [GeForce RTX 3090] (NVIDIA Corporation)"))
+}
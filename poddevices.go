@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// podDevice is an entry of the pod devices annotation.
+type podDevice struct {
+	// Rule is the name of the rule that propagates the device.
+	Rule string `json:"rule"`
+	// Label is the label key of the device with the prefix.
+	Label  string `json:"label"`
+	ID     string `json:"id"`
+	Port   string `json:"port,omitempty"`
+	Serial string `json:"serial,omitempty"`
+	// DevicePath is the device node of usb devices, e.g. /dev/bus/usb/001/004, if the bus and device numbers are known.
+	DevicePath string `json:"devicePath,omitempty"`
+}
+
+// podDevicesAnnotationKey returns the key of the annotation that holds the devices of the rules with propagate.
+func podDevicesAnnotationKey() string {
+	return sprintLabelKey("pod-devices")
+}
+
+// usbDevicePath returns the device node of a usb device, or an empty string if it is not known.
+func usbDevicePath(d device) string {
+	bus := usbBusNumber(d.Port)
+	if !isUSB(d) || bus == 0 || d.Address == 0 {
+		return ""
+	}
+	return fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, d.Address)
+}
+
+// podDevices returns the devices that are not filtered and whose rule propagates them, sorted by rule and port.
+func podDevices(ds []device) []podDevice {
+	pds := make([]podDevice, 0)
+	for _, d := range ds {
+		if filtered(d) || d.Rule == nil || !d.Rule.Propagate {
+			continue
+		}
+		pds = append(pds, podDevice{
+			Rule:       d.Rule.Name,
+			Label:      sprintLabelKey(d.Key),
+			ID:         d.ID,
+			Port:       d.Port,
+			Serial:     d.Serial,
+			DevicePath: usbDevicePath(d),
+		})
+	}
+	sort.SliceStable(pds, func(i, j int) bool {
+		if pds[i].Rule != pds[j].Rule {
+			return pds[i].Rule < pds[j].Rule
+		}
+		return pds[i].Port < pds[j].Port
+	})
+	return pds
+}
+
+// hasPropagatedRules returns true if a rule of the rules file propagates its devices.
+// The rules file is validated on start.
+func hasPropagatedRules() bool {
+	if *rulesFile == "" {
+		return false
+	}
+	rs, err := loadRules(*rulesFile)
+	if err != nil {
+		return false
+	}
+	for _, r := range rs.Rules {
+		if r.Propagate {
+			return true
+		}
+	}
+	return false
+}
+
+// podDevicesAnnotations returns the annotations to patch.
+// The annotation is deleted if no rule propagates its devices or the node is cleaned up.
+func podDevicesAnnotations(current map[string]string, ds []device, clean bool) (map[string]*string, error) {
+	k := podDevicesAnnotationKey()
+	_, exists := current[k]
+	if !hasPropagatedRules() || clean {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	data, err := json.Marshal(podDevices(ds))
+	if err != nil {
+		return nil, err
+	}
+	v := string(data)
+	if current[k] == v {
+		return nil, nil
+	}
+	return map[string]*string{k: &v}, nil
+}
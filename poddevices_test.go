@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodDevicesAnnotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+- name: coral
+  match: {vendor: 1a6e}
+  label: {key: coral}
+  propagate: true
+`), 0o644))
+	k := podDevicesAnnotationKey()
+	// Without rules, a previous annotation is deleted.
+	a, err := podDevicesAnnotations(map[string]string{k: "[]"}, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{k: nil}, a)
+
+	*rulesFile = path
+	t.Cleanup(func() { *rulesFile = "" })
+	require.NoError(t, validateRules())
+	ds, err := applyRules([]device{
+		{ID: "1a6e_089a", Key: "Global-Unichip_coral", Port: "2-1", Address: 4, Serial: "a"},
+		{ID: "1a6e_089a", Key: "Global-Unichip_coral", Port: "1-3"},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Port: "1-2", Address: 3},
+	})
+	require.NoError(t, err)
+	a, err = podDevicesAnnotations(nil, ds, false)
+	require.NoError(t, err)
+	require.Contains(t, a, k)
+	assert.JSONEq(t, `[
+		{"rule":"coral","label":"nudl.squat.ai/coral","id":"1a6e_089a","port":"1-3"},
+		{"rule":"coral","label":"nudl.squat.ai/coral","id":"1a6e_089a","port":"2-1","serial":"a","devicePath":"/dev/bus/usb/002/004"}
+	]`, *a[k])
+	// An unchanged annotation is not patched.
+	a, err = podDevicesAnnotations(map[string]string{k: *a[k]}, ds, false)
+	require.NoError(t, err)
+	assert.Empty(t, a)
+	a, err = podDevicesAnnotations(map[string]string{k: "[]"}, ds, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{k: nil}, a)
+
+	// A device that moves to another port changes the fingerprint.
+	moved := append([]device{}, ds...)
+	moved[0].Port = "2-2"
+	assert.NotEqual(t, fingerprint(ds), fingerprint(moved))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+var (
+	podResourcesSocket = flag.String("pod-resources-socket", "/var/lib/kubelet/pod-resources/kubelet.sock", "path of the socket of the kubelet PodResources API")
+	deviceResources    = flag.StringToString("device-resources", map[string]string{}, "map of device keys to the resource names of the device plugins that allocate them, e.g. 2341_0043=squat.ai/serial; the devices are labeled with their total and free count")
+)
+
+// newPodResourcesClient connects to the kubelet PodResources API.
+func newPodResourcesClient(socket string) (podresourcesv1.PodResourcesListerClient, *grpc.ClientConn, error) {
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not connect to the PodResources API: %w", err)
+	}
+	return podresourcesv1.NewPodResourcesListerClient(conn), conn, nil
+}
+
+// allocationLabels returns labels <key>.total and <key>.free for every device in device-resources.
+// The total is the number of discovered devices with the key,
+// the free count subtracts the devices of the resource that the kubelet allocated to containers.
+func allocationLabels(ctx context.Context, client podresourcesv1.PodResourcesListerClient, ds []device) (labels, error) {
+	res, err := client.List(ctx, &podresourcesv1.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list pod resources: %w", err)
+	}
+	allocated := make(map[string]int)
+	for _, p := range res.GetPodResources() {
+		for _, c := range p.GetContainers() {
+			for _, d := range c.GetDevices() {
+				allocated[d.GetResourceName()] += len(d.GetDeviceIds())
+			}
+		}
+	}
+	total := make(map[string]int)
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		total[d.Key]++
+	}
+	l := make(labels, 2*len(*deviceResources))
+	for key, resource := range *deviceResources {
+		free := total[key] - allocated[resource]
+		if free < 0 {
+			free = 0
+		}
+		l[sprintLabelKey(suffixKey(key, ".total"))] = strconv.Itoa(total[key])
+		l[sprintLabelKey(suffixKey(key, ".free"))] = strconv.Itoa(free)
+	}
+	return l, nil
+}
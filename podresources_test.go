@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// fakePodResources returns the pod resources of its List response.
+type fakePodResources struct {
+	podresourcesv1.PodResourcesListerClient
+	pods []*podresourcesv1.PodResources
+}
+
+func (f fakePodResources) List(_ context.Context, _ *podresourcesv1.ListPodResourcesRequest, _ ...grpc.CallOption) (*podresourcesv1.ListPodResourcesResponse, error) {
+	return &podresourcesv1.ListPodResourcesResponse{PodResources: f.pods}, nil
+}
+
+func TestAllocationLabels(t *testing.T) {
+	old := *deviceResources
+	*deviceResources = map[string]string{"Uno": "squat.ai/serial", "CP2102": "squat.ai/uart", "Missing": "squat.ai/missing"}
+	t.Cleanup(func() { *deviceResources = old })
+
+	client := fakePodResources{pods: []*podresourcesv1.PodResources{{
+		Name: "flasher",
+		Containers: []*podresourcesv1.ContainerResources{{
+			Name:    "flash",
+			Devices: []*podresourcesv1.ContainerDevices{{ResourceName: "squat.ai/serial", DeviceIds: []string{"1-2"}}},
+		}},
+	}}}
+	ds := []device{{ID: "2341_0043", Key: "Uno"}, {ID: "2341_0043", Key: "Uno"}, {ID: "10c4_ea60", Key: "CP2102"}}
+	l, err := allocationLabels(context.Background(), client, ds)
+	require.NoError(t, err)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Uno.total":     "2",
+		"nudl.squat.ai/Uno.free":      "1",
+		"nudl.squat.ai/CP2102.total":  "1",
+		"nudl.squat.ai/CP2102.free":   "1",
+		"nudl.squat.ai/Missing.total": "0",
+		"nudl.squat.ai/Missing.free":  "0",
+	}, l)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	portLabels = flag.Bool("port-labels", false, "label every device with its bus and port path, e.g. <key>.port=1-1.4, so the labels can be correlated with the device paths of device plugins and the device can be located physically")
+	onlyPorts  = flag.StringSlice("only-port", []string{}, "port paths of the usb devices that are labeled, e.g. 1-1.4, or patterns, e.g. 1-1.*; usb devices on other ports are not labeled")
+)
+
+// validateOnlyPorts returns an error if a pattern of only-port is invalid.
+func validateOnlyPorts() error {
+	for _, p := range *onlyPorts {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid --only-port pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// filteredByPort returns true if only-port is set and the usb device is not on one of its ports.
+// Devices of the other scanners are not filtered.
+func filteredByPort(d device) bool {
+	if len(*onlyPorts) == 0 || !isUSB(d) {
+		return false
+	}
+	for _, p := range *onlyPorts {
+		// The patterns are validated on start.
+		if ok, _ := path.Match(p, d.Port); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// addPortLabels adds a label <key>.port with the port paths of every device that is labeled and has a known port, e.g. 1-1.4.
+// The sorted port paths of identical devices are joined with an underscore, which is allowed in label values unlike a comma,
+// and truncated to 63 characters.
+func addPortLabels(l labels, ds []device) {
+	ports := make(map[string][]string)
+	for _, d := range ds {
+		if d.Port == "" {
+			continue
+		}
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		ports[d.Key] = append(ports[d.Key], d.Port)
+	}
+	for k, ps := range ports {
+		sort.Strings(ps)
+		v := strings.Join(ps, "_")
+		if len(v) > maxLabelValueLength {
+			v = strings.TrimRight(v[:maxLabelValueLength], "-_.")
+		}
+		l[sprintLabelKey(suffixKey(k, ".port"))] = v
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortLabels(t *testing.T) {
+	*portLabels = true
+	defer func() { *portLabels = false }()
+	ds := []device{
+		{ID: "2341_0043", Key: "Uno", Port: "1-2"},
+		{ID: "2341_0043", Key: "Uno", Port: "1-1.4"},
+		{ID: "10c4_ea60", Key: "CP2102", Port: "3-1"},
+		{ID: "dev-video0", Key: "dev-video0"},
+	}
+	l := createLabels(ds)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Uno":         "true",
+		"nudl.squat.ai/Uno.port":    "1-1.4_1-2",
+		"nudl.squat.ai/CP2102":      "true",
+		"nudl.squat.ai/CP2102.port": "3-1",
+		"nudl.squat.ai/dev-video0":  "true",
+	}, l)
+
+	assert.NotEqual(t, fingerprint(ds), fingerprint([]device{ds[1], ds[0], {ID: "10c4_ea60", Key: "CP2102", Port: "3-2"}, ds[3]}))
+}
+
+func TestOnlyPort(t *testing.T) {
+	*onlyPorts = []string{"1-1.4", "3-*"}
+	defer func() { *onlyPorts = []string{} }()
+	assert.NoError(t, validateOnlyPorts())
+	ds := []device{
+		{ID: "2341_0043", Key: "Uno", Port: "1-2"},
+		{ID: "2341_0043", Key: "Uno", Port: "1-1.4"},
+		{ID: "10c4_ea60", Key: "CP2102", Port: "3-1"},
+		{ID: "046d_c52b", Key: "Receiver"},
+		{ID: "dev-video0", Key: "dev-video0"},
+	}
+	// Devices of other scanners are not filtered by port.
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Uno":        "true",
+		"nudl.squat.ai/CP2102":     "true",
+		"nudl.squat.ai/dev-video0": "true",
+	}, createLabels(ds))
+
+	*onlyPorts = []string{"1-["}
+	assert.Error(t, validateOnlyPorts())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+// labelValueState sets the value of the device labels to true, suspended or error by the power states of the devices.
+const labelValueState = "state"
+
+const (
+	powerStateActive    = "active"
+	powerStateSuspended = "suspended"
+	powerStateError     = "error"
+)
+
+var powerStateLabels = flag.Bool("power-state-labels", false, "add a label <key>.power-state with the runtime power state of the devices of every label from sysfs power/runtime_status at --sysfs-root: active, suspended for usb autosuspend, or error")
+
+// needsPowerState returns true if the scanners read the power states of the devices.
+func needsPowerState() bool {
+	return *powerStateLabels || *labelValue == labelValueState
+}
+
+// powerState returns the power state of a runtime_status of sysfs.
+// Devices that are resuming or do not support runtime power management are active,
+// devices that are suspending are suspended.
+func powerState(runtimeStatus string) string {
+	switch runtimeStatus {
+	case "suspended", "suspending":
+		return powerStateSuspended
+	case "error":
+		return powerStateError
+	}
+	return powerStateActive
+}
+
+// bestPowerState returns the state of the most usable device, so a label is only suspended or error if no device is active.
+// Devices with an unknown state are active.
+func bestPowerState(ds []device) string {
+	best := ""
+	for _, d := range ds {
+		switch s := d.PowerState; {
+		case s == "" || s == powerStateActive:
+			return powerStateActive
+		case s == powerStateSuspended || best == "":
+			best = s
+		}
+	}
+	return best
+}
+
+// stateValue returns true if a device of the label is active, suspended or error otherwise, or false if no device is attached.
+func stateValue(ds []device) string {
+	switch s := bestPowerState(ds); s {
+	case "":
+		return "false"
+	case powerStateActive:
+		return "true"
+	default:
+		return s
+	}
+}
+
+// addPowerStateLabels adds a label <key>.power-state with the best power state of the devices of every label that is labeled.
+func addPowerStateLabels(l labels, ds []device) {
+	groups := make(map[string][]device)
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		groups[d.Key] = append(groups[d.Key], d)
+	}
+	for k, g := range groups {
+		l[sprintLabelKey(suffixKey(k, ".power-state"))] = bestPowerState(g)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowerState(t *testing.T) {
+	for in, exp := range map[string]string{
+		"active":      powerStateActive,
+		"resuming":    powerStateActive,
+		"unsupported": powerStateActive,
+		"suspending":  powerStateSuspended,
+		"suspended":   powerStateSuspended,
+		"error":       powerStateError,
+	} {
+		assert.Equal(t, exp, powerState(in), in)
+	}
+}
+
+func TestPowerStateLabels(t *testing.T) {
+	oldValue, oldLabels := *labelValue, *powerStateLabels
+	*labelValue, *powerStateLabels = labelValueState, true
+	t.Cleanup(func() { *labelValue, *powerStateLabels = oldValue, oldLabels })
+
+	ds := []device{
+		{ID: "046d_c52b", Key: "Logitech_Receiver", PowerState: powerStateSuspended},
+		{ID: "0781_5581", Key: "SanDisk_Ultra", PowerState: powerStateError},
+		{ID: "0781_5581", Key: "SanDisk_Ultra", PowerState: powerStateSuspended},
+		// A single active device makes the label usable.
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x", PowerState: powerStateError},
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x", PowerState: powerStateActive},
+		// Devices of scanners without power states are active.
+		{ID: "pci-8086_1533", Key: "pci-Intel_I210"},
+	}
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Logitech_Receiver":               "suspended",
+		"nudl.squat.ai/Logitech_Receiver.power-state":   "suspended",
+		"nudl.squat.ai/SanDisk_Ultra":                   "suspended",
+		"nudl.squat.ai/SanDisk_Ultra.power-state":       "suspended",
+		"nudl.squat.ai/Silicon-Labs_CP210x":             "true",
+		"nudl.squat.ai/Silicon-Labs_CP210x.power-state": "active",
+		"nudl.squat.ai/pci-Intel_I210":                  "true",
+		"nudl.squat.ai/pci-Intel_I210.power-state":      "active",
+	}, createLabels(ds))
+	assert.Equal(t, "error", stateValue(ds[1:2]))
+	assert.Equal(t, "false", stateValue(nil))
+	assert.NotEqual(t, fingerprint(ds[:1]), fingerprint([]device{{ID: "046d_c52b", Key: "Logitech_Receiver", PowerState: powerStateActive}}))
+}
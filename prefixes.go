@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var extraLabelPrefixes = flag.StringArray("extra-label-prefix", []string{}, "additional prefix for labels with its own options, in the format <prefix>[,human-readable=<bool>][,label-value=bool|count][,no-contain=<string>|...][,only=<key>|...], e.g. internal.example.com,human-readable=false,label-value=count; can be repeated")
+
+// labelPrefixSpec is an additional label prefix with its own options.
+type labelPrefixSpec struct {
+	prefix        string
+	humanReadable bool
+	labelValue    string
+	noContain     []string
+	only          []string
+}
+
+// parseLabelPrefixSpec parses an extra-label-prefix.
+// Options that are not set default to the global flags.
+func parseLabelPrefixSpec(s string) (labelPrefixSpec, error) {
+	parts := strings.Split(s, ",")
+	spec := labelPrefixSpec{
+		prefix:        strings.TrimSpace(parts[0]),
+		humanReadable: *humanReadable,
+		labelValue:    labelValueBool,
+	}
+	if errs := validation.IsDNS1123Subdomain(spec.prefix); len(errs) > 0 {
+		return spec, fmt.Errorf("invalid prefix %q: %s", spec.prefix, strings.Join(errs, "; "))
+	}
+	if spec.prefix == *labelPrefix {
+		return spec, fmt.Errorf("prefix %q is already the label-prefix", spec.prefix)
+	}
+	for _, o := range parts[1:] {
+		k, v, ok := strings.Cut(o, "=")
+		if !ok {
+			return spec, fmt.Errorf("invalid option %q of prefix %q, the format is <option>=<value>", o, spec.prefix)
+		}
+		switch strings.TrimSpace(k) {
+		case "human-readable":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return spec, fmt.Errorf("invalid human-readable of prefix %q: %w", spec.prefix, err)
+			}
+			// The scanners only generate human readable keys, if human-readable or dual-labels is set.
+			if b && !*humanReadable && !*dualLabels {
+				return spec, fmt.Errorf("human-readable of prefix %q requires --human-readable or --dual-labels", spec.prefix)
+			}
+			spec.humanReadable = b
+		case "label-value":
+			if v != labelValueBool && v != labelValueCount {
+				return spec, fmt.Errorf("label value %q of prefix %q unknown; possible values are: %s, %s", v, spec.prefix, labelValueBool, labelValueCount)
+			}
+			spec.labelValue = v
+		case "no-contain":
+			spec.noContain = strings.Split(v, "|")
+		case "only":
+			spec.only = strings.Split(v, "|")
+		default:
+			return spec, fmt.Errorf("unknown option %q of prefix %q; possible options are: human-readable, label-value, no-contain, only", k, spec.prefix)
+		}
+	}
+	return spec, nil
+}
+
+// labelPrefixSpecs returns the parsed extra-label-prefix flags.
+func labelPrefixSpecs() ([]labelPrefixSpec, error) {
+	specs := make([]labelPrefixSpec, 0, len(*extraLabelPrefixes))
+	seen := make(map[string]bool, len(*extraLabelPrefixes))
+	for _, s := range *extraLabelPrefixes {
+		spec, err := parseLabelPrefixSpec(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --extra-label-prefix: %w", err)
+		}
+		if seen[spec.prefix] {
+			return nil, fmt.Errorf("invalid --extra-label-prefix: prefix %q is defined twice", spec.prefix)
+		}
+		seen[spec.prefix] = true
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// managedPrefix returns true if the key of a label or annotation has the label prefix, one of the extra label prefixes
+// or the prefix that is migrated from, so its labels are removed after the migration.
+func managedPrefix(k string) bool {
+	if strings.HasPrefix(k, *labelPrefix) {
+		return true
+	}
+	if *migrateFromPrefix != "" && strings.HasPrefix(k, *migrateFromPrefix+"/") {
+		return true
+	}
+	for _, s := range *extraLabelPrefixes {
+		p, _, _ := strings.Cut(s, ",")
+		if strings.HasPrefix(k, strings.TrimSpace(p)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// filtered returns true if the device is not supposed to be used for the labels of the prefix.
+// The class filters apply to all prefixes.
+func (s labelPrefixSpec) filtered(d device) bool {
+	for _, str := range s.noContain {
+		if strings.Contains(strings.ToLower(d.Description), strings.ToLower(str)) {
+			return true
+		}
+	}
+	return filteredByClass(d)
+}
+
+// labels returns the labels of the devices with the prefix and its options.
+func (s labelPrefixSpec) labels(ds []device) labels {
+	counts := make(map[string]int, len(ds))
+	for _, d := range ds {
+		if s.filtered(d) {
+			continue
+		}
+		k := d.Key
+		if !s.humanReadable {
+			k = d.ID
+		}
+		counts[k]++
+	}
+	value := func(n int) string {
+		if s.labelValue == labelValueCount {
+			return strconv.Itoa(n)
+		}
+		return strconv.FormatBool(n > 0)
+	}
+	l := make(labels, len(counts))
+	if len(s.only) > 0 {
+		for _, k := range s.only {
+			l[s.prefix+"/"+k] = value(counts[k])
+		}
+		return l
+	}
+	for k, n := range counts {
+		l[s.prefix+"/"+k] = value(n)
+	}
+	return l
+}
+
+// addExtraPrefixLabels adds the labels of the extra label prefixes.
+func addExtraPrefixLabels(l labels, ds []device) {
+	// The flags are validated on start.
+	specs, _ := labelPrefixSpecs()
+	for _, s := range specs {
+		for k, v := range s.labels(ds) {
+			l[k] = v
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabelPrefixSpec(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		want labelPrefixSpec
+		err  bool
+	}{
+		{spec: "devic.es", want: labelPrefixSpec{prefix: "devic.es", humanReadable: true, labelValue: labelValueBool}},
+		{
+			spec: "internal.example.com,human-readable=false,label-value=count,no-contain=hub|bridge,only=2341_0043",
+			want: labelPrefixSpec{prefix: "internal.example.com", labelValue: labelValueCount, noContain: []string{"hub", "bridge"}, only: []string{"2341_0043"}},
+		},
+		{spec: "nudl.squat.ai", err: true},
+		{spec: "Invalid_Prefix", err: true},
+		{spec: "devic.es,label-value=serial", err: true},
+		{spec: "devic.es,human-readable", err: true},
+		{spec: "devic.es,class=03", err: true},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			spec, err := parseLabelPrefixSpec(tc.spec)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, spec)
+		})
+	}
+}
+
+func TestExtraLabelPrefixes(t *testing.T) {
+	*extraLabelPrefixes = []string{"devic.es,no-contain=hub", "internal.example.com,human-readable=false,label-value=count"}
+	defer func() { *extraLabelPrefixes = []string{} }()
+	ds := []device{
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)"},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)"},
+		{ID: "1d6b_0002", Key: "Linux-Foundation_2-0-root-hub", Description: "2.0 root hub (Linux Foundation)"},
+	}
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Arduino-SA_Uno-R3":             "true",
+		"nudl.squat.ai/Linux-Foundation_2-0-root-hub": "true",
+		"devic.es/Arduino-SA_Uno-R3":                  "true",
+		"internal.example.com/2341_0043":              "2",
+		"internal.example.com/1d6b_0002":              "1",
+	}, createLabels(ds))
+
+	// The labels of all prefixes are managed, so they are removed when they are stale.
+	assert.Equal(t, labels{"devic.es/old": "true", "nudl.squat.ai/old": "true"}, filter(map[string]string{
+		"devic.es/old":          "true",
+		"nudl.squat.ai/old":     "true",
+		"other.example.com/old": "true",
+	}))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var devicePresentGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "nudl_usb_device_present",
+		Help: "Number of attached usb devices of a model, 0 if all devices of a model that was seen before were detached",
+	},
+	[]string{"vendor_id", "product_id", "vendor", "product"},
+)
+
+// presenceTracker sets the presence gauge of the usb device models.
+// Models that were seen before are kept at 0, so alerts can fire when a device disappears.
+// A presenceTracker must not be used concurrently.
+type presenceTracker struct {
+	seen map[[4]string]struct{}
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{seen: make(map[[4]string]struct{})}
+}
+
+// update sets the gauge for the usb devices that are not filtered.
+func (p *presenceTracker) update(ds []device) {
+	counts := make(map[[4]string]int, len(ds))
+	for _, d := range ds {
+		if filtered(d) || !isUSB(d) {
+			continue
+		}
+		var ls [4]string
+		ls[0], ls[1], _ = vendorProduct(d)
+		if regParse.MatchString(d.Description) {
+			ls[2] = regParse.ReplaceAllString(d.Description, "$2")
+			ls[3] = regParse.ReplaceAllString(d.Description, "$1")
+		}
+		counts[ls]++
+		p.seen[ls] = struct{}{}
+	}
+	for ls := range p.seen {
+		devicePresentGauge.WithLabelValues(ls[:]...).Set(float64(counts[ls]))
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresenceTracker(t *testing.T) {
+	present := func(ls ...string) float64 {
+		var m dto.Metric
+		require.NoError(t, devicePresentGauge.WithLabelValues(ls...).Write(&m))
+		return m.GetGauge().GetValue()
+	}
+	arduino := device{ID: "2341_0043", Description: "Uno R3 (Arduino SA)"}
+	dongle := device{ID: "096e_0006", Description: "HASP (Feitian Technologies, Inc.)"}
+	p := newPresenceTracker()
+
+	p.update([]device{arduino, arduino, dongle, {ID: "pci-10de_2204"}})
+	assert.Equal(t, 2.0, present("2341", "0043", "Arduino SA", "Uno R3"))
+	assert.Equal(t, 1.0, present("096e", "0006", "Feitian Technologies, Inc.", "HASP"))
+	assert.Len(t, p.seen, 2)
+
+	p.update([]device{arduino})
+	assert.Equal(t, 1.0, present("2341", "0043", "Arduino SA", "Uno R3"))
+	assert.Equal(t, 0.0, present("096e", "0006", "Feitian Technologies, Inc.", "HASP"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	flag "github.com/spf13/pflag"
+)
+
+var preserveLabels = flag.StringSlice("preserve-labels", nil, "keys of labels with the label prefix that nudl never changes or deletes, e.g. labels that were added by hand; an entry is a key or a regular expression that matches the whole key, e.g. 'nudl.squat.ai/pinned-.*'")
+
+// preserveExps returns the compiled entries of preserve-labels.
+func preserveExps() ([]*regexp.Regexp, error) {
+	exps := make([]*regexp.Regexp, 0, len(*preserveLabels))
+	for _, p := range *preserveLabels {
+		e, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid preserve-labels entry %q: %w", p, err)
+		}
+		exps = append(exps, e)
+	}
+	return exps, nil
+}
+
+// preserved returns true if the label key is in preserve-labels.
+func preserved(k string) bool {
+	// The entries are validated on start.
+	exps, _ := preserveExps()
+	for i, e := range exps {
+		if k == (*preserveLabels)[i] || e.MatchString(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPreserved removes the preserved labels, so the values on the node are kept.
+func withoutPreserved(l labels) labels {
+	for k := range l {
+		if preserved(k) {
+			delete(l, k)
+		}
+	}
+	return l
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPreserveLabels(t *testing.T) {
+	*preserveLabels = []string{"nudl.squat.ai/rack", "nudl.squat.ai/pinned-.*"}
+	defer func() { *preserveLabels = nil }()
+	current := map[string]string{
+		"nudl.squat.ai/rack":          "a1",
+		"nudl.squat.ai/pinned-camera": "true",
+		"nudl.squat.ai/Uno":           "true",
+		"other":                       "x",
+	}
+
+	assert.Equal(t, labels{"nudl.squat.ai/Uno": "true"}, filter(current))
+
+	// Preserved labels are neither deleted nor overwritten.
+	nl := withoutPreserved(labels{"nudl.squat.ai/CP2102": "true", "nudl.squat.ai/rack": "false"})
+	assert.Equal(t, labels{"nudl.squat.ai/CP2102": "true"}, nl)
+	patch, err := labelPatch(current, nl, nil)
+	require.NoError(t, err)
+	var p struct {
+		Metadata struct {
+			Labels map[string]*string `json:"labels"`
+		} `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal(patch, &p))
+	v := "true"
+	assert.Equal(t, map[string]*string{"nudl.squat.ai/Uno": nil, "nudl.squat.ai/CP2102": &v}, p.Metadata.Labels)
+
+	assert.False(t, metadataChanged(&v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: current}}, labels{"nudl.squat.ai/Uno": "true"}, nil))
+
+	*preserveLabels = []string{"nudl.squat.ai/("}
+	_, err = preserveExps()
+	assert.Error(t, err)
+}
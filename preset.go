@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var presets = flag.StringSlice("preset", []string{}, "list of built-in filters that exclude devices which are rarely worth a label, in addition to no-contain and no-class: "+presetNames())
+
+// preset is a curated filter of devices.
+type preset struct {
+	description string
+	// ids are patterns of <vendor id>_<product id> like the patterns of only, e.g. 1d6b_*.
+	ids []string
+	// classes are usb classes like the classes of no-class.
+	classes []string
+	// contains are case-insensitive strings of descriptions like no-contain.
+	contains []string
+}
+
+// builtinPresets are the presets by name.
+var builtinPresets = map[string]preset{
+	"ignore-internal": {
+		description: "root hubs, internal webcams, fingerprint readers and bluetooth controllers of laptops and NUC-class nodes",
+		ids: []string{
+			// Root hubs of the Linux Foundation.
+			"1d6b_*",
+			// Bluetooth controllers and rate matching hubs of Intel.
+			"8087_*",
+			// Fingerprint readers of Synaptics, Goodix, Validity and Elan.
+			"06cb_*", "27c6_*", "138a_*", "04f3_0c*",
+		},
+		// Bluetooth controllers are wireless controllers with the subclass RF controller.
+		classes:  []string{"e0:01"},
+		contains: []string{"integrated camera", "integrated webcam", "integrated_webcam", "integrated rgb camera", "integrated ir camera", "fingerprint"},
+	},
+	"ignore-hubs": {
+		description: "usb hubs",
+		ids:         []string{"1d6b_*"},
+		classes:     []string{"hub"},
+	},
+}
+
+// presetNames returns the names and descriptions of the presets for the usage.
+func presetNames() string {
+	names := make([]string, 0, len(builtinPresets))
+	for n, p := range builtinPresets {
+		names = append(names, fmt.Sprintf("%s excludes %s", n, p.description))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// validatePresets returns an error if a preset is unknown.
+func validatePresets() error {
+	for _, n := range *presets {
+		if _, ok := builtinPresets[n]; !ok {
+			keys := make([]string, 0, len(builtinPresets))
+			for k := range builtinPresets {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return fmt.Errorf("preset %q unknown; possible values are: %s", n, strings.Join(keys, ", "))
+		}
+	}
+	return nil
+}
+
+// filteredByPreset returns true if a preset excludes the usb device.
+func filteredByPreset(d device) bool {
+	if len(*presets) == 0 || !isUSB(d) {
+		return false
+	}
+	for _, n := range *presets {
+		p := builtinPresets[n]
+		for _, id := range p.ids {
+			if ok, _ := path.Match(id, d.ID); ok {
+				return true
+			}
+		}
+		// The classes of the presets are valid.
+		if cs, _ := parseClassSpecs(p.classes); matchesClass(d, cs) {
+			return true
+		}
+		for _, s := range p.contains {
+			if strings.Contains(strings.ToLower(d.Description), s) {
+				return true
+			}
+		}
+	}
+	return false
+}
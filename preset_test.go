@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresets(t *testing.T) {
+	old := *presets
+	t.Cleanup(func() { *presets = old })
+
+	ds := []device{
+		{ID: "1d6b_0002", Key: "Linux-Foundation_2.0-root-hub", Description: "2.0 root hub (Linux Foundation)", Classes: []string{"09:00"}},
+		{ID: "8087_0026", Key: "Intel-Corp._AX201-Bluetooth", Description: "AX201 Bluetooth (Intel Corp.)", Classes: []string{"e0:01"}},
+		{ID: "0bda_5634", Key: "Realtek_Integrated-Camera", Description: "Integrated Camera (Realtek Semiconductor Corp.)", Classes: []string{"0e:01", "0e:02"}},
+		{ID: "27c6_5395", Key: "Goodix_Fingerprint", Description: "Fingerprint Reader (Goodix Technology Co., Ltd.)", Classes: []string{"ff:00"}},
+		{ID: "0a12_0001", Key: "CSR_Bluetooth-Dongle", Description: "Bluetooth Dongle (HCI mode) (Cambridge Silicon Radio, Ltd)", Classes: []string{"e0:01"}},
+		{ID: "05e3_0610", Key: "Genesys-Logic_Hub", Description: "Hub (Genesys Logic, Inc.)", Classes: []string{"09:00"}},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)", Classes: []string{"02:02", "0a:00"}},
+		{ID: "046d_0825", Key: "Logitech_Webcam-C270", Description: "Webcam C270 (Logitech, Inc.)", Classes: []string{"0e:01", "0e:02"}},
+	}
+	kept := func() []string {
+		var keys []string
+		for _, d := range ds {
+			if !filtered(d) {
+				keys = append(keys, d.Key)
+			}
+		}
+		return keys
+	}
+
+	assert.Len(t, kept(), len(ds))
+	*presets = []string{"ignore-internal"}
+	assert.Equal(t, []string{"Genesys-Logic_Hub", "Arduino-SA_Uno-R3", "Logitech_Webcam-C270"}, kept())
+	*presets = []string{"ignore-internal", "ignore-hubs"}
+	assert.Equal(t, []string{"Arduino-SA_Uno-R3", "Logitech_Webcam-C270"}, kept())
+
+	assert.NoError(t, validatePresets())
+	*presets = []string{"ignore-everything"}
+	assert.Error(t, validatePresets())
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
+)
+
+const (
+	conditionDeviceMissing = "USBDeviceMissing"
+	conditionScanFailing   = "USBScanFailing"
+	// problemSource is the source component of the events, like the Node Problem Detector uses its monitor names.
+	problemSource = "nudl"
+)
+
+var (
+	nodeConditions  = flag.Bool("node-conditions", false, "set node conditions and create events like the Node Problem Detector, when required devices are missing or scanners fail repeatedly")
+	requiredDevices = flag.StringSlice("required-devices", []string{}, "keys or ids of the devices that are required on the node, * is a wildcard, a missing device sets the "+conditionDeviceMissing+" condition")
+)
+
+// problem is the state of a node condition.
+type problem struct {
+	Type    string
+	Status  bool
+	Reason  string
+	Message string
+}
+
+// problemDetector reports node conditions and events for missing devices and failing scanners.
+// It must not be used concurrently.
+type problemDetector struct {
+	// reported holds the last reported problem of every condition type.
+	reported map[string]problem
+	// transitions holds the time of the last status change of every condition type.
+	transitions map[string]time.Time
+	synced      time.Time
+	clock       clock.PassiveClock
+	// events is true if an event is created for every changed condition.
+	events bool
+}
+
+func newProblemDetector(c clock.PassiveClock) *problemDetector {
+	return &problemDetector{reported: make(map[string]problem), transitions: make(map[string]time.Time), clock: c, events: true}
+}
+
+// check updates the node conditions if a problem changed or after resync-period to refresh the heartbeat.
+func (pd *problemDetector) check(ctx context.Context, clientset kubernetes.Interface, ds []device, scanErr error, scanners []*scanRunner, logger log.Logger) {
+	if !*nodeConditions {
+		return
+	}
+	pd.report(ctx, clientset, detectProblems(ds, scanErr, scanners), logger)
+}
+
+// report updates the node conditions of the problems if a problem changed or after resync-period to refresh the heartbeat.
+// Errors are logged, but not returned, because reporting must not interfere with labeling.
+func (pd *problemDetector) report(ctx context.Context, clientset kubernetes.Interface, ps []problem, logger log.Logger) {
+	now := pd.clock.Now()
+	var changed []problem
+	for _, p := range ps {
+		if r, ok := pd.reported[p.Type]; !ok || r != p {
+			changed = append(changed, p)
+		}
+		if r, ok := pd.reported[p.Type]; !ok || r.Status != p.Status {
+			pd.transitions[p.Type] = now
+		}
+		pd.reported[p.Type] = p
+	}
+	if len(changed) == 0 && now.Sub(pd.synced) < *resyncPeriod {
+		return
+	}
+	node, err := getNode(ctx, clientset)
+	if err != nil {
+		level.Error(logger).Log("msg", "could not update node conditions", "err", err)
+		return
+	}
+	patch, err := pd.conditionPatch(now)
+	if err != nil {
+		level.Error(logger).Log("msg", "could not create node condition patch", "err", err)
+		return
+	}
+	if _, err := clientset.CoreV1().Nodes().PatchStatus(ctx, node.Name, patch); err != nil {
+		level.Error(logger).Log("msg", "could not update node conditions", "err", err)
+		return
+	}
+	pd.synced = now
+	if !pd.events {
+		return
+	}
+	for _, p := range changed {
+		if err := createProblemEvent(ctx, clientset, node, p, now); err != nil {
+			level.Error(logger).Log("msg", "could not create event", "condition", p.Type, "err", err)
+		}
+	}
+}
+
+// conditionPatch creates a strategic merge patch for the reported conditions.
+// Conditions are merged by their type, so conditions of other components are not touched.
+func (pd *problemDetector) conditionPatch(now time.Time) ([]byte, error) {
+	types := make([]string, 0, len(pd.reported))
+	for t := range pd.reported {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	cs := make([]v1.NodeCondition, 0, len(types))
+	for _, t := range types {
+		p := pd.reported[t]
+		status := v1.ConditionFalse
+		if p.Status {
+			status = v1.ConditionTrue
+		}
+		cs = append(cs, v1.NodeCondition{
+			Type:               v1.NodeConditionType(p.Type),
+			Status:             status,
+			LastHeartbeatTime:  metav1.NewTime(now),
+			LastTransitionTime: metav1.NewTime(pd.transitions[t]),
+			Reason:             p.Reason,
+			Message:            p.Message,
+		})
+	}
+	return json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": cs,
+		},
+	})
+}
+
+// createProblemEvent creates an event for the node.
+// Problems create warnings, resolved problems normal events.
+func createProblemEvent(ctx context.Context, clientset kubernetes.Interface, node *v1.Node, p problem, now time.Time) error {
+	t := v1.EventTypeNormal
+	if p.Status {
+		t = v1.EventTypeWarning
+	}
+	_, err := clientset.CoreV1().Events(metav1.NamespaceDefault).Create(ctx, &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s.", node.Name),
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind: "Node",
+			Name: node.Name,
+			UID:  node.UID,
+		},
+		Reason:         p.Reason,
+		Message:        p.Message,
+		Type:           t,
+		Source:         v1.EventSource{Component: problemSource, Host: node.Name},
+		FirstTimestamp: metav1.NewTime(now),
+		LastTimestamp:  metav1.NewTime(now),
+		Count:          1,
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// missingDevices returns the required devices that are missing.
+// They are matched like only, by key, by id or with wildcards.
+func missingDevices(ds []device) []string {
+	return missingMatching(ds, *requiredDevices)
+}
+
+// detectProblems returns the problems that can be evaluated with the scan result.
+// If the scan failed, missing devices are not evaluated.
+func detectProblems(ds []device, scanErr error, scanners []*scanRunner) []problem {
+	var ps []problem
+
+	var failing []string
+	for _, r := range scanners {
+		if r.failures > 0 && r.failures >= *scanFailureThreshold {
+			failing = append(failing, fmt.Sprintf("%s failed %d times", r.Name(), r.failures))
+		}
+	}
+	if len(failing) > 0 {
+		ps = append(ps, problem{Type: conditionScanFailing, Status: true, Reason: "ScanFailing", Message: fmt.Sprintf("scanners failed repeatedly: %s", strings.Join(failing, ", "))})
+	} else {
+		ps = append(ps, problem{Type: conditionScanFailing, Reason: "ScanSucceeding", Message: "all scanners succeeded"})
+	}
+
+	if scanErr != nil || len(*requiredDevices) == 0 {
+		return ps
+	}
+	if missing := missingDevices(ds); len(missing) > 0 {
+		ps = append(ps, problem{Type: conditionDeviceMissing, Status: true, Reason: "RequiredDeviceMissing", Message: fmt.Sprintf("required devices are missing: %s", strings.Join(missing, ", "))})
+	} else {
+		ps = append(ps, problem{Type: conditionDeviceMissing, Reason: "RequiredDevicesPresent", Message: "all required devices are present"})
+	}
+	return ps
+}
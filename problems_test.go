@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectProblems(t *testing.T) {
+	*requiredDevices = []string{"a", "b", "10c4_*"}
+	defer func() { *requiredDevices = []string{} }()
+	healthy := &scanRunner{scanner: fakeScanner{name: "healthy"}}
+	failing := &scanRunner{scanner: fakeScanner{name: "failing"}, failures: *scanFailureThreshold}
+
+	for _, tc := range []struct {
+		name     string
+		ds       []device
+		scanErr  error
+		scanners []*scanRunner
+		want     map[string]bool
+	}{
+		{
+			name:     "healthy",
+			ds:       []device{{Key: "a"}, {Key: "b"}, {Key: "c", ID: "10c4_ea60"}},
+			scanners: []*scanRunner{healthy},
+			want:     map[string]bool{conditionScanFailing: false, conditionDeviceMissing: false},
+		},
+		{
+			name:     "missing device",
+			ds:       []device{{Key: "a"}},
+			scanners: []*scanRunner{healthy},
+			want:     map[string]bool{conditionScanFailing: false, conditionDeviceMissing: true},
+		},
+		{
+			name:     "required by id",
+			ds:       []device{{Key: "a", ID: "10c4_ea60"}, {Key: "b"}},
+			scanners: []*scanRunner{healthy},
+			want:     map[string]bool{conditionScanFailing: false, conditionDeviceMissing: false},
+		},
+		{
+			name:     "scan failed",
+			scanErr:  errors.New("failed"),
+			scanners: []*scanRunner{healthy, failing},
+			want:     map[string]bool{conditionScanFailing: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := make(map[string]bool)
+			for _, p := range detectProblems(tc.ds, tc.scanErr, tc.scanners) {
+				got[p.Type] = p.Status
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMissingDevices(t *testing.T) {
+	old := *requiredDevices
+	t.Cleanup(func() { *requiredDevices = old })
+	*requiredDevices = []string{"10c4_ea60", "Arduino-SA_Uno-R3", "2341_*", "1050_0407"}
+
+	ds := []device{
+		{Key: "Silicon-Labs_CP210x-UART-Bridge", ID: "10c4_ea60"},
+		{Key: "Arduino-SA_Uno-R3", ID: "2341_0043"},
+	}
+	assert.Equal(t, []string{"1050_0407"}, missingDevices(ds))
+}
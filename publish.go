@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/clock"
+)
+
+const (
+	eventAttached = "attached"
+	eventDetached = "detached"
+	// fieldManager is the field manager of the custom resources that are applied by publishers.
+	fieldManager = "nudl"
+)
+
+var publishTimeout = flag.Duration("publish-timeout", 5*time.Second, "timeout for publishing the inventory or events to a publisher")
+
+var publishErrorCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "nudl_publish_errors_total",
+		Help: "Number of failed attempts to publish the inventory or events",
+	},
+	[]string{"publisher"},
+)
+
+// inventory holds all devices attached to a node.
+type inventory struct {
+	Node    string    `json:"node"`
+	Time    time.Time `json:"time"`
+	Devices []device  `json:"devices"`
+}
+
+// event is created when a device is attached to or detached from a node.
+type event struct {
+	Node string    `json:"node"`
+	Time time.Time `json:"time"`
+	// Type is either attached or detached.
+	Type   string `json:"type"`
+	Device device `json:"device"`
+}
+
+// publisher publishes the inventory and events to an external system.
+type publisher interface {
+	// Name returns the name of the publisher used in logs and metrics.
+	Name() string
+	PublishInventory(ctx context.Context, inv inventory) error
+	PublishEvents(ctx context.Context, es []event) error
+	Close() error
+}
+
+// newPublishers returns the publishers that are configured by flags.
+func newPublishers(config *rest.Config, logger log.Logger) ([]publisher, error) {
+	var ps []publisher
+	if *mqttBroker != "" {
+		p, err := newMQTTPublisher(logger)
+		if err != nil {
+			return nil, fmt.Errorf("could not create mqtt publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *natsURL != "" {
+		p, err := newNATSPublisher(logger)
+		if err != nil {
+			return nil, fmt.Errorf("could not create nats publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *webhookURL != "" {
+		p, err := newWebhookPublisher(logger)
+		if err != nil {
+			return nil, fmt.Errorf("could not create webhook publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *alertURL != "" {
+		p, err := newAlertPublisher()
+		if err != nil {
+			return nil, fmt.Errorf("could not create alert publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if len(*kafkaBrokers) > 0 {
+		p, err := newKafkaPublisher()
+		if err != nil {
+			return nil, fmt.Errorf("could not create kafka publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *cloudEventsURL != "" {
+		p, err := newCloudEventsPublisher()
+		if err != nil {
+			return nil, fmt.Errorf("could not create cloudevents publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *grpcAddress != "" {
+		p, err := newGRPCPublisher(logger)
+		if err != nil {
+			return nil, fmt.Errorf("could not create grpc publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *nfdNodeFeature {
+		p, err := newNFDPublisher(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not create nfd publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *akriConfiguration != "" {
+		p, err := newAkriPublisher(config, logger)
+		if err != nil {
+			return nil, fmt.Errorf("could not create akri publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *usbInventory {
+		p, err := newUSBInventoryPublisher(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not create usb inventory publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *nodeEvents {
+		p, err := newNodeEventPublisher(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not create node event publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	if *gdpFile != "" || *gdpConfigMap != "" {
+		p, err := newGDPPublisher(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not create generic-device-plugin publisher: %w", err)
+		}
+		ps = append(ps, p)
+	}
+	for _, p := range ps {
+		publishErrorCounter.WithLabelValues(p.Name())
+	}
+	return ps, nil
+}
+
+// dispatcher publishes the inventory when the devices change or after resync-period,
+// and events for the devices that were attached or detached since the previous scan.
+// Every publisher has its own queue, so publishing never delays the labeling.
+// A dispatcher must not be used concurrently.
+type dispatcher struct {
+	publishers []publisher
+	clock      clock.PassiveClock
+	// queues are started by the first dispatch.
+	queues []*publishQueue
+	// previous are the devices of the previous scan, if hasPrevious is true.
+	previous    []device
+	hasPrevious bool
+	// published is the time when the inventory was queued by all publishers.
+	published time.Time
+}
+
+func newDispatcher(c clock.PassiveClock, publishers ...publisher) *dispatcher {
+	return &dispatcher{publishers: publishers, clock: c}
+}
+
+// dispatch queues the scanned devices for publishing and returns without waiting for the publishers.
+// Errors are logged and counted by the queues, because publishing must not interfere with labeling.
+// An inventory that could not be published is published again by the next dispatch.
+func (d *dispatcher) dispatch(ds []device, logger log.Logger) {
+	if len(d.publishers) == 0 {
+		return
+	}
+	if d.queues == nil {
+		for _, p := range d.publishers {
+			d.queues = append(d.queues, newPublishQueue(p, logger))
+		}
+	}
+	now := d.clock.Now()
+	var es []event
+	if d.hasPrevious {
+		es = diffDevices(d.previous, ds, *hostname, now)
+	}
+	d.previous, d.hasPrevious = ds, true
+
+	publishInventory := len(es) > 0 || d.published.IsZero() || now.Sub(d.published) >= *resyncPeriod
+	for _, q := range d.queues {
+		if q.failed.Swap(false) {
+			publishInventory = true
+		}
+	}
+	ok := true
+	for _, q := range d.queues {
+		if len(es) > 0 {
+			q.enqueue(publishJob{events: es})
+		}
+		if publishInventory && !q.enqueue(publishJob{inventory: &inventory{Node: *hostname, Time: now, Devices: ds}}) {
+			ok = false
+		}
+	}
+	if publishInventory && ok {
+		d.published = now
+	}
+}
+
+// withTimeout calls f with a context that is cancelled after the timeout.
+func withTimeout(ctx context.Context, timeout time.Duration, f func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return f(ctx)
+}
+
+// close publishes the queued inventories and events within publish-timeout and closes all publishers.
+func (d *dispatcher) close(logger log.Logger) {
+	closeQueues(d.queues, *publishTimeout)
+	d.queues = nil
+	for _, p := range d.publishers {
+		if err := p.Close(); err != nil {
+			level.Error(logger).Log("msg", "could not close publisher", "publisher", p.Name(), "err", err)
+		}
+	}
+}
+
+// diffDevices returns the events for the devices that were attached or detached.
+// Devices are compared by their ids, so identical devices are counted.
+func diffDevices(previous, current []device, node string, t time.Time) []event {
+	count := make(map[string]int, len(current))
+	for _, d := range current {
+		count[d.ID]++
+	}
+	for _, d := range previous {
+		count[d.ID]--
+	}
+	var es []event
+	for _, d := range current {
+		if count[d.ID] > 0 {
+			count[d.ID]--
+			es = append(es, event{Node: node, Time: t, Type: eventAttached, Device: d})
+		}
+	}
+	for _, d := range previous {
+		if count[d.ID] < 0 {
+			count[d.ID]++
+			es = append(es, event{Node: node, Time: t, Type: eventDetached, Device: d})
+		}
+	}
+	return es
+}
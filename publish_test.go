@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffDevices(t *testing.T) {
+	a := device{ID: "a_a"}
+	b := device{ID: "b_b"}
+	c := device{ID: "c_c"}
+	now := time.Now()
+	for _, tc := range []struct {
+		name     string
+		previous []device
+		current  []device
+		want     []event
+	}{
+		{
+			name:     "unchanged",
+			previous: []device{a, b},
+			current:  []device{b, a},
+		},
+		{
+			name:     "attached and detached",
+			previous: []device{a, b},
+			current:  []device{a, c},
+			want: []event{
+				{Node: "n", Time: now, Type: eventAttached, Device: c},
+				{Node: "n", Time: now, Type: eventDetached, Device: b},
+			},
+		},
+		{
+			name:     "identical devices",
+			previous: []device{a},
+			current:  []device{a, a},
+			want: []event{
+				{Node: "n", Time: now, Type: eventAttached, Device: a},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, diffDevices(tc.previous, tc.current, "n", now))
+		})
+	}
+}
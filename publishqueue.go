@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	publishQueueSize    = flag.Int("publish-queue-size", 100, "number of inventories and event batches that are queued per publisher, further messages are dropped while a publisher is slow or unavailable")
+	publishRetries      = flag.Int("publish-retries", 3, "number of retries for publishing an inventory or events before they are dropped")
+	publishRetryBackoff = flag.Duration("publish-retry-backoff", time.Second, "backoff before the first retry of publishing, it is doubled for every retry")
+)
+
+var (
+	publishDroppedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nudl_publish_dropped_total",
+			Help: "Number of inventories and event batches that were dropped, because the queue was full or all retries failed",
+		},
+		[]string{"publisher"},
+	)
+	publishQueueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nudl_publish_queue_length",
+			Help: "Number of inventories and event batches waiting to be published",
+		},
+		[]string{"publisher"},
+	)
+)
+
+func validatePublishQueue() error {
+	if *publishQueueSize < 1 {
+		return fmt.Errorf("publish-queue-size must be positive, got %d", *publishQueueSize)
+	}
+	if *publishRetries < 0 {
+		return fmt.Errorf("publish-retries must not be negative, got %d", *publishRetries)
+	}
+	return nil
+}
+
+// publishJob is either an inventory or a batch of events.
+type publishJob struct {
+	inventory *inventory
+	events    []event
+}
+
+func (j publishJob) publish(ctx context.Context, p publisher) error {
+	if j.inventory != nil {
+		return p.PublishInventory(ctx, *j.inventory)
+	}
+	return p.PublishEvents(ctx, j.events)
+}
+
+// publishQueue publishes jobs to a single publisher in its own go routine,
+// so a slow or unavailable broker does not delay the labeling or the other publishers.
+type publishQueue struct {
+	publisher publisher
+	jobs      chan publishJob
+	logger    log.Logger
+	timeout   time.Duration
+	retries   int
+	backoff   time.Duration
+	// failed is true if an inventory was dropped, so the next dispatch publishes the inventory again.
+	failed atomic.Bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPublishQueue(p publisher, logger log.Logger) *publishQueue {
+	size := *publishQueueSize
+	if size < 1 {
+		size = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &publishQueue{
+		publisher: p,
+		jobs:      make(chan publishJob, size),
+		logger:    log.With(logger, "publisher", p.Name()),
+		timeout:   *publishTimeout,
+		retries:   *publishRetries,
+		backoff:   *publishRetryBackoff,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	publishDroppedCounter.WithLabelValues(p.Name())
+	publishQueueGauge.WithLabelValues(p.Name()).Set(0)
+	go q.run()
+	return q
+}
+
+// enqueue adds the job to the queue without blocking.
+// It returns false if the queue is full and the job was dropped.
+func (q *publishQueue) enqueue(j publishJob) bool {
+	select {
+	case q.jobs <- j:
+		publishQueueGauge.WithLabelValues(q.publisher.Name()).Set(float64(len(q.jobs)))
+		return true
+	default:
+		level.Warn(q.logger).Log("msg", "publish queue is full, dropping message")
+		q.drop(j)
+		return false
+	}
+}
+
+func (q *publishQueue) drop(j publishJob) {
+	publishDroppedCounter.WithLabelValues(q.publisher.Name()).Inc()
+	if j.inventory != nil {
+		q.failed.Store(true)
+	}
+}
+
+func (q *publishQueue) run() {
+	defer close(q.done)
+	for j := range q.jobs {
+		publishQueueGauge.WithLabelValues(q.publisher.Name()).Set(float64(len(q.jobs)))
+		if err := q.publish(j); err != nil {
+			level.Error(q.logger).Log("msg", "could not publish, dropping message", "inventory", j.inventory != nil, "events", len(j.events), "err", err)
+			q.drop(j)
+		}
+	}
+}
+
+// publish publishes the job and retries with an exponential backoff.
+func (q *publishQueue) publish(j publishJob) error {
+	backoff := q.backoff
+	for i := 0; ; i++ {
+		configMu.RLock()
+		err := withTimeout(q.ctx, q.timeout, func(ctx context.Context) error {
+			return j.publish(ctx, q.publisher)
+		})
+		configMu.RUnlock()
+		if err == nil {
+			return nil
+		}
+		publishErrorCounter.WithLabelValues(q.publisher.Name()).Inc()
+		if i >= q.retries || q.ctx.Err() != nil {
+			return err
+		}
+		level.Debug(q.logger).Log("msg", "retrying publishing", "err", err, "backoff", backoff)
+		select {
+		case <-q.ctx.Done():
+			return errors.Join(err, q.ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// close publishes the queued jobs within the timeout, the remaining jobs are dropped.
+func (q *publishQueue) close(timeout time.Duration) {
+	close(q.jobs)
+	select {
+	case <-q.done:
+	case <-time.After(timeout):
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+}
+
+// closeQueues closes all queues concurrently.
+func closeQueues(qs []*publishQueue, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, q := range qs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.close(timeout)
+		}()
+	}
+	wg.Wait()
+}
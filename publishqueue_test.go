@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+// fakePublisher records the published inventories and fails while fail returns an error.
+type fakePublisher struct {
+	name        string
+	block       chan struct{}
+	mu          sync.Mutex
+	fail        int
+	inventories []inventory
+	events      []event
+}
+
+func (p *fakePublisher) Name() string {
+	return p.name
+}
+
+func (p *fakePublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	if p.block != nil {
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail > 0 {
+		p.fail--
+		return errors.New("broker unavailable")
+	}
+	p.inventories = append(p.inventories, inv)
+	return nil
+}
+
+func (p *fakePublisher) PublishEvents(_ context.Context, es []event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, es...)
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
+
+func (p *fakePublisher) published() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.inventories)
+}
+
+func TestDispatchDoesNotWait(t *testing.T) {
+	old := *publishRetryBackoff
+	*publishRetryBackoff = time.Millisecond
+	t.Cleanup(func() { *publishRetryBackoff = old })
+
+	slow := &fakePublisher{name: "slow", block: make(chan struct{})}
+	flaky := &fakePublisher{name: "flaky", fail: 2}
+	d := newDispatcher(testclock.NewFakePassiveClock(time.Now()), slow, flaky)
+
+	done := make(chan struct{})
+	go func() {
+		d.dispatch([]device{{ID: "a_b"}}, log.NewNopLogger())
+		d.dispatch([]device{{ID: "a_b"}, {ID: "c_d"}}, log.NewNopLogger())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch waited for the publishers")
+	}
+
+	// The flaky publisher succeeds after retries, without waiting for the slow one.
+	require.Eventually(t, func() bool { return flaky.published() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, slow.published())
+
+	close(slow.block)
+	d.close(log.NewNopLogger())
+	assert.Equal(t, 2, slow.published())
+	assert.Len(t, flaky.events, 1)
+}
+
+func TestPublishQueueFull(t *testing.T) {
+	old := *publishQueueSize
+	*publishQueueSize = 1
+	t.Cleanup(func() { *publishQueueSize = old })
+
+	var m dto.Metric
+	require.NoError(t, publishDroppedCounter.WithLabelValues("full").Write(&m))
+	dropped := m.GetCounter().GetValue()
+	p := &fakePublisher{name: "full", block: make(chan struct{})}
+	q := newPublishQueue(p, log.NewNopLogger())
+	require.True(t, q.enqueue(publishJob{inventory: &inventory{}}))
+	require.Eventually(t, func() bool { return len(q.jobs) == 0 }, time.Second, time.Millisecond)
+	// The first inventory is being published, the second is queued and the third is dropped.
+	require.True(t, q.enqueue(publishJob{inventory: &inventory{}}))
+	require.False(t, q.enqueue(publishJob{inventory: &inventory{}}))
+
+	require.NoError(t, publishDroppedCounter.WithLabelValues("full").Write(&m))
+	assert.Equal(t, dropped+1, m.GetCounter().GetValue())
+	assert.True(t, q.failed.Load())
+
+	close(p.block)
+	q.close(time.Second)
+	assert.Equal(t, 2, p.published())
+}
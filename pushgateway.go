@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	pushgatewayURL = flag.String("pushgateway-url", "", "URL of a Prometheus Pushgateway to push the metrics to after a run in once mode. Metrics are not pushed if empty.")
+	pushgatewayJob = flag.String("pushgateway-job", "nudl", "job name for the metrics pushed to the Pushgateway, the metrics are grouped by the hostname as instance")
+)
+
+var lastSuccessGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "nudl_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run in once mode",
+	},
+)
+
+// pushMetrics pushes the given collectors to the Pushgateway and replaces the metrics of a previous run.
+// The Go and process collectors are not pushed, because they are meaningless after the process exited.
+func pushMetrics(ctx context.Context, logger log.Logger, cs ...prometheus.Collector) error {
+	p := push.New(*pushgatewayURL, *pushgatewayJob).Grouping("instance", *hostname)
+	for _, c := range cs {
+		p = p.Collector(c)
+	}
+	if err := p.PushContext(ctx); err != nil {
+		return fmt.Errorf("could not push metrics to Pushgateway: %w", err)
+	}
+	level.Debug(logger).Log("msg", "pushed metrics to Pushgateway", "url", *pushgatewayURL)
+	return nil
+}
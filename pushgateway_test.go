@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+func TestPushMetrics(t *testing.T) {
+	*hostname = "node"
+	defer func() { *hostname = "" }()
+	oldJob := *pushgatewayJob
+	defer func() { *pushgatewayJob = oldJob }()
+	*pushgatewayJob = "usb"
+
+	var (
+		method, path string
+		names        []string
+		status       = http.StatusOK
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		names = nil
+		br := bufio.NewReader(r.Body)
+		for {
+			mf := &dto.MetricFamily{}
+			if err := protodelim.UnmarshalFrom(br, mf); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Errorf("could not decode pushed metrics: %v", err)
+				break
+			}
+			names = append(names, mf.GetName())
+		}
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+	oldURL := *pushgatewayURL
+	defer func() { *pushgatewayURL = oldURL }()
+	*pushgatewayURL = s.URL
+
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test"})
+	g.Set(1)
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test"})
+	c.Inc()
+
+	require.NoError(t, pushMetrics(context.Background(), log.NewNopLogger(), g, c))
+	// PUT replaces all metrics of the group from a previous run.
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/usb/instance/node", path)
+	sort.Strings(names)
+	// Only the given collectors are pushed, not the Go and process collectors.
+	assert.Equal(t, []string{"test_gauge", "test_total"}, names)
+
+	status = http.StatusInternalServerError
+	err := pushMetrics(context.Background(), log.NewNopLogger(), g)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not push metrics to Pushgateway")
+	assert.Contains(t, err.Error(), "500")
+}
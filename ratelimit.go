@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var (
+	kubeAPIQPS        = flag.Float32("kube-api-qps", 5, "maximum number of requests per second to the Kubernetes api")
+	kubeAPIBurst      = flag.Int("kube-api-burst", 10, "maximum burst of requests to the Kubernetes api")
+	kubeAPIWriteQPS   = flag.Float32("kube-api-write-qps", 1, "maximum number of writes, e.g. patches of the node, per second to the Kubernetes api, in addition to kube-api-qps; 0 disables the limit")
+	kubeAPIWriteBurst = flag.Int("kube-api-write-burst", 5, "maximum burst of writes to the Kubernetes api")
+	startupJitter     = flag.Duration("startup-jitter", 0, "maximum random delay of the first reconciliation, so many nudl instances that start at the same time, e.g. after a cluster reboot, do not update their nodes at once")
+	initialDelay      = flag.Duration("initial-delay", 0, "delay of the first reconciliation before startup-jitter, e.g. to wait for udev to settle after a boot; by default, the node is labeled immediately on start")
+)
+
+// validateRateLimits returns an error if writes are limited without a burst.
+func validateRateLimits() error {
+	if *kubeAPIWriteQPS > 0 && *kubeAPIWriteBurst < 1 {
+		return errors.New("kube-api-write-burst must be at least 1, if kube-api-write-qps is set")
+	}
+	return nil
+}
+
+// configureRateLimits sets the rate limits of all requests of the config and adds a rate limit for writes.
+func configureRateLimits(config *rest.Config) {
+	config.QPS = *kubeAPIQPS
+	config.Burst = *kubeAPIBurst
+	if *kubeAPIWriteQPS > 0 {
+		l := flowcontrol.NewTokenBucketRateLimiter(*kubeAPIWriteQPS, *kubeAPIWriteBurst)
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &writeLimiter{rt: rt, limiter: l}
+		})
+	}
+}
+
+// writeLimiter waits for the rate limiter before requests that write.
+type writeLimiter struct {
+	rt      http.RoundTripper
+	limiter flowcontrol.RateLimiter
+}
+
+func (w *writeLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if err := w.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return w.rt.RoundTrip(req)
+}
+
+// firstReconcileDelay returns the time until the first reconciliation,
+// which is initial-delay and a random delay of up to startup-jitter,
+// so a fresh node is labeled on start instead of after update-time.
+func firstReconcileDelay() time.Duration {
+	if *startupJitter <= 0 {
+		return *initialDelay
+	}
+	return *initialDelay + rand.N(*startupJitter)
+}
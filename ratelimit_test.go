@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWriteLimiter(t *testing.T) {
+	var n int
+	w := &writeLimiter{
+		rt: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			n++
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		limiter: flowcontrol.NewTokenBucketRateLimiter(0.001, 1),
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := func(ctx context.Context, method string) error {
+		req, err := http.NewRequestWithContext(ctx, method, "https://example.com/api/v1/nodes/node1", nil)
+		require.NoError(t, err)
+		_, err = w.RoundTrip(req)
+		return err
+	}
+	// The burst allows the first write.
+	assert.NoError(t, request(context.Background(), http.MethodPatch))
+	// The next write waits for the limiter until the context is done.
+	assert.Error(t, request(cancelled, http.MethodPatch))
+	// Reads are not limited.
+	assert.NoError(t, request(cancelled, http.MethodGet))
+	assert.Equal(t, 2, n)
+}
+
+func TestFirstReconcileDelay(t *testing.T) {
+	oldUpdate, oldJitter, oldDelay := *updateTime, *startupJitter, *initialDelay
+	t.Cleanup(func() { *updateTime, *startupJitter, *initialDelay = oldUpdate, oldJitter, oldDelay })
+	*updateTime = time.Minute
+	// The node is labeled on start, not after update-time.
+	assert.Equal(t, time.Duration(0), firstReconcileDelay())
+	*initialDelay = 10 * time.Second
+	assert.Equal(t, 10*time.Second, firstReconcileDelay())
+	*startupJitter = time.Minute
+	for i := 0; i < 100; i++ {
+		d := firstReconcileDelay()
+		assert.GreaterOrEqual(t, d, 10*time.Second)
+		assert.Less(t, d, 70*time.Second)
+	}
+
+	*kubeAPIWriteBurst = 0
+	t.Cleanup(func() { *kubeAPIWriteBurst = 5 })
+	assert.Error(t, validateRateLimits())
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
+)
+
+// conditionHealthy is the node condition that tells whether nudl scans and labels the node.
+// Unlike the problem conditions, True is the healthy state.
+const conditionHealthy = "NudlHealthy"
+
+var (
+	healthCondition = flag.Bool("health-condition", false, "set the node condition "+conditionHealthy+" to True while nudl scans and labels the node successfully, and to False when the reconciliation fails or nudl stops; its heartbeat is refreshed every resync-period")
+
+	readyGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nudl_ready",
+			Help: "1 if the last reconciliation succeeded and nudl is ready, 0 otherwise",
+		},
+	)
+)
+
+// healthReporter reports the health of the labeler in the nudl_ready gauge and the NudlHealthy node condition.
+type healthReporter struct {
+	conditions *problemDetector
+}
+
+func newHealthReporter(c clock.PassiveClock) *healthReporter {
+	pd := newProblemDetector(c)
+	// The condition is visible in the node status, events would only repeat it.
+	pd.events = false
+	return &healthReporter{conditions: pd}
+}
+
+// healthProblem returns the state of the NudlHealthy condition after a reconciliation with the error,
+// and the readiness of the labeler.
+func healthProblem(err, notReady error) problem {
+	if err = errors.Join(err, notReady); err != nil {
+		return problem{Type: conditionHealthy, Reason: "ReconcileFailing", Message: err.Error()}
+	}
+	return problem{Type: conditionHealthy, Status: true, Reason: "Reconciling", Message: "nudl scans and labels the node"}
+}
+
+// reconciled reports the health after a reconciliation.
+func (hr *healthReporter) reconciled(ctx context.Context, clientset kubernetes.Interface, err, notReady error, logger log.Logger) {
+	p := healthProblem(err, notReady)
+	if p.Status {
+		readyGauge.Set(1)
+	} else {
+		readyGauge.Set(0)
+	}
+	// The condition is set to False by stopped, when the reconciliation is interrupted by the shutdown.
+	if *healthCondition && clientset != nil && ctx.Err() == nil {
+		hr.conditions.report(ctx, clientset, []problem{p}, logger)
+	}
+}
+
+// stopped reports that nudl does not label the node anymore, because it shuts down.
+func (hr *healthReporter) stopped(ctx context.Context, clientset kubernetes.Interface, logger log.Logger) {
+	readyGauge.Set(0)
+	if *healthCondition && clientset != nil {
+		hr.conditions.report(ctx, clientset, []problem{{Type: conditionHealthy, Reason: "NudlStopped", Message: "nudl was stopped"}}, logger)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestHealthCondition(t *testing.T) {
+	oldHostname, oldCondition := *hostname, *healthCondition
+	*hostname, *healthCondition = "node1", true
+	t.Cleanup(func() { *hostname, *healthCondition = oldHostname, oldCondition })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	var scanErr error
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "2341_0043", Key: "Arduino"}}, scanErr
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(metav1.Now().Time), nil, s)
+	ctx := context.Background()
+	condition := func() v1.NodeCondition {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, n.Status.Conditions, 1)
+		return n.Status.Conditions[0]
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, 1.0, testutil.ToFloat64(readyGauge))
+	c := condition()
+	assert.Equal(t, v1.NodeConditionType(conditionHealthy), c.Type)
+	assert.Equal(t, v1.ConditionTrue, c.Status)
+	assert.Equal(t, "Reconciling", c.Reason)
+
+	scanErr = errors.New("LIBUSB_ERROR_IO")
+	require.Error(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, 0.0, testutil.ToFloat64(readyGauge))
+	c = condition()
+	assert.Equal(t, v1.ConditionFalse, c.Status)
+	assert.Equal(t, "ReconcileFailing", c.Reason)
+	assert.Contains(t, c.Message, "LIBUSB_ERROR_IO")
+
+	lb.ready.stopped(ctx, clientset, log.NewNopLogger())
+	c = condition()
+	assert.Equal(t, v1.ConditionFalse, c.Status)
+	assert.Equal(t, "NudlStopped", c.Reason)
+}
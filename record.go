@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+)
+
+var recordFile = flag.String("record-file", "", "append every scan with its time to a JSON lines file, which can be replayed with --replay")
+
+// scanRecord is the result of a scan at a point in time.
+type scanRecord struct {
+	Time    time.Time `json:"time"`
+	Devices []device  `json:"devices"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// recordingScanner writes the results of the wrapped scanner to a file.
+// A scan that timed out can still be running when the next scan starts, so writes are serialized.
+type recordingScanner struct {
+	scanner
+	clock clock.PassiveClock
+	mu    sync.Mutex
+	enc   *json.Encoder
+}
+
+// newRecordingScanner wraps the scanner and appends its results to the file at path.
+// The file is kept open until the process exits.
+func newRecordingScanner(s scanner, path string) (*recordingScanner, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open record file: %w", err)
+	}
+	return &recordingScanner{scanner: s, clock: clock.RealClock{}, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *recordingScanner) Scan(ctx context.Context) ([]device, error) {
+	ds, err := s.scanner.Scan(ctx)
+	r := scanRecord{Time: s.clock.Now(), Devices: ds}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if werr := s.enc.Encode(r); werr != nil {
+		return ds, errors.Join(err, fmt.Errorf("could not record scan: %w", werr))
+	}
+	return ds, err
+}
+
+// replayScanner replays recorded scans with the same time between them as when they were recorded.
+// Every scan returns the last record that is due, starting with the first record.
+type replayScanner struct {
+	records []scanRecord
+	clock   clock.PassiveClock
+	start   time.Time
+}
+
+// newReplayScanner reads the records from a file written by a recordingScanner.
+func newReplayScanner(path string) (*replayScanner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open replay file: %w", err)
+	}
+	defer f.Close()
+	var rs []scanRecord
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var r scanRecord
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("could not parse record %d: %w", len(rs)+1, err)
+		}
+		rs = append(rs, r)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("could not read replay file: %w", err)
+	}
+	if len(rs) == 0 {
+		return nil, errors.New("replay file has no records")
+	}
+	c := clock.RealClock{}
+	return &replayScanner{records: rs, clock: c, start: c.Now()}, nil
+}
+
+func (*replayScanner) Name() string {
+	return "replay"
+}
+
+// Scan returns the devices or the error of the record that is due.
+// After the last record, the last record is returned forever.
+func (s *replayScanner) Scan(_ context.Context) ([]device, error) {
+	elapsed := s.clock.Since(s.start)
+	r := s.records[0]
+	for _, next := range s.records[1:] {
+		if next.Time.Sub(s.records[0].Time) > elapsed {
+			break
+		}
+		r = next
+	}
+	if r.Error != "" {
+		return nil, errors.New(r.Error)
+	}
+	return r.Devices, nil
+}
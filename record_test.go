@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scans.jsonl")
+	results := []struct {
+		ds  []device
+		err error
+	}{
+		{ds: []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}},
+		{err: errors.New("LIBUSB_ERROR_IO")},
+		{ds: []device{}},
+	}
+	i := 0
+	s := fakeScanner{name: "flaky", scan: func(context.Context) ([]device, error) {
+		r := results[i]
+		i++
+		return r.ds, r.err
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	rs, err := newRecordingScanner(s, path)
+	require.NoError(t, err)
+	rs.clock = c
+	assert.Equal(t, "flaky", rs.Name())
+	for range results {
+		rs.Scan(context.Background())
+		c.SetTime(c.Now().Add(10 * time.Second))
+	}
+
+	rp, err := newReplayScanner(path)
+	require.NoError(t, err)
+	c = testclock.NewFakePassiveClock(time.Now())
+	rp.clock, rp.start = c, c.Now()
+	for _, r := range results {
+		ds, err := rp.Scan(context.Background())
+		if r.err != nil {
+			assert.EqualError(t, err, r.err.Error())
+		} else {
+			require.NoError(t, err)
+			assert.Equal(t, r.ds, ds)
+		}
+		c.SetTime(c.Now().Add(10 * time.Second))
+	}
+	// The last record is kept.
+	ds, err := rp.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+)
+
+var enableLifecycle = flag.Bool("enable-lifecycle", false, "serve the endpoints that change how nudl runs, POST /-/reload and GET and PUT /-/loglevel, on listen-address; requires metrics-bearer-token-file or metrics-client-ca-file, so only authenticated clients can use them")
+
+// validateLifecycle returns an error if the lifecycle endpoints are enabled without authentication,
+// because anyone who can reach the pod could use them otherwise.
+func validateLifecycle() error {
+	if *enableLifecycle && *metricsBearerTokenFile == "" && *metricsClientCAFile == "" {
+		return errors.New("enable-lifecycle requires metrics-bearer-token-file or metrics-client-ca-file")
+	}
+	return nil
+}
+
+// handleLifecycle registers a lifecycle endpoint on the metrics server, if enable-lifecycle is set.
+// The requests are authenticated by metricsAuth, which validateLifecycle requires.
+func handleLifecycle(m *http.ServeMux, pattern string, h http.Handler) {
+	if *enableLifecycle {
+		m.Handle(pattern, h)
+	}
+}
+
+// reloader requests an immediate scan and label cycle, in which the config file is reloaded.
+// Requests that arrive while a request is pending are merged.
+type reloader struct {
+	ch    chan struct{}
+	clock clock.PassiveClock
+	mu    sync.Mutex
+	// last is the time of the last request over HTTP.
+	last time.Time
+}
+
+func newReloader(c clock.PassiveClock) *reloader {
+	return &reloader{ch: make(chan struct{}, 1), clock: c}
+}
+
+func (r *reloader) request() {
+	select {
+	case r.ch <- struct{}{}:
+	default:
+	}
+}
+
+// watchSignal requests a reload for every SIGHUP until the context is done.
+func (r *reloader) watchSignal(ctx context.Context, logger log.Logger) error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case s := <-ch:
+			level.Info(logger).Log("msg", "received signal, rescanning", "signal", s)
+			r.request()
+		}
+	}
+}
+
+// allow returns how long a request over HTTP must wait, or 0 if it is allowed.
+// The requests are limited to one per min-patch-interval, because every request scans and labels.
+func (r *reloader) allow() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	if *minPatchInterval > 0 && !r.last.IsZero() {
+		if wait := *minPatchInterval - now.Sub(r.last); wait > 0 {
+			return wait
+		}
+	}
+	r.last = now
+	return 0
+}
+
+// ServeHTTP requests a reload for POST requests, e.g.
+// curl -X POST -H "Authorization: Bearer $TOKEN" http://localhost:8080/-/reload
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if wait := r.allow(); wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many requests, limited by min-patch-interval", http.StatusTooManyRequests)
+		return
+	}
+	r.request()
+	w.WriteHeader(http.StatusAccepted)
+}
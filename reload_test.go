@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestReloader(t *testing.T) {
+	r := newReloader(testclock.NewFakePassiveClock(time.Now()))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Len(t, r.ch, 0)
+
+	// Pending requests are merged.
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+		assert.Equal(t, http.StatusAccepted, w.Code)
+	}
+	assert.Len(t, r.ch, 1)
+	<-r.ch
+	assert.Len(t, r.ch, 0)
+}
+
+func TestReloaderRateLimit(t *testing.T) {
+	oldInterval := *minPatchInterval
+	*minPatchInterval = time.Minute
+	t.Cleanup(func() { *minPatchInterval = oldInterval })
+	c := testclock.NewFakePassiveClock(time.Now())
+	r := newReloader(c)
+
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+		return w
+	}
+	assert.Equal(t, http.StatusAccepted, post().Code)
+	<-r.ch
+	c.SetTime(c.Now().Add(20 * time.Second))
+	w := post()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "40", w.Header().Get("Retry-After"))
+	assert.Len(t, r.ch, 0)
+	// SIGHUP is not limited.
+	r.request()
+	assert.Len(t, r.ch, 1)
+	<-r.ch
+
+	c.SetTime(c.Now().Add(40 * time.Second))
+	assert.Equal(t, http.StatusAccepted, post().Code)
+	assert.Len(t, r.ch, 1)
+}
+
+func TestLifecycle(t *testing.T) {
+	oldEnabled, oldToken, oldCA := *enableLifecycle, *metricsBearerTokenFile, *metricsClientCAFile
+	t.Cleanup(func() { *enableLifecycle, *metricsBearerTokenFile, *metricsClientCAFile = oldEnabled, oldToken, oldCA })
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		r := newReloader(testclock.NewFakePassiveClock(time.Now()))
+		m := http.NewServeMux()
+		handleLifecycle(m, "/-/reload", r)
+		h, err := newMetricsAuth(m)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/-/reload", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// The endpoints are not served by default.
+	assert.NoError(t, validateLifecycle())
+	assert.Equal(t, http.StatusNotFound, serve("").Code)
+
+	// They can not be enabled without authentication.
+	*enableLifecycle = true
+	assert.Error(t, validateLifecycle())
+
+	*metricsBearerTokenFile = filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(*metricsBearerTokenFile, []byte("s3cret\n"), 0o600))
+	assert.NoError(t, validateLifecycle())
+	assert.Equal(t, http.StatusUnauthorized, serve("").Code, "unauthenticated requests are rejected")
+	assert.Equal(t, http.StatusUnauthorized, serve("Bearer secret").Code)
+	assert.Equal(t, http.StatusAccepted, serve("Bearer s3cret").Code)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	retryReasonConflict  = "conflict"
+	retryReasonTransient = "transient"
+)
+
+var (
+	patchRetries      = flag.Int("patch-retries", 4, "number of retries of a failed update of the node, if the error is transient or a conflict")
+	patchRetryBackoff = flag.Duration("patch-retry-backoff", 200*time.Millisecond, "backoff before the first retry of an update of the node, it is doubled for every retry and jittered by 10%")
+
+	nodeUpdateRetryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nudl_node_update_retries_total",
+			Help: "Number of retried updates of the node by reason, conflict or transient",
+		},
+		[]string{"reason"},
+	)
+)
+
+// retryReason returns the reason to retry an update of the node after err, or an empty string if err is permanent.
+// Conflicts of the resource version and concurrent modifications detected by a JSON patch are retried with the latest node,
+// conflicts with other field managers are not.
+func retryReason(err error) string {
+	switch {
+	case errors.Is(err, errFieldManagerConflict):
+		return ""
+	case apierrors.IsConflict(err), errors.Is(err, errNodeModified):
+		return retryReasonConflict
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err),
+		utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return retryReasonTransient
+	}
+	return ""
+}
+
+// retryNodeUpdate calls update until it succeeds, fails permanently or patch-retries retries are exhausted.
+// The backoff grows exponentially with jitter.
+// update must get the node again, so a conflict is resolved by applying to the latest node.
+func retryNodeUpdate(ctx context.Context, action string, update func() error, logger log.Logger) error {
+	b := wait.Backoff{
+		Duration: *patchRetryBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    *patchRetries + 1,
+	}
+	var last error
+	return retry.OnError(b, func(err error) bool {
+		return retryReason(err) != "" && ctx.Err() == nil
+	}, func() error {
+		if last != nil {
+			reason := retryReason(last)
+			nodeUpdateRetryCounter.With(prometheus.Labels{"reason": reason}).Inc()
+			level.Warn(logger).Log("msg", "retrying update of the node", "action", action, "reason", reason, "err", last)
+		}
+		last = update()
+		return last
+	})
+}
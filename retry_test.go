@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func retries(t *testing.T, reason string) float64 {
+	var m dto.Metric
+	require.NoError(t, nodeUpdateRetryCounter.With(prometheus.Labels{"reason": reason}).Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestRetryNodeUpdate(t *testing.T) {
+	old := *patchRetryBackoff
+	*patchRetryBackoff = time.Millisecond
+	t.Cleanup(func() { *patchRetryBackoff = old })
+
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node1", errors.New("the object has been modified"))
+	for _, tc := range []struct {
+		name   string
+		errs   []error
+		calls  int
+		reason string
+		err    bool
+	}{
+		{name: "success", calls: 1},
+		{name: "conflict", errs: []error{conflict}, calls: 2, reason: retryReasonConflict},
+		{name: "transient", errs: []error{apierrors.NewServiceUnavailable("down"), apierrors.NewTooManyRequests("slow down", 1)}, calls: 3, reason: retryReasonTransient},
+		{name: "field manager conflict", errs: []error{fmt.Errorf("%w: %w", errFieldManagerConflict, conflict)}, calls: 1, err: true},
+		{name: "permanent", errs: []error{apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "node1", errors.New("no"))}, calls: 1, err: true},
+		{name: "exhausted", errs: []error{conflict, conflict, conflict, conflict, conflict, conflict}, calls: 5, reason: retryReasonConflict, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var before float64
+			if tc.reason != "" {
+				before = retries(t, tc.reason)
+			}
+			calls := 0
+			err := retryNodeUpdate(context.Background(), "label", func() error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			}, log.NewNopLogger())
+			assert.Equal(t, tc.err, err != nil, err)
+			assert.Equal(t, tc.calls, calls)
+			if tc.reason != "" {
+				assert.Equal(t, float64(calls-1), retries(t, tc.reason)-before)
+			}
+		})
+	}
+}
+
+func TestLabelerRetriesConflict(t *testing.T) {
+	oldHostname, oldBackoff := *hostname, *patchRetryBackoff
+	*hostname, *patchRetryBackoff = "node1", time.Millisecond
+	t.Cleanup(func() { *hostname, *patchRetryBackoff = oldHostname, oldBackoff })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	conflicts := 1
+	clientset.PrependReactor("patch", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node1", errors.New("the object has been modified"))
+	})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}, nil
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	ctx := context.Background()
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "true", n.Labels["nudl.squat.ai/Logitech_Receiver"])
+	gets := 0
+	for _, a := range clientset.Actions() {
+		if a.GetVerb() == "get" {
+			gets++
+		}
+	}
+	// The node is fetched again for the retry.
+	assert.Equal(t, 3, gets)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ruleMultipleIndexed labels every device of a label with the key suffixed by its index, e.g. <key>-0 and <key>-1.
+	ruleMultipleIndexed = "indexed"
+	// ruleMultipleCount sets the value of the label to the number of devices.
+	ruleMultipleCount = "count"
+)
+
+var rulesFile = flag.String("rules-file", "", "YAML or JSON file with rules that match devices by vendor, product, class, description or serial number and skip them, set their label key and value, taint the node, advertise them as extended resources or propagate them to pods in an annotation; the first matching rule of a device applies and the file is read on every scan")
+
+// rules are the rules of the rules file.
+type rules struct {
+	Rules []*rule `json:"rules"`
+}
+
+// rule matches devices and applies its actions to them.
+type rule struct {
+	// Name identifies the rule in errors.
+	Name  string    `json:"name,omitempty"`
+	Match ruleMatch `json:"match"`
+	// Skip excludes the devices from the labels like no-contain.
+	Skip bool `json:"skip,omitempty"`
+	// Label replaces the label key or value of the devices.
+	Label ruleLabel `json:"label,omitempty"`
+	// Taint is applied to the node while one of the devices is attached, in the format <key>[=<value>]:<effect>.
+	Taint string `json:"taint,omitempty"`
+	// ExtendedResource is the name of the extended resource without prefix, under which the devices are advertised.
+	ExtendedResource string `json:"extendedResource,omitempty"`
+	// Propagate publishes the devices in the pod devices annotation of the node, e.g. for webhooks that inject the devices into pods.
+	Propagate bool `json:"propagate,omitempty"`
+	// Multiple labels identical devices with indexed keys or the number of devices, see ruleMultipleIndexed and ruleMultipleCount.
+	Multiple string `json:"multiple,omitempty"`
+
+	description *regexp.Regexp
+	serial      *regexp.Regexp
+	class       *classSpec
+	taint       *v1.Taint
+}
+
+// ruleMatch are the conditions of a rule, which all have to match a device.
+// Empty conditions match all devices.
+type ruleMatch struct {
+	// Vendor and Product are the hex ids, e.g. 10c4 and ea60.
+	Vendor  string `json:"vendor,omitempty"`
+	Product string `json:"product,omitempty"`
+	// Class is a class of the device or one of its interfaces in the format of class, e.g. hid or 02:02.
+	Class string `json:"class,omitempty"`
+	// Description and Serial are regular expressions.
+	Description string `json:"description,omitempty"`
+	Serial      string `json:"serial,omitempty"`
+}
+
+// ruleLabel replaces the label key and value of the devices.
+type ruleLabel struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// loadRules reads and validates the rules file.
+func loadRules(path string) (*rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read rules file: %w", err)
+	}
+	var rs rules
+	if err := yaml.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("could not parse rules file: %w", err)
+	}
+	for i, r := range rs.Rules {
+		if r == nil {
+			return nil, fmt.Errorf("rule %d in rules file is empty", i+1)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("invalid %s in rules file: %w", r.Name, err)
+		}
+	}
+	return &rs, nil
+}
+
+// compile validates the rule and compiles its conditions.
+func (r *rule) compile() error {
+	r.Match.Vendor, r.Match.Product = strings.ToLower(r.Match.Vendor), strings.ToLower(r.Match.Product)
+	var err error
+	if r.Match.Description != "" {
+		if r.description, err = regexp.Compile(r.Match.Description); err != nil {
+			return fmt.Errorf("invalid description: %w", err)
+		}
+	}
+	if r.Match.Serial != "" {
+		if r.serial, err = regexp.Compile(r.Match.Serial); err != nil {
+			return fmt.Errorf("invalid serial: %w", err)
+		}
+	}
+	if r.Match.Class != "" {
+		c, err := parseClassSpec(r.Match.Class)
+		if err != nil {
+			return err
+		}
+		r.class = &c
+	}
+	if k := r.Label.Key; k != "" {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 || strings.Contains(k, "/") {
+			return fmt.Errorf("invalid label key %q: %s", k, strings.Join(errs, "; "))
+		}
+	}
+	if v := r.Label.Value; v != "" {
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid label value %q: %s", v, strings.Join(errs, "; "))
+		}
+	}
+	switch r.Multiple {
+	case "", ruleMultipleIndexed:
+	case ruleMultipleCount:
+		if r.Label.Value != "" {
+			return fmt.Errorf("label value and multiple %q are mutually exclusive", ruleMultipleCount)
+		}
+	default:
+		return fmt.Errorf("multiple %q unknown; possible values are: %s, %s", r.Multiple, ruleMultipleIndexed, ruleMultipleCount)
+	}
+	if r.Taint != "" {
+		t, err := parseTaint(r.Taint)
+		if err != nil {
+			return err
+		}
+		r.taint = &t
+	}
+	if n := r.ExtendedResource; n != "" {
+		if errs := validation.IsQualifiedName(sprintLabelKey(n)); len(errs) > 0 || strings.Contains(n, "/") {
+			return fmt.Errorf("invalid extended resource %q: %s", n, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// matches returns true if all conditions of the rule match the device.
+func (r *rule) matches(d device) bool {
+	if r.Match.Vendor != "" || r.Match.Product != "" {
+		vendor, product, ok := vendorProduct(d)
+		if !ok || (r.Match.Vendor != "" && r.Match.Vendor != vendor) || (r.Match.Product != "" && r.Match.Product != product) {
+			return false
+		}
+	}
+	if r.class != nil && !matchesClass(d, []classSpec{*r.class}) {
+		return false
+	}
+	if r.description != nil && !r.description.MatchString(d.Description) {
+		return false
+	}
+	if r.serial != nil && !r.serial.MatchString(d.Serial) {
+		return false
+	}
+	return true
+}
+
+// match returns the first rule that matches the device, or nil.
+func (rs *rules) match(d device) *rule {
+	for _, r := range rs.Rules {
+		if r.matches(d) {
+			return r
+		}
+	}
+	return nil
+}
+
+// validateRules returns an error if the rules file is invalid,
+// or if it taints the node, advertises extended resources or propagates devices without the kubernetes sink.
+func validateRules() error {
+	if *rulesFile == "" {
+		return nil
+	}
+	rs, err := loadRules(*rulesFile)
+	if err != nil {
+		return err
+	}
+	if *sinkName == sinkKubernetes {
+		return nil
+	}
+	for _, r := range rs.Rules {
+		if r.Taint != "" || r.ExtendedResource != "" || r.Propagate {
+			return fmt.Errorf("taints, extended resources and propagate of %s in rules file are not available with the %s sink", r.Name, *sinkName)
+		}
+	}
+	return nil
+}
+
+// applyRules returns the devices with the first matching rule of the rules file, if it is set,
+// and the label keys of the rules.
+// The rules are applied after device-names-file, so they take precedence.
+func applyRules(ds []device) ([]device, error) {
+	if *rulesFile == "" {
+		return ds, nil
+	}
+	rs, err := loadRules(*rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	rds := make([]device, 0, len(ds))
+	for _, d := range ds {
+		if r := rs.match(d); r != nil {
+			d.Rule = r
+			if r.Label.Key != "" {
+				d.Key = r.Label.Key
+			}
+		}
+		rds = append(rds, d)
+	}
+	return rds, nil
+}
+
+// skippedByRule returns true if the rule of the device skips it.
+func skippedByRule(d device) bool {
+	return d.Rule != nil && d.Rule.Skip
+}
+
+// ruleValueFunc returns a function that returns the label value of the rule of the first device of a label,
+// or the value of the value function.
+func ruleValueFunc(value func([]device) string) func([]device) string {
+	return func(ds []device) string {
+		if len(ds) > 0 && ds[0].Rule != nil && ds[0].Rule.Label.Value != "" {
+			return ds[0].Rule.Label.Value
+		}
+		return value(ds)
+	}
+}
+
+// addRuleMultipleLabels applies multiple of the rules to the labels of their devices that are labeled and not false.
+// With count, the value of the label is the number of devices, e.g. 2,
+// with indexed, every device is labeled with the key suffixed by its index in the order of sortedCollision in addition,
+// so workloads can require at least n devices with the label <key>-<n-1>.
+func addRuleMultipleLabels(l labels, ds []device, value func([]device) string) {
+	groups := make(map[string][]device)
+	for _, d := range ds {
+		if filtered(d) || d.Rule == nil || d.Rule.Multiple == "" {
+			continue
+		}
+		groups[d.Key] = append(groups[d.Key], d)
+	}
+	for k, g := range groups {
+		lk := sprintLabelKey(k)
+		if v, ok := l[lk]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		if g[0].Rule.Multiple == ruleMultipleCount {
+			l[lk] = strconv.Itoa(len(g))
+			continue
+		}
+		for i, d := range sortedCollision(g) {
+			l[sprintLabelKey(indexKey(k, i))] = value([]device{d})
+		}
+	}
+}
+
+// indexKey appends the index to the key and shortens the key, so the result is not longer than a label name.
+func indexKey(key string, i int) string {
+	return suffixKey(key, "-"+strconv.Itoa(i))
+}
+
+// ruleResourceCounts returns the number of devices by the extended resources of their rules.
+func ruleResourceCounts(ds []device) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, d := range ds {
+		if filtered(d) || d.Rule == nil || d.Rule.ExtendedResource == "" {
+			continue
+		}
+		counts[sprintLabelKey(d.Rule.ExtendedResource)]++
+	}
+	return counts
+}
+
+// hasRuleResources returns true if a rule of the rules file advertises extended resources.
+// The rules file is validated on start.
+func hasRuleResources() bool {
+	if *rulesFile == "" {
+		return false
+	}
+	rs, err := loadRules(*rulesFile)
+	if err != nil {
+		return false
+	}
+	for _, r := range rs.Rules {
+		if r.ExtendedResource != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleTaintsPatch returns a strategic merge patch that adds the taints of the rules of the devices that are not filtered
+// and removes the other taints of the rules.
+// It returns nil if the node does not need to be patched.
+func ruleTaintsPatch(node *v1.Node, rs *rules, ds []device) ([]byte, error) {
+	desired := make(map[string]v1.Taint)
+	for _, d := range ds {
+		if filtered(d) || d.Rule == nil || d.Rule.taint == nil {
+			continue
+		}
+		desired[d.Rule.taint.ToString()] = *d.Rule.taint
+	}
+	// The taints of rules that were removed since they were applied are managed as well,
+	// except for the taint of taint-when-missing.
+	var missingTaint *v1.Taint
+	if *taintWhenMissing != "" {
+		// The flag is validated on start.
+		t, _ := parseTaint(*taintWhenMissing)
+		missingTaint = &t
+	}
+	var managed []v1.Taint
+	for _, r := range rs.Rules {
+		if r.taint != nil {
+			managed = append(managed, *r.taint)
+		}
+	}
+	for _, t := range appliedTaints(node) {
+		if missingTaint == nil || !t.MatchTaint(missingTaint) {
+			managed = append(managed, t)
+		}
+	}
+	taints := make([]v1.Taint, 0, len(node.Spec.Taints)+len(desired))
+	changed := false
+	for _, t := range node.Spec.Taints {
+		if _, ok := desired[t.ToString()]; ok {
+			delete(desired, t.ToString())
+			taints = append(taints, t)
+			continue
+		}
+		if matchesTaint(t, managed) {
+			changed = true
+			continue
+		}
+		taints = append(taints, t)
+	}
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		taints = append(taints, desired[k])
+		changed = true
+	}
+	if missingTaint != nil {
+		managed = append(managed, *missingTaint)
+	}
+	return replaceTaintsPatch(node, taints, managed, changed)
+}
+
+// ruleTaint applies the taints of the rules of the attached devices to the node and removes the others.
+// It returns the patched node, or the node if it did not need to be patched.
+func (lb *labeler) ruleTaint(ctx context.Context, node *v1.Node, ds []device, logger log.Logger) (*v1.Node, error) {
+	rs, err := loadRules(*rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := ruleTaintsPatch(node, rs, ds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create taint patch for node %q: %w", node.Name, err)
+	}
+	if patch == nil {
+		return node, nil
+	}
+	nn, err := lb.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply the taints of the rules: %w", err)
+	}
+	level.Info(logger).Log("msg", "updated the taints of the rules", "patch", string(patch))
+	return nn, nil
+}
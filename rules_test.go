@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+const testRules = `
+rules:
+- name: hubs
+  match:
+    class: hub
+  skip: true
+- name: zigbee
+  match:
+    vendor: 10C4
+    product: ea60
+    serial: ^zb-
+  label:
+    key: zigbee
+    value: coordinator
+  taint: devic.es/zigbee=true:NoSchedule
+  extendedResource: zigbee
+- match:
+    description: (?i)arduino
+  label:
+    key: arduino
+`
+
+func TestRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRules), 0o644))
+	*rulesFile = path
+	t.Cleanup(func() { *rulesFile = "" })
+	require.NoError(t, validateRules())
+
+	ds, err := applyRules([]device{
+		{ID: "1d6b_0002", Key: "Linux-Foundation_2.0-root-hub", Description: "2.0 root hub (Linux Foundation)", Classes: []string{"09:00"}},
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x", Description: "CP210x UART Bridge (Silicon Labs)", Serial: "zb-0001"},
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x", Description: "CP210x UART Bridge (Silicon Labs)", Serial: "0002"},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (CDC ACM) (Arduino SA)"},
+		{ID: "pci-8086_1533", Key: "pci-Intel-Corporation_I210", Description: "I210 (Intel Corporation)"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hubs", ds[0].Rule.Name)
+	assert.True(t, filtered(ds[0]))
+	assert.Equal(t, "zigbee", ds[1].Key)
+	assert.Nil(t, ds[2].Rule)
+	// Rules without a name are named by their position.
+	assert.Equal(t, "rule 3", ds[3].Rule.Name)
+	assert.Nil(t, ds[4].Rule)
+
+	assert.Equal(t, labels{
+		"nudl.squat.ai/zigbee":                     "coordinator",
+		"nudl.squat.ai/Silicon-Labs_CP210x":        "true",
+		"nudl.squat.ai/arduino":                    "true",
+		"nudl.squat.ai/pci-Intel-Corporation_I210": "true",
+	}, createLabels(ds))
+	assert.Equal(t, map[string]int64{"nudl.squat.ai/zigbee": 1}, ruleResourceCounts(ds))
+	assert.True(t, hasRuleResources())
+
+	rs, err := loadRules(path)
+	require.NoError(t, err)
+	other := v1.Taint{Key: "example.com/other", Effect: v1.TaintEffectNoExecute}
+	n := &v1.Node{Spec: v1.NodeSpec{Taints: []v1.Taint{other}}}
+	patch, err := ruleTaintsPatch(n, rs, ds)
+	require.NoError(t, err)
+	var p struct {
+		Spec v1.NodeSpec `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(patch, &p))
+	assert.Equal(t, []v1.Taint{other, {Key: "devic.es/zigbee", Value: "true", Effect: v1.TaintEffectNoSchedule}}, p.Spec.Taints)
+
+	applyTaintPatch(t, n, patch)
+	assert.Contains(t, n.Annotations[taintsAnnotation()], "devic.es/zigbee")
+	patch, err = ruleTaintsPatch(n, rs, ds)
+	require.NoError(t, err)
+	assert.Nil(t, patch)
+	// The taint is removed when the device is detached.
+	patch, err = ruleTaintsPatch(n, rs, ds[2:])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(patch, &p))
+	assert.Equal(t, []v1.Taint{other}, p.Spec.Taints)
+	// The taint of a rule that was removed since it was applied is removed.
+	patch, err = ruleTaintsPatch(n, &rules{}, ds[2:])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(patch, &p))
+	assert.Equal(t, []v1.Taint{other}, p.Spec.Taints)
+	// The taints of the rules are removed on clean up without reading the rules file.
+	*rulesFile = filepath.Join(t.TempDir(), "missing.yaml")
+	patch, err = untaintPatch(n, ownedTaints(n))
+	require.NoError(t, err)
+	applyTaintPatch(t, n, patch)
+	assert.Equal(t, []v1.Taint{other}, n.Spec.Taints)
+	assert.NotContains(t, n.Annotations, taintsAnnotation())
+	*rulesFile = path
+
+	*sinkName = sinkStdout
+	t.Cleanup(func() { *sinkName = sinkKubernetes })
+	assert.Error(t, validateRules())
+}
+
+func TestRuleMultiple(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+- match: {vendor: 1a6e}
+  label: {key: coral}
+  multiple: indexed
+- match: {vendor: 10c4}
+  multiple: count
+`), 0o644))
+	*rulesFile = path
+	t.Cleanup(func() { *rulesFile = "" })
+
+	ds, err := applyRules([]device{
+		{ID: "1a6e_089a", Key: "Global-Unichip_coral", Serial: "b"},
+		{ID: "1a6e_089a", Key: "Global-Unichip_coral", Serial: "a"},
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x"},
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x"},
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x"},
+		{ID: "2341_0043", Key: "Arduino-SA_Uno-R3"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/coral":               "true",
+		"nudl.squat.ai/coral-0":             "true",
+		"nudl.squat.ai/coral-1":             "true",
+		"nudl.squat.ai/Silicon-Labs_CP210x": "3",
+		"nudl.squat.ai/Arduino-SA_Uno-R3":   "true",
+	}, createLabels(ds))
+
+	assert.Equal(t, "abc-12", indexKey("abc", 12))
+	assert.Len(t, indexKey(string(make([]byte, maxLabelNameLength)), 1), maxLabelNameLength)
+}
+
+func TestLoadRulesInvalid(t *testing.T) {
+	for _, r := range []string{
+		"rules:\n- match: {description: '('}",
+		"rules:\n- match: {class: keyboard}",
+		"rules:\n- label: {key: a/b}",
+		"rules:\n- label: {value: '-'}",
+		"rules:\n- taint: devic.es/zigbee",
+		"rules:\n- extendedResource: 'a b'",
+		"rules:\n- multiple: all",
+		"rules:\n- multiple: count\n  label: {value: coral}",
+		"rules:\n-",
+	} {
+		path := filepath.Join(t.TempDir(), "rules.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(r), 0o644))
+		_, err := loadRules(path)
+		assert.Error(t, err, r)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	flag "github.com/spf13/pflag"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	keySanitizerTransliterate = "transliterate"
+	keySanitizerCollapse      = "collapse-dashes"
+	keySanitizerTrim          = "trim"
+)
+
+var keySanitizers = flag.StringSlice("key-sanitizers", []string{}, fmt.Sprintf("additional steps that sanitize the vendor and product names of human readable label keys: %s replaces non-ASCII letters, e.g. Müller GmbH becomes Mueller-GmbH instead of M-ller-GmbH, %s replaces runs of dashes with one dash and %s removes leading and trailing punctuation; the steps change existing keys", keySanitizerTransliterate, keySanitizerCollapse, keySanitizerTrim))
+
+// keySanitizer is a step of the sanitization of a name in a label key.
+type keySanitizer struct {
+	name string
+	// optional steps only run if they are enabled by key-sanitizers.
+	optional bool
+	f        func(string) string
+}
+
+// regDashes matches runs of dashes.
+var regDashes = regexp.MustCompile(`-{2,}`)
+
+// keySanitizerPipeline holds all steps in the order they run.
+// Invalid characters are always replaced, transliteration runs before, so the letters are not replaced.
+var keySanitizerPipeline = []keySanitizer{
+	{name: keySanitizerTransliterate, optional: true, f: transliterate},
+	{name: "replace", f: func(s string) string { return regTrim.ReplaceAllString(s, "-") }},
+	{name: keySanitizerCollapse, optional: true, f: func(s string) string { return regDashes.ReplaceAllString(s, "-") }},
+	{name: keySanitizerTrim, optional: true, f: func(s string) string { return strings.Trim(s, "-_.") }},
+}
+
+// validateKeySanitizers returns an error if a step of key-sanitizers is unknown.
+func validateKeySanitizers() error {
+	for _, n := range *keySanitizers {
+		if !optionalKeySanitizer(n) {
+			return fmt.Errorf("key sanitizer %q unknown; possible values are: %s, %s, %s", n, keySanitizerTransliterate, keySanitizerCollapse, keySanitizerTrim)
+		}
+	}
+	return nil
+}
+
+func optionalKeySanitizer(name string) bool {
+	for _, ks := range keySanitizerPipeline {
+		if ks.optional && ks.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeName returns the name with only characters that are allowed in label keys,
+// sanitized by the enabled steps of the pipeline.
+func sanitizeName(s string) string {
+	for _, ks := range keySanitizerPipeline {
+		if !ks.optional || slices.Contains(*keySanitizers, ks.name) {
+			s = ks.f(s)
+		}
+	}
+	return s
+}
+
+// transliterations holds replacements of letters that are not only a base letter with diacritics,
+// and of umlauts, which are written with an e in German names.
+var transliterations = map[rune]string{
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'Ä': "Ae", 'Ö': "Oe", 'Ü': "Ue",
+	'ß': "ss", 'æ': "ae", 'Æ': "Ae", 'ø': "o", 'Ø': "O", 'œ': "oe", 'Œ': "Oe",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'þ': "th", 'Þ': "Th", 'ð': "d", 'Ð': "D",
+}
+
+// transliterate replaces non-ASCII letters with ASCII letters, e.g. é with e, by removing the diacritics.
+// Other non-ASCII characters are kept and replaced like any invalid character.
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < unicode.MaxASCII {
+			b.WriteRune(r)
+			continue
+		}
+		if t, ok := transliterations[r]; ok {
+			b.WriteString(t)
+			continue
+		}
+		for _, d := range norm.NFD.String(string(r)) {
+			if !unicode.Is(unicode.Mn, d) {
+				b.WriteRune(d)
+			}
+		}
+	}
+	return b.String()
+}
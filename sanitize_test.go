@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeName(t *testing.T) {
+	old := *keySanitizers
+	t.Cleanup(func() { *keySanitizers = old })
+
+	for _, tc := range []struct {
+		name       string
+		sanitizers []string
+		in         string
+		out        string
+	}{
+		{name: "default", in: "Müller GmbH", out: "M-ller-GmbH"},
+		{name: "default keeps dashes", in: "Co., Ltd (x)", out: "Co.--Ltd--x-"},
+		{name: "transliterate", sanitizers: []string{keySanitizerTransliterate}, in: "Müller GmbH", out: "Mueller-GmbH"},
+		{name: "transliterate diacritics", sanitizers: []string{keySanitizerTransliterate}, in: "Société Générale Łódź", out: "Societe-Generale-Lodz"},
+		{name: "transliterate unknown", sanitizers: []string{keySanitizerTransliterate}, in: "深圳 Tech", out: "---Tech"},
+		{name: "collapse", sanitizers: []string{keySanitizerCollapse}, in: "Co., Ltd (x)", out: "Co.-Ltd-x-"},
+		{name: "all", sanitizers: []string{keySanitizerTrim, keySanitizerCollapse, keySanitizerTransliterate}, in: "深圳 Müller Co., Ltd.", out: "Mueller-Co.-Ltd"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			*keySanitizers = tc.sanitizers
+			assert.Equal(t, tc.out, sanitizeName(tc.in))
+		})
+	}
+
+	*keySanitizers = []string{keySanitizerTransliterate, keySanitizerCollapse, keySanitizerTrim}
+	assert.Equal(t, "Mueller-GmbH_Geraet-2", humanKey("", "Gerät 2 (Müller GmbH)", "1234_5678"))
+	assert.NoError(t, validateKeySanitizers())
+	*keySanitizers = []string{"lowercase"}
+	assert.Error(t, validateKeySanitizers())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log"
+	flag "github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var output = flag.String("output", outputTable, fmt.Sprintf("output format of nudl scan and nudl list: %s, %s or %s, and %s or %s for nudl list", outputTable, outputJSON, outputYAML, outputWide, outputLsusb))
+
+// runScan scans the devices once and writes the labels that would be set to stdout.
+// Neither a kubeconfig nor a cluster is needed.
+func runScan(logger log.Logger) error {
+	ds, err := scanOnce(logger)
+	if err != nil {
+		return err
+	}
+	return writeScan(os.Stdout, createLabels(ds), *output)
+}
+
+// scanOnce runs all scanners once and returns the devices.
+func scanOnce(logger log.Logger) ([]device, error) {
+	scs, err := newScanners(logger)
+	if err != nil {
+		return nil, err
+	}
+	var ds []device
+	for _, sc := range scs {
+		sds, err := runScanner(context.Background(), sc, logger)
+		if err != nil {
+			return nil, fmt.Errorf("scanner %s failed: %w", sc.Name(), err)
+		}
+		ds = append(ds, stampLastSeen(sds, time.Now())...)
+	}
+	return ds, nil
+}
+
+// writeScan writes the labels in the format.
+func writeScan(w io.Writer, l labels, format string) error {
+	switch format {
+	case outputTable:
+		keys := make([]string, 0, len(l))
+		for k := range l {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "LABEL\tVALUE")
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%s\n", k, l[k])
+		}
+		return tw.Flush()
+	case outputJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(l)
+	case outputYAML:
+		data, err := yaml.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("could not marshal labels: %w", err)
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("output format %q unknown; possible values are: %s, %s, %s", format, outputTable, outputJSON, outputYAML)
+	}
+}
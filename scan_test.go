@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteScan(t *testing.T) {
+	l := labels{"nudl.squat.ai/Logitech_Receiver": "true", "nudl.squat.ai/Arduino-SA_Uno-R3": "true"}
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{format: outputTable, want: "LABEL                            VALUE\nnudl.squat.ai/Arduino-SA_Uno-R3  true\nnudl.squat.ai/Logitech_Receiver  true\n"},
+		{format: outputJSON, want: "{\n  \"nudl.squat.ai/Arduino-SA_Uno-R3\": \"true\",\n  \"nudl.squat.ai/Logitech_Receiver\": \"true\"\n}\n"},
+		{format: outputYAML, want: "nudl.squat.ai/Arduino-SA_Uno-R3: \"true\"\nnudl.squat.ai/Logitech_Receiver: \"true\"\n"},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeScan(&buf, l, tc.format))
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+	assert.Error(t, writeScan(&bytes.Buffer{}, l, "xml"))
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+)
+
+var (
+	scannerKind          = flag.String("scanner", "usb", "scanner used to discover devices: usb, or fixture to read them from --fixture-file")
+	scanFailureThreshold = flag.Int("scan-failure-threshold", 5, "number of consecutive failures after which a scanner is backed off, 0 disables the back off")
+	scanFailureBackoff   = flag.Duration("scan-failure-backoff", time.Minute, "time to wait before a backed off scanner is run again")
+)
+
+var (
+	scannerBackoffGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nudl_scanner_backoff",
+			Help: "Whether a scanner is backed off after consecutive failures",
+		},
+		[]string{"scanner"},
+	)
+	scanTimeoutCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nudl_scan_timeouts_total",
+			Help: "Number of scans that exceeded the scan timeout",
+		},
+		[]string{"scanner"},
+	)
+	scannerFailedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nudl_scanner_failed",
+			Help: "Whether the last scan of a scanner failed, so its devices are not labeled",
+		},
+		[]string{"scanner"},
+	)
+	scannerWedgedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nudl_scanner_wedged",
+			Help: "Whether a scan that timed out is still running, e.g. because a device hangs in libusb",
+		},
+		[]string{"scanner"},
+	)
+	scanDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "nudl_scan_duration_seconds",
+			Help:    "Duration of the scans, including failed scans",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		},
+		[]string{"scanner"},
+	)
+)
+
+// device is a device found by a scanner.
+type device struct {
+	// ID identifies the model of the device, e.g. <vendor id>_<product id> for usb devices.
+	ID string `json:"id"`
+	// Key is the generated label key without prefix.
+	Key string `json:"key"`
+	// Description is a human readable description of the device that is used for filtering.
+	Description string `json:"description"`
+	// Drivers are the kernel drivers bound to the interfaces of the device, if driver-labels is set.
+	Drivers []string `json:"drivers,omitempty"`
+	// Port is the port path of the device, e.g. 1-2.3, if it is known.
+	Port string `json:"port,omitempty"`
+	// Serial is the serial number of the device, if it is known without opening the device or include-serial is set.
+	Serial string `json:"serial,omitempty"`
+	// Class is the device class in hex, e.g. ef, if it is known.
+	Class string `json:"class,omitempty"`
+	// Classes are the sorted class and subclass pairs of the device and its interfaces, e.g. 03:01, if they are known.
+	Classes []string `json:"classes,omitempty"`
+	// Speed is the negotiated speed of the device, e.g. high, if it is known.
+	Speed string `json:"speed,omitempty"`
+	// Address is the device number of usb devices on their bus, e.g. 4, if it is known.
+	Address int `json:"address,omitempty"`
+	// Version is the device release number (bcdDevice) of usb devices, e.g. 1.0.4, if it is known.
+	Version string `json:"version,omitempty"`
+	// Remote is true for usb devices that are attached over usbip, if remote-devices is set.
+	Remote bool `json:"remote,omitempty"`
+	// Authorized is true for thunderbolt devices that are authorized to connect.
+	Authorized bool `json:"authorized,omitempty"`
+	// HIDKinds are the sorted kinds of the HID application collections of usb devices, e.g. scanner, if hid-detail is set.
+	HIDKinds []string `json:"hidKinds,omitempty"`
+	// PowerState is the runtime power state of usb devices, e.g. suspended, if power-state-labels or the state label value is set.
+	PowerState string `json:"powerState,omitempty"`
+	// Size is the size of block devices in bytes.
+	Size uint64 `json:"size,omitempty"`
+	// Rule is the first rule of rules-file that matches the device, if any.
+	Rule *rule `json:"-"`
+	// LastSeen is the start of the scan that found the device.
+	LastSeen time.Time `json:"-"`
+}
+
+// fingerprint returns a hash of the sorted device ids, their drivers and,
+// if resolve-collisions, include-serial, label-template or only-port is set or the device details are annotated, their serial numbers and ports,
+// if value-template is set, their ports, speeds and versions, if port-labels is set, their ports,
+// if firmware-labels is set, their versions, if a rule propagates them, their serial numbers, ports and device numbers,
+// the sizes of block devices, the power states and the HID kinds of the devices,
+// which changes if a device is attached or removed, a driver is bound or unbound, a device is attached over usbip,
+// media of a different size is inserted or a device is suspended.
+func fingerprint(ds []device) uint64 {
+	ids := make([]string, 0, len(ds))
+	for _, d := range ds {
+		id := d.ID
+		if len(d.Drivers) > 0 {
+			id += "=" + strings.Join(d.Drivers, ",")
+		}
+		if d.Remote {
+			id += "@remote"
+		}
+		if d.Size > 0 {
+			id += "@" + strconv.FormatUint(d.Size, 10)
+		}
+		if d.Authorized {
+			id += "@authorized"
+		}
+		if d.PowerState != "" {
+			id += "@" + d.PowerState
+		}
+		if len(d.HIDKinds) > 0 {
+			id += "@hid=" + strings.Join(d.HIDKinds, ",")
+		}
+		// Resolved label keys, keys with serial numbers, templated keys, the device details and only-port depend on the serial numbers and ports.
+		if *resolveCollisions || *includeSerial || publishAnnotations() || *labelTemplate != "" || len(*onlyPorts) > 0 {
+			id += "@" + d.Serial + "@" + d.Port
+		}
+		// Templated label values depend on the ports and speeds.
+		if *valueTemplate != "" {
+			id += "@" + d.Port + "@" + d.Speed
+		}
+		if *portLabels {
+			id += "@" + d.Port
+		}
+		// The pod devices annotation holds the serial numbers, ports and device nodes.
+		if d.Rule != nil && d.Rule.Propagate {
+			id += "@" + d.Serial + "@" + d.Port + "@" + strconv.Itoa(d.Address)
+		}
+		if *firmwareLabels || *valueTemplate != "" {
+			id += "@" + d.Version
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	h := fnv.New64a()
+	for _, id := range ids {
+		h.Write([]byte(id))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+// scanner discovers the devices attached to the node.
+type scanner interface {
+	// Name returns the name of the scanner used in logs and errors.
+	Name() string
+	// Scan returns the attached devices.
+	// Implementations are allowed to ignore the context, e.g. if they block in calls to libusb.
+	Scan(ctx context.Context) ([]device, error)
+}
+
+// newScanner returns the scanner selected with --scanner, or the scanner of the file to replay.
+// If record-file is set, the results of the scanner are recorded.
+func newScanner(logger log.Logger) (scanner, error) {
+	var s scanner
+	switch {
+	case *replay != "":
+		rs, err := newReplay(*replay)
+		if err != nil {
+			return nil, err
+		}
+		s = rs
+	case *scannerKind == "usb":
+		s = newUSBScanner(logger)
+		if *remoteDevices != "" {
+			s = remoteScanner{scanner: s, root: *sysfsRoot}
+		}
+	case *scannerKind == "fixture":
+		if *fixtureFile == "" {
+			return nil, errors.New("--fixture-file is required for --scanner=fixture")
+		}
+		fs, err := newFixtureScanner(*fixtureFile)
+		if err != nil {
+			return nil, err
+		}
+		s = fs
+	default:
+		return nil, fmt.Errorf("unknown scanner %q", *scannerKind)
+	}
+	if *recordFile != "" {
+		return newRecordingScanner(s, *recordFile)
+	}
+	return s, nil
+}
+
+// newScanners returns the scanner selected with --scanner and the pci, i2c, sound, storage, thunderbolt and device node scanners, if they are enabled.
+// They are never recorded.
+func newScanners(logger log.Logger) ([]scanner, error) {
+	s, err := newScanner(logger)
+	if err != nil {
+		return nil, err
+	}
+	scs := []scanner{s}
+	if *scanPCI {
+		ps, err := newPCIScanner(*sysfsRoot, *pciIDs)
+		if err != nil {
+			return nil, err
+		}
+		scs = append(scs, ps)
+	}
+	if *scanI2C {
+		scs = append(scs, &i2cScanner{root: *sysfsRoot, gpio: *scanGPIO})
+	}
+	if *scanSound {
+		scs = append(scs, &soundScanner{root: *sysfsRoot})
+	}
+	if *scanStorage {
+		scs = append(scs, &storageScanner{root: *sysfsRoot})
+	}
+	if *scanThunderbolt {
+		scs = append(scs, &thunderboltScanner{root: *sysfsRoot})
+	}
+	if *scanDev {
+		ds, err := newDevScanner(*devRoot, *sysfsRoot, *devPatterns)
+		if err != nil {
+			return nil, err
+		}
+		scs = append(scs, ds)
+	}
+	return scs, nil
+}
+
+// vendorProduct returns the vendor and product id of a device, e.g. 046d and c52b.
+// Thunderbolt devices have vendor and product ids, device nodes, i2c devices, gpio chips, sound cards and block devices do not.
+func vendorProduct(d device) (string, string, bool) {
+	if isDev(d) || isI2C(d) || isGPIO(d) || isSound(d) || isStorage(d) {
+		return "", "", false
+	}
+	return strings.Cut(strings.TrimPrefix(strings.TrimPrefix(d.ID, pciPrefix), thunderboltPrefix), "_")
+}
+
+// isPCI returns true for pci devices.
+func isPCI(d device) bool {
+	return strings.HasPrefix(d.ID, pciPrefix)
+}
+
+// scanRunner runs a scanner and keeps track of its failures.
+// A scanRunner must not be run concurrently.
+type scanRunner struct {
+	scanner
+	clock clock.PassiveClock
+	// failures is the number of consecutive failures.
+	failures int
+	// backoffUntil is the time until which the scanner is not run, because it failed too often.
+	backoffUntil time.Time
+	// previous is the result of the last successful scan, if hasPrevious is true.
+	previous    []device
+	hasPrevious bool
+
+	// mu protects running, which is reset by the go routine of the scan, even after the scan timed out.
+	mu      sync.Mutex
+	running bool
+}
+
+// errScanRunning is returned if the previous scan of a scanner timed out and did not return yet.
+var errScanRunning = errors.New("the previous scan is still running")
+
+// trackedScanner calls done when the scan returns.
+type trackedScanner struct {
+	scanner
+	done func()
+}
+
+func (s trackedScanner) Scan(ctx context.Context) ([]device, error) {
+	defer s.done()
+	return s.scanner.Scan(ctx)
+}
+
+// start marks the scanner as running, unless it is still running.
+func (r *scanRunner) start() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return false
+	}
+	r.running = true
+	return true
+}
+
+func (r *scanRunner) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running = false
+	scannerWedgedGauge.WithLabelValues(r.Name()).Set(0)
+}
+
+// wedged returns true if a scan that timed out is still running.
+func (r *scanRunner) wedged() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running
+}
+
+func newScanRunners(c clock.PassiveClock, scanners ...scanner) []*scanRunner {
+	rs := make([]*scanRunner, 0, len(scanners))
+	for _, s := range scanners {
+		scannerBackoffGauge.WithLabelValues(s.Name()).Set(0)
+		scanTimeoutCounter.WithLabelValues(s.Name())
+		scannerWedgedGauge.WithLabelValues(s.Name()).Set(0)
+		scannerFailedGauge.WithLabelValues(s.Name()).Set(0)
+		rs = append(rs, &scanRunner{scanner: s, clock: c})
+	}
+	return rs
+}
+
+// run runs the scanner unless it is backed off.
+// After scan-failure-threshold consecutive failures the scanner is backed off for scan-failure-backoff,
+// instead of hammering e.g. a broken usb stack every update-time.
+// If the scan times out, the result of the last successful scan is returned.
+// A scan that timed out keeps running in the background, e.g. blocked in libusb by a wedged device,
+// and the scanner is not run again until it returns, which counts as a timeout as well.
+func (r *scanRunner) run(ctx context.Context, logger log.Logger) ([]device, error) {
+	if r.clock.Now().Before(r.backoffUntil) {
+		return nil, fmt.Errorf("backed off until %s after %d consecutive failures", r.backoffUntil.Format(time.RFC3339), r.failures)
+	}
+	start := r.clock.Now()
+	var ds []device
+	var err error
+	if r.start() {
+		ds, err = runScanner(ctx, trackedScanner{scanner: r.scanner, done: r.finish}, logger)
+	} else {
+		err = fmt.Errorf("%w: %w", errScanRunning, context.DeadlineExceeded)
+	}
+	scanDurationHistogram.WithLabelValues(r.Name()).Observe(r.clock.Since(start).Seconds())
+	if err != nil {
+		// The scanner is not to blame, if it was cancelled from outside.
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		r.failures++
+		if *scanFailureThreshold > 0 && r.failures >= *scanFailureThreshold {
+			r.backoffUntil = r.clock.Now().Add(*scanFailureBackoff)
+			scannerBackoffGauge.WithLabelValues(r.Name()).Set(1)
+			level.Warn(logger).Log("msg", "backing off scanner", "scanner", r.Name(), "failures", r.failures, "until", r.backoffUntil)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			scanTimeoutCounter.WithLabelValues(r.Name()).Inc()
+			r.mu.Lock()
+			if r.running {
+				scannerWedgedGauge.WithLabelValues(r.Name()).Set(1)
+			}
+			r.mu.Unlock()
+			if r.hasPrevious {
+				level.Warn(logger).Log("msg", "scanner timed out, using the previous result", "scanner", r.Name())
+				return r.previous, nil
+			}
+		}
+		return nil, err
+	}
+	if r.failures >= *scanFailureThreshold && *scanFailureThreshold > 0 {
+		level.Info(logger).Log("msg", "scanner recovered", "scanner", r.Name())
+	}
+	r.failures = 0
+	// The previous result keeps the time, so devices of a timed out scan were last seen in the previous scan.
+	ds = stampLastSeen(ds, start)
+	r.previous, r.hasPrevious = ds, true
+	scannerBackoffGauge.WithLabelValues(r.Name()).Set(0)
+	return ds, nil
+}
+
+// scanAll runs all scanners concurrently and returns the devices found by the scanners that succeeded
+// and the errors of the scanners that failed, are backed off or exceeded the scan-timeout.
+// A failing scanner, e.g. an optional exec or pci scanner, does not prevent the devices of the others from being labeled.
+// The devices of the last successful scan of a failed scanner are kept, so their labels are not removed.
+func scanAll(ctx context.Context, runners []*scanRunner, logger log.Logger) ([]device, []error) {
+	results := make([][]device, len(runners))
+	errs := make([]error, len(runners))
+	var wg sync.WaitGroup
+	for i, r := range runners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds, err := r.run(ctx, logger)
+			if err != nil {
+				scannerFailedGauge.WithLabelValues(r.Name()).Set(1)
+				errs[i] = &scanError{scanner: r.Name(), err: err}
+				results[i] = r.previous
+				return
+			}
+			scannerFailedGauge.WithLabelValues(r.Name()).Set(0)
+			results[i] = ds
+		}()
+	}
+	wg.Wait()
+	var ds []device
+	var failed []error
+	for i, r := range results {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		}
+		ds = append(ds, r...)
+	}
+	return ds, failed
+}
+
+// runScanner runs a scanner with its own timeout.
+// Not all scanners can be cancelled, so the scan runs in a separate go routine
+// and runScanner returns as soon as the context is done.
+// A panic in the scanner is returned as an error.
+// The keys of the devices that are generated by different products are disambiguated,
+// then they are generated by label-template, if it is set, and replaced by the names of device-names-file and the rules of rules-file.
+func runScanner(ctx context.Context, s scanner, logger log.Logger) ([]device, error) {
+	ctx, cancel := context.WithTimeout(ctx, *scanTimeout)
+	defer cancel()
+	type result struct {
+		ds  []device
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			ch <- r
+		}()
+		defer recoverPanic(log.With(logger, "scanner", s.Name()), &r.err)
+		// A scan that timed out keeps running, so it must not see a reload of the flags.
+		configMu.RLock()
+		defer configMu.RUnlock()
+		r.ds, r.err = s.Scan(ctx)
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.err != nil {
+			return nil, r.err
+		}
+		ds, err := applyLabelTemplate(disambiguateKeys(r.ds, log.With(logger, "scanner", s.Name())))
+		if err != nil {
+			return nil, err
+		}
+		if ds, err = applyDeviceNames(ds); err != nil {
+			return nil, err
+		}
+		return applyRules(ds)
+	}
+}
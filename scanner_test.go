@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/clock"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+// fakeScanner returns the result of its scan function.
+type fakeScanner struct {
+	name string
+	scan func(ctx context.Context) ([]device, error)
+}
+
+func (s fakeScanner) Name() string {
+	return s.name
+}
+
+func (s fakeScanner) Scan(ctx context.Context) ([]device, error) {
+	return s.scan(ctx)
+}
+
+func TestRunScannerPanic(t *testing.T) {
+	s := fakeScanner{name: "panic", scan: func(context.Context) ([]device, error) {
+		panic("exotic device")
+	}}
+	_, err := runScanner(context.Background(), s, log.NewNopLogger())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exotic device")
+}
+
+func TestRunScannerTimeout(t *testing.T) {
+	old := *scanTimeout
+	*scanTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { *scanTimeout = old })
+
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	s := fakeScanner{name: "wedged", scan: func(context.Context) ([]device, error) {
+		<-block
+		return nil, nil
+	}}
+	_, err := runScanner(context.Background(), s, log.NewNopLogger())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestScanRunnerWedged(t *testing.T) {
+	old := *scanTimeout
+	*scanTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { *scanTimeout = old })
+
+	var calls atomic.Int32
+	block := make(chan struct{})
+	s := fakeScanner{name: "wedged", scan: func(context.Context) ([]device, error) {
+		calls.Add(1)
+		<-block
+		return []device{{ID: "a_b"}}, nil
+	}}
+	r := newScanRunners(testclock.NewFakePassiveClock(time.Now()), s)[0]
+
+	_, err := r.run(context.Background(), log.NewNopLogger())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, r.wedged())
+	var m dto.Metric
+	require.NoError(t, scannerWedgedGauge.WithLabelValues("wedged").Write(&m))
+	assert.Equal(t, 1.0, m.GetGauge().GetValue())
+
+	// The scanner is not run again while the previous scan blocks.
+	_, err = r.run(context.Background(), log.NewNopLogger())
+	assert.ErrorIs(t, err, errScanRunning)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), calls.Load())
+
+	close(block)
+	require.Eventually(t, func() bool { return !r.wedged() }, time.Second, time.Millisecond)
+	require.NoError(t, scannerWedgedGauge.WithLabelValues("wedged").Write(&m))
+	assert.Equal(t, 0.0, m.GetGauge().GetValue())
+	ds, err := r.run(context.Background(), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Len(t, ds, 1)
+}
+
+func TestScanRunnerBackoff(t *testing.T) {
+	calls := 0
+	fail := true
+	s := fakeScanner{name: "flaky", scan: func(context.Context) ([]device, error) {
+		calls++
+		if fail {
+			return nil, errors.New("broken")
+		}
+		return []device{{ID: "a_b"}}, nil
+	}}
+	c := testclock.NewFakePassiveClock(time.Now())
+	r := newScanRunners(c, s)[0]
+	for i := 0; i < *scanFailureThreshold; i++ {
+		_, err := r.run(context.Background(), log.NewNopLogger())
+		require.Error(t, err)
+	}
+	assert.Equal(t, *scanFailureThreshold, calls)
+
+	// The scanner is backed off and not called.
+	_, err := r.run(context.Background(), log.NewNopLogger())
+	require.Error(t, err)
+	assert.Equal(t, *scanFailureThreshold, calls)
+
+	// The scanner is called again after the back off.
+	fail = false
+	c.SetTime(c.Now().Add(*scanFailureBackoff))
+	ds, err := r.run(context.Background(), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Len(t, ds, 1)
+	assert.Equal(t, 0, r.failures)
+}
+
+func TestScanRunnerTimeoutPrevious(t *testing.T) {
+	old := *scanTimeout
+	*scanTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { *scanTimeout = old })
+
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	wedged := false
+	s := fakeScanner{name: "sometimes-wedged", scan: func(context.Context) ([]device, error) {
+		if wedged {
+			<-block
+		}
+		return []device{{ID: "a_b"}}, nil
+	}}
+	r := newScanRunners(clock.RealClock{}, s)[0]
+	ds, err := r.run(context.Background(), log.NewNopLogger())
+	require.NoError(t, err)
+
+	wedged = true
+	prev, err := r.run(context.Background(), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Equal(t, ds, prev)
+	assert.Equal(t, 1, r.failures)
+}
+
+func TestScanAllPartialFailure(t *testing.T) {
+	fail := false
+	broken := fakeScanner{name: "broken", scan: func(context.Context) ([]device, error) {
+		if fail {
+			return nil, errors.New("broken")
+		}
+		return []device{{ID: "c_d"}}, nil
+	}}
+	working := fakeScanner{name: "working", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "a_b"}}, nil
+	}}
+	rs := newScanRunners(testclock.NewFakePassiveClock(time.Now()), broken, working)
+
+	ds, failed := scanAll(context.Background(), rs, log.NewNopLogger())
+	assert.Empty(t, failed)
+	assert.Len(t, ds, 2)
+
+	// The devices of the working scanner are returned and the broken scanner keeps its previous devices.
+	fail = true
+	ds, failed = scanAll(context.Background(), rs, log.NewNopLogger())
+	require.Len(t, failed, 1)
+	var se *scanError
+	require.ErrorAs(t, failed[0], &se)
+	assert.Equal(t, "broken", se.scanner)
+	assert.ElementsMatch(t, []string{"a_b", "c_d"}, []string{ds[0].ID, ds[1].ID})
+	var m dto.Metric
+	require.NoError(t, scannerFailedGauge.WithLabelValues("broken").Write(&m))
+	assert.Equal(t, 1.0, m.GetGauge().GetValue())
+	require.NoError(t, scannerFailedGauge.WithLabelValues("working").Write(&m))
+	assert.Equal(t, 0.0, m.GetGauge().GetValue())
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-kit/log"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var selftestFake = flag.Bool("selftest-fake", false, "run the selftest against a fake cluster with a node named hostname instead of the cluster")
+
+// selftestCheck is a step of the selftest.
+// It returns a short result that is reported if the check passes.
+type selftestCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// runSelftest runs the selftest against the cluster, or a fake cluster if selftest-fake is set,
+// and writes the report to stdout.
+func runSelftest(logger log.Logger) error {
+	if *hostname == "" {
+		return fmt.Errorf("--hostname is required for the selftest")
+	}
+	var clientset kubernetes.Interface
+	if *selftestFake {
+		clientset = fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: *hostname}})
+	} else {
+		config, err := newKubeConfig(logger)
+		if err != nil {
+			return err
+		}
+		if clientset, err = kubernetes.NewForConfig(config); err != nil {
+			return fmt.Errorf("could not create kubernetes clientset: %w", err)
+		}
+	}
+	scs, err := newScanners(logger)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout+*scanTimeout)
+	defer cancel()
+	return selftest(ctx, os.Stdout, clientset, scs, logger)
+}
+
+// selftest scans the devices, creates the labels, patches the node in dry-run mode
+// and verifies that the clean up removes all labels.
+// Nothing is changed in the cluster.
+// The checks are run in order and a failed check skips all following checks.
+func selftest(ctx context.Context, w io.Writer, clientset kubernetes.Interface, scs []scanner, logger log.Logger) error {
+	var (
+		ds      []device
+		nl      labels
+		node    *v1.Node
+		labeled *v1.Node
+	)
+	checks := []selftestCheck{
+		{"scan", func(ctx context.Context) (string, error) {
+			names := make([]string, 0, len(scs))
+			for _, sc := range scs {
+				sds, err := runScanner(ctx, sc, logger)
+				if err != nil {
+					return "", err
+				}
+				ds = append(ds, sds...)
+				names = append(names, sc.Name())
+			}
+			noun := "scanner"
+			if len(names) > 1 {
+				noun = "scanners"
+			}
+			return fmt.Sprintf("found %d devices with %s %s", len(ds), noun, strings.Join(names, ", ")), nil
+		}},
+		{"labels", func(_ context.Context) (string, error) {
+			nl = createLabels(ds)
+			for k, v := range nl {
+				if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+					return "", fmt.Errorf("%w: key %q: %s", errInvalidLabel, k, strings.Join(errs, ", "))
+				}
+				if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+					return "", fmt.Errorf("%w: value of %q: %s", errInvalidLabel, k, strings.Join(errs, ", "))
+				}
+			}
+			return fmt.Sprintf("created %d valid labels", len(nl)), nil
+		}},
+		{"patch", func(ctx context.Context) (string, error) {
+			var err error
+			if node, err = getNode(ctx, clientset); err != nil {
+				return "", err
+			}
+			patch, err := labelPatch(node.Labels, nl, nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to create patch: %w", err)
+			}
+			if labeled, err = clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager, DryRun: []string{metav1.DryRunAll}}); err != nil {
+				return "", fmt.Errorf("dry-run patch failed: %w", err)
+			}
+			if got := filter(labeled.Labels); len(got) != len(nl) {
+				return "", fmt.Errorf("node has %d labels after the dry-run patch, expected %d", len(got), len(nl))
+			}
+			return fmt.Sprintf("dry-run patch of node %s succeeded", node.Name), nil
+		}},
+		{"clean up", func(_ context.Context) (string, error) {
+			patch, err := labelPatch(labeled.Labels, nil, nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to create patch: %w", err)
+			}
+			original, err := json.Marshal(labeled)
+			if err != nil {
+				return "", err
+			}
+			data, err := strategicpatch.StrategicMergePatch(original, patch, v1.Node{})
+			if err != nil {
+				return "", fmt.Errorf("failed to apply patch: %w", err)
+			}
+			var cleaned v1.Node
+			if err := json.Unmarshal(data, &cleaned); err != nil {
+				return "", err
+			}
+			if left := filter(cleaned.Labels); len(left) > 0 {
+				return "", fmt.Errorf("%d labels are left after the clean up", len(left))
+			}
+			return fmt.Sprintf("clean up removes all %d labels", len(filter(labeled.Labels))), nil
+		}},
+	}
+
+	failed := false
+	for _, c := range checks {
+		if failed {
+			fmt.Fprintf(w, "SKIP %s\n", c.name)
+			continue
+		}
+		res, err := c.run(ctx)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Fprintf(w, "PASS %s: %s\n", c.name, res)
+	}
+	if failed {
+		return fmt.Errorf("selftest failed")
+	}
+	return nil
+}
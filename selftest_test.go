@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSelftest(t *testing.T) {
+	old := *hostname
+	*hostname = "node1"
+	t.Cleanup(func() { *hostname = old })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node1",
+		Labels: map[string]string{"other": "x", "nudl.squat.ai/stale": "true"},
+	}})
+	ok := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}, nil
+	}}
+	w := &bytes.Buffer{}
+	require.NoError(t, selftest(context.Background(), w, clientset, []scanner{ok}, log.NewNopLogger()), w.String())
+	assert.Equal(t, `PASS scan: found 1 devices with scanner fake
+PASS labels: created 1 valid labels
+PASS patch: dry-run patch of node node1 succeeded
+PASS clean up: clean up removes all 1 labels
+`, w.String())
+
+	broken := fakeScanner{name: "broken", scan: func(context.Context) ([]device, error) {
+		return nil, errors.New("LIBUSB_ERROR_IO")
+	}}
+	w.Reset()
+	require.Error(t, selftest(context.Background(), w, clientset, []scanner{broken}, log.NewNopLogger()))
+	assert.Equal(t, `FAIL scan: LIBUSB_ERROR_IO
+SKIP labels
+SKIP patch
+SKIP clean up
+`, w.String())
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	flag "github.com/spf13/pflag"
+)
+
+// maxLabelNameLength is the maximum length of the name of a label without prefix.
+const maxLabelNameLength = 63
+
+var includeSerial = flag.Bool("include-serial", false, "append the serial number of every device to its label key, so identical devices can be told apart; the usb scanner opens the devices to read the serial numbers")
+
+// serialKey appends the sanitized serial number to the key of a device, if include-serial is set.
+// If the key would be too long for a label, a hash of the serial number is appended instead.
+func serialKey(key, serial string) string {
+	if !*includeSerial || serial == "" {
+		return key
+	}
+	k := key + "_" + regTrim.ReplaceAllString(serial, "-")
+	if len(k) <= maxLabelNameLength {
+		return k
+	}
+	h := sha256.Sum256([]byte(serial))
+	return key + "_" + hex.EncodeToString(h[:4])
+}
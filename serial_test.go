@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerialKey(t *testing.T) {
+	assert.Equal(t, "10c4_ea60", serialKey("10c4_ea60", "0001"))
+
+	*includeSerial = true
+	defer func() { *includeSerial = false }()
+	for _, tc := range []struct {
+		name   string
+		key    string
+		serial string
+		want   string
+	}{
+		{name: "no serial", key: "10c4_ea60", want: "10c4_ea60"},
+		{name: "serial", key: "10c4_ea60", serial: "0001", want: "10c4_ea60_0001"},
+		{name: "sanitized", key: "10c4_ea60", serial: "E6 61:64", want: "10c4_ea60_E6-61-64"},
+		{name: "hashed", key: "10c4_ea60", serial: strings.Repeat("a", 60), want: "10c4_ea60_11ee3912"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, serialKey(tc.key, tc.serial))
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	listenFailurePolicyExit  = "exit"
+	listenFailurePolicyRetry = "retry"
+
+	maxListenBackoff = time.Minute
+)
+
+var listenFailurePolicy = flag.String("listen-failure-policy", listenFailurePolicyExit, fmt.Sprintf("policy if the listen address can not be bound, %q exits with a non-zero exit code, %q retries with an exponential back off", listenFailurePolicyExit, listenFailurePolicyRetry))
+
+func validateListenFailurePolicy() error {
+	switch *listenFailurePolicy {
+	case listenFailurePolicyExit, listenFailurePolicyRetry:
+		return nil
+	default:
+		return fmt.Errorf("listen failure policy %q unknown; possible values are: %s, %s", *listenFailurePolicy, listenFailurePolicyExit, listenFailurePolicyRetry)
+	}
+}
+
+// validateListenAddress returns an error if an address of listen-address is invalid.
+func validateListenAddress() error {
+	for _, a := range strings.Split(*addr, ",") {
+		a = strings.TrimSpace(a)
+		if path, ok := strings.CutPrefix(a, "unix://"); ok {
+			if path == "" || path == "@" {
+				return fmt.Errorf("invalid --listen-address %q: the path of the unix socket is empty", a)
+			}
+			continue
+		}
+		if strings.HasPrefix(a, "systemd://") {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(a); err != nil {
+			return fmt.Errorf("invalid --listen-address %q: %w", a, err)
+		}
+	}
+	return nil
+}
+
+// listen binds the comma separated addresses, e.g. an IPv4 and an IPv6 address for dual-stack,
+// and accepts connections on all of them.
+// With the retry policy, binding is retried with an exponential back off until it succeeds or the context is done.
+func listen(ctx context.Context, addr string, logger log.Logger) (net.Listener, error) {
+	backoff := time.Second
+	for {
+		l, err := listenAll(strings.Split(addr, ","))
+		if err == nil || *listenFailurePolicy != listenFailurePolicyRetry {
+			return l, err
+		}
+		level.Warn(logger).Log("msg", "could not bind listen address, retrying", "addr", addr, "err", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxListenBackoff)
+	}
+}
+
+// listenAll binds all addresses, or none if one of them can not be bound.
+func listenAll(addrs []string) (net.Listener, error) {
+	ls := make([]net.Listener, 0, len(addrs))
+	for _, a := range addrs {
+		l, err := listenAddress(strings.TrimSpace(a))
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	if len(ls) == 1 {
+		return ls[0], nil
+	}
+	return newMultiListener(ls), nil
+}
+
+// listenAddress binds a single address:
+// unix:///path is a unix domain socket, unix://@name an abstract unix socket on Linux,
+// systemd:// the first socket that systemd passed with socket activation and systemd://<name> the socket with the FileDescriptorName,
+// and every other address is a TCP address, e.g. :8080, which listens on IPv4 and IPv6, or [::1]:8080.
+func listenAddress(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		if !strings.HasPrefix(path, "@") {
+			// Remove the socket of a previous process, but never a file that is not a socket, e.g. after a typo in the path.
+			fi, err := os.Lstat(path)
+			switch {
+			case os.IsNotExist(err):
+			case err != nil:
+				return nil, fmt.Errorf("could not check socket: %w", err)
+			case fi.Mode()&os.ModeSocket == 0:
+				return nil, fmt.Errorf("could not listen on %q, because it exists and is not a socket", path)
+			default:
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return nil, fmt.Errorf("could not remove socket: %w", err)
+				}
+			}
+		}
+		return net.Listen("unix", path)
+	}
+	if name, ok := strings.CutPrefix(addr, "systemd://"); ok {
+		return systemdListener(name)
+	}
+	return net.Listen("tcp", addr)
+}
+
+var systemdListeners struct {
+	once sync.Once
+	ls   map[string][]net.Listener
+	err  error
+}
+
+// systemdListener returns the socket with the name that systemd passed with socket activation, or the first socket if the name is empty.
+// systemd passes the sockets once, so they are read on the first call.
+func systemdListener(name string) (net.Listener, error) {
+	systemdListeners.once.Do(func() {
+		systemdListeners.ls, systemdListeners.err = activation.ListenersWithNames()
+	})
+	if systemdListeners.err != nil {
+		return nil, fmt.Errorf("could not read the sockets of systemd: %w", systemdListeners.err)
+	}
+	var ls []net.Listener
+	if name == "" {
+		for _, nls := range systemdListeners.ls {
+			ls = append(ls, nls...)
+		}
+	} else {
+		ls = systemdListeners.ls[name]
+	}
+	for _, l := range ls {
+		// Sockets that are not stream sockets, e.g. of ListenDatagram, are nil.
+		if l != nil {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("systemd did not pass a socket named %q; is the service started by a .socket unit?", name)
+}
+
+// multiListener accepts connections on several listeners.
+type multiListener struct {
+	ls      []net.Listener
+	accepts chan acceptResult
+	done    chan struct{}
+	once    sync.Once
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(ls []net.Listener) *multiListener {
+	m := &multiListener{ls: ls, accepts: make(chan acceptResult), done: make(chan struct{})}
+	for _, l := range ls {
+		go func() {
+			var delay time.Duration
+			for {
+				c, err := l.Accept()
+				if err != nil && !errors.Is(err, net.ErrClosed) {
+					// Errors like EMFILE are temporary, so they are retried with a backoff like net/http does,
+					// instead of stopping the listener or the server that serves all listeners.
+					delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+					select {
+					case <-time.After(delay):
+						continue
+					case <-m.done:
+						return
+					}
+				}
+				delay = 0
+				select {
+				case m.accepts <- acceptResult{conn: c, err: err}:
+				case <-m.done:
+					if c != nil {
+						c.Close()
+					}
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	return m
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-m.accepts:
+		return r.conn, r.err
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes all listeners.
+func (m *multiListener) Close() error {
+	var errs []error
+	m.once.Do(func() {
+		close(m.done)
+		for _, l := range m.ls {
+			errs = append(errs, l.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Addr returns the address of the first listener.
+func (m *multiListener) Addr() net.Addr {
+	return m.ls[0].Addr()
+}
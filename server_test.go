@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveOK serves a handler that answers ok on the listener until the test ends.
+func serveOK(t *testing.T, l net.Listener) {
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+}
+
+func getOK(t *testing.T, c *http.Client, url string) {
+	res, err := c.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nudl.sock")
+	l, err := listen(context.Background(), "unix://"+path, log.NewNopLogger())
+	require.NoError(t, err)
+	serveOK(t, l)
+
+	c := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", path)
+	}}}
+	getOK(t, c, "http://nudl/metrics")
+
+	// The socket of a previous process is replaced.
+	l, err = listenAddress("unix://" + path)
+	require.NoError(t, err)
+	l.Close()
+
+	// Files that are not sockets are never removed.
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("keep"), 0o644))
+	_, err = listenAddress("unix://" + file)
+	assert.Error(t, err)
+	assert.FileExists(t, file)
+}
+
+func TestListenMultiple(t *testing.T) {
+	l, err := listen(context.Background(), "127.0.0.1:0, 127.0.0.1:0", log.NewNopLogger())
+	require.NoError(t, err)
+	ml, ok := l.(*multiListener)
+	require.True(t, ok)
+	serveOK(t, l)
+
+	for _, l := range ml.ls {
+		getOK(t, http.DefaultClient, "http://"+l.Addr().String())
+	}
+	require.NoError(t, ml.Close())
+	_, err = ml.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+// flakyListener fails the first accepts with a temporary error, e.g. EMFILE.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, syscall.EMFILE
+	}
+	return l.Listener.Accept()
+}
+
+func TestMultiListenerTemporaryError(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ml := newMultiListener([]net.Listener{&flakyListener{Listener: tcp, failures: 3}})
+	serveOK(t, ml)
+	// The listener keeps accepting after the temporary errors.
+	getOK(t, http.DefaultClient, "http://"+tcp.Addr().String())
+	require.NoError(t, ml.Close())
+}
+
+func TestListenAllClosesOnError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+	_, err = listenAll([]string{"127.0.0.1:0", taken.Addr().String()})
+	assert.Error(t, err)
+}
+
+func TestValidateListenAddress(t *testing.T) {
+	old := *addr
+	t.Cleanup(func() { *addr = old })
+	for a, valid := range map[string]bool{
+		":8080":                          true,
+		"[::1]:8080,127.0.0.1:8080":      true,
+		"unix:///run/nudl/metrics.sock":  true,
+		"unix://@nudl":                   true,
+		"systemd://":                     true,
+		"systemd://metrics":              true,
+		"unix://":                        false,
+		"8080":                           false,
+		":8080,unix:///run/nudl.sock,::": false,
+	} {
+		*addr = a
+		if valid {
+			assert.NoError(t, validateListenAddress(), a)
+		} else {
+			assert.Error(t, validateListenAddress(), a)
+		}
+	}
+}
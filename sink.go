@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	sinkKubernetes = "kubernetes"
+	sinkNFD        = "nfd"
+	sinkFile       = "file"
+	sinkStdout     = "stdout"
+)
+
+var (
+	sinkName = flag.String("sink", sinkKubernetes, fmt.Sprintf("where the labels are written to: %s labels the node, %s applies them to a NodeFeature of Node Feature Discovery in --nfd-namespace, %s writes them to --sink-path, %s prints them as JSON lines, so nudl can run without Kubernetes", sinkKubernetes, sinkNFD, sinkFile, sinkStdout))
+	sinkPath = flag.String("sink-path", "/etc/kubernetes/node-feature-discovery/features.d/nudl", "path of the file the labels are written to as <key>=<value> lines, if sink is "+sinkFile)
+)
+
+// sink receives the labels instead of the node.
+type sink interface {
+	Write(context.Context, labels) error
+	// Clean removes the labels, when nudl shuts down.
+	Clean(context.Context) error
+}
+
+// needsKubeConfig returns true if the sink needs the Kubernetes api.
+func needsKubeConfig() bool {
+	return *sinkName == sinkKubernetes || *sinkName == sinkNFD
+}
+
+// newSink returns the sink of the sink flag, or nil if the node is labeled.
+// The config is only used by sinks that need the Kubernetes api.
+func newSink(config *rest.Config) (sink, error) {
+	switch *sinkName {
+	case sinkKubernetes:
+		return nil, nil
+	case sinkNFD:
+		return newNFDSink(config)
+	case sinkFile:
+		return &fileSink{path: *sinkPath}, nil
+	case sinkStdout:
+		return &writerSink{w: os.Stdout}, nil
+	default:
+		return nil, fmt.Errorf("sink %q unknown; possible values are: %s, %s, %s, %s", *sinkName, sinkKubernetes, sinkNFD, sinkFile, sinkStdout)
+	}
+}
+
+// validateSink returns an error if a feature that needs the node is enabled without the kubernetes sink,
+// or a feature that needs the Kubernetes api is enabled with a sink that does not need it.
+func validateSink() error {
+	if *sinkName == sinkKubernetes {
+		return nil
+	}
+	if *sinkName == sinkNFD && *nfdNodeFeature {
+		return fmt.Errorf("nfd-nodefeature and the %s sink are mutually exclusive, because both apply the NodeFeature", sinkNFD)
+	}
+	features := map[string]bool{
+		"node-conditions":      *nodeConditions,
+		"health-condition":     *healthCondition,
+		"cordon-missing":       *cordonMissing,
+		"taint-when-missing":   *taintWhenMissing != "",
+		"extended-resources":   *extendedResources,
+		"audit-log":            *auditLogPath != "",
+		"inventory-annotation": *inventoryAnnotation,
+		"last-seen-annotation": *lastSeenAnnotation,
+		"label-snapshot":       *labelSnapshot,
+		"rollback":             *rollback,
+	}
+	if !needsKubeConfig() {
+		features["nfd-nodefeature"] = *nfdNodeFeature
+		features["akri-configuration"] = *akriConfiguration != ""
+		features["usb-inventory"] = *usbInventory
+		features["node-events"] = *nodeEvents
+		features["generic-device-plugin-configmap"] = *gdpConfigMap != ""
+	}
+	for f, enabled := range features {
+		if enabled {
+			return fmt.Errorf("%s is not available with the %s sink", f, *sinkName)
+		}
+	}
+	return nil
+}
+
+// fileSink writes the labels as <key>=<value> lines, the format of the local feature files of node-feature-discovery.
+type fileSink struct {
+	path string
+}
+
+// Write replaces the file atomically, so readers never see a partially written file.
+func (s *fileSink) Write(_ context.Context, l labels) error {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, l[k])
+	}
+	return writeFileAtomic(s.path, []byte(b.String()))
+}
+
+// writeFileAtomic replaces the file at path with a temporary file in the same directory,
+// so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %q: %w", f.Name(), err)
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return fmt.Errorf("could not change mode of %q: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not close %q: %w", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not replace %q: %w", path, err)
+	}
+	return nil
+}
+
+func (s *fileSink) Clean(_ context.Context) error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove %q: %w", s.path, err)
+	}
+	return nil
+}
+
+// writerSink writes the labels as JSON lines.
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Write(_ context.Context, l labels) error {
+	if l == nil {
+		l = labels{}
+	}
+	return json.NewEncoder(s.w).Encode(l)
+}
+
+// Clean writes empty labels.
+func (s *writerSink) Clean(ctx context.Context) error {
+	return s.Write(ctx, nil)
+}
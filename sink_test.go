@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	s := &fileSink{path: filepath.Join(dir, "nudl")}
+
+	require.NoError(t, s.Write(context.Background(), labels{"nudl.squat.ai/b": "true", "nudl.squat.ai/a": "2"}))
+	data, err := os.ReadFile(s.path)
+	require.NoError(t, err)
+	assert.Equal(t, "nudl.squat.ai/a=2\nnudl.squat.ai/b=true\n", string(data))
+
+	require.NoError(t, s.Write(context.Background(), labels{}))
+	data, err = os.ReadFile(s.path)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, s.Clean(context.Background()))
+	assert.NoFileExists(t, s.path)
+	require.NoError(t, s.Clean(context.Background()))
+}
+
+func TestLabelerSink(t *testing.T) {
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "046d_c52b", Key: "Logitech_Receiver"}}, nil
+	}}
+	// Without the kubernetes sink, there is no clientset.
+	lb := newLabeler(nil, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	var out bytes.Buffer
+	lb.sink = &writerSink{w: &out}
+	ctx := context.Background()
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	require.NoError(t, lb.health.ready())
+	require.NoError(t, lb.cleanUp(ctx, log.NewNopLogger()))
+	assert.Equal(t, "{\"nudl.squat.ai/Logitech_Receiver\":\"true\"}\n{}\n", out.String())
+}
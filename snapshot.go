@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	labelSnapshot = flag.Bool("label-snapshot", false, "before the first patch, save the labels of the node with the prefix in an annotation, so they can be restored with --rollback, e.g. after a bad rules file replaced curated labels")
+	rollback      = flag.Bool("rollback", false, "restore the labels of the node with the prefix from the snapshot of label-snapshot, delete the snapshot and exit")
+)
+
+// labelSnapshotAnnotationKey returns the key of the annotation that holds the labels before the first patch.
+func labelSnapshotAnnotationKey() string {
+	return sprintLabelKey("label-snapshot")
+}
+
+// snapshot is the value of the label snapshot annotation.
+type snapshot struct {
+	Time   time.Time `json:"time"`
+	Labels labels    `json:"labels"`
+}
+
+// snapshotAnnotations returns the annotations to patch.
+// The snapshot is only written if the node has none, so it keeps the labels from before nudl first labeled the node.
+// The annotation is deleted if label-snapshot is not set. It is kept if the node is cleaned up, so the labels can still be restored.
+func snapshotAnnotations(current, currentLabels map[string]string, now time.Time, clean bool) (map[string]*string, error) {
+	k := labelSnapshotAnnotationKey()
+	_, exists := current[k]
+	if !*labelSnapshot {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	if exists || clean {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot{Time: now.UTC().Truncate(time.Second), Labels: filter(currentLabels)})
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	return map[string]*string{k: &s}, nil
+}
+
+// rollbackPatch returns a strategic merge patch that restores the labels with the prefix of the snapshot of the node
+// and deletes the snapshot.
+// The resource version makes the patch fail, if the labels were changed concurrently.
+func rollbackPatch(node *v1.Node) ([]byte, error) {
+	v, ok := node.Annotations[labelSnapshotAnnotationKey()]
+	if !ok {
+		return nil, fmt.Errorf("node %q has no label snapshot", node.Name)
+	}
+	var s snapshot
+	if err := json.Unmarshal([]byte(v), &s); err != nil {
+		return nil, fmt.Errorf("could not parse the label snapshot of node %q: %w", node.Name, err)
+	}
+	ls := make(map[string]*string)
+	for k := range filter(node.Labels) {
+		ls[k] = nil
+	}
+	for k, v := range s.Labels {
+		if !managedPrefix(k) || preserved(k) {
+			continue
+		}
+		ls[k] = &v
+	}
+	metadata := map[string]interface{}{
+		"labels":      ls,
+		"annotations": map[string]*string{labelSnapshotAnnotationKey(): nil},
+	}
+	if node.ResourceVersion != "" {
+		metadata["resourceVersion"] = node.ResourceVersion
+	}
+	return json.Marshal(map[string]interface{}{"metadata": metadata})
+}
+
+// rollbackNode restores the labels of the snapshot of the node.
+// A node that a nudl instance still labels is not rolled back, because the instance would label it again.
+func rollbackNode(ctx context.Context, clientset kubernetes.Interface, name string, now time.Time, w io.Writer, logger log.Logger) error {
+	node, err := getNamedNode(ctx, clientset, name)
+	if err != nil {
+		return err
+	}
+	if o, _ := checkOwner(node.Annotations, "", now); o != nil {
+		return fmt.Errorf("not rolling back node %q, because nudl instance %s still labels it", name, o.ID)
+	}
+	patch, err := rollbackPatch(node)
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		nn, err := clientset.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+		if err != nil {
+			return fmt.Errorf("could not patch node %q: %w", name, err)
+		}
+		audit(name, "rollback", filter(node.Labels), filter(nn.Labels), nil)
+		level.Info(logger).Log("msg", "successfully restored the label snapshot", "node", name)
+	}
+	if err := json.NewEncoder(w).Encode(cleanupResult{Node: name, Patch: patch}); err != nil {
+		return fmt.Errorf("could not print patch: %w", err)
+	}
+	return nil
+}
+
+// rollbackNodes restores the label snapshots of the nodes and returns the errors of all nodes.
+func rollbackNodes(ctx context.Context, clientset kubernetes.Interface, w io.Writer, logger log.Logger) error {
+	names, err := (&labeler{clientset: clientset}).targetNodes(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		errs = append(errs, retryNodeUpdate(ctx, "rollback", func() error {
+			return rollbackNode(ctx, clientset, name, time.Now(), w, log.With(logger, "node", name))
+		}, logger))
+	}
+	return errors.Join(errs...)
+}
+
+// runRollback restores the labels from before nudl first labeled the nodes,
+// e.g. after a misconfiguration replaced curated labels.
+func runRollback(logger log.Logger) error {
+	config, err := newKubeConfig(logger)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("could not create kubernetes clientset: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if *hostname == "" && !multiNode() {
+		n, err := newNodeNameDetector(clientset).detect(ctx, logger)
+		if err != nil {
+			return err
+		}
+		*hostname = n
+	}
+	return rollbackNodes(ctx, clientset, os.Stdout, logger)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestLabelSnapshot(t *testing.T) {
+	oldHostname, oldSnapshot := *hostname, *labelSnapshot
+	*hostname, *labelSnapshot = "node1", true
+	t.Cleanup(func() { *hostname, *labelSnapshot = oldHostname, oldSnapshot })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name: "node1",
+		Labels: map[string]string{
+			"other":                  "x",
+			"nudl.squat.ai/rack":     "a",
+			"nudl.squat.ai/Receiver": "true",
+		},
+	}})
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return []device{{ID: "2341_0043", Key: "Arduino"}}, nil
+	}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(now), nil, s)
+	ctx := context.Background()
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"other": "x", "nudl.squat.ai/Arduino": "true"}, n.Labels)
+	assert.JSONEq(t, `{"time":"2024-05-01T12:00:00Z","labels":{"nudl.squat.ai/rack":"a","nudl.squat.ai/Receiver":"true"}}`, n.Annotations[labelSnapshotAnnotationKey()])
+
+	// The snapshot keeps the labels from before the first patch.
+	a, err := snapshotAnnotations(n.Annotations, n.Labels, now.Add(time.Hour), false)
+	require.NoError(t, err)
+	assert.Empty(t, a)
+
+	// The labeling instance is still alive.
+	var b bytes.Buffer
+	require.Error(t, rollbackNode(ctx, clientset, "node1", now, &b, log.NewNopLogger()))
+
+	require.NoError(t, rollbackNode(ctx, clientset, "node1", now.Add(time.Hour), &b, log.NewNopLogger()))
+	n, err = clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"other": "x", "nudl.squat.ai/rack": "a", "nudl.squat.ai/Receiver": "true"}, n.Labels)
+	assert.NotContains(t, n.Annotations, labelSnapshotAnnotationKey())
+
+	// Without a snapshot, there is nothing to roll back.
+	require.Error(t, rollbackNode(ctx, clientset, "node1", now.Add(time.Hour), &b, log.NewNopLogger()))
+
+	*labelSnapshot = false
+	a, err = snapshotAnnotations(map[string]string{labelSnapshotAnnotationKey(): "{}"}, nil, now, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{labelSnapshotAnnotationKey(): nil}, a)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// soundPrefix is the prefix of the ids and keys of sound cards, so they can not be confused with usb devices.
+const soundPrefix = "sound-card-"
+
+var scanSound = flag.Bool("scan-sound", false, "additionally label the node with the ALSA sound cards in sysfs at --sysfs-root by their bus, e.g. nudl.squat.ai/sound-card-usb=true for a usb audio interface or nudl.squat.ai/sound-card-hdmi=true for HDMI audio")
+
+// isSound returns true for sound cards.
+func isSound(d device) bool {
+	return strings.HasPrefix(d.ID, soundPrefix)
+}
+
+// soundKind returns the kind of a sound card from its id and the subsystem of its parent device,
+// e.g. hdmi for the cards of HDMI outputs, usb, pci or platform.
+func soundKind(id, subsystem string) string {
+	if strings.Contains(strings.ToLower(id), "hdmi") {
+		return "hdmi"
+	}
+	if subsystem == "" {
+		return "unknown"
+	}
+	return subsystem
+}
+
+// soundScanner scans the sound cards by reading sysfs.
+type soundScanner struct {
+	root string
+}
+
+func (*soundScanner) Name() string {
+	return "sound"
+}
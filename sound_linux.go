@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// regSoundCard matches the names of sound cards in sysfs, e.g. card0.
+// The devices of the cards, e.g. pcmC0D0p or controlC0, are not labeled.
+var regSoundCard = regexp.MustCompile(`^card[0-9]+$`)
+
+// Scan returns the sound cards, e.g. card0.
+// A node without sound cards, e.g. because ALSA is not loaded, has no devices.
+func (s *soundScanner) Scan(_ context.Context) ([]device, error) {
+	dir := filepath.Join(s.root, "class", "sound")
+	es, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not list sound cards: %w", err)
+	}
+	var ds []device
+	for _, e := range es {
+		if !regSoundCard.MatchString(e.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), "id"))
+		if os.IsNotExist(err) {
+			// The card was removed while scanning.
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read id of %q: %w", e.Name(), err)
+		}
+		id := strings.TrimSpace(string(data))
+		var subsystem string
+		if link, err := os.Readlink(filepath.Join(dir, e.Name(), "device", "subsystem")); err == nil {
+			subsystem = filepath.Base(link)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not read subsystem of %q: %w", e.Name(), err)
+		}
+		k := soundPrefix + regTrim.ReplaceAllString(soundKind(id, subsystem), "-")
+		d := device{
+			ID:          k,
+			Key:         k,
+			Description: fmt.Sprintf("%s (%s)", id, e.Name()),
+			Port:        e.Name(),
+		}
+		if *driverLabels {
+			link, err := os.Readlink(filepath.Join(dir, e.Name(), "device", "driver"))
+			if err == nil {
+				d.Drivers = []string{filepath.Base(link)}
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("could not read driver of %q: %w", e.Name(), err)
+			}
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoundScanner(t *testing.T) {
+	root := t.TempDir()
+	for card, c := range map[string]struct{ id, subsystem, driver string }{
+		"card0": {"HDMI", "pci", "snd_hda_intel"},
+		"card1": {"PCH", "pci", "snd_hda_intel"},
+		"card2": {"Device", "usb", "snd-usb-audio"},
+		"card3": {"Headphones", "", ""},
+	} {
+		dir := filepath.Join(root, "class", "sound", card)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "device"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "id"), []byte(c.id+"\n"), 0o644))
+		if c.subsystem != "" {
+			require.NoError(t, os.Symlink(filepath.Join("..", "bus", c.subsystem), filepath.Join(dir, "device", "subsystem")))
+			require.NoError(t, os.Symlink(filepath.Join("..", "bus", c.subsystem, "drivers", c.driver), filepath.Join(dir, "device", "driver")))
+		}
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "class", "sound", "controlC0"), 0o755))
+	*driverLabels = true
+	defer func() { *driverLabels = false }()
+
+	ds, err := (&soundScanner{root: root}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []device{
+		{ID: "sound-card-hdmi", Key: "sound-card-hdmi", Description: "HDMI (card0)", Port: "card0", Drivers: []string{"snd_hda_intel"}},
+		{ID: "sound-card-pci", Key: "sound-card-pci", Description: "PCH (card1)", Port: "card1", Drivers: []string{"snd_hda_intel"}},
+		{ID: "sound-card-usb", Key: "sound-card-usb", Description: "Device (card2)", Port: "card2", Drivers: []string{"snd-usb-audio"}},
+		{ID: "sound-card-unknown", Key: "sound-card-unknown", Description: "Headphones (card3)", Port: "card3"},
+	}, ds)
+	assert.False(t, isUSB(ds[2]))
+	assert.Equal(t, "sound", newLabelTemplateData(ds[2]).Bus)
+
+	// A node without ALSA has no sound cards.
+	ds, err = (&soundScanner{root: t.TempDir()}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+}
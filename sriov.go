@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+)
+
+var sriov = flag.Bool("sriov", false, "label the node with the number of configured and total SR-IOV virtual functions of its network interfaces")
+
+// labelsFingerprint returns a hash of the labels that is independent of their order.
+func labelsFingerprint(l labels) uint64 {
+	ks := make([]string, 0, len(l))
+	for k := range l {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	h := fnv.New64a()
+	for _, k := range ks {
+		fmt.Fprintf(h, "%s=%s\n", k, l[k])
+	}
+	return h.Sum64()
+}
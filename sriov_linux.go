@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// sriovLabels returns labels with the number of configured and total virtual functions
+// for every network interface whose PCI device is SR-IOV capable.
+func sriovLabels(root string) (labels, error) {
+	ifaces, err := os.ReadDir(filepath.Join(root, "class", "net"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list network interfaces: %w", err)
+	}
+	l := make(labels)
+	for _, iface := range ifaces {
+		dev := filepath.Join(root, "class", "net", iface.Name(), "device")
+		total, err := readSysfsInt(filepath.Join(dev, "sriov_totalvfs"))
+		if os.IsNotExist(err) {
+			// The interface is not backed by an SR-IOV capable PCI device.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if total == 0 {
+			continue
+		}
+		configured, err := readSysfsInt(filepath.Join(dev, "sriov_numvfs"))
+		if err != nil {
+			return nil, err
+		}
+		name := regTrim.ReplaceAllString(iface.Name(), "_")
+		l[sprintLabelKey(fmt.Sprintf("sriov.%s.total-vfs", name))] = strconv.Itoa(total)
+		l[sprintLabelKey(fmt.Sprintf("sriov.%s.configured-vfs", name))] = strconv.Itoa(configured)
+	}
+	if len(l) > 0 {
+		l[sprintLabelKey("sriov")] = "true"
+	}
+	return l, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSRIOVLabels(t *testing.T) {
+	root := t.TempDir()
+	for iface, files := range map[string]map[string]string{
+		"eth0": {"sriov_totalvfs": "8\n", "sriov_numvfs": "4\n"},
+		"eth1": {"sriov_totalvfs": "0\n", "sriov_numvfs": "0\n"},
+		"eth2": {"vendor": "0x8086\n"},
+	} {
+		dev := filepath.Join(root, "class", "net", iface, "device")
+		require.NoError(t, os.MkdirAll(dev, 0o755))
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dev, name), []byte(content), 0o644))
+		}
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "class", "net", "lo"), 0o755))
+
+	l, err := sriovLabels(root)
+	require.NoError(t, err)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/sriov":                     "true",
+		"nudl.squat.ai/sriov.eth0.total-vfs":      "8",
+		"nudl.squat.ai/sriov.eth0.configured-vfs": "4",
+	}, l)
+}
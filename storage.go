@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// storagePrefix is the prefix of the ids and keys of block devices, so they can not be confused with usb devices.
+const storagePrefix = "storage-"
+
+var (
+	scanStorage        = flag.Bool("scan-storage", false, "additionally label the node with the removable and usb block devices in sysfs at --sysfs-root, e.g. nudl.squat.ai/storage-usb=true for a usb stick, and their sizes with --storage-size-buckets")
+	storageSizeBuckets = flag.IntSlice("storage-size-buckets", []int{16, 32, 64, 128, 256, 512, 1000, 2000}, "sizes in GB of the labels <key>-gte-<size>gb=true for block devices that are at least that large, if scan-storage is set")
+)
+
+// storageSizeTolerance is the share of the nominal size that media must have to count for a size bucket,
+// because e.g. a 64 GB usb stick has less than 64 GB of capacity.
+const storageSizeTolerance = 0.9
+
+// isStorage returns true for block devices.
+func isStorage(d device) bool {
+	return strings.HasPrefix(d.ID, storagePrefix)
+}
+
+// validateStorageSizeBuckets returns an error if a size bucket is not positive.
+func validateStorageSizeBuckets() error {
+	for _, b := range *storageSizeBuckets {
+		if b <= 0 {
+			return fmt.Errorf("storage size bucket %d must be positive", b)
+		}
+	}
+	return nil
+}
+
+// addStorageSizeLabels adds a label <key>-gte-<size>gb=true for every size bucket,
+// if one of the block devices with the key that is labeled is at least as large.
+func addStorageSizeLabels(l labels, ds []device) {
+	largest := make(map[string]uint64)
+	for _, d := range ds {
+		if !isStorage(d) {
+			continue
+		}
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		largest[d.Key] = max(largest[d.Key], d.Size)
+	}
+	for k, size := range largest {
+		for _, b := range *storageSizeBuckets {
+			if float64(size) >= float64(b)*1e9*storageSizeTolerance {
+				l[sprintLabelKey(fmt.Sprintf("%s-gte-%dgb", k, b))] = "true"
+			}
+		}
+	}
+}
+
+// storageScanner scans the block devices by reading sysfs.
+type storageScanner struct {
+	root string
+}
+
+func (*storageScanner) Name() string {
+	return "storage"
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Scan returns the block devices that are removable or attached over usb, e.g. sda, and that contain media.
+// Partitions are not in /sys/block, and virtual block devices, e.g. loop0, are skipped.
+func (s *storageScanner) Scan(_ context.Context) ([]device, error) {
+	dir := filepath.Join(s.root, "block")
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list block devices: %w", err)
+	}
+	var ds []device
+	for _, e := range es {
+		d, ok, err := readBlockDevice(filepath.Join(dir, e.Name()))
+		if os.IsNotExist(err) {
+			// The device was removed while scanning.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if ok {
+			ds = append(ds, d)
+		}
+	}
+	return ds, nil
+}
+
+// readBlockDevice returns the block device in the sysfs directory, if it is removable or attached over usb and contains media.
+func readBlockDevice(dir string) (device, bool, error) {
+	name := filepath.Base(dir)
+	path, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return device{}, false, err
+	}
+	if strings.Contains(path, "/devices/virtual/") {
+		return device{}, false, nil
+	}
+	removable, err := os.ReadFile(filepath.Join(dir, "removable"))
+	if err != nil {
+		return device{}, false, err
+	}
+	usb := strings.Contains(path, "/usb")
+	if !usb && strings.TrimSpace(string(removable)) != "1" {
+		return device{}, false, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "size"))
+	if err != nil {
+		return device{}, false, err
+	}
+	// The size is in 512 byte sectors regardless of the block size of the device.
+	sectors, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return device{}, false, fmt.Errorf("could not parse size of %q: %w", name, err)
+	}
+	// Card readers without a card have no media.
+	if sectors == 0 {
+		return device{}, false, nil
+	}
+	k := storagePrefix + "removable"
+	if usb {
+		k = storagePrefix + "usb"
+	}
+	d := device{
+		ID:          k,
+		Key:         k,
+		Description: fmt.Sprintf("%s (%s)", blockAttr(dir, "model", "name"), blockAttr(dir, "vendor", "manfid")),
+		Port:        name,
+		Size:        sectors * 512,
+	}
+	if *driverLabels {
+		link, err := os.Readlink(filepath.Join(dir, "device", "driver"))
+		if err == nil {
+			d.Drivers = []string{filepath.Base(link)}
+		} else if !os.IsNotExist(err) {
+			return device{}, false, fmt.Errorf("could not read driver of %q: %w", name, err)
+		}
+	}
+	return d, true, nil
+}
+
+// blockAttr returns the first of the attributes of the parent device of a block device that is not empty,
+// e.g. the model of a scsi disk or the name of an mmc card, or Unknown.
+func blockAttr(dir string, attrs ...string) string {
+	for _, a := range attrs {
+		if data, err := os.ReadFile(filepath.Join(dir, "device", a)); err == nil {
+			if v := strings.TrimSpace(string(data)); v != "" {
+				return v
+			}
+		}
+	}
+	return "Unknown"
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageScanner(t *testing.T) {
+	root := t.TempDir()
+	for path, files := range map[string]map[string]string{
+		"devices/pci0000:00/usb1/1-1/host0/target0:0:0/0:0:0:0/block/sda":          {"removable": "1\n", "size": "120176640\n", "device/model": "Ultra Fit       \n", "device/vendor": "SanDisk \n"},
+		"devices/pci0000:00/usb1/1-2/host1/target1:0:0/1:0:0:0/block/sdb":          {"removable": "1\n", "size": "0\n"},
+		"devices/pci0000:00/usb1/1-3/host2/target2:0:0/2:0:0:0/block/sdc":          {"removable": "0\n", "size": "1953525168\n", "device/model": "Portable SSD T5\n", "device/vendor": "Samsung\n"},
+		"devices/pci0000:00/0000:00:17.0/ata1/host3/target3:0:0/3:0:0:0/block/sdd": {"removable": "0\n", "size": "1953525168\n"},
+		"devices/platform/emmc2bus/mmc1/mmc1:aaaa/block/mmcblk1":                   {"removable": "1\n", "size": "31116288\n", "device/name": "SC16G\n"},
+		"devices/virtual/block/loop0":                                              {"removable": "1\n", "size": "8\n"},
+	} {
+		dir := filepath.Join(root, path)
+		for f, content := range files {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, f), []byte(content), 0o644))
+		}
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "block"), 0o755))
+		require.NoError(t, os.Symlink(filepath.Join("..", path), filepath.Join(root, "block", filepath.Base(path))))
+	}
+
+	ds, err := (&storageScanner{root: root}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []device{
+		{ID: "storage-removable", Key: "storage-removable", Description: "SC16G (Unknown)", Port: "mmcblk1", Size: 15931539456},
+		{ID: "storage-usb", Key: "storage-usb", Description: "Ultra Fit (SanDisk)", Port: "sda", Size: 61530439680},
+		{ID: "storage-usb", Key: "storage-usb", Description: "Portable SSD T5 (Samsung)", Port: "sdc", Size: 1000204886016},
+	}, ds)
+	assert.False(t, isUSB(ds[0]))
+
+	*scanStorage = true
+	defer func() { *scanStorage = false }()
+	assert.Equal(t, labels{
+		"nudl.squat.ai/storage-removable":          "true",
+		"nudl.squat.ai/storage-usb":                "true",
+		"nudl.squat.ai/storage-usb-gte-16gb":       "true",
+		"nudl.squat.ai/storage-usb-gte-32gb":       "true",
+		"nudl.squat.ai/storage-usb-gte-64gb":       "true",
+		"nudl.squat.ai/storage-usb-gte-128gb":      "true",
+		"nudl.squat.ai/storage-usb-gte-256gb":      "true",
+		"nudl.squat.ai/storage-usb-gte-512gb":      "true",
+		"nudl.squat.ai/storage-usb-gte-1000gb":     "true",
+		"nudl.squat.ai/storage-removable-gte-16gb": "true",
+	}, createLabels(ds))
+	// Media of a different size changes the fingerprint.
+	assert.NotEqual(t, fingerprint(ds), fingerprint(ds[:2]))
+	assert.NotEqual(t, fingerprint(ds[:1]), fingerprint([]device{{ID: "storage-removable", Size: 1}}))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventoryStore(t *testing.T) {
+	ctx := context.Background()
+	s, err := openInventoryStore(ctx, databaseDriverSQLite, filepath.Join(t.TempDir(), "nudl.db"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	a := device{ID: "a_a", Key: "a"}
+	b := device{ID: "b_b", Key: "b"}
+	start := time.Now().Truncate(time.Second)
+	for i, ds := range [][]device{{a, a}, {a, a, b}, {a}} {
+		require.NoError(t, s.upsert(ctx, inventory{Node: "node", Time: start.Add(time.Duration(i) * time.Minute), Devices: ds}))
+	}
+	require.NoError(t, s.upsert(ctx, inventory{Node: "other", Time: start, Devices: []device{b}}))
+
+	type row struct {
+		id       string
+		idx      int
+		detached bool
+	}
+	var got []row
+	rows, err := s.db.QueryContext(ctx, `SELECT device_id, idx, detached_at FROM devices WHERE node = 'node' ORDER BY device_id, idx`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var r row
+		var detached sql.NullTime
+		require.NoError(t, rows.Scan(&r.id, &r.idx, &detached))
+		r.detached = detached.Valid
+		got = append(got, r)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []row{{"a_a", 0, false}, {"a_a", 1, true}, {"b_b", 0, true}}, got)
+
+	present, absent := true, false
+	for _, tc := range []struct {
+		name   string
+		filter deviceFilter
+		offset int
+		limit  int
+		want   int
+	}{
+		{name: "all", limit: 10, want: 4},
+		{name: "node", filter: deviceFilter{node: "node"}, limit: 10, want: 3},
+		{name: "vendor", filter: deviceFilter{vendor: "b"}, limit: 10, want: 2},
+		{name: "product", filter: deviceFilter{product: "a"}, limit: 10, want: 2},
+		{name: "present", filter: deviceFilter{present: &present}, limit: 10, want: 2},
+		{name: "absent", filter: deviceFilter{present: &absent}, limit: 10, want: 2},
+		{name: "page", offset: 3, limit: 2, want: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rs, err := s.list(ctx, tc.filter, tc.offset, tc.limit)
+			require.NoError(t, err)
+			assert.Len(t, rs, tc.want)
+		})
+	}
+}
+
+func TestRebind(t *testing.T) {
+	s := &inventoryStore{driver: databaseDriverPostgres}
+	assert.Equal(t, "SELECT * FROM devices WHERE node = $1 AND idx = $2", s.rebind("SELECT * FROM devices WHERE node = ? AND idx = ?"))
+	s.driver = databaseDriverSQLite
+	assert.Equal(t, "SELECT ?", s.rebind("SELECT ?"))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// usbBackendLibusb scans usb devices with libusb, which needs to open the devices.
+	usbBackendLibusb = "libusb"
+	// usbBackendSysfs scans usb devices by reading their descriptors from sysfs.
+	usbBackendSysfs = "sysfs"
+)
+
+var (
+	sysfsRoot    = flag.String("sysfs-root", "/sys", "path where sysfs is mounted")
+	usbBackend   = flag.String("usb-backend", defaultUSBBackend(), fmt.Sprintf("backend that scans the usb devices; possible values are: %s, which needs cgo, %s, which reads sysfs, so neither root, capabilities nor access to /dev/bus/usb are needed; defaults to %s in builds without cgo", usbBackendLibusb, usbBackendSysfs, usbBackendSysfs))
+	unprivileged = flag.Bool("unprivileged", false, "shorthand for --usb-backend="+usbBackendSysfs)
+)
+
+var disabledFeatureGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "nudl_disabled_features",
+		Help: "Features that are disabled, because they need to open devices, which the sysfs backend does not",
+	},
+	[]string{"feature"},
+)
+
+// defaultUSBBackend returns libusb, or sysfs if nudl was built without cgo, e.g. as a static binary.
+func defaultUSBBackend() string {
+	if !libusbAvailable {
+		return usbBackendSysfs
+	}
+	return usbBackendLibusb
+}
+
+// sysfsBackend returns true if the usb devices are scanned from sysfs.
+func sysfsBackend() bool {
+	return *unprivileged || *usbBackend == usbBackendSysfs
+}
+
+// validateUSBBackend returns an error if the usb backend is unknown or contradicts unprivileged.
+func validateUSBBackend() error {
+	switch *usbBackend {
+	case usbBackendLibusb:
+		if !libusbAvailable && !*unprivileged {
+			return fmt.Errorf("usb backend %s needs cgo, but nudl was built without cgo", usbBackendLibusb)
+		}
+		if *unprivileged && flag.CommandLine.Changed("usb-backend") {
+			return fmt.Errorf("unprivileged requires the usb backend %s", usbBackendSysfs)
+		}
+	case usbBackendSysfs:
+	default:
+		return fmt.Errorf("usb backend %q unknown; possible values are: %s, %s", *usbBackend, usbBackendLibusb, usbBackendSysfs)
+	}
+	return nil
+}
+
+// newUSBScanner returns the usb scanner of the backend.
+// With the sysfs backend, features that need to open devices are disabled.
+func newUSBScanner(logger log.Logger) scanner {
+	if !sysfsBackend() {
+		return &usbScanner{}
+	}
+	if *usbDebug > 0 {
+		disableFeature("usb-debug", logger)
+	}
+	return sysfsScanner{root: *sysfsRoot}
+}
+
+// disableFeature logs and counts a feature that is disabled with the sysfs backend.
+func disableFeature(feature string, logger log.Logger) {
+	level.Warn(logger).Log("msg", "feature is disabled with the sysfs backend, because it needs to open devices", "feature", feature)
+	disabledFeatureGauge.WithLabelValues(feature).Set(1)
+}
+
+// sysfsScanner scans usb devices by reading their descriptors from sysfs.
+// It only needs read access to sysfs, which is available in unprivileged containers.
+type sysfsScanner struct {
+	root string
+}
+
+func (sysfsScanner) Name() string {
+	return "sysfs"
+}
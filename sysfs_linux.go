@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validateSysfs always succeeds, because sysfs is available on Linux.
+func validateSysfs() error {
+	return nil
+}
+
+// Scan returns the usb devices, including root hubs, like libusb does.
+func (s sysfsScanner) Scan(_ context.Context) ([]device, error) {
+	dir := filepath.Join(s.root, "bus", "usb", "devices")
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list usb devices: %w", err)
+	}
+	var ds []device
+	for _, e := range es {
+		// Interfaces, e.g. 1-1:1.0, are not devices.
+		if strings.Contains(e.Name(), ":") {
+			continue
+		}
+		desc, err := readSysfsDesc(filepath.Join(dir, e.Name()))
+		if os.IsNotExist(err) {
+			// The device was detached while scanning.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		n := lookupName(desc.id)
+		if *readStringDescriptors {
+			m, p := sysfsStrings(filepath.Join(dir, e.Name()))
+			n = stringName(desc.id, n, m, p)
+		}
+		d := device{
+			ID:          desc.id.String(),
+			Key:         n.key,
+			Description: n.description,
+			Port:        e.Name(),
+			Class:       fmt.Sprintf("%02x", desc.class),
+		}
+		if d.Classes, err = sysfsClasses(filepath.Join(dir, e.Name()), desc); err != nil {
+			return nil, err
+		}
+		// The device number is optional.
+		if a, err := readSysfsInt(filepath.Join(dir, e.Name(), "devnum")); err == nil {
+			d.Address = a
+		}
+		// The device release number is optional.
+		if v, err := readSysfsHex(filepath.Join(dir, e.Name(), "bcdDevice"), 16); err == nil {
+			d.Version = bcdVersion(uint16(v))
+		}
+		// The speed is in Mbit/s.
+		if speed, err := os.ReadFile(filepath.Join(dir, e.Name(), "speed")); err == nil {
+			d.Speed = sysfsSpeed(strings.TrimSpace(string(speed)))
+		}
+		// The serial number is optional.
+		if serial, err := os.ReadFile(filepath.Join(dir, e.Name(), "serial")); err == nil {
+			d.Serial = strings.TrimSpace(string(serial))
+			d.Key = serialKey(d.Key, d.Serial)
+		}
+		if *driverLabels {
+			if d.Drivers, err = sysfsDrivers(filepath.Join(dir, e.Name())); err != nil {
+				return nil, err
+			}
+		}
+		if needsPowerState() {
+			d.PowerState = sysfsPowerState(filepath.Join(dir, e.Name()))
+		}
+		if *hidDetail {
+			d.HIDKinds = sysfsHIDKinds(filepath.Join(dir, e.Name()))
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// sysfsStrings returns the manufacturer and product strings of the device in dir, which the kernel reads when the device is attached.
+// Missing strings are empty.
+func sysfsStrings(dir string) (string, string) {
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	return read("manufacturer"), read("product")
+}
+
+// sysfsPowerState returns the power state of the device in dir, or active if the runtime power management is unknown.
+func sysfsPowerState(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "power", "runtime_status"))
+	if err != nil {
+		return powerStateActive
+	}
+	return powerState(strings.TrimSpace(string(data)))
+}
+
+// sysfsHIDKinds returns the kinds of the HID devices of the interfaces of the device in dir from their report descriptors,
+// e.g. 1-2:1.0/0003:0C2E:0B61.0001/report_descriptor. Descriptors that can not be read are skipped.
+func sysfsHIDKinds(dir string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, filepath.Base(dir)+":*", "*:*:*.*", "report_descriptor"))
+	if err != nil {
+		return nil
+	}
+	var descs [][]byte
+	for _, p := range paths {
+		if data, err := os.ReadFile(p); err == nil {
+			descs = append(descs, data)
+		}
+	}
+	return hidKinds(descs...)
+}
+
+// sysfsClasses returns the class pairs of the device and of its interfaces in dir.
+func sysfsClasses(dir string, desc sysfsDesc) ([]string, error) {
+	pairs := [][2]uint8{{desc.class, desc.subClass}}
+	ifaces, err := filepath.Glob(filepath.Join(dir, filepath.Base(dir)+":*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		class, err := readSysfsHex(filepath.Join(iface, "bInterfaceClass"), 8)
+		if os.IsNotExist(err) {
+			// The device was detached while scanning.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		subClass, err := readSysfsHex(filepath.Join(iface, "bInterfaceSubClass"), 8)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, [2]uint8{uint8(class), uint8(subClass)})
+	}
+	return formatClasses(pairs), nil
+}
+
+// sysfsSpeed returns the name of the speed in Mbit/s like libusb, or an empty string if it is unknown.
+func sysfsSpeed(mbits string) string {
+	switch mbits {
+	case "1.5":
+		return speedLow
+	case "12":
+		return speedFull
+	case "480":
+		return speedHigh
+	case "5000", "10000", "20000":
+		return speedSuper
+	}
+	return ""
+}
+
+// sysfsDrivers returns the sorted names of the kernel drivers bound to the interfaces of the device in dir.
+func sysfsDrivers(dir string) ([]string, error) {
+	ifaces, err := filepath.Glob(filepath.Join(dir, filepath.Base(dir)+":*"))
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{})
+	for _, iface := range ifaces {
+		link, err := os.Readlink(filepath.Join(iface, "driver"))
+		if os.IsNotExist(err) {
+			// No driver is bound to the interface, or the device was detached while scanning.
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read driver of %q: %w", iface, err)
+		}
+		set[filepath.Base(link)] = struct{}{}
+	}
+	drivers := make([]string, 0, len(set))
+	for d := range set {
+		drivers = append(drivers, d)
+	}
+	sort.Strings(drivers)
+	return drivers, nil
+}
+
+// sysfsDesc are the ids and the class of a device in sysfs.
+type sysfsDesc struct {
+	id       deviceID
+	class    uint8
+	subClass uint8
+	protocol uint8
+}
+
+// readSysfsDesc reads the ids and the class of a device from its sysfs directory.
+func readSysfsDesc(dir string) (sysfsDesc, error) {
+	var vs [5]uint64
+	for i, f := range []string{"idVendor", "idProduct", "bDeviceClass", "bDeviceSubClass", "bDeviceProtocol"} {
+		bits := 8
+		if i < 2 {
+			bits = 16
+		}
+		v, err := readSysfsHex(filepath.Join(dir, f), bits)
+		if err != nil {
+			return sysfsDesc{}, err
+		}
+		vs[i] = v
+	}
+	return sysfsDesc{
+		id:       deviceID{vendor: usbID(vs[0]), product: usbID(vs[1])},
+		class:    uint8(vs[2]),
+		subClass: uint8(vs[3]),
+		protocol: uint8(vs[4]),
+	}, nil
+}
+
+func readSysfsHex(path string, bits int) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, bits)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %q: %w", path, err)
+	}
+	return v, nil
+}
+
+func readSysfsInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %q: %w", path, err)
+	}
+	return i, nil
+}
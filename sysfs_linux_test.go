@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSysfsScanner(t *testing.T) {
+	root := t.TempDir()
+	for name, files := range map[string]map[string]string{
+		"usb1":    {"idVendor": "1d6b\n", "idProduct": "0002\n", "bDeviceClass": "09\n", "bDeviceSubClass": "00\n", "bDeviceProtocol": "01\n"},
+		"1-1":     {"idVendor": "046d\n", "idProduct": "c52b\n", "bDeviceClass": "00\n", "bDeviceSubClass": "00\n", "bDeviceProtocol": "00\n", "speed": "12\n"},
+		"1-1:1.0": {"bInterfaceClass": "03\n"},
+		// Interfaces are listed next to the devices and are subdirectories of their devices.
+		"1-1/1-1:1.0": {"bInterfaceClass": "03\n", "bInterfaceSubClass": "01\n"},
+	} {
+		dir := filepath.Join(root, "bus", "usb", "devices", name)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		for f, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, f), []byte(content), 0o644))
+		}
+	}
+
+	ds, err := sysfsScanner{root: root}.Scan(context.Background())
+	require.NoError(t, err)
+	ids := make([]string, 0, len(ds))
+	speeds := make(map[string]string, len(ds))
+	classes := make(map[string][]string, len(ds))
+	for _, d := range ds {
+		ids = append(ids, d.ID)
+		speeds[d.Port] = d.Speed
+		classes[d.Port] = d.Classes
+	}
+	assert.ElementsMatch(t, []string{"1d6b_0002", "046d_c52b"}, ids)
+	assert.Equal(t, map[string]string{"usb1": "", "1-1": "full"}, speeds)
+	assert.Equal(t, map[string][]string{"usb1": {"09:00"}, "1-1": {"00:00", "03:01"}}, classes)
+}
+
+func TestSysfsDrivers(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "1-2")
+	for iface, driver := range map[string]string{"1-2:1.0": "cdc_acm", "1-2:1.1": "cdc_acm", "1-2:1.2": "usbhid", "1-2:1.3": ""} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, iface), 0o755))
+		if driver != "" {
+			require.NoError(t, os.Symlink(filepath.Join("..", "..", "bus", "usb", "drivers", driver), filepath.Join(dir, iface, "driver")))
+		}
+	}
+	ds, err := sysfsDrivers(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cdc_acm", "usbhid"}, ds)
+}
+
+func TestSysfsStrings(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "bus", "usb", "devices", "1-1")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	for f, content := range map[string]string{"idVendor": "2341\n", "idProduct": "0043\n", "bDeviceClass": "02\n", "bDeviceSubClass": "00\n", "bDeviceProtocol": "00\n", "manufacturer": "Arduino (www.arduino.cc)\n", "product": "Arduino Uno\n"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), []byte(content), 0o644))
+	}
+	m, p := sysfsStrings(dir)
+	assert.Equal(t, "Arduino (www.arduino.cc)", m)
+	assert.Equal(t, "Arduino Uno", p)
+
+	*readStringDescriptors = true
+	defer func() { *readStringDescriptors = false }()
+	ds, err := sysfsScanner{root: root}.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, "Arduino Uno (Arduino www.arduino.cc)", ds[0].Description)
+	assert.Equal(t, "Arduino-www.arduino.cc_Arduino-Uno", ds[0].Key)
+}
+
+func TestUSBBackend(t *testing.T) {
+	defer func(b string, u bool) { *usbBackend, *unprivileged = b, u }(*usbBackend, *unprivileged)
+
+	// Without cgo, libusb is not available and sysfs is the default.
+	assert.Equal(t, libusbAvailable, defaultUSBBackend() == usbBackendLibusb)
+	*usbBackend = usbBackendLibusb
+	assert.Equal(t, libusbAvailable, validateUSBBackend() == nil)
+	assert.IsType(t, &usbScanner{}, newUSBScanner(log.NewNopLogger()))
+	*usbBackend = usbBackendSysfs
+	assert.NoError(t, validateUSBBackend())
+	assert.Equal(t, "sysfs", newUSBScanner(log.NewNopLogger()).Name())
+
+	// unprivileged is a shorthand for the sysfs backend.
+	*usbBackend, *unprivileged = usbBackendLibusb, true
+	assert.NoError(t, validateUSBBackend())
+	assert.True(t, sysfsBackend())
+
+	*usbBackend = "gousb"
+	assert.Error(t, validateUSBBackend())
+}
+
+func TestSysfsPowerState(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, powerStateActive, sysfsPowerState(dir))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "power"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "power", "runtime_status"), []byte("suspended\n"), 0o644))
+	assert.Equal(t, powerStateSuspended, sysfsPowerState(dir))
+}
+
+func TestSysfsHIDKinds(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "1-2")
+	assert.Nil(t, sysfsHIDKinds(dir))
+	for i, desc := range [][]byte{scannerHIDDescriptor, keyboardHIDDescriptor} {
+		hid := filepath.Join(dir, fmt.Sprintf("1-2:1.%d", i), fmt.Sprintf("0003:0C2E:0B61.000%d", i+1))
+		require.NoError(t, os.MkdirAll(hid, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(hid, "report_descriptor"), desc, 0o444))
+	}
+	assert.Equal(t, []string{"consumer-control", "keyboard", "scanner"}, sysfsHIDKinds(dir))
+}
@@ -0,0 +1,114 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// On macOS, FreeBSD and Windows, the following works:
+//   - the usb scanner with the libusb backend, which needs cgo; on Windows, it only sees the devices that use the WinUSB driver,
+//   - the fixture scanner, --replay and --scanner-exec,
+//   - the device node scanner, except on Windows, which has no device nodes,
+//   - --hotplug, which falls back to the update interval.
+//
+// The sysfs usb backend, the pci, i2c, sound, storage and thunderbolt scanners and the labels read from sysfs are only available on Linux.
+// A build without cgo can therefore not scan usb devices on these systems.
+var errNoSysfs = errors.New("sysfs is only available on Linux")
+
+// validateSysfs rejects the flags that need sysfs, e.g. on macOS, FreeBSD and Windows,
+// where only libusb can be used to scan devices.
+// Windows has no device nodes, so scan-dev is rejected there as well.
+func validateSysfs() error {
+	if *replay == "" && *scannerKind == "usb" && sysfsBackend() {
+		if !libusbAvailable {
+			return fmt.Errorf("--scanner=usb needs libusb on %s, but nudl was built without cgo", runtime.GOOS)
+		}
+		return fmt.Errorf("--usb-backend=%s is not supported on %s", usbBackendSysfs, runtime.GOOS)
+	}
+	if *sriov {
+		return fmt.Errorf("--sriov is not supported on %s", runtime.GOOS)
+	}
+	if *driverLabels {
+		return fmt.Errorf("--driver-labels is not supported on %s", runtime.GOOS)
+	}
+	if *scanPCI {
+		return fmt.Errorf("--scan-pci is not supported on %s", runtime.GOOS)
+	}
+	if *remoteDevices != "" {
+		return fmt.Errorf("--remote-devices is not supported on %s", runtime.GOOS)
+	}
+	if *scanI2C {
+		return fmt.Errorf("--scan-i2c is not supported on %s", runtime.GOOS)
+	}
+	if *scanSound {
+		return fmt.Errorf("--scan-sound is not supported on %s", runtime.GOOS)
+	}
+	if *scanStorage {
+		return fmt.Errorf("--scan-storage is not supported on %s", runtime.GOOS)
+	}
+	if *scanThunderbolt {
+		return fmt.Errorf("--scan-thunderbolt is not supported on %s", runtime.GOOS)
+	}
+	if needsPowerState() {
+		return fmt.Errorf("--power-state-labels and --label-value=%s are not supported on %s", labelValueState, runtime.GOOS)
+	}
+	if *hidDetail {
+		return fmt.Errorf("--hid-detail is not supported on %s", runtime.GOOS)
+	}
+	if *scanDev && runtime.GOOS == "windows" {
+		return fmt.Errorf("--scan-dev is not supported on %s", runtime.GOOS)
+	}
+	return nil
+}
+
+func (sysfsScanner) Scan(_ context.Context) ([]device, error) {
+	return nil, errNoSysfs
+}
+
+func (*pciScanner) Scan(_ context.Context) ([]device, error) {
+	return nil, errNoSysfs
+}
+
+func (*i2cScanner) Scan(_ context.Context) ([]device, error) {
+	return nil, errNoSysfs
+}
+
+func (*soundScanner) Scan(_ context.Context) ([]device, error) {
+	return nil, errNoSysfs
+}
+
+func (*storageScanner) Scan(_ context.Context) ([]device, error) {
+	return nil, errNoSysfs
+}
+
+func (*thunderboltScanner) Scan(_ context.Context) ([]device, error) {
+	return nil, errNoSysfs
+}
+
+func sysfsDrivers(_ string) ([]string, error) {
+	return nil, errNoSysfs
+}
+
+func sriovLabels(_ string) (labels, error) {
+	return nil, errNoSysfs
+}
+
+func vhciBuses(_ string) (map[string]bool, error) {
+	return nil, errNoSysfs
+}
+
+func sysfsPowerState(_ string) string {
+	return ""
+}
+
+func sysfsHIDKinds(_ string) []string {
+	return nil
+}
+
+func sysfsStrings(_ string) (string, string) {
+	return "", ""
+}
@@ -0,0 +1,62 @@
+//go:build !linux
+
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSysfsOther(t *testing.T) {
+	defer func(b string, u bool, s string) {
+		*usbBackend, *unprivileged, *scannerKind = b, u, s
+	}(*usbBackend, *unprivileged, *scannerKind)
+	*usbBackend, *unprivileged, *scannerKind = usbBackendLibusb, false, "usb"
+	assert.NoError(t, validateSysfs())
+
+	for _, tc := range []struct {
+		name string
+		flag *bool
+	}{
+		{name: "unprivileged", flag: unprivileged},
+		{name: "sriov", flag: sriov},
+		{name: "driver-labels", flag: driverLabels},
+		{name: "scan-pci", flag: scanPCI},
+		{name: "scan-i2c", flag: scanI2C},
+		{name: "scan-sound", flag: scanSound},
+		{name: "scan-storage", flag: scanStorage},
+		{name: "scan-thunderbolt", flag: scanThunderbolt},
+		{name: "power-state-labels", flag: powerStateLabels},
+		{name: "hid-detail", flag: hidDetail},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(v bool) { *tc.flag = v }(*tc.flag)
+			*tc.flag = true
+			assert.Error(t, validateSysfs())
+		})
+	}
+
+	t.Run("remote-devices", func(t *testing.T) {
+		defer func(v string) { *remoteDevices = v }(*remoteDevices)
+		*remoteDevices = remoteDevicesLabel
+		assert.Error(t, validateSysfs())
+	})
+
+	t.Run("scan-dev", func(t *testing.T) {
+		defer func(v bool) { *scanDev = v }(*scanDev)
+		*scanDev = true
+		assert.Equal(t, runtime.GOOS == "windows", validateSysfs() != nil)
+	})
+
+	// The sysfs backend is only rejected if the usb scanner is used.
+	*usbBackend = usbBackendSysfs
+	assert.Error(t, validateSysfs())
+	*scannerKind = "fixture"
+	assert.NoError(t, validateSysfs())
+	// A replay does not scan usb devices either.
+	*scannerKind, *replay = "usb", "dump.json"
+	defer func() { *replay = "" }()
+	assert.NoError(t, validateSysfs())
+}
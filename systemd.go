@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// notifySystemd sends the state to systemd, if nudl runs as a service with Type=notify.
+// Errors are logged, because the notification must not interfere with labeling.
+func notifySystemd(state string, logger log.Logger) {
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		level.Warn(logger).Log("msg", "could not notify systemd", "state", state, "err", err)
+	}
+}
+
+// systemdWatchdog pings the systemd watchdog as long as no reconciliation is stuck,
+// so systemd restarts nudl, e.g. if a libusb call hangs.
+type systemdWatchdog struct {
+	// timeout is WatchdogSec of the service, 0 if the watchdog is disabled.
+	timeout time.Duration
+	// busySince is the time in unix nanoseconds when the running reconciliation started, 0 if none is running.
+	busySince atomic.Int64
+}
+
+func newSystemdWatchdog() (*systemdWatchdog, error) {
+	timeout, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the systemd watchdog configuration: %w", err)
+	}
+	return &systemdWatchdog{timeout: timeout}, nil
+}
+
+// begin marks the start of a reconciliation.
+func (w *systemdWatchdog) begin(now time.Time) {
+	w.busySince.Store(now.UnixNano())
+}
+
+// end marks the end of a reconciliation.
+func (w *systemdWatchdog) end() {
+	w.busySince.Store(0)
+}
+
+// healthy returns false if a reconciliation is running for longer than the watchdog timeout.
+func (w *systemdWatchdog) healthy(now time.Time) bool {
+	since := w.busySince.Load()
+	return since == 0 || now.Sub(time.Unix(0, since)) < w.timeout
+}
+
+// run pings the watchdog every half of its timeout until the context is cancelled.
+func (w *systemdWatchdog) run(ctx context.Context, logger log.Logger) error {
+	if w.timeout == 0 {
+		return nil
+	}
+	level.Info(logger).Log("msg", "starting systemd watchdog", "timeout", w.timeout)
+	t := time.NewTicker(w.timeout / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-t.C:
+			if !w.healthy(now) {
+				level.Warn(logger).Log("msg", "reconciliation is stuck, not pinging the systemd watchdog")
+				continue
+			}
+			notifySystemd(daemon.SdNotifyWatchdog, logger)
+		}
+	}
+}
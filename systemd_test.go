@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdWatchdogHealthy(t *testing.T) {
+	w := &systemdWatchdog{timeout: time.Minute}
+	now := time.Now()
+	assert.True(t, w.healthy(now))
+	w.begin(now)
+	assert.True(t, w.healthy(now.Add(30*time.Second)))
+	assert.False(t, w.healthy(now.Add(time.Minute)))
+	w.end()
+	assert.True(t, w.healthy(now.Add(time.Minute)))
+}
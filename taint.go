@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+)
+
+var taintWhenMissing = flag.String("taint-when-missing", "", "taint in the format <key>[=<value>]:<effect>, e.g. devic.es/usb-missing:NoSchedule, that is applied to the node while a device in --only is missing and removed when all are present again")
+
+// parseTaint parses a taint in the format key[=value]:effect.
+func parseTaint(s string) (v1.Taint, error) {
+	kv, effect, ok := strings.Cut(s, ":")
+	if !ok {
+		return v1.Taint{}, fmt.Errorf("taint %q has no effect", s)
+	}
+	key, value, _ := strings.Cut(kv, "=")
+	if key == "" {
+		return v1.Taint{}, fmt.Errorf("taint %q has no key", s)
+	}
+	switch e := v1.TaintEffect(effect); e {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		return v1.Taint{Key: key, Value: value, Effect: e}, nil
+	default:
+		return v1.Taint{}, fmt.Errorf("taint effect %q unknown; possible values are: %s, %s, %s", effect, v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute)
+	}
+}
+
+// missingOnly returns the devices in only that are not found.
+func missingOnly(ds []device) []string {
+	return missingMatching(ds, *only)
+}
+
+// missingMatching returns the entries of want that match no device that is not filtered.
+// Entries are matched like only, by key, by id or with wildcards.
+func missingMatching(ds []device, want []string) []string {
+	present := make(map[string]struct{}, len(ds))
+	for _, d := range ds {
+		if filtered(d) {
+			continue
+		}
+		present[d.Key] = struct{}{}
+		present[d.ID] = struct{}{}
+	}
+	var missing []string
+	for _, k := range want {
+		if _, ok := present[k]; ok {
+			continue
+		}
+		found := false
+		for p := range present {
+			if onlyMatches(k, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, k)
+		}
+	}
+	return missing
+}
+
+// taintPatch returns a strategic merge patch that adds the taint to the node if devices are missing,
+// or removes it if no device is missing.
+// It returns nil if the node does not need to be patched.
+func taintPatch(node *v1.Node, taint v1.Taint, missing bool) ([]byte, error) {
+	taints := make([]v1.Taint, 0, len(node.Spec.Taints)+1)
+	var found bool
+	for _, t := range node.Spec.Taints {
+		if t.MatchTaint(&taint) {
+			found = true
+			if !missing {
+				continue
+			}
+		}
+		taints = append(taints, t)
+	}
+	if missing && !found {
+		taints = append(taints, taint)
+	}
+	return replaceTaintsPatch(node, taints, append(appliedTaints(node), taint), found != missing)
+}
+
+// taintsAnnotation holds the taints that nudl added to the node,
+// so they are removed on clean up without reading the rules file, even if the rules changed since.
+func taintsAnnotation() string {
+	return sprintLabelKey("taints")
+}
+
+// appliedTaints returns the taints of the taints annotation of the node.
+func appliedTaints(node *v1.Node) []v1.Taint {
+	var ts []v1.Taint
+	if v, ok := node.Annotations[taintsAnnotation()]; ok {
+		// A broken annotation is overwritten by the next taint patch.
+		_ = json.Unmarshal([]byte(v), &ts)
+	}
+	return ts
+}
+
+func matchesTaint(t v1.Taint, ts []v1.Taint) bool {
+	for _, o := range ts {
+		if t.MatchTaint(&o) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceTaintsPatch returns a strategic merge patch that replaces the taints of the node
+// and records the taints that match managed in the taints annotation.
+// It returns nil if neither the taints changed nor the annotation.
+func replaceTaintsPatch(node *v1.Node, taints, managed []v1.Taint, changed bool) ([]byte, error) {
+	var applied []v1.Taint
+	for _, t := range taints {
+		if matchesTaint(t, managed) {
+			applied = append(applied, t)
+		}
+	}
+	key := taintsAnnotation()
+	current, exists := node.Annotations[key]
+	var annotation *string
+	if len(applied) > 0 {
+		data, err := json.Marshal(applied)
+		if err != nil {
+			return nil, err
+		}
+		v := string(data)
+		annotation = &v
+	}
+	annotationChanged := exists != (annotation != nil) || (annotation != nil && current != *annotation)
+	if !changed && !annotationChanged {
+		return nil, nil
+	}
+	// Taints have no merge key, so the whole list is replaced.
+	// The resource version makes the patch fail, if the taints were changed concurrently.
+	p := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"taints": taints,
+		},
+	}
+	metadata := make(map[string]interface{})
+	if annotationChanged {
+		metadata["annotations"] = map[string]*string{key: annotation}
+	}
+	if node.ResourceVersion != "" {
+		metadata["resourceVersion"] = node.ResourceVersion
+	}
+	if len(metadata) > 0 {
+		p["metadata"] = metadata
+	}
+	return json.Marshal(p)
+}
+
+// ownedTaints returns the taints that nudl added to the node: the taints of the taints annotation and of taint-when-missing,
+// which was added before the annotation existed.
+func ownedTaints(node *v1.Node) []v1.Taint {
+	owned := appliedTaints(node)
+	if *taintWhenMissing != "" {
+		// The flag is validated on start.
+		t, _ := parseTaint(*taintWhenMissing)
+		owned = append(owned, t)
+	}
+	return owned
+}
+
+// untaintPatch returns a strategic merge patch that removes the owned taints and the taints annotation from the node.
+// It returns nil if the node has none of them.
+func untaintPatch(node *v1.Node, owned []v1.Taint) ([]byte, error) {
+	taints := make([]v1.Taint, 0, len(node.Spec.Taints))
+	for _, t := range node.Spec.Taints {
+		if !matchesTaint(t, owned) {
+			taints = append(taints, t)
+		}
+	}
+	return replaceTaintsPatch(node, taints, nil, len(taints) != len(node.Spec.Taints))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestParseTaint(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want v1.Taint
+		err  bool
+	}{
+		{in: "devic.es/usb-missing:NoSchedule", want: v1.Taint{Key: "devic.es/usb-missing", Effect: v1.TaintEffectNoSchedule}},
+		{in: "devic.es/usb-missing=tuner:NoExecute", want: v1.Taint{Key: "devic.es/usb-missing", Value: "tuner", Effect: v1.TaintEffectNoExecute}},
+		{in: "devic.es/usb-missing", err: true},
+		{in: ":NoSchedule", err: true},
+		{in: "devic.es/usb-missing:Sometimes", err: true},
+	} {
+		got, err := parseTaint(tc.in)
+		if tc.err {
+			assert.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.want, got, tc.in)
+	}
+}
+
+func TestTaintPatchKeepsOtherTaints(t *testing.T) {
+	taint := v1.Taint{Key: "devic.es/usb-missing", Effect: v1.TaintEffectNoSchedule}
+	other := v1.Taint{Key: "dedicated", Value: "media", Effect: v1.TaintEffectNoSchedule}
+	n := &v1.Node{Spec: v1.NodeSpec{Taints: []v1.Taint{other}}}
+
+	p, err := taintPatch(n, taint, false)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	p, err = taintPatch(n, taint, true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"metadata":{"annotations":{"nudl.squat.ai/taints":"[{\"key\":\"devic.es/usb-missing\",\"effect\":\"NoSchedule\"}]"}},"spec":{"taints":[{"key":"dedicated","value":"media","effect":"NoSchedule"},{"key":"devic.es/usb-missing","effect":"NoSchedule"}]}}`, string(p))
+
+	applyTaintPatch(t, n, p)
+	p, err = taintPatch(n, taint, true)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	p, err = taintPatch(n, taint, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"metadata":{"annotations":{"nudl.squat.ai/taints":null}},"spec":{"taints":[{"key":"dedicated","value":"media","effect":"NoSchedule"}]}}`, string(p))
+}
+
+// applyTaintPatch applies the taints and the annotations of a patch to the node.
+func applyTaintPatch(t *testing.T, n *v1.Node, patch []byte) {
+	var p struct {
+		Metadata struct {
+			Annotations map[string]*string `json:"annotations"`
+		} `json:"metadata"`
+		Spec v1.NodeSpec `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(patch, &p))
+	n.Spec.Taints = p.Spec.Taints
+	for k, v := range p.Metadata.Annotations {
+		if v == nil {
+			delete(n.Annotations, k)
+			continue
+		}
+		if n.Annotations == nil {
+			n.Annotations = make(map[string]string)
+		}
+		n.Annotations[k] = *v
+	}
+}
+
+func TestLabelerTaintWhenMissing(t *testing.T) {
+	oldHostname, oldTaint, oldOnly := *hostname, *taintWhenMissing, *only
+	*hostname, *taintWhenMissing, *only = "node1", "devic.es/usb-missing:NoSchedule", []string{"2040_826d"}
+	t.Cleanup(func() { *hostname, *taintWhenMissing, *only = oldHostname, oldTaint, oldOnly })
+
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	ds := []device{{ID: "2040_826d", Key: "2040_826d"}}
+	s := fakeScanner{name: "fake", scan: func(context.Context) ([]device, error) {
+		return ds, nil
+	}}
+	lb := newLabeler(clientset, testclock.NewFakePassiveClock(time.Now()), nil, s)
+	ctx := context.Background()
+	node := func() *v1.Node {
+		n, err := clientset.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return n
+	}
+
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Empty(t, node().Spec.Taints)
+
+	ds = nil
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Equal(t, []v1.Taint{{Key: "devic.es/usb-missing", Effect: v1.TaintEffectNoSchedule}}, node().Spec.Taints)
+	assert.Equal(t, "false", node().Labels["nudl.squat.ai/2040_826d"])
+
+	ds = []device{{ID: "2040_826d", Key: "2040_826d"}}
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	assert.Empty(t, node().Spec.Taints)
+
+	// The taint is removed on clean up, but not the taints of others.
+	ds = nil
+	require.NoError(t, lb.reconcile(ctx, log.NewNopLogger()))
+	n := node()
+	other := v1.Taint{Key: "dedicated", Value: "media", Effect: v1.TaintEffectNoSchedule}
+	n.Spec.Taints = append(n.Spec.Taints, other)
+	_, err := clientset.CoreV1().Nodes().Update(ctx, n, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, lb.cleanUp(ctx, log.NewNopLogger()))
+	assert.Equal(t, []v1.Taint{other}, node().Spec.Taints)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	flag "github.com/spf13/pflag"
+)
+
+var labelTemplate = flag.String("label-template", "", "Go template for the label keys that replaces the default format, with the fields .VendorID, .ProductID, .VendorName, .ProductName, .Class, .Serial, .Bus and .Port, e.g. '{{.VendorName}}_{{.ProductID}}'; the result is sanitized and truncated to 63 characters")
+
+// labelTemplateData are the fields of a device that can be used in label-template.
+type labelTemplateData struct {
+	VendorID    string
+	ProductID   string
+	VendorName  string
+	ProductName string
+	Class       string
+	Serial      string
+	// Bus is usb, pci, dev, i2c, gpio, sound, storage or thunderbolt.
+	Bus string
+	// Port is the port path, e.g. 1-1.4, if it is known.
+	Port string
+}
+
+func newLabelTemplateData(d device) labelTemplateData {
+	td := labelTemplateData{
+		Class:  d.Class,
+		Serial: d.Serial,
+		Bus:    "usb",
+		Port:   d.Port,
+	}
+	switch {
+	case isPCI(d):
+		td.Bus = "pci"
+	case isDev(d):
+		td.Bus = "dev"
+	case isI2C(d):
+		td.Bus = "i2c"
+	case isGPIO(d):
+		td.Bus = "gpio"
+	case isSound(d):
+		td.Bus = "sound"
+	case isStorage(d):
+		td.Bus = "storage"
+	case isThunderbolt(d):
+		td.Bus = "thunderbolt"
+	}
+	td.VendorID, td.ProductID, _ = vendorProduct(d)
+	if regParse.MatchString(d.Description) {
+		td.ProductName = regParse.ReplaceAllString(d.Description, "$1")
+		td.VendorName = regParse.ReplaceAllString(d.Description, "$2")
+	}
+	return td
+}
+
+// parseLabelTemplate parses the template and executes it for an example device,
+// so invalid templates are rejected on start.
+func parseLabelTemplate(text string) (*template.Template, error) {
+	t, err := template.New("label").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse label template: %w", err)
+	}
+	if _, err := executeLabelTemplate(t, device{ID: "2341_0043", Description: "Uno R3 (CDC ACM) (Arduino SA)", Class: "02", Serial: "7573530303235", Port: "1-1.4"}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// executeLabelTemplate returns the sanitized key of a device.
+// Characters that are not allowed in label names are replaced, the key is truncated to 63 characters
+// and must start and end with an alphanumeric character.
+func executeLabelTemplate(t *template.Template, d device) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, newLabelTemplateData(d)); err != nil {
+		return "", fmt.Errorf("could not execute label template: %w", err)
+	}
+	k := regTrim.ReplaceAllString(buf.String(), "-")
+	if len(k) > maxLabelNameLength {
+		k = k[:maxLabelNameLength]
+	}
+	k = strings.Trim(k, "-_.")
+	if k == "" {
+		return "", fmt.Errorf("label template generates an empty key for device %s", d.ID)
+	}
+	return k, nil
+}
+
+// applyLabelTemplate returns the devices with keys generated by label-template, if it is set.
+func applyLabelTemplate(ds []device) ([]device, error) {
+	if *labelTemplate == "" {
+		return ds, nil
+	}
+	t, err := parseLabelTemplate(*labelTemplate)
+	if err != nil {
+		return nil, err
+	}
+	tds := make([]device, 0, len(ds))
+	for _, d := range ds {
+		if d.Key, err = executeLabelTemplate(t, d); err != nil {
+			return nil, err
+		}
+		tds = append(tds, d)
+	}
+	return tds, nil
+}
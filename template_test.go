@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelTemplate(t *testing.T) {
+	d := device{ID: "2341_0043", Key: "Arduino-SA_Uno-R3--CDC-ACM-", Description: "Uno R3 (CDC ACM) (Arduino SA)", Class: "02", Serial: "7573530303235", Port: "1-1.4"}
+	for _, tc := range []struct {
+		name     string
+		template string
+		want     string
+		err      bool
+	}{
+		{name: "hex", template: "{{.VendorID}}_{{.ProductID}}", want: "2341_0043"},
+		{name: "vendor only", template: "{{.VendorName}}", want: "Arduino-SA"},
+		{name: "sanitized and trimmed", template: "{{.ProductName}}", want: "Uno-R3--CDC-ACM"},
+		{name: "class and serial", template: "{{.Bus}}-{{.Class}}_{{.Serial}}", want: "usb-02_7573530303235"},
+		{name: "port", template: "{{.ProductID}}@{{.Port}}", want: "0043-1-1.4"},
+		{name: "truncated", template: "{{.VendorID}}" + strings.Repeat("x", 70), want: "2341" + strings.Repeat("x", 59)},
+		{name: "unknown field", template: "{{.Vendor}}", err: true},
+		{name: "empty", template: "{{/* nothing */}}", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseLabelTemplate(tc.template)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			k, err := executeLabelTemplate(tmpl, d)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, k)
+		})
+	}
+}
+
+func TestApplyLabelTemplate(t *testing.T) {
+	ds := []device{{ID: "2341_0043", Key: "Arduino-SA_Uno-R3", Description: "Uno R3 (Arduino SA)"}, {ID: "pci-10de_2204", Key: "pci-10de_2204", Description: "Unknown (Unknown)"}}
+	tds, err := applyLabelTemplate(ds)
+	require.NoError(t, err)
+	assert.Equal(t, ds, tds)
+
+	*labelTemplate = "{{.Bus}}_{{.VendorID}}"
+	defer func() { *labelTemplate = "" }()
+	tds, err = applyLabelTemplate(ds)
+	require.NoError(t, err)
+	assert.Equal(t, "usb_2341", tds[0].Key)
+	assert.Equal(t, "pci_10de", tds[1].Key)
+	assert.Equal(t, "Arduino-SA_Uno-R3", ds[0].Key)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// thunderboltPrefix is the prefix of the ids and keys of thunderbolt devices, so they can not be confused with usb devices.
+const thunderboltPrefix = "thunderbolt-"
+
+var scanThunderbolt = flag.Bool("scan-thunderbolt", false, "additionally label the node with the thunderbolt and USB4 devices in sysfs at --sysfs-root, e.g. docks and eGPU enclosures, and whether they are authorized with <key>.authorized=true|false")
+
+// isThunderbolt returns true for thunderbolt devices.
+func isThunderbolt(d device) bool {
+	return strings.HasPrefix(d.ID, thunderboltPrefix)
+}
+
+// thunderboltKey generates a key without prefix for a thunderbolt device like sanitizeKey for usb devices.
+func thunderboltKey(vendor, device uint16, vendorName, deviceName string) string {
+	hexKey := fmt.Sprintf("%s%04x_%04x", thunderboltPrefix, vendor, device)
+	if (!*humanReadable && !*dualLabels) || vendorName == "" || deviceName == "" {
+		return hexKey
+	}
+	return humanKey(thunderboltPrefix, fmt.Sprintf("%s (%s)", deviceName, vendorName), hexKey)
+}
+
+// addThunderboltLabels adds a label <key>.authorized for every label of thunderbolt devices,
+// which is only true if all devices of the label are authorized, because the PCIe tunnels of unauthorized devices,
+// e.g. of an eGPU, are not set up.
+func addThunderboltLabels(l labels, ds []device) {
+	authorized := make(map[string]bool)
+	for _, d := range ds {
+		if !isThunderbolt(d) || filtered(d) {
+			continue
+		}
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		a, ok := authorized[d.Key]
+		authorized[d.Key] = d.Authorized && (a || !ok)
+	}
+	for k, a := range authorized {
+		l[sprintLabelKey(suffixKey(k, ".authorized"))] = fmt.Sprint(a)
+	}
+}
+
+// thunderboltScanner scans thunderbolt devices by reading sysfs.
+type thunderboltScanner struct {
+	root string
+}
+
+func (*thunderboltScanner) Name() string {
+	return "thunderbolt"
+}
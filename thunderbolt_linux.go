@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// regThunderboltDevice matches the names of thunderbolt routers in sysfs, e.g. 0-1 or 0-301.
+// Domains, e.g. domain0, and services and retimers, e.g. 0-1.1 or 0-0:1.1, are not devices.
+var regThunderboltDevice = regexp.MustCompile(`^[0-9]+-[0-9a-f]+$`)
+
+// Scan returns the thunderbolt devices, e.g. docks, without the host routers.
+// A node without thunderbolt, e.g. because the driver is not loaded, has no devices.
+func (s *thunderboltScanner) Scan(_ context.Context) ([]device, error) {
+	dir := filepath.Join(s.root, "bus", "thunderbolt", "devices")
+	es, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not list thunderbolt devices: %w", err)
+	}
+	var ds []device
+	for _, e := range es {
+		// The route string of host routers is 0, e.g. 0-0.
+		if !regThunderboltDevice.MatchString(e.Name()) || strings.HasSuffix(e.Name(), "-0") {
+			continue
+		}
+		d, err := readThunderboltDevice(filepath.Join(dir, e.Name()))
+		if os.IsNotExist(err) {
+			// The device was removed while scanning.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// readThunderboltDevice returns the thunderbolt device in the sysfs directory.
+func readThunderboltDevice(dir string) (device, error) {
+	name := filepath.Base(dir)
+	read := func(attr string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(dir, attr))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	var ids [2]uint16
+	for i, attr := range []string{"vendor", "device"} {
+		s, err := read(attr)
+		if err != nil {
+			return device{}, err
+		}
+		v, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return device{}, fmt.Errorf("invalid %s %q of thunderbolt device %q: %w", attr, s, name, err)
+		}
+		ids[i] = uint16(v)
+	}
+	// The names are optional.
+	vendorName, _ := read("vendor_name")
+	deviceName, _ := read("device_name")
+	authorized, err := read("authorized")
+	if err != nil {
+		return device{}, err
+	}
+	d := device{
+		ID:  fmt.Sprintf("%s%04x_%04x", thunderboltPrefix, ids[0], ids[1]),
+		Key: thunderboltKey(ids[0], ids[1], vendorName, deviceName),
+		// 1 is authorized and 2 is authorized with a key.
+		Authorized: authorized != "0",
+		Port:       name,
+	}
+	d.Description = fmt.Sprintf("%s (%s)", deviceName, vendorName)
+	if vendorName == "" || deviceName == "" {
+		d.Description = fmt.Sprintf("%04x:%04x (%s)", ids[0], ids[1], name)
+	}
+	if *driverLabels {
+		link, err := os.Readlink(filepath.Join(dir, "driver"))
+		if err == nil {
+			d.Drivers = []string{filepath.Base(link)}
+		} else if !os.IsNotExist(err) {
+			return device{}, fmt.Errorf("could not read driver of %q: %w", name, err)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThunderboltScanner(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "bus", "thunderbolt", "devices")
+	for name, attrs := range map[string]map[string]string{
+		"0-0":     {"vendor": "0x8086", "device": "0x9a1b", "authorized": "1"},
+		"0-1":     {"vendor": "0xd4", "device": "0xb070", "vendor_name": "Dell", "device_name": "WD19TB Thunderbolt Dock", "authorized": "2"},
+		"0-3":     {"vendor": "0x8086", "device": "0x15ef", "authorized": "0"},
+		"0-1.1":   {},
+		"domain0": {},
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0o755))
+		for k, v := range attrs {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name, k), []byte(v+"\n"), 0o644))
+		}
+	}
+
+	ds, err := (&thunderboltScanner{root: root}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []device{
+		{ID: "thunderbolt-00d4_b070", Key: "thunderbolt-Dell_WD19TB-Thunderbolt-Dock", Description: "WD19TB Thunderbolt Dock (Dell)", Port: "0-1", Authorized: true},
+		{ID: "thunderbolt-8086_15ef", Key: "thunderbolt-8086_15ef", Description: "8086:15ef (0-3)", Port: "0-3"},
+	}, ds)
+	assert.False(t, isUSB(ds[0]))
+	assert.Equal(t, "thunderbolt", newLabelTemplateData(ds[0]).Bus)
+	assert.Equal(t, "00d4", newLabelTemplateData(ds[0]).VendorID)
+
+	*scanThunderbolt = true
+	t.Cleanup(func() { *scanThunderbolt = false })
+	assert.Equal(t, labels{
+		"nudl.squat.ai/thunderbolt-Dell_WD19TB-Thunderbolt-Dock":            "true",
+		"nudl.squat.ai/thunderbolt-Dell_WD19TB-Thunderbolt-Dock.authorized": "true",
+		"nudl.squat.ai/thunderbolt-8086_15ef":                               "true",
+		"nudl.squat.ai/thunderbolt-8086_15ef.authorized":                    "false",
+	}, createLabels(ds))
+	assert.NotEqual(t, fingerprint(ds), fingerprint([]device{ds[0], {ID: ds[1].ID, Key: ds[1].Key, Description: ds[1].Description, Port: ds[1].Port, Authorized: true}}))
+
+	// A node without thunderbolt has no devices.
+	ds, err = (&thunderboltScanner{root: t.TempDir()}).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	flag "github.com/spf13/pflag"
+)
+
+// tlsFlags are the flags to configure TLS for a client of a sink.
+type tlsFlags struct {
+	caFile   *string
+	certFile *string
+	keyFile  *string
+	spiffeID *string
+}
+
+// newTLSFlags defines the flags <prefix>-ca-file, <prefix>-cert-file, <prefix>-key-file and <prefix>-spiffe-id
+// for a client of the server with the given name.
+func newTLSFlags(prefix, name string) tlsFlags {
+	return tlsFlags{
+		caFile:   flag.String(prefix+"-ca-file", "", fmt.Sprintf("path to a CA certificate to verify the %s", name)),
+		certFile: flag.String(prefix+"-cert-file", "", fmt.Sprintf("path to a client certificate for the %s", name)),
+		keyFile:  flag.String(prefix+"-key-file", "", fmt.Sprintf("path to the key of the client certificate for the %s", name)),
+		spiffeID: flag.String(prefix+"-spiffe-id", "", fmt.Sprintf("SPIFFE ID, e.g. spiffe://example.org/ns/default/sa/broker, that the certificate of the %s must have as URI SAN instead of its hostname", name)),
+	}
+}
+
+// enabled returns true if any of the flags is set.
+func (f tlsFlags) enabled() bool {
+	return *f.caFile != "" || *f.certFile != "" || *f.keyFile != "" || *f.spiffeID != ""
+}
+
+// config creates the TLS config for a client.
+func (f tlsFlags) config() (*tls.Config, error) {
+	c, err := newTLSConfig(*f.caFile, *f.certFile, *f.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if *f.spiffeID != "" {
+		verifySPIFFEID(c, *f.spiffeID, false)
+	}
+	return c, nil
+}
+
+// transport returns a clone of http.DefaultTransport with the TLS config for a client,
+// so the proxy of the environment and the timeouts of the default transport are kept.
+func (f tlsFlags) transport() (*http.Transport, error) {
+	c, err := f.config()
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = c
+	return t, nil
+}
+
+// newTLSConfig creates a TLS config for a client.
+// If caFile is empty, the system's root CAs are used.
+// A client certificate is only used if both certFile and keyFile are set.
+func newTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	c := &tls.Config{}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in CA file %q", caFile)
+	}
+	return pool, nil
+}
+
+// verifySPIFFEID makes the config verify that the peer certificate has the SPIFFE ID as URI SAN.
+// SPIFFE certificates identify workloads rather than hosts, so the hostname of a server is not verified.
+// For a server, the certificate of the client is verified against ClientCAs.
+func verifySPIFFEID(c *tls.Config, id string, server bool) {
+	if !server {
+		c.InsecureSkipVerify = true
+	}
+	c.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("peer did not present a certificate")
+		}
+		leaf := cs.PeerCertificates[0]
+		if !server {
+			opts := x509.VerifyOptions{Roots: c.RootCAs, Intermediates: x509.NewCertPool()}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if _, err := leaf.Verify(opts); err != nil {
+				return err
+			}
+		}
+		for _, u := range leaf.URIs {
+			if u.String() == id {
+				return nil
+			}
+		}
+		return fmt.Errorf("certificate does not have the SPIFFE ID %q", id)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySPIFFEID(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id, err := url.Parse("spiffe://example.org/ns/default/sa/server")
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		URIs:         []*url.URL{id},
+	}, caTemplate, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		id      string
+		success bool
+	}{
+		{id: id.String(), success: true},
+		{id: "spiffe://example.org/ns/default/sa/other"},
+	} {
+		c, err := newTLSConfig(caFile, "", "")
+		require.NoError(t, err)
+		verifySPIFFEID(c, tc.id, false)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: c}}
+		res, err := client.Get(srv.URL)
+		if tc.success {
+			require.NoError(t, err)
+			res.Body.Close()
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
+
+func TestTLSFlagsTransport(t *testing.T) {
+	empty := ""
+	spiffeID := "spiffe://example.org/broker"
+	f := tlsFlags{caFile: &empty, certFile: &empty, keyFile: &empty, spiffeID: &spiffeID}
+	tr, err := f.transport()
+	require.NoError(t, err)
+	require.NotNil(t, tr.TLSClientConfig)
+	// The proxy and the timeouts of the default transport are kept.
+	def := http.DefaultTransport.(*http.Transport)
+	assert.NotNil(t, tr.Proxy)
+	assert.Equal(t, def.TLSHandshakeTimeout, tr.TLSHandshakeTimeout)
+	assert.Equal(t, def.IdleConnTimeout, tr.IdleConnTimeout)
+	assert.NotSame(t, def, tr)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var labelTTL = flag.Duration("label-ttl", 0, "stamp the labels with an expiry time in an annotation that is renewed after half of the TTL, so labels of a dead agent can be garbage-collected, 0 disables the TTL")
+
+// ttlAnnotationKey returns the key of the annotation that holds the expiry time of every managed label.
+func ttlAnnotationKey() string {
+	return sprintLabelKey("label-expiry")
+}
+
+// ttlAnnotations returns the annotations to patch.
+// The annotation maps every label to its expiry time in RFC 3339 format.
+// It is deleted if the TTL is disabled or the node is cleaned up.
+func ttlAnnotations(current map[string]string, nl labels, now time.Time, clean bool) (map[string]*string, error) {
+	k := ttlAnnotationKey()
+	_, exists := current[k]
+	if *labelTTL == 0 || clean {
+		if exists {
+			return map[string]*string{k: nil}, nil
+		}
+		return nil, nil
+	}
+	expiry := now.Add(*labelTTL).UTC().Format(time.RFC3339)
+	m := make(map[string]string, len(nl))
+	for l := range nl {
+		m[l] = expiry
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	v := string(data)
+	return map[string]*string{k: &v}, nil
+}
+
+// expiredLabels returns the labels of the annotations whose expiry time is before now,
+// e.g. for tools that garbage-collect the labels of dead agents.
+func expiredLabels(annotations map[string]string, now time.Time) ([]string, error) {
+	v, ok := annotations[ttlAnnotationKey()]
+	if !ok {
+		return nil, nil
+	}
+	var m map[string]time.Time
+	if err := json.Unmarshal([]byte(v), &m); err != nil {
+		return nil, err
+	}
+	var expired []string
+	for l, t := range m {
+		if t.Before(now) {
+			expired = append(expired, l)
+		}
+	}
+	return expired, nil
+}
+
+// mergeAnnotations adds the annotations of b to a.
+func mergeAnnotations(a, b map[string]*string) map[string]*string {
+	if len(b) == 0 {
+		return a
+	}
+	if a == nil {
+		a = make(map[string]*string, len(b))
+	}
+	for k, v := range b {
+		a[k] = v
+	}
+	return a
+}
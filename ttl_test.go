@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLAnnotations(t *testing.T) {
+	*labelTTL = time.Hour
+	t.Cleanup(func() { *labelTTL = 0 })
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, err := ttlAnnotations(nil, labels{"nudl.squat.ai/Uno": "true"}, now, false)
+	require.NoError(t, err)
+	require.Contains(t, a, "nudl.squat.ai/label-expiry")
+	assert.JSONEq(t, `{"nudl.squat.ai/Uno": "2024-05-01T13:00:00Z"}`, *a["nudl.squat.ai/label-expiry"])
+
+	current := map[string]string{"nudl.squat.ai/label-expiry": *a["nudl.squat.ai/label-expiry"]}
+	expired, err := expiredLabels(current, now.Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	expired, err = expiredLabels(current, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nudl.squat.ai/Uno"}, expired)
+
+	a, err = ttlAnnotations(current, nil, now, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{"nudl.squat.ai/label-expiry": nil}, a)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	flag "github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+)
+
+var unknownDevicesSummaryInterval = flag.Duration("unknown-devices-summary-interval", time.Hour, "interval of the summary log line of the attached usb devices whose name could not be found; every vendor:product is only logged once on its own, 0 disables the summary")
+
+var unknownDevicesGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "nudl_unknown_devices",
+		Help: "Number of products of the attached usb devices whose name could not be found, e.g. in usb.ids",
+	},
+)
+
+// unknownDeviceLogger logs the usb devices without a name without repeating itself every reconciliation.
+// An unknownDeviceLogger must not be used concurrently.
+type unknownDeviceLogger struct {
+	clock clock.PassiveClock
+	// logged are the vendor:product ids that were logged.
+	logged map[string]bool
+	// summarized is the time of the last summary, or of the first log line.
+	summarized time.Time
+}
+
+func newUnknownDeviceLogger(c clock.PassiveClock) *unknownDeviceLogger {
+	return &unknownDeviceLogger{clock: c, logged: make(map[string]bool)}
+}
+
+// unknownID returns the vendor:product id of a usb device whose name could not be found.
+func unknownID(d device) (string, bool) {
+	sm := regHexID.FindStringSubmatch(d.ID)
+	if sm == nil || !strings.HasPrefix(d.Description, "Unknown") {
+		return "", false
+	}
+	return sm[1] + ":" + sm[2], true
+}
+
+// update logs every product without a name the first time it is attached
+// and a summary of the attached products without a name every unknown-devices-summary-interval.
+func (u *unknownDeviceLogger) update(ds []device, logger log.Logger) {
+	now := u.clock.Now()
+	attached := make(map[string]bool)
+	for _, d := range ds {
+		id, ok := unknownID(d)
+		if !ok || filtered(d) {
+			continue
+		}
+		attached[id] = true
+		if !u.logged[id] {
+			level.Warn(logger).Log("msg", "could not find device name", "id", id, "description", d.Description)
+			if len(u.logged) == 0 {
+				u.summarized = now
+			}
+			u.logged[id] = true
+		}
+	}
+	unknownDevicesGauge.Set(float64(len(attached)))
+	if *unknownDevicesSummaryInterval <= 0 || len(attached) == 0 || now.Sub(u.summarized) < *unknownDevicesSummaryInterval {
+		return
+	}
+	level.Warn(logger).Log("msg", "could not find the names of attached devices", "count", len(attached), "ids", strings.Join(sortedKeys(attached), ","))
+	u.summarized = now
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+func TestUnknownDeviceLogger(t *testing.T) {
+	c := testclock.NewFakeClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	u := newUnknownDeviceLogger(c)
+	var b bytes.Buffer
+	logger := log.NewLogfmtLogger(&b)
+	ds := []device{
+		{ID: "1234_5678", Description: "Unknown 1234:5678"},
+		{ID: "1234_5678", Description: "Unknown 1234:5678"},
+		{ID: "2341_abcd", Description: "Unknown (Arduino SA)"},
+		{ID: "2341_0043", Description: "Uno R3 (CDC ACM) (Arduino SA)"},
+	}
+	count := func(msg string) int {
+		return strings.Count(b.String(), `msg="`+msg+`"`)
+	}
+
+	u.update(ds, logger)
+	assert.Equal(t, 2, count("could not find device name"))
+	assert.Equal(t, 0, count("could not find the names of attached devices"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(unknownDevicesGauge))
+
+	// Every product is only logged once.
+	c.Step(10 * time.Second)
+	u.update(ds, logger)
+	assert.Equal(t, 2, count("could not find device name"))
+
+	c.Step(*unknownDevicesSummaryInterval)
+	u.update(ds, logger)
+	assert.Equal(t, 2, count("could not find device name"))
+	assert.Equal(t, 1, count("could not find the names of attached devices"))
+	assert.Contains(t, b.String(), `ids=1234:5678,2341:abcd`)
+
+	c.Step(10 * time.Second)
+	u.update(ds, logger)
+	assert.Equal(t, 1, count("could not find the names of attached devices"))
+
+	// Detached devices are not summarized.
+	c.Step(*unknownDevicesSummaryInterval)
+	u.update(ds[3:], logger)
+	assert.Equal(t, 1, count("could not find the names of attached devices"))
+	assert.Equal(t, 0.0, testutil.ToFloat64(unknownDevicesGauge))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The names of the usb speeds, as reported by libusb.
+const (
+	speedLow   = "low"
+	speedFull  = "full"
+	speedHigh  = "high"
+	speedSuper = "super"
+)
+
+// usbID is a vendor or product id of a usb device.
+type usbID uint16
+
+// String returns the id in hex, e.g. 0043.
+func (id usbID) String() string {
+	return fmt.Sprintf("%04x", uint16(id))
+}
+
+// deviceID identifies a device model by its vendor and product id.
+type deviceID struct {
+	vendor  usbID
+	product usbID
+}
+
+// String returns the hex key of the device model, e.g. 2341_0043.
+func (id deviceID) String() string {
+	return fmt.Sprintf("%s_%s", id.vendor, id.product)
+}
+
+// deviceName holds the usbid description and the generated key without prefix of a device model.
+type deviceName struct {
+	description string
+	key         string
+}
+
+// nameCache memoizes the usb.ids lookups and generated keys,
+// because they only depend on the vendor and product id
+// and would otherwise be computed for every device on every scan.
+var nameCache = struct {
+	sync.Mutex
+	m map[deviceID]deviceName
+}{m: make(map[deviceID]deviceName)}
+
+// resetNameCache removes the cached names, e.g. after the usb.ids file or the flags of the keys changed.
+func resetNameCache() {
+	nameCache.Lock()
+	nameCache.m = make(map[deviceID]deviceName)
+	nameCache.Unlock()
+}
+
+// lookupName returns the cached name of a device or generates it.
+func lookupName(id deviceID) deviceName {
+	nameCache.Lock()
+	defer nameCache.Unlock()
+	if n, ok := nameCache.m[id]; ok {
+		return n
+	}
+	dev := describeUSB(id)
+	n := deviceName{
+		description: dev,
+		key:         sanitizeKey(id, dev),
+	}
+	nameCache.m[id] = n
+	return n
+}
+
+// sanitizeKey generates a key without prefix out of a device description.
+// A device whose vendor is unknown, e.g. every device without cgo and usb.ids file, keeps the hex key,
+// because its description "Unknown 10c4:ea60" has no name.
+func sanitizeKey(id deviceID, dev string) string {
+	hexKey := id.String()
+	// In dual-labels mode, the hex code is labeled in addition to the human readable name.
+	if !*humanReadable && !*dualLabels || !regParse.MatchString(dev) {
+		return hexKey
+	}
+	return humanKey("", dev, hexKey)
+}
+
+// humanKey generates a human readable key with the prefix out of a description in the format of usbid, e.g. "Uno (Arduino)".
+// Keys that are too long for a label are shortened with long-label-strategy.
+func humanKey(prefix, dev, hexKey string) string {
+	// parse vendor and device from usbid
+	device := regParse.ReplaceAll([]byte(dev), []byte("$1"))
+	vendor := regParse.ReplaceAll([]byte(dev), []byte("$2"))
+	// Replace charackters not allowed in node labels.
+	return limitKey(prefix, sanitizeName(string(vendor)), sanitizeName(string(device)), hexKey, dev)
+}
@@ -0,0 +1,187 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/google/gousb/usbid"
+)
+
+// libusbAvailable is true if nudl was built with cgo, which libusb needs.
+const libusbAvailable = true
+
+// descID returns the vendor and product id of a device descriptor.
+func descID(desc *gousb.DeviceDesc) deviceID {
+	return deviceID{vendor: usbID(desc.Vendor), product: usbID(desc.Product)}
+}
+
+// describeEmbedded returns the description of a device model in the embedded database of usbid.
+func describeEmbedded(id deviceID) string {
+	return usbid.Describe(&gousb.DeviceDesc{Vendor: gousb.ID(id.vendor), Product: gousb.ID(id.product)})
+}
+
+// embeddedUSBIDsUpdate returns the date of the embedded database of usbid.
+func embeddedUSBIDsUpdate() (time.Time, bool) {
+	return usbid.LastUpdate, true
+}
+
+// usbScanner scans usb devices with libusb.
+// The usb context is kept across scans, because creating a context for every scan causes CPU spikes and libusb errors on some small boards.
+// It is only recreated after the devices could not be listed.
+type usbScanner struct {
+	mu  sync.Mutex
+	ctx *gousb.Context
+}
+
+func (*usbScanner) Name() string {
+	return "usb"
+}
+
+// usbContext returns the usb context and creates it if there is none.
+func (s *usbScanner) usbContext() *gousb.Context {
+	if s.ctx == nil {
+		s.ctx = gousb.NewContext()
+		s.ctx.Debug(*usbDebug)
+	}
+	return s.ctx
+}
+
+// reset closes the usb context, so the next scan creates a new one.
+func (s *usbScanner) reset() {
+	if s.ctx != nil {
+		s.ctx.Close()
+		s.ctx = nil
+	}
+}
+
+// Scan returns the scanned usb devices.
+// libusb calls can not be cancelled, so the context is ignored.
+func (s *usbScanner) Scan(_ context.Context) ([]device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx := s.usbContext()
+
+	var ds []device
+	var derr error
+	ids := make(map[string]deviceID)
+	// The devices are only opened to read the serial numbers, if include-serial is set,
+	// or the string descriptors, if read-string-descriptors is set.
+	open := *includeSerial || *readStringDescriptors
+	devs, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		id := descID(desc)
+		n := lookupName(id)
+		d := device{
+			ID:          id.String(),
+			Key:         n.key,
+			Description: n.description,
+			Port:        sysfsName(desc.Bus, desc.Path),
+			Class:       fmt.Sprintf("%02x", uint8(desc.Class)),
+			Classes:     usbClasses(desc),
+			Version:     bcdVersion(uint16(desc.Device)),
+			Address:     desc.Address,
+		}
+		if desc.Speed != gousb.SpeedUnknown {
+			d.Speed = desc.Speed.String()
+		}
+		if *driverLabels && derr == nil {
+			d.Drivers, derr = sysfsDrivers(filepath.Join(*sysfsRoot, "bus", "usb", "devices", d.Port))
+		}
+		if needsPowerState() {
+			d.PowerState = sysfsPowerState(filepath.Join(*sysfsRoot, "bus", "usb", "devices", d.Port))
+		}
+		if *hidDetail {
+			d.HIDKinds = sysfsHIDKinds(filepath.Join(*sysfsRoot, "bus", "usb", "devices", d.Port))
+		}
+		ids[d.Port] = id
+		ds = append(ds, d)
+		return open
+	})
+	// Devices that can not be opened, e.g. because of missing permissions, are labeled without serial number
+	// and named from sysfs or usb.ids.
+	// The error is only returned if the devices could not be listed.
+	if err != nil && (!open || len(ds) == 0) {
+		for _, dev := range devs {
+			dev.Close()
+		}
+		s.reset()
+		return nil, err
+	}
+	strs := make(map[string]deviceStrings, len(devs))
+	for _, dev := range devs {
+		if ss, ok := readDeviceStrings(dev); ok {
+			strs[sysfsName(dev.Desc.Bus, dev.Desc.Path)] = ss
+		}
+	}
+	if derr != nil {
+		return nil, derr
+	}
+	for i := range ds {
+		ss, ok := strs[ds[i].Port]
+		if *readStringDescriptors {
+			if !ok {
+				// sysfs caches the strings, so they can be read without opening the device.
+				ss.manufacturer, ss.product = sysfsStrings(filepath.Join(*sysfsRoot, "bus", "usb", "devices", ds[i].Port))
+			}
+			n := stringName(ids[ds[i].Port], deviceName{description: ds[i].Description, key: ds[i].Key}, ss.manufacturer, ss.product)
+			ds[i].Description, ds[i].Key = n.description, n.key
+		}
+		if ss.serial != "" {
+			ds[i].Serial = ss.serial
+			ds[i].Key = serialKey(ds[i].Key, ss.serial)
+		}
+	}
+	return ds, nil
+}
+
+// deviceStrings are the string descriptors of a device.
+type deviceStrings struct {
+	serial       string
+	manufacturer string
+	product      string
+}
+
+// readDeviceStrings reads the string descriptors of an opened device and closes it.
+// Only the serial number is read, unless read-string-descriptors is set.
+// A device that does not answer within string-descriptor-timeout is left to the go routine,
+// which closes it when the read returns, and false is returned.
+func readDeviceStrings(dev *gousb.Device) (deviceStrings, bool) {
+	ch := make(chan deviceStrings, 1)
+	go func() {
+		defer dev.Close()
+		var s deviceStrings
+		// Devices without the descriptors or that deny the request keep the names of usb.ids.
+		if *includeSerial {
+			s.serial, _ = dev.SerialNumber()
+		}
+		if *readStringDescriptors {
+			s.manufacturer, _ = dev.Manufacturer()
+			s.product, _ = dev.Product()
+		}
+		ch <- s
+	}()
+	select {
+	case s := <-ch:
+		return s, true
+	case <-time.After(*stringDescriptorTimeout):
+		return deviceStrings{}, false
+	}
+}
+
+// usbClasses returns the class pairs of a device and of all its interfaces from the descriptor.
+func usbClasses(desc *gousb.DeviceDesc) []string {
+	pairs := [][2]uint8{{uint8(desc.Class), uint8(desc.SubClass)}}
+	for _, cfg := range desc.Configs {
+		for _, iface := range cfg.Interfaces {
+			for _, alt := range iface.AltSettings {
+				pairs = append(pairs, [2]uint8{uint8(alt.Class), uint8(alt.SubClass)})
+			}
+		}
+	}
+	return formatClasses(pairs)
+}
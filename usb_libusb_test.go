@@ -0,0 +1,41 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeEmbedded(t *testing.T) {
+	assert.Equal(t, "Uno R3 (CDC ACM) (Arduino SA)", describeEmbedded(deviceID{vendor: 0x2341, product: 0x0043}))
+	assert.Equal(t, "Unknown 2e8a:000a", describeEmbedded(deviceID{vendor: 0x2e8a, product: 0x000a}))
+}
+
+// BenchmarkUSBScan compares scans with the cached usb context to scans that create a new context every time.
+// It needs libusb and is skipped if the devices can not be listed.
+func BenchmarkUSBScan(b *testing.B) {
+	b.Run("cached context", func(b *testing.B) {
+		s := &usbScanner{}
+		defer s.reset()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.Scan(context.Background()); err != nil {
+				b.Skip(err)
+			}
+		}
+	})
+	b.Run("new context", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s := &usbScanner{}
+			_, err := s.Scan(context.Background())
+			s.reset()
+			if err != nil {
+				b.Skip(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+//go:build !cgo
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// libusbAvailable is false without cgo, so the usb devices are scanned from sysfs.
+const libusbAvailable = false
+
+var errNoLibusb = errors.New("libusb is not available, because nudl was built without cgo")
+
+// usbScanner can not scan without libusb. It is never used, because the sysfs backend is selected without cgo.
+type usbScanner struct{}
+
+func (*usbScanner) Name() string {
+	return "usb"
+}
+
+func (*usbScanner) Scan(_ context.Context) ([]device, error) {
+	return nil, errNoLibusb
+}
+
+// describeEmbedded describes a device model like usbid describes unknown devices,
+// because the embedded database of usbid needs cgo.
+func describeEmbedded(id deviceID) string {
+	return fmt.Sprintf("Unknown %s:%s", id.vendor, id.product)
+}
+
+// embeddedUSBIDsUpdate returns false, because there is no embedded database without cgo.
+func embeddedUSBIDsUpdate() (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDualLabels(t *testing.T) {
+	oldHuman, oldDual := *humanReadable, *dualLabels
+	*humanReadable, *dualLabels = false, true
+	t.Cleanup(func() { *humanReadable, *dualLabels = oldHuman, oldDual })
+
+	desc := deviceID{vendor: 0x2341, product: 0x0043}
+	key := sanitizeKey(desc, "Uno (Arduino)")
+	assert.Equal(t, "Arduino_Uno", key)
+	assert.Equal(t, labels{
+		"nudl.squat.ai/Arduino_Uno": "true",
+		"nudl.squat.ai/2341_0043":   "true",
+	}, createLabels([]device{{ID: "2341_0043", Key: key}}))
+
+	// Devices of unknown vendors keep the hex key, e.g. without cgo and usb.ids file.
+	*humanReadable = true
+	unknown := deviceID{vendor: 0x10c4, product: 0xea60}
+	assert.Equal(t, "10c4_ea60", sanitizeKey(unknown, "Unknown 10c4:ea60"))
+}
+
+func TestCountLabelValue(t *testing.T) {
+	oldValue, oldOnly := *labelValue, *only
+	*labelValue = labelValueCount
+	t.Cleanup(func() { *labelValue, *only = oldValue, oldOnly })
+
+	ds := []device{{ID: "2341_0043", Key: "2341_0043"}, {ID: "2341_0043", Key: "2341_0043"}, {ID: "046d_c52b", Key: "046d_c52b"}}
+	assert.Equal(t, labels{
+		"nudl.squat.ai/2341_0043": "2",
+		"nudl.squat.ai/046d_c52b": "1",
+	}, createLabels(ds))
+
+	*only = []string{"2341_0043", "10c4_ea60"}
+	assert.Equal(t, labels{
+		"nudl.squat.ai/2341_0043": "2",
+		"nudl.squat.ai/10c4_ea60": "0",
+	}, createLabels(ds))
+}
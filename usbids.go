@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	usbIDsPath      = flag.String("usb-ids-path", "", "path of a usb.ids file that is used instead of the embedded database to describe usb devices, e.g. /usr/share/hwdata/usb.ids")
+	usbIDsURL       = flag.String("usb-ids-url", "", "URL of a usb.ids file that is downloaded and used instead of the embedded database to describe usb devices, e.g. https://www.linux-usb.org/usb.ids")
+	usbIDsSHA256    = flag.String("usb-ids-sha256", "", "hex encoded SHA-256 checksum that the usb.ids file of usb-ids-path or usb-ids-url must have; a file with a different checksum is rejected and the previous database is kept. The pinned file is only loaded on start, so usb-ids-refresh is disabled")
+	usbIDsSHA256URL = flag.String("usb-ids-sha256-url", "", "URL of a checksum file in the format of sha256sum that is downloaded every time the usb.ids file of usb-ids-path or usb-ids-url is loaded; a file with a different checksum is rejected and the previous database and usb-ids-cache are kept")
+	usbIDsCache     = flag.String("usb-ids-cache", "", "path where the last usb.ids file that was loaded successfully is saved, e.g. on an emptyDir volume; it is used on start if usb-ids-path or usb-ids-url can not be loaded")
+	usbIDsRefresh   = flag.Duration("usb-ids-refresh", 24*time.Hour, "period after which the usb.ids file of usb-ids-path or usb-ids-url is loaded again, 0 loads it only on start")
+)
+
+// usbVendor is a vendor of a usb.ids file with the names of its products.
+type usbVendor struct {
+	name     string
+	products map[usbID]string
+}
+
+// usbIDs are the vendors and products of the external usb.ids file.
+// If no file is loaded, the embedded database of usbid is used.
+var usbIDs = struct {
+	sync.RWMutex
+	vendors map[usbID]*usbVendor
+}{}
+
+// describeUSB returns the description of a device in the format of usbid.Describe, e.g. "Uno R3 (Arduino SA)".
+// Devices that are not in the external usb.ids file are looked up in the embedded database.
+func describeUSB(id deviceID) string {
+	usbIDs.RLock()
+	defer usbIDs.RUnlock()
+	if v, ok := usbIDs.vendors[id.vendor]; ok {
+		if p, ok := v.products[id.product]; ok {
+			return fmt.Sprintf("%s (%s)", p, v.name)
+		}
+	}
+	return describeEmbedded(id)
+}
+
+// parseUSBIDs parses the vendors and products of a usb.ids file.
+// The interfaces of the products and the sections after the vendors, e.g. the classes, are skipped.
+func parseUSBIDs(r io.Reader) (map[usbID]*usbVendor, error) {
+	vendors := make(map[usbID]*usbVendor)
+	var vendor *usbVendor
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		level := len(line) - len(strings.TrimLeft(line, "\t"))
+		id, name, ok := strings.Cut(line[level:], "  ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: malformed line %q", n, line)
+		}
+		if level == 0 && strings.Contains(id, " ") {
+			// The section of the line is not the vendors, e.g. C 03 for a class.
+			break
+		}
+		v, err := strconv.ParseUint(id, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: malformed id %q", n, id)
+		}
+		switch level {
+		case 0:
+			vendor = &usbVendor{name: name, products: make(map[usbID]string)}
+			vendors[usbID(v)] = vendor
+		case 1:
+			if vendor == nil {
+				return nil, fmt.Errorf("line %d: product without vendor", n)
+			}
+			vendor.products[usbID(v)] = name
+		}
+	}
+	return vendors, s.Err()
+}
+
+// setUSBIDs replaces the vendors of the external usb.ids file
+// and resets the cached names, so the devices are described with the new file.
+func setUSBIDs(vendors map[usbID]*usbVendor) {
+	usbIDs.Lock()
+	usbIDs.vendors = vendors
+	usbIDs.Unlock()
+	resetNameCache()
+}
+
+// usbIDsLoader loads a usb.ids file from a path or a URL.
+type usbIDsLoader struct {
+	path string
+	url  string
+	// sha256 is the hex encoded checksum the file must have, if it is not empty.
+	sha256 string
+	// sha256URL is the URL of the checksum file that is downloaded with every file, if it is not empty.
+	sha256URL string
+	// cache is the path of the copy of the last file that was loaded, if it is not empty.
+	cache  string
+	client *http.Client
+	// loaded is true if a file was used to describe the devices.
+	loaded bool
+}
+
+// warnUnnamedDevices warns if there is neither an embedded nor an external usb.ids database,
+// e.g. in a static build without --usb-ids-path, so the devices are not named.
+func warnUnnamedDevices(logger log.Logger) {
+	if _, ok := embeddedUSBIDsUpdate(); ok {
+		return
+	}
+	level.Warn(logger).Log("msg", "nudl was built without cgo and has no usb.ids database, so devices are described as unknown and keep their hex keys; set --usb-ids-path or --usb-ids-url to name them")
+}
+
+// maxUSBIDsSize is the maximum size of a usb.ids file, which is about 700 KB, so a broken server can not exhaust the memory.
+var maxUSBIDsSize int64 = 10 << 20
+
+// maxChecksumFileSize is the maximum size of a checksum file, which usually has a few lines.
+const maxChecksumFileSize = 64 << 10
+
+func newUSBIDsLoader() *usbIDsLoader {
+	return &usbIDsLoader{path: *usbIDsPath, url: *usbIDsURL, sha256: *usbIDsSHA256, sha256URL: *usbIDsSHA256URL, cache: *usbIDsCache, client: &http.Client{Timeout: time.Minute}}
+}
+
+// validateUSBIDsSHA256 returns an error if usb-ids-sha256 is not a SHA-256 checksum or there is no file to verify.
+// A pinned checksum would reject every updated file, so it can not be combined with a changed usb-ids-refresh.
+func validateUSBIDsSHA256() error {
+	if *usbIDsCache != "" && *usbIDsPath == "" && *usbIDsURL == "" {
+		return errors.New("usb-ids-cache requires usb-ids-path or usb-ids-url")
+	}
+	if *usbIDsSHA256URL != "" {
+		if *usbIDsSHA256 != "" {
+			return errors.New("usb-ids-sha256 and usb-ids-sha256-url are mutually exclusive")
+		}
+		if *usbIDsPath == "" && *usbIDsURL == "" {
+			return errors.New("usb-ids-sha256-url requires usb-ids-path or usb-ids-url")
+		}
+		if u, err := url.Parse(*usbIDsSHA256URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("usb-ids-sha256-url %q is not an http or https URL", *usbIDsSHA256URL)
+		}
+	}
+	if *usbIDsSHA256 == "" {
+		return nil
+	}
+	if *usbIDsPath == "" && *usbIDsURL == "" {
+		return errors.New("usb-ids-sha256 requires usb-ids-path or usb-ids-url")
+	}
+	if b, err := hex.DecodeString(*usbIDsSHA256); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("usb-ids-sha256 %q is not a hex encoded SHA-256 checksum", *usbIDsSHA256)
+	}
+	if f := flag.Lookup("usb-ids-refresh"); *usbIDsRefresh != 0 && f.Value.String() != f.DefValue {
+		return errors.New("usb-ids-sha256 and usb-ids-refresh are mutually exclusive, because a pinned file is never updated")
+	}
+	return nil
+}
+
+// open returns the usb.ids file.
+func (l *usbIDsLoader) open(ctx context.Context) (io.ReadCloser, error) {
+	if l.path != "" {
+		return os.Open(l.path)
+	}
+	return l.get(ctx, l.url)
+}
+
+// get returns the body of a successful GET request of the URL.
+func (l *usbIDsLoader) get(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status %q", res.Status)
+	}
+	return res.Body, nil
+}
+
+// load loads, verifies and parses the usb.ids file and returns its vendors and content.
+func (l *usbIDsLoader) load(ctx context.Context) (map[usbID]*usbVendor, []byte, error) {
+	r, err := l.open(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open usb.ids file: %w", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxUSBIDsSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read usb.ids file: %w", err)
+	}
+	if int64(len(data)) > maxUSBIDsSize {
+		return nil, nil, fmt.Errorf("usb.ids file is larger than %d bytes", maxUSBIDsSize)
+	}
+	if l.sha256URL != "" {
+		sum, err := l.loadSHA256(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not load checksum of usb.ids file: %w", err)
+		}
+		if err := verifySHA256(data, sum); err != nil {
+			return nil, nil, fmt.Errorf("usb.ids file does not match usb-ids-sha256-url: %w", err)
+		}
+	}
+	vendors, err := l.parse(data)
+	return vendors, data, err
+}
+
+// loadSHA256 downloads the checksum file of usb-ids-sha256-url and returns the checksum of the usb.ids file.
+func (l *usbIDsLoader) loadSHA256(ctx context.Context) (string, error) {
+	r, err := l.get(ctx, l.sha256URL)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxChecksumFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxChecksumFileSize {
+		return "", fmt.Errorf("checksum file is larger than %d bytes", maxChecksumFileSize)
+	}
+	name := path.Base(l.path)
+	if l.path == "" {
+		if u, err := url.Parse(l.url); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+	return parseChecksumFile(data, name)
+}
+
+// parseChecksumFile returns the checksum of the file with the name from a checksum file in the format of sha256sum,
+// e.g. "<checksum>  usb.ids". A file with a single checksum without a name is also accepted.
+func parseChecksumFile(data []byte, name string) (string, error) {
+	var sums []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+			continue
+		case len(fields) == 1:
+			sums = append(sums, fields[0])
+		case strings.TrimPrefix(fields[1], "*") == name:
+			return fields[0], nil
+		}
+	}
+	if len(sums) != 1 {
+		return "", fmt.Errorf("checksum file does not contain a checksum of %q", name)
+	}
+	return sums[0], nil
+}
+
+// parse verifies and parses the content of a usb.ids file.
+// A file with a different checksum than usb-ids-sha256 is rejected before it is parsed,
+// as well as a file without vendors, e.g. an error page of a proxy.
+func (l *usbIDsLoader) parse(data []byte) (map[usbID]*usbVendor, error) {
+	if l.sha256 != "" {
+		if err := verifySHA256(data, l.sha256); err != nil {
+			return nil, fmt.Errorf("usb.ids file does not match usb-ids-sha256: %w", err)
+		}
+	}
+	vendors, err := parseUSBIDs(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse usb.ids file: %w", err)
+	}
+	if len(vendors) == 0 {
+		return nil, errors.New("usb.ids file does not contain any vendors")
+	}
+	return vendors, nil
+}
+
+// loadCache loads the copy of the last file that was loaded.
+// The copy is verified like the file, so a copy of a file with another checksum is never used.
+func (l *usbIDsLoader) loadCache() (map[usbID]*usbVendor, error) {
+	data, err := os.ReadFile(l.cache)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cached usb.ids file: %w", err)
+	}
+	return l.parse(data)
+}
+
+// update loads the usb.ids file and uses it to describe the devices and saves a copy to usb-ids-cache.
+// If the file can not be loaded, the previous file is kept. On start, there is no previous file,
+// so the copy of usb-ids-cache is used, or the embedded database if there is none.
+func (l *usbIDsLoader) update(ctx context.Context, logger log.Logger) {
+	vendors, data, err := l.load(ctx)
+	if err != nil {
+		if !l.loaded && l.cache != "" {
+			cached, cerr := l.loadCache()
+			if cerr == nil {
+				setUSBIDs(cached)
+				l.loaded = true
+				level.Warn(logger).Log("msg", "could not load usb.ids file, using the cached copy", "err", err, "cache", l.cache, "vendors", len(cached))
+				return
+			}
+			if !errors.Is(cerr, os.ErrNotExist) {
+				level.Warn(logger).Log("msg", "could not load cached usb.ids file", "err", cerr, "cache", l.cache)
+			}
+		}
+		level.Warn(logger).Log("msg", "could not load usb.ids file, keeping the previous database", "err", err)
+		return
+	}
+	setUSBIDs(vendors)
+	l.loaded = true
+	level.Info(logger).Log("msg", "loaded usb.ids file", "vendors", len(vendors))
+	if l.cache != "" {
+		if err := writeFileAtomic(l.cache, data); err != nil {
+			level.Warn(logger).Log("msg", "could not save usb.ids file to the cache", "err", err)
+		}
+	}
+}
+
+// run loads the usb.ids file every usb-ids-refresh, until the context is cancelled.
+// The file is loaded on start by the caller, so the first scan already uses it.
+// A file pinned with usb-ids-sha256 is never loaded again, because an updated file would be rejected.
+func (l *usbIDsLoader) run(ctx context.Context, logger log.Logger) error {
+	if *usbIDsRefresh == 0 || l.sha256 != "" {
+		return nil
+	}
+	t := time.NewTicker(*usbIDsRefresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			l.update(ctx, logger)
+		}
+	}
+}
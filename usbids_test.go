@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUSBIDs = `# usb.ids
+2e8a  Raspberry Pi
+	000a  Pico
+`
+
+func TestUSBIDsLoader(t *testing.T) {
+	t.Cleanup(func() { setUSBIDs(nil) })
+	pico := deviceID{vendor: 0x2e8a, product: 0x000a}
+	arduino := deviceID{vendor: 0x2341, product: 0x0043}
+	assert.Equal(t, "Unknown 2e8a:000a", describeUSB(pico))
+
+	path := filepath.Join(t.TempDir(), "usb.ids")
+	require.NoError(t, os.WriteFile(path, []byte(testUSBIDs), 0o644))
+	l := &usbIDsLoader{path: path}
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico (Raspberry Pi)", describeUSB(pico))
+	assert.Equal(t, "Pico (Raspberry Pi)", lookupName(pico).description)
+	// Devices that are not in the file are described with the embedded database.
+	assert.Equal(t, describeEmbedded(arduino), describeUSB(arduino))
+
+	// The previous file is kept, if the file can not be loaded.
+	status := http.StatusOK
+	body := "<html>maintenance</html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	l = &usbIDsLoader{url: srv.URL, client: srv.Client()}
+	_, _, err := l.load(context.Background())
+	assert.Error(t, err)
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico (Raspberry Pi)", describeUSB(pico))
+
+	status = http.StatusNotFound
+	_, _, err = l.load(context.Background())
+	assert.Error(t, err)
+
+	status, body = http.StatusOK, "2e8a  Raspberry Pi Ltd\n\t000a  Pico W\n"
+	vendors, _, err := l.load(context.Background())
+	require.NoError(t, err)
+	setUSBIDs(vendors)
+	assert.Equal(t, "Pico W (Raspberry Pi Ltd)", lookupName(pico).description)
+
+	// A file that is larger than the limit is rejected.
+	oldMax := maxUSBIDsSize
+	maxUSBIDsSize = int64(len(body) - 1)
+	_, _, err = l.load(context.Background())
+	maxUSBIDsSize = oldMax
+	assert.ErrorContains(t, err, "larger than")
+
+	// A file with a different checksum is rejected and the previous database is kept.
+	sum := sha256.Sum256([]byte(body))
+	l.sha256 = strings.Repeat("0", 64)
+	body = "2e8a  Evil\n\t000a  Pico\n"
+	_, _, err = l.load(context.Background())
+	assert.ErrorContains(t, err, "does not match usb-ids-sha256")
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico W (Raspberry Pi Ltd)", lookupName(pico).description)
+
+	body = "2e8a  Raspberry Pi Ltd\n\t000a  Pico W\n"
+	l.sha256 = strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, _, err = l.load(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestUSBIDsCache(t *testing.T) {
+	t.Cleanup(func() { setUSBIDs(nil) })
+	pico := deviceID{vendor: 0x2e8a, product: 0x000a}
+	dir := t.TempDir()
+	path, cache := filepath.Join(dir, "usb.ids"), filepath.Join(dir, "cache", "usb.ids")
+	require.NoError(t, os.Mkdir(filepath.Dir(cache), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(testUSBIDs), 0o644))
+	(&usbIDsLoader{path: path, cache: cache}).update(context.Background(), log.NewNopLogger())
+	data, err := os.ReadFile(cache)
+	require.NoError(t, err)
+	assert.Equal(t, testUSBIDs, string(data))
+
+	// After a restart, the cached copy is used, if the file can not be loaded.
+	setUSBIDs(nil)
+	require.NoError(t, os.WriteFile(path, []byte("<html>maintenance</html>"), 0o644))
+	l := &usbIDsLoader{path: path, cache: cache}
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico (Raspberry Pi)", describeUSB(pico))
+	data, err = os.ReadFile(cache)
+	require.NoError(t, err)
+	assert.Equal(t, testUSBIDs, string(data))
+
+	// A cached copy with another checksum is not used.
+	setUSBIDs(nil)
+	l = &usbIDsLoader{path: path, cache: cache, sha256: strings.Repeat("0", 64)}
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, describeEmbedded(pico), describeUSB(pico))
+}
+
+func TestUSBIDsSHA256URL(t *testing.T) {
+	t.Cleanup(func() { setUSBIDs(nil) })
+	pico := deviceID{vendor: 0x2e8a, product: 0x000a}
+	body := testUSBIDs
+	sum := sha256.Sum256([]byte(body))
+	sums := hex.EncodeToString(sum[:]) + "  usb.ids\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/SHA256SUMS" {
+			w.Write([]byte(sums))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	cache := filepath.Join(t.TempDir(), "usb.ids")
+	l := &usbIDsLoader{url: srv.URL + "/usb.ids", sha256URL: srv.URL + "/SHA256SUMS", cache: cache, client: srv.Client()}
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico (Raspberry Pi)", describeUSB(pico))
+
+	// A poisoned download is rejected, and the previous database and cached copy are kept.
+	body = "2e8a  Evil\n\t000a  Pico\n"
+	_, _, err := l.load(context.Background())
+	assert.ErrorContains(t, err, "does not match usb-ids-sha256-url")
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico (Raspberry Pi)", describeUSB(pico))
+	data, err := os.ReadFile(cache)
+	require.NoError(t, err)
+	assert.Equal(t, testUSBIDs, string(data))
+
+	// After a restart, the cached copy is used instead of the poisoned download.
+	setUSBIDs(nil)
+	l = &usbIDsLoader{url: srv.URL + "/usb.ids", sha256URL: srv.URL + "/SHA256SUMS", cache: cache, client: srv.Client()}
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico (Raspberry Pi)", describeUSB(pico))
+
+	// An updated file with an updated checksum is used.
+	body = "2e8a  Raspberry Pi Ltd\n\t000a  Pico W\n"
+	sum = sha256.Sum256([]byte(body))
+	sums = "# checksums\n" + strings.Repeat("0", 64) + "  other.ids\n" + hex.EncodeToString(sum[:]) + " *usb.ids\n"
+	l.update(context.Background(), log.NewNopLogger())
+	assert.Equal(t, "Pico W (Raspberry Pi Ltd)", describeUSB(pico))
+	data, err = os.ReadFile(cache)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(data))
+
+	// A checksum file without the checksum of the file is rejected.
+	sums = strings.Repeat("0", 64) + "  other.ids\n"
+	_, _, err = l.load(context.Background())
+	assert.ErrorContains(t, err, "does not contain a checksum")
+}
+
+func TestParseChecksumFile(t *testing.T) {
+	a, b := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	for _, tc := range []struct {
+		name string
+		data string
+		want string
+		err  bool
+	}{
+		{name: "single checksum", data: a + "\n", want: a},
+		{name: "named", data: b + "  other.ids\n" + a + "  usb.ids\n", want: a},
+		{name: "binary mode", data: a + " *usb.ids\n", want: a},
+		{name: "missing", data: b + "  other.ids\n", err: true},
+		{name: "ambiguous", data: a + "\n" + b + "\n", err: true},
+		{name: "empty", data: "", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseChecksumFile([]byte(tc.data), "usb.ids")
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestValidateUSBIDsSHA256(t *testing.T) {
+	oldURL, oldSum, oldSumURL, oldRefresh, oldCache := *usbIDsURL, *usbIDsSHA256, *usbIDsSHA256URL, *usbIDsRefresh, *usbIDsCache
+	t.Cleanup(func() {
+		*usbIDsURL, *usbIDsSHA256, *usbIDsSHA256URL, *usbIDsRefresh, *usbIDsCache = oldURL, oldSum, oldSumURL, oldRefresh, oldCache
+	})
+
+	*usbIDsCache = "/var/cache/nudl/usb.ids"
+	assert.Error(t, validateUSBIDsSHA256())
+	*usbIDsCache = ""
+
+	assert.NoError(t, validateUSBIDsSHA256())
+	*usbIDsSHA256 = strings.Repeat("a", 64)
+	assert.Error(t, validateUSBIDsSHA256())
+	*usbIDsURL = "https://www.linux-usb.org/usb.ids"
+	assert.NoError(t, validateUSBIDsSHA256())
+	// A pinned file is never refreshed.
+	*usbIDsRefresh = time.Hour
+	assert.Error(t, validateUSBIDsSHA256())
+	*usbIDsRefresh = 0
+	assert.NoError(t, validateUSBIDsSHA256())
+	*usbIDsSHA256 = "abc"
+	assert.Error(t, validateUSBIDsSHA256())
+
+	// A checksum file is downloaded with every file, so it can be refreshed.
+	*usbIDsSHA256, *usbIDsRefresh = "", time.Hour
+	*usbIDsSHA256URL = "https://example.com/SHA256SUMS"
+	assert.NoError(t, validateUSBIDsSHA256())
+	*usbIDsSHA256 = strings.Repeat("a", 64)
+	assert.Error(t, validateUSBIDsSHA256())
+	*usbIDsSHA256 = ""
+	*usbIDsSHA256URL = "file:///SHA256SUMS"
+	assert.Error(t, validateUSBIDsSHA256())
+	*usbIDsURL, *usbIDsSHA256URL = "", "https://example.com/SHA256SUMS"
+	assert.Error(t, validateUSBIDsSHA256())
+}
+
+func TestParseUSBIDs(t *testing.T) {
+	vendors, err := parseUSBIDs(strings.NewReader(`# usb.ids
+2341  Arduino SA
+	0043  Uno R3 (CDC ACM)
+		00  Interface
+2e8a  Raspberry Pi
+
+# The classes are not parsed.
+C 00  (Defined at Interface level)
+	00  Unused
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[usbID]*usbVendor{
+		0x2341: {name: "Arduino SA", products: map[usbID]string{0x0043: "Uno R3 (CDC ACM)"}},
+		0x2e8a: {name: "Raspberry Pi", products: map[usbID]string{}},
+	}, vendors)
+
+	_, err = parseUSBIDs(strings.NewReader("<html>maintenance</html>\n"))
+	assert.Error(t, err)
+	_, err = parseUSBIDs(strings.NewReader("\t0043  Uno\n"))
+	assert.Error(t, err)
+}
+
+func TestWarnUnnamedDevices(t *testing.T) {
+	var b strings.Builder
+	warnUnnamedDevices(log.NewLogfmtLogger(&b))
+	_, embedded := embeddedUSBIDsUpdate()
+	assert.Equal(t, !embedded, strings.Contains(b.String(), "--usb-ids-path"))
+}
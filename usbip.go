@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	remoteDevicesLabel   = "label"
+	remoteDevicesExclude = "exclude"
+)
+
+var remoteDevices = flag.String("remote-devices", "", fmt.Sprintf("handle usb devices that are attached over usbip to the vhci_hcd host controller: %s adds a label <key>.remote=true, %s does not label them; by default they are labeled like local devices", remoteDevicesLabel, remoteDevicesExclude))
+
+// validateRemoteDevices returns an error if remote-devices is unknown.
+func validateRemoteDevices() error {
+	switch *remoteDevices {
+	case "", remoteDevicesLabel, remoteDevicesExclude:
+		return nil
+	}
+	return fmt.Errorf("remote devices %q unknown; possible values are: %s, %s", *remoteDevices, remoteDevicesLabel, remoteDevicesExclude)
+}
+
+// usbBus returns the bus of a usb device from its port, e.g. 3 for 3-1.2 or for the root hub usb3.
+func usbBus(d device) string {
+	if bus, ok := strings.CutPrefix(d.Port, "usb"); ok {
+		return bus
+	}
+	bus, _, _ := strings.Cut(d.Port, "-")
+	return bus
+}
+
+// remoteScanner marks the usb devices of the wrapped scanner that are attached over usbip.
+type remoteScanner struct {
+	scanner
+	root string
+}
+
+func (s remoteScanner) Scan(ctx context.Context) ([]device, error) {
+	ds, err := s.scanner.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buses, err := vhciBuses(s.root)
+	if err != nil {
+		return nil, fmt.Errorf("could not find usbip buses: %w", err)
+	}
+	for i := range ds {
+		if isUSB(ds[i]) && ds[i].Port != "" && buses[usbBus(ds[i])] {
+			ds[i].Remote = true
+		}
+	}
+	return ds, nil
+}
+
+// addRemoteLabels adds a label <key>.remote=true for every device that is labeled and attached over usbip,
+// so workloads can avoid devices with the reliability of the network.
+func addRemoteLabels(l labels, ds []device) {
+	for _, d := range ds {
+		if !d.Remote {
+			continue
+		}
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		l[sprintLabelKey(suffixKey(d.Key, ".remote"))] = "true"
+	}
+}
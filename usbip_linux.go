@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vhciBuses returns the buses of the vhci_hcd host controllers of usbip.
+// The root hubs in sysfs, e.g. usb3, link to the host controller, e.g. devices/platform/vhci_hcd.0/usb3.
+func vhciBuses(root string) (map[string]bool, error) {
+	dir := filepath.Join(root, "bus", "usb", "devices")
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	buses := make(map[string]bool)
+	for _, e := range es {
+		bus, ok := strings.CutPrefix(e.Name(), "usb")
+		if !ok {
+			continue
+		}
+		p, err := filepath.EvalSymlinks(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range strings.Split(p, string(filepath.Separator)) {
+			if strings.HasPrefix(c, "vhci_hcd") {
+				buses[bus] = true
+				break
+			}
+		}
+	}
+	return buses, nil
+}
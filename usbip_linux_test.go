@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteScanner(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"pci0000:00/0000:00:14.0/usb1", "platform/vhci_hcd.0/usb3"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "devices", p), 0o755))
+	}
+	dir := filepath.Join(root, "bus", "usb", "devices")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.Symlink("../../../devices/pci0000:00/0000:00:14.0/usb1", filepath.Join(dir, "usb1")))
+	require.NoError(t, os.Symlink("../../../devices/platform/vhci_hcd.0/usb3", filepath.Join(dir, "usb3")))
+
+	s := remoteScanner{scanner: fakeScanner{name: "usb", scan: func(context.Context) ([]device, error) {
+		return []device{
+			{ID: "10c4_ea60", Key: "CP2102", Port: "1-2"},
+			{ID: "2341_0043", Key: "Uno", Port: "3-1"},
+			{ID: "pci-10de_2204", Key: "pci-10de_2204", Port: "0000:01:00.0"},
+		}, nil
+	}}, root: root}
+	ds, err := s.Scan(context.Background())
+	require.NoError(t, err)
+	remote := make(map[string]bool, len(ds))
+	for _, d := range ds {
+		remote[d.Key] = d.Remote
+	}
+	assert.Equal(t, map[string]bool{"CP2102": false, "Uno": true, "pci-10de_2204": false}, remote)
+}
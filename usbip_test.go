@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUSBBus(t *testing.T) {
+	assert.Equal(t, "3", usbBus(device{Port: "usb3"}))
+	assert.Equal(t, "3", usbBus(device{Port: "3-1.2"}))
+	assert.Equal(t, "12", usbBus(device{Port: "12-4"}))
+}
+
+func TestRemoteDevices(t *testing.T) {
+	ds := []device{
+		{ID: "10c4_ea60", Key: "CP2102", Port: "1-2"},
+		{ID: "2341_0043", Key: "Uno", Port: "3-1", Remote: true},
+	}
+
+	l := createLabels(ds)
+	assert.Equal(t, labels{"nudl.squat.ai/CP2102": "true", "nudl.squat.ai/Uno": "true"}, l)
+
+	*remoteDevices = remoteDevicesLabel
+	defer func() { *remoteDevices = "" }()
+	l = createLabels(ds)
+	assert.Equal(t, labels{"nudl.squat.ai/CP2102": "true", "nudl.squat.ai/Uno": "true", "nudl.squat.ai/Uno.remote": "true"}, l)
+
+	*remoteDevices = remoteDevicesExclude
+	l = createLabels(ds)
+	assert.Equal(t, labels{"nudl.squat.ai/CP2102": "true"}, l)
+
+	*remoteDevices = "ignore"
+	assert.Error(t, validateRemoteDevices())
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// configCheck validates flags that belong together.
+type configCheck struct {
+	check func() error
+	// example is a valid configuration that is printed with the error.
+	example string
+}
+
+// configErrors are all problems of the configuration, so they can be fixed at once.
+type configErrors []configError
+
+type configError struct {
+	err     error
+	example string
+}
+
+func (e configErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration with %d problem(s):", len(e))
+	for _, ce := range e {
+		fmt.Fprintf(&b, "\n  - %v", ce.err)
+		if ce.example != "" {
+			fmt.Fprintf(&b, "\n    e.g. %s", ce.example)
+		}
+	}
+	return b.String()
+}
+
+func (e configErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, ce := range e {
+		errs = append(errs, ce.err)
+	}
+	return errs
+}
+
+// configChecks returns the checks of the flags, in the order of the errors.
+func configChecks() []configCheck {
+	return []configCheck{
+		{check: func() error {
+			if errs := validation.IsDNS1123Subdomain(*labelPrefix); len(errs) > 0 {
+				return fmt.Errorf("invalid --label-prefix %q: %s", *labelPrefix, strings.Join(errs, "; "))
+			}
+			return nil
+		}, example: "--label-prefix=devic.es"},
+		{check: func() error {
+			if *publishMode != publishModeLabels && *publishMode != publishModeAnnotations && *publishMode != publishModeBoth {
+				return fmt.Errorf("publish mode %q unknown; possible values are: %s, %s, %s", *publishMode, publishModeLabels, publishModeAnnotations, publishModeBoth)
+			}
+			return nil
+		}, example: "--publish-mode=" + publishModeBoth},
+		{check: func() error {
+			if *longLabelStrategy != longLabelStrategyHex && *longLabelStrategy != longLabelStrategyTruncate && *longLabelStrategy != longLabelStrategyHash {
+				return fmt.Errorf("long label strategy %q unknown; possible values are: %s, %s, %s", *longLabelStrategy, longLabelStrategyHex, longLabelStrategyTruncate, longLabelStrategyHash)
+			}
+			return nil
+		}, example: "--long-label-strategy=" + longLabelStrategyHash},
+		{check: func() error {
+			if _, err := parseClassSpecs(*classes); err != nil {
+				return fmt.Errorf("invalid --class: %w", err)
+			}
+			return nil
+		}, example: "--class=hid,02:02"},
+		{check: func() error {
+			if _, err := parseClassSpecs(*noClasses); err != nil {
+				return fmt.Errorf("invalid --no-class: %w", err)
+			}
+			return nil
+		}, example: "--no-class=hub"},
+		{check: func() error {
+			if *labelTemplate == "" {
+				return nil
+			}
+			_, err := parseLabelTemplate(*labelTemplate)
+			return err
+		}, example: "--label-template='{{.VendorName}}_{{.ProductID}}'"},
+		{check: func() error {
+			if *labelValue != labelValueBool && *labelValue != labelValueCount && *labelValue != labelValueLastSeen && *labelValue != labelValueState {
+				return fmt.Errorf("label value %q unknown; possible values are: %s, %s, %s, %s", *labelValue, labelValueBool, labelValueCount, labelValueLastSeen, labelValueState)
+			}
+			return nil
+		}, example: "--label-value=" + labelValueCount},
+		{check: func() error {
+			if *valueTemplate == "" {
+				return nil
+			}
+			if *labelValue != labelValueBool {
+				return fmt.Errorf("label-value and value-template are mutually exclusive")
+			}
+			_, err := parseValueTemplate(*valueTemplate)
+			return err
+		}, example: "--value-template='{{.Speed}}'"},
+		{check: func() error {
+			_, err := levelOption(*logLevel)
+			return err
+		}, example: "--log-level=" + logLevelDebug},
+		{check: validateUSBBackend, example: "--usb-backend=" + usbBackendSysfs},
+		{check: validateKeySanitizers, example: "--key-sanitizers=transliterate,collapse-dashes,trim"},
+		{check: validatePresets, example: "--preset=ignore-internal"},
+		{check: validateOnly, example: "--only=10c4_ea60,10c4_*"},
+		{check: validateOnlyPorts, example: "--only-port=1-1.4,1-2.*"},
+		{check: validateRemoteDevices, example: "--remote-devices=" + remoteDevicesLabel},
+		{check: validateI2C, example: "--scan-i2c --scan-gpio"},
+		{check: validateStorageSizeBuckets, example: "--storage-size-buckets=16,32,64"},
+		{check: validateRules, example: "--rules-file=/etc/nudl/rules.yaml"},
+		{check: validateRateLimits, example: "--kube-api-qps=5 --kube-api-burst=10"},
+		{check: validateNodes, example: "--node-selector=usb-server=rack-1"},
+		{check: func() error {
+			_, err := preserveExps()
+			return err
+		}, example: "--preserve-labels='nudl.squat.ai/pinned-.*'"},
+		{check: func() error {
+			if *mode != modeAgent && *mode != modeController {
+				return fmt.Errorf("mode %q unknown; possible values are: %s, %s", *mode, modeAgent, modeController)
+			}
+			return nil
+		}, example: "--mode=" + modeController},
+		{check: func() error {
+			_, err := labelPrefixSpecs()
+			return err
+		}, example: "--extra-label-prefix='devic.es,no-contain=hub|bridge'"},
+		{check: func() error {
+			if *deviceNamesFile == "" {
+				return nil
+			}
+			_, err := loadDeviceNames(*deviceNamesFile)
+			return err
+		}, example: "--device-names-file=/etc/nudl/names.yaml"},
+		{check: func() error {
+			if *usbIDsPath != "" && *usbIDsURL != "" {
+				return fmt.Errorf("usb-ids-path and usb-ids-url are mutually exclusive")
+			}
+			return nil
+		}, example: "--usb-ids-path=/usr/share/hwdata/usb.ids"},
+		{check: func() error {
+			if *replay != "" && *scannerKind != "usb" {
+				return fmt.Errorf("replay selects the scanner for the file itself and can not be combined with --scanner=%s", *scannerKind)
+			}
+			return nil
+		}, example: "--replay=dump.json"},
+		{check: validateUSBIDsSHA256, example: "--usb-ids-url=https://www.linux-usb.org/usb.ids --usb-ids-sha256=<sha256sum of the file>"},
+		{check: func() error {
+			if *cordonMissing && len(*requiredDevices) == 0 {
+				return fmt.Errorf("cordon-missing requires required-devices")
+			}
+			return nil
+		}, example: "--cordon-missing --required-devices=10c4_ea60"},
+		{check: func() error {
+			if *taintWhenMissing == "" {
+				return nil
+			}
+			if len(*only) == 0 {
+				return fmt.Errorf("taint-when-missing requires only")
+			}
+			if _, err := parseTaint(*taintWhenMissing); err != nil {
+				return fmt.Errorf("invalid --taint-when-missing: %w", err)
+			}
+			return nil
+		}, example: "--only=10c4_ea60 --taint-when-missing=nudl.squat.ai/missing:NoSchedule"},
+		{check: validateSink, example: "--sink=" + sinkKubernetes},
+		{check: validateMigration, example: "--migrate-from-prefix=squat.ai --migrate-until=2024-06-01T00:00:00Z"},
+		{check: validateListenAddress, example: "--listen-address=unix:///run/nudl/metrics.sock"},
+		{check: validateListenFailurePolicy, example: "--listen-failure-policy=" + listenFailurePolicyRetry},
+		{check: validatePatchStrategy, example: "--patch-strategy=" + patchStrategyJSON},
+		{check: validateCleanup, example: "--node=node1 --prefix=squat.ai"},
+		{check: validateScannerExecs, example: "--scanner-exec=/usr/local/bin/detect-rack"},
+		{check: validateMetricsTLS, example: "--metrics-cert-file=/etc/nudl/tls.crt --metrics-key-file=/etc/nudl/tls.key"},
+		{check: validateOwnerTimeout, example: "--resync-period=5m --owner-timeout=15m"},
+		{check: validateLifecycle, example: "--enable-lifecycle --metrics-bearer-token-file=/etc/nudl/token"},
+		{check: validateSysfs, example: "--sysfs-root=/sys"},
+		{check: validatePublishQueue, example: "--publish-queue-size=100 --publish-retries=3"},
+	}
+}
+
+// validateConfig runs all checks of the flags and returns all problems at once,
+// so a configuration does not have to be fixed one error at a time.
+func validateConfig() error {
+	var errs configErrors
+	for _, c := range configChecks() {
+		if err := c.check(); err != nil {
+			errs = append(errs, configError{err: err, example: c.example})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// isConfigError returns true if the error is a problem of the configuration.
+func isConfigError(err error) bool {
+	var ce configErrors
+	return errors.As(err, &ce)
+}
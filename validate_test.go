@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	require.NoError(t, validateConfig())
+
+	oldPrefix, oldValue, oldClasses := *labelPrefix, *labelValue, *classes
+	*labelPrefix, *labelValue, *classes = "Nudl_Squat", "maybe", []string{"nope"}
+	t.Cleanup(func() { *labelPrefix, *labelValue, *classes = oldPrefix, oldValue, oldClasses })
+
+	err := validateConfig()
+	require.Error(t, err)
+	assert.True(t, isConfigError(err))
+	assert.Equal(t, 2, exitCode(err))
+	var ce configErrors
+	require.ErrorAs(t, err, &ce)
+	// Every problem is reported at once with an example.
+	assert.Len(t, ce, 3)
+	assert.Contains(t, err.Error(), "invalid configuration with 3 problem(s)")
+	assert.Contains(t, err.Error(), `invalid --label-prefix "Nudl_Squat"`)
+	assert.Contains(t, err.Error(), "e.g. --label-prefix=devic.es")
+	assert.Contains(t, err.Error(), "invalid --class")
+	assert.Contains(t, err.Error(), "e.g. --class=hid,02:02")
+	assert.Contains(t, err.Error(), `label value "maybe" unknown`)
+}
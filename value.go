@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	flag "github.com/spf13/pflag"
+)
+
+var valueTemplate = flag.String("value-template", "", "Go template for the values of the device labels that replaces label-value, with the fields .Count, .Speed, .Bus, .Port, .Ports and .Version of the devices of a label, e.g. '{{.Speed}}'; the result is sanitized and truncated to 63 characters")
+
+// maxLabelValueLength is the maximum length of a label value.
+const maxLabelValueLength = 63
+
+// labelValueData are the fields of the devices of a label that can be used in value-template.
+type labelValueData struct {
+	// Count is the number of attached devices, 0 for absent devices of only.
+	Count int
+	// Speed is the fastest negotiated speed of the devices, e.g. high or super, if it is known.
+	Speed string
+	// Bus is the usb bus number of the first device, e.g. 1.
+	Bus string
+	// Port is the port path of the first device, e.g. 1-2.3.
+	Port string
+	// Ports are the sorted port paths of all devices.
+	Ports []string
+	// Version is the lowest device release number of the devices, e.g. 1.0.4, if it is known.
+	Version string
+}
+
+// speedRank orders the speeds, so the fastest speed of multiple devices can be chosen.
+var speedRank = map[string]int{
+	speedLow:   1,
+	speedFull:  2,
+	speedHigh:  3,
+	speedSuper: 4,
+}
+
+func newLabelValueData(ds []device) labelValueData {
+	vd := labelValueData{Count: len(ds)}
+	for _, d := range ds {
+		if speedRank[d.Speed] > speedRank[vd.Speed] {
+			vd.Speed = d.Speed
+		}
+		if d.Port != "" {
+			vd.Ports = append(vd.Ports, d.Port)
+		}
+		if d.Version != "" && (vd.Version == "" || versionLess(d.Version, vd.Version)) {
+			vd.Version = d.Version
+		}
+	}
+	sort.Strings(vd.Ports)
+	if len(vd.Ports) > 0 {
+		vd.Port = vd.Ports[0]
+		vd.Bus, _, _ = strings.Cut(strings.TrimPrefix(vd.Port, "usb"), "-")
+	}
+	return vd
+}
+
+// parseValueTemplate parses the template and executes it for an attached and an absent example device,
+// so invalid templates are rejected on start.
+func parseValueTemplate(text string) (*template.Template, error) {
+	t, err := template.New("value").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse value template: %w", err)
+	}
+	for _, ds := range [][]device{{{ID: "2341_0043", Port: "1-2.3", Speed: speedFull, Version: "1.0.4"}}, nil} {
+		if _, err := executeValueTemplate(t, ds); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// executeValueTemplate returns the sanitized label value for the devices of a label.
+// Characters that are not allowed in label values are replaced, the value is truncated to 63 characters
+// and must start and end with an alphanumeric character, or be empty.
+func executeValueTemplate(t *template.Template, ds []device) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, newLabelValueData(ds)); err != nil {
+		return "", fmt.Errorf("could not execute value template: %w", err)
+	}
+	v := regTrim.ReplaceAllString(buf.String(), "-")
+	if len(v) > maxLabelValueLength {
+		v = v[:maxLabelValueLength]
+	}
+	return strings.Trim(v, "-_."), nil
+}
+
+// labelValueFunc returns the function that generates the value of a label from its devices,
+// according to value-template and label-value.
+func labelValueFunc() func([]device) string {
+	boolValue := func(ds []device) string {
+		return strconv.FormatBool(len(ds) > 0)
+	}
+	if *valueTemplate != "" {
+		t, err := parseValueTemplate(*valueTemplate)
+		if err != nil {
+			// The template is validated on start.
+			return boolValue
+		}
+		return func(ds []device) string {
+			v, err := executeValueTemplate(t, ds)
+			if err != nil {
+				return boolValue(ds)
+			}
+			return v
+		}
+	}
+	switch *labelValue {
+	case labelValueCount:
+		return func(ds []device) string {
+			return strconv.Itoa(len(ds))
+		}
+	case labelValueLastSeen:
+		return lastSeenValue
+	case labelValueState:
+		return stateValue
+	}
+	return boolValue
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueTemplate(t *testing.T) {
+	ds := []device{{ID: "0781_5581", Port: "2-1", Speed: "super"}, {ID: "0781_5581", Port: "1-2.3", Speed: "high"}}
+	for _, tc := range []struct {
+		name     string
+		template string
+		ds       []device
+		want     string
+		err      bool
+	}{
+		{name: "speed", template: "{{.Speed}}", ds: ds, want: "super"},
+		{name: "count", template: "{{.Count}}", ds: ds, want: "2"},
+		{name: "bus and port", template: "bus{{.Bus}}_{{.Port}}", ds: ds, want: "bus1_1-2.3"},
+		{name: "ports", template: `{{range .Ports}}{{.}}_{{end}}`, ds: ds, want: "1-2.3_2-1"},
+		{name: "absent", template: "{{.Count}}{{.Speed}}", want: "0"},
+		{name: "sanitized and trimmed", template: "-{{.Speed}} usb-", ds: ds, want: "super-usb"},
+		{name: "truncated", template: strings.Repeat("x", 70), ds: ds, want: strings.Repeat("x", 63)},
+		{name: "unknown field", template: "{{.Vendor}}", err: true},
+		{name: "fails for absent devices", template: "{{index .Ports 0}}", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseValueTemplate(tc.template)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			v, err := executeValueTemplate(tmpl, tc.ds)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, v)
+		})
+	}
+}
+
+func TestCreateLabelsValueTemplate(t *testing.T) {
+	*valueTemplate = "{{.Speed}}"
+	*only = []string{"Ultra", "Uno"}
+	defer func() { *valueTemplate, *only = "", []string{} }()
+	ds := []device{{ID: "0781_5581", Key: "Ultra", Speed: "super"}}
+	assert.Equal(t, labels{"nudl.squat.ai/Ultra": "super", "nudl.squat.ai/Uno": ""}, createLabels(ds))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var vendorLabels = flag.Bool("vendor-labels", false, "additionally label the node with an aggregate label vendor-<vendor> for every vendor of the labeled devices, e.g. vendor-Silicon-Labs or vendor-10c4 with --human-readable=false")
+
+// vendorKeys returns the keys of the vendor labels of a device, e.g. vendor-10c4 and vendor-Silicon-Labs with dual-labels.
+// Pci vendors are prefixed like pci devices, device nodes do not have a vendor.
+func vendorKeys(d device) []string {
+	vendor, _, ok := vendorProduct(d)
+	if !ok {
+		return nil
+	}
+	prefix := "vendor-"
+	switch {
+	case isPCI(d):
+		prefix = pciPrefix + prefix
+	case isThunderbolt(d):
+		prefix = thunderboltPrefix + prefix
+	}
+	var keys []string
+	if !*humanReadable || *dualLabels {
+		keys = append(keys, prefix+vendor)
+	}
+	if *humanReadable || *dualLabels {
+		name := vendor
+		if regParse.MatchString(d.Description) {
+			if n := regParse.ReplaceAllString(d.Description, "$2"); n != "Unknown" {
+				name = n
+			}
+		}
+		k := strings.Trim(regTrim.ReplaceAllString(prefix+name, "-"), "-_.")
+		if len(k) > maxLabelNameLength {
+			k = strings.TrimRight(k[:maxLabelNameLength], "-_.")
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// addVendorLabels adds an aggregate label for every vendor of the devices that are labeled,
+// so workloads can select nodes with any adapter of a vendor.
+// The value is the number of devices of the vendor, if label-value is count.
+func addVendorLabels(l labels, ds []device) {
+	counts := make(map[string]int)
+	for _, d := range ds {
+		if v, ok := l[sprintLabelKey(d.Key)]; !ok || v == "false" || v == "0" {
+			continue
+		}
+		for _, k := range vendorKeys(d) {
+			counts[k]++
+		}
+	}
+	for k, n := range counts {
+		v := "true"
+		if *labelValue == labelValueCount {
+			v = strconv.Itoa(n)
+		}
+		l[sprintLabelKey(k)] = v
+	}
+}
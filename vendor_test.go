@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVendorLabels(t *testing.T) {
+	*vendorLabels = true
+	defer func() { *vendorLabels = false }()
+	ds := []device{
+		{ID: "10c4_ea60", Key: "Silicon-Labs_CP210x-UART-Bridge", Description: "CP210x UART Bridge (Silicon Labs)"},
+		{ID: "10c4_ea70", Key: "Silicon-Labs_CP2105-Dual-UART-Bridge", Description: "CP2105 Dual UART Bridge (Silicon Labs)"},
+		{ID: "2e8a_000a", Key: "2e8a_000a", Description: "Unknown 2e8a:000a"},
+		{ID: "pci-10de_2204", Key: "pci-NVIDIA-Corporation_GA102", Description: "GA102 (NVIDIA Corporation)"},
+		{ID: "dev-video0", Key: "dev-video0", Description: "Unknown (video0)"},
+	}
+	l := createLabels(ds)
+	assert.Equal(t, "true", l["nudl.squat.ai/vendor-Silicon-Labs"])
+	assert.Equal(t, "true", l["nudl.squat.ai/vendor-2e8a"])
+	assert.Equal(t, "true", l["nudl.squat.ai/pci-vendor-NVIDIA-Corporation"])
+	assert.Len(t, l, 8)
+
+	*humanReadable, *labelValue = false, labelValueCount
+	defer func() { *humanReadable, *labelValue = true, labelValueBool }()
+	ds[0].Key, ds[1].Key = ds[0].ID, ds[1].ID
+	l = createLabels(ds)
+	assert.Equal(t, "2", l["nudl.squat.ai/vendor-10c4"])
+	assert.NotContains(t, l, "nudl.squat.ai/vendor-Silicon-Labs")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	flag "github.com/spf13/pflag"
+)
+
+const webhookSignatureHeader = "X-Nudl-Signature"
+
+var (
+	webhookURL          = flag.String("webhook-url", "", "URL to POST the inventory as JSON to on changes and after resync-period. The webhook is disabled if empty.")
+	webhookSecretFile   = flag.String("webhook-secret-file", "", "path to a file containing the secret to sign the request body with HMAC-SHA256, the signature is sent in the "+webhookSignatureHeader+" header")
+	webhookRetries      = flag.Int("webhook-retries", 3, "number of retries for failed webhook requests, the retries are bounded by publish-timeout")
+	webhookRetryBackoff = flag.Duration("webhook-retry-backoff", 500*time.Millisecond, "backoff before the first retry of a webhook request, it is doubled for every retry")
+	webhookTLS          = newTLSFlags("webhook", "webhook server")
+)
+
+// webhookPublisher POSTs the inventory to a URL.
+// Events are not published, because the receiver gets the full inventory on every change.
+type webhookPublisher struct {
+	client  *http.Client
+	url     string
+	secret  []byte
+	retries int
+	backoff time.Duration
+	logger  log.Logger
+}
+
+func newWebhookPublisher(logger log.Logger) (*webhookPublisher, error) {
+	if *webhookRetries < 0 {
+		return nil, fmt.Errorf("webhook retries must not be negative, got %d", *webhookRetries)
+	}
+	p := &webhookPublisher{
+		client:  &http.Client{},
+		url:     *webhookURL,
+		retries: *webhookRetries,
+		backoff: *webhookRetryBackoff,
+		logger:  logger,
+	}
+	if *webhookSecretFile != "" {
+		s, err := os.ReadFile(*webhookSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read webhook secret file: %w", err)
+		}
+		p.secret = []byte(strings.TrimSpace(string(s)))
+	}
+	if webhookTLS.enabled() {
+		t, err := webhookTLS.transport()
+		if err != nil {
+			return nil, err
+		}
+		p.client.Transport = t
+	}
+	return p, nil
+}
+
+func (p *webhookPublisher) Name() string {
+	return "webhook"
+}
+
+func (p *webhookPublisher) PublishInventory(ctx context.Context, inv inventory) error {
+	body, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	backoff := p.backoff
+	for i := 0; ; i++ {
+		retry, err := p.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || i >= p.retries {
+			return err
+		}
+		level.Debug(p.logger).Log("msg", "retrying webhook request", "err", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %w", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends the body to the webhook.
+// It returns true, if the request failed and can be retried.
+func (p *webhookPublisher) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.secret != nil {
+		req.Header.Set(webhookSignatureHeader, "sha256="+sign(p.secret, body))
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+	// Drain the body to reuse the connection.
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook responded with status %s", res.Status)
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+}
+
+func (p *webhookPublisher) PublishEvents(_ context.Context, _ []event) error {
+	return nil
+}
+
+func (p *webhookPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body.
+func sign(secret, body []byte) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	secret := []byte("secret")
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "sha256="+sign(secret, body), r.Header.Get(webhookSignatureHeader))
+		var inv inventory
+		assert.NoError(t, json.Unmarshal(body, &inv))
+		assert.Equal(t, "node", inv.Node)
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	p := &webhookPublisher{client: srv.Client(), url: srv.URL, secret: secret, retries: 2, backoff: time.Millisecond, logger: log.NewNopLogger()}
+	assert.NoError(t, p.PublishInventory(context.Background(), inventory{Node: "node"}))
+	assert.Equal(t, 3, requests)
+
+	requests = 0
+	p.retries = 1
+	assert.Error(t, p.PublishInventory(context.Background(), inventory{Node: "node"}))
+	assert.Equal(t, 2, requests)
+}
+
+func TestWebhookPublisherNoRetry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p := &webhookPublisher{client: srv.Client(), url: srv.URL, retries: 3, backoff: time.Millisecond, logger: log.NewNopLogger()}
+	assert.Error(t, p.PublishInventory(context.Background(), inventory{}))
+	assert.Equal(t, 1, requests)
+}